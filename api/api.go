@@ -0,0 +1,12 @@
+// Package api содержит спецификацию HTTP API брокера в формате OpenAPI 3.0
+package api
+
+import "embed"
+
+// SpecPath задает путь к спецификации в FS
+const SpecPath = "openapi.yaml"
+
+// FS содержит спецификацию, чтобы брокер отдавал её без внешних файлов
+//
+//go:embed openapi.yaml
+var FS embed.FS
@@ -0,0 +1,194 @@
+// Package client реализует клиент HTTP API брокера: запись и чтение сообщений, поток сообщений через SSE,
+// перевод кодов ответа в ошибки и повтор запросов, отклоненных из-за перегрузки
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Заголовки ответа GET, см. handler
+const (
+	enqueuedAtHeader = "X-Enqueued-At"
+	messageAgeHeader = "X-Message-Age-Ms"
+)
+
+var (
+	ErrNoMessage    = errors.New("No message")     // очередь пуста или её нет, сервер ответил 404
+	ErrTooManyItems = errors.New("Too many items") // сервер ответил 429 на всех попытках
+)
+
+// StatusError - ответ сервера с кодом, для которого нет отдельной ошибки
+type StatusError struct {
+	StatusCode int
+	Body       string // текст ответа, сервер кладет в него описание ошибки, например, недопустимого имени очереди
+}
+
+func (e *StatusError) Error() string {
+	if e.Body == "" {
+		return fmt.Sprintf("unexpected status %d", e.StatusCode)
+	}
+	return fmt.Sprintf("unexpected status %d: %s", e.StatusCode, e.Body)
+}
+
+// Message - сообщение, полученное из очереди
+type Message struct {
+	Body       string
+	EnqueuedAt time.Time // момент приема сообщения очередью, нулевой, если сервер его не сообщил
+}
+
+type messageDto struct {
+	Message string `json:"message"`
+}
+
+// Client выполняет запросы к брокеру. Поля можно менять до первого запроса
+type Client struct {
+	BaseURL    string       // адрес сервера без завершающего '/', например, http://localhost:8080
+	HTTPClient *http.Client // клиент для запросов, без Timeout, так как GET ждет сообщения на сервере
+	APIKey     string       // ключ для заголовка Authorization, пустой - без аутентификации
+	MaxRetries int          // число повторов запроса после ответа 429 или 5xx
+	RetryDelay time.Duration
+}
+
+// New создает клиент для сервера baseURL с тремя повторами, начиная с задержки в 100мс, которая далее удваивается.
+// Если сервер прислал Retry-After больше задержки, то повтор ждет столько, сколько он просит
+func New(baseURL string) *Client {
+	return &Client{
+		BaseURL:    strings.TrimSuffix(baseURL, "/"),
+		HTTPClient: &http.Client{},
+		MaxRetries: 3,
+		RetryDelay: 100 * time.Millisecond,
+	}
+}
+
+// Put помещает message в конец очереди queue
+func (c *Client) Put(ctx context.Context, queue, message string) error {
+	body, err := json.Marshal(messageDto{Message: message})
+	if err != nil {
+		return err
+	}
+	resp, err := c.do(ctx, http.MethodPut, c.queueURL("/queue/", queue, nil), body)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return statusError(resp)
+	}
+	return nil
+}
+
+// Get извлекает первое сообщение очереди queue, ожидая его на сервере до timeout секунд.
+// Нулевой timeout означает таймаут сервера по умолчанию. Если сообщения нет, то возвращает ErrNoMessage
+func (c *Client) Get(ctx context.Context, queue string, timeout int) (Message, error) {
+	query := url.Values{}
+	if timeout > 0 {
+		query.Set("timeout", strconv.Itoa(timeout))
+	}
+	resp, err := c.do(ctx, http.MethodGet, c.queueURL("/queue/", queue, query), nil)
+	if err != nil {
+		return Message{}, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return Message{}, statusError(resp)
+	}
+	var m messageDto
+	if err := json.NewDecoder(resp.Body).Decode(&m); err != nil {
+		return Message{}, err
+	}
+	message := Message{Body: m.Message}
+	if enqueuedAt := resp.Header.Get(enqueuedAtHeader); enqueuedAt != "" {
+		// Время приема справочное, поэтому некорректный заголовок не мешает получить сообщение
+		message.EnqueuedAt, _ = time.Parse(time.RFC3339Nano, enqueuedAt)
+	}
+	return message, nil
+}
+
+// queueURL собирает адрес ресурса очереди, экранируя её имя
+func (c *Client) queueURL(prefix, queue string, query url.Values) string {
+	u := c.BaseURL + prefix + url.PathEscape(queue)
+	if len(query) != 0 {
+		u += "?" + query.Encode()
+	}
+	return u
+}
+
+// do выполняет запрос, повторяя его после ответов 429 и 5xx. Возвращает последний ответ, тело которого закрывает вызывающий
+func (c *Client) do(ctx context.Context, method, u string, body []byte) (*http.Response, error) {
+	delay := c.RetryDelay
+	for attempt := 0; ; attempt++ {
+		req, err := http.NewRequestWithContext(ctx, method, u, nil)
+		if err != nil {
+			return nil, err
+		}
+		if body != nil {
+			// Каждая попытка читает тело заново
+			req.Body = io.NopCloser(bytes.NewReader(body))
+			req.ContentLength = int64(len(body))
+			req.Header.Set("Content-Type", "application/json")
+		}
+		if c.APIKey != "" {
+			req.Header.Set("Authorization", "Bearer "+c.APIKey)
+		}
+		resp, err := c.httpClient().Do(req)
+		if err != nil {
+			return nil, err
+		}
+		if attempt >= c.MaxRetries || !isRetryable(resp.StatusCode) {
+			return resp, nil
+		}
+		wait := max(delay, retryAfter(resp))
+		// Тело дочитывается, чтобы соединение вернулось в пул
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(wait):
+		}
+		delay *= 2
+	}
+}
+
+func (c *Client) httpClient() *http.Client {
+	if c.HTTPClient == nil {
+		return http.DefaultClient
+	}
+	return c.HTTPClient
+}
+
+// isRetryable сообщает, имеет ли смысл повторить запрос: 429 и 5xx означают временную перегрузку или остановку сервера
+func isRetryable(statusCode int) bool {
+	return statusCode == http.StatusTooManyRequests || statusCode >= http.StatusInternalServerError
+}
+
+// retryAfter возвращает задержку из заголовка Retry-After в секундах, 0 - если его нет
+func retryAfter(resp *http.Response) time.Duration {
+	seconds, err := strconv.Atoi(resp.Header.Get("Retry-After"))
+	if err != nil || seconds < 0 {
+		return 0
+	}
+	return time.Duration(seconds) * time.Second
+}
+
+// statusError переводит код ответа в ошибку
+func statusError(resp *http.Response) error {
+	switch resp.StatusCode {
+	case http.StatusNotFound:
+		return ErrNoMessage
+	case http.StatusTooManyRequests:
+		return ErrTooManyItems
+	}
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	return &StatusError{StatusCode: resp.StatusCode, Body: strings.TrimSpace(string(body))}
+}
@@ -0,0 +1,236 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/nebotan/simplebroker/handler"
+	"github.com/nebotan/simplebroker/queue"
+)
+
+// newTestServer запускает настоящий обработчик API поверх менеджера очередей с двумя сообщениями на очередь
+func newTestServer(t *testing.T, config handler.HandlerConfig) *httptest.Server {
+	t.Helper()
+	manager := queue.NewQueueManager(queue.QueueManagerConfig{
+		MaxQueueNum:                10,
+		MaxMessageNumPerQueue:      2,
+		MaxSubscriptionNumPerTopic: 10,
+	})
+	mux := http.NewServeMux()
+	handler.Setup(mux, manager, config)
+	server := httptest.NewServer(mux)
+	t.Cleanup(func() {
+		server.Close()
+		manager.Stop()
+	})
+	return server
+}
+
+func TestPutGet(t *testing.T) {
+	server := newTestServer(t, handler.HandlerConfig{DefaultTimeout: 1})
+	c := New(server.URL)
+	ctx := context.Background()
+
+	start := time.Now()
+	if err := c.Put(ctx, "queue1", `{"a": "message 1"}`); err != nil {
+		t.Fatalf("unexpected Put error: %v", err)
+	}
+	message, err := c.Get(ctx, "queue1", 1)
+	if err != nil {
+		t.Fatalf("unexpected Get error: %v", err)
+	}
+	if message.Body != `{"a": "message 1"}` {
+		t.Errorf("wrong message: got [%v] want [%v]", message.Body, `{"a": "message 1"}`)
+	}
+	if message.EnqueuedAt.Before(start.Add(-time.Second)) || message.EnqueuedAt.After(time.Now()) {
+		t.Errorf("wrong enqueue time: got %v, test started at %v", message.EnqueuedAt, start)
+	}
+}
+
+func TestErrors(t *testing.T) {
+	testCases := []struct {
+		description string
+		call        func(c *Client) error
+		err         error
+		statusCode  int
+	}{
+		{
+			description: "Empty queue",
+			call: func(c *Client) error {
+				_, err := c.Get(context.Background(), "empty", 1)
+				return err
+			},
+			err: ErrNoMessage,
+		},
+		{
+			description: "Queue is full",
+			call: func(c *Client) error {
+				for i := 0; i < 3; i++ {
+					if err := c.Put(context.Background(), "full", "message"); err != nil {
+						return err
+					}
+				}
+				return nil
+			},
+			err: ErrTooManyItems,
+		},
+		{
+			description: "Invalid queue name",
+			call: func(c *Client) error {
+				return c.Put(context.Background(), "queue/1", "message")
+			},
+			statusCode: http.StatusBadRequest,
+		},
+		{
+			description: "Wrong API key",
+			call: func(c *Client) error {
+				c.APIKey = "wrong"
+				return c.Put(context.Background(), "queue1", "message")
+			},
+			statusCode: http.StatusUnauthorized,
+		},
+	}
+	server := newTestServer(t, handler.HandlerConfig{DefaultTimeout: 1, APIKeys: []string{"key1"}})
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			c := New(server.URL)
+			c.APIKey = "key1"
+			// Без повторов, иначе 429 ждал бы Retry-After
+			c.MaxRetries = 0
+			err := tc.call(c)
+			if tc.err != nil && !errors.Is(err, tc.err) {
+				t.Errorf("wrong error: got [%v] want [%v]", err, tc.err)
+			}
+			if tc.statusCode != 0 {
+				var statusErr *StatusError
+				if !errors.As(err, &statusErr) || statusErr.StatusCode != tc.statusCode {
+					t.Errorf("wrong error: got [%v] want status %v", err, tc.statusCode)
+				}
+			}
+		})
+	}
+}
+
+func TestRetry(t *testing.T) {
+	testCases := []struct {
+		description   string
+		failures      int32
+		failureStatus int
+		maxRetries    int
+		isErr         bool
+	}{
+		{
+			description:   "Retried after 503",
+			failures:      2,
+			failureStatus: http.StatusServiceUnavailable,
+			maxRetries:    3,
+		},
+		{
+			description:   "Retried after 429",
+			failures:      1,
+			failureStatus: http.StatusTooManyRequests,
+			maxRetries:    1,
+		},
+		{
+			description:   "Retries exhausted",
+			failures:      3,
+			failureStatus: http.StatusInternalServerError,
+			maxRetries:    2,
+			isErr:         true,
+		},
+		{
+			description:   "400 is not retried",
+			failures:      1,
+			failureStatus: http.StatusBadRequest,
+			maxRetries:    3,
+			isErr:         true,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			server := newTestServer(t, handler.HandlerConfig{DefaultTimeout: 1})
+			var calls atomic.Int32
+			// Первые запросы отклоняет прокси, остальные доходят до настоящего обработчика
+			proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if calls.Add(1) <= tc.failures {
+					http.Error(w, "", tc.failureStatus)
+					return
+				}
+				server.Config.Handler.ServeHTTP(w, r)
+			}))
+			defer proxy.Close()
+
+			c := New(proxy.URL)
+			c.MaxRetries = tc.maxRetries
+			c.RetryDelay = time.Millisecond
+			err := c.Put(context.Background(), "queue1", "message1")
+			if (err != nil) != tc.isErr {
+				t.Fatalf("wrong error: got [%v] want error %v", err, tc.isErr)
+			}
+			if tc.isErr {
+				return
+			}
+			if message, err := New(server.URL).Get(context.Background(), "queue1", 1); err != nil || message.Body != "message1" {
+				t.Errorf("wrong message: got [%v, %v] want [message1]", message.Body, err)
+			}
+		})
+	}
+}
+
+func TestStream(t *testing.T) {
+	server := newTestServer(t, handler.HandlerConfig{DefaultTimeout: 1})
+	c := New(server.URL)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	messages := []string{"message1", "multi\nline", strings.Repeat("a", 100_000)}
+	go func() {
+		for _, message := range messages {
+			if err := c.Put(ctx, "queue1", message); err != nil {
+				t.Errorf("unexpected Put error: %v", err)
+			}
+			// Очередь вмещает 2 сообщения, поэтому пишем не быстрее чтения
+			time.Sleep(50 * time.Millisecond)
+		}
+	}()
+	var received []string
+	err := c.Stream(ctx, "queue1", 1, func(message string) error {
+		received = append(received, message)
+		if len(received) == len(messages) {
+			cancel()
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("unexpected Stream error: %v", err)
+	}
+	if len(received) != len(messages) {
+		t.Fatalf("wrong messages number: got %v want %v", len(received), len(messages))
+	}
+	for i := range messages {
+		if received[i] != messages[i] {
+			t.Errorf("wrong message %d: got [%.20v] want [%.20v]", i, received[i], messages[i])
+		}
+	}
+}
+
+func TestStreamReceiveError(t *testing.T) {
+	server := newTestServer(t, handler.HandlerConfig{DefaultTimeout: 1})
+	c := New(server.URL)
+	if err := c.Put(context.Background(), "queue1", "message1"); err != nil {
+		t.Fatalf("unexpected Put error: %v", err)
+	}
+	stop := errors.New("stop")
+	err := c.Stream(context.Background(), "queue1", 1, func(string) error {
+		return stop
+	})
+	if !errors.Is(err, stop) {
+		t.Errorf("wrong error: got [%v] want [%v]", err, stop)
+	}
+}
@@ -0,0 +1,77 @@
+package client
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// Stream передает в receive сообщения очереди queue по мере поступления через GET /sse/queue/{queue}.
+// timeout задает в секундах каждое ожидание сообщения на сервере, 0 - таймаут сервера по умолчанию.
+// Возвращает nil после отмены ctx, иначе - ошибку подключения, разбора события или receive.
+// Если сервер закрыл поток сам, например, при остановке, то возвращает io.ErrUnexpectedEOF
+func (c *Client) Stream(ctx context.Context, queue string, timeout int, receive func(message string) error) error {
+	query := url.Values{}
+	if timeout > 0 {
+		query.Set("timeout", strconv.Itoa(timeout))
+	}
+	resp, err := c.do(ctx, http.MethodGet, c.queueURL("/sse/queue/", queue, query), nil)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil
+		}
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return statusError(resp)
+	}
+	err = readEvents(resp.Body, func(data string) error {
+		var m messageDto
+		if err := json.Unmarshal([]byte(data), &m); err != nil {
+			return err
+		}
+		return receive(m.Message)
+	})
+	if ctx.Err() != nil {
+		// Отмена ctx обрывает чтение тела, это штатное завершение потока
+		return nil
+	}
+	return err
+}
+
+// readEvents разбирает поток Server-Sent Events и передает в handle данные каждого события.
+// Строки data одного события объединяются через '\n', остальные поля сервер не отправляет
+func readEvents(r io.Reader, handle func(data string) error) error {
+	reader := bufio.NewReader(r)
+	var data []string
+	for {
+		// ReadString, а не Scanner, так как сообщение может быть длиннее буфера Scanner
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return io.ErrUnexpectedEOF
+			}
+			return err
+		}
+		line = strings.TrimSuffix(strings.TrimSuffix(line, "\n"), "\r")
+		if line == "" {
+			if len(data) != 0 {
+				if err := handle(strings.Join(data, "\n")); err != nil {
+					return err
+				}
+				data = data[:0]
+			}
+			continue
+		}
+		if value, found := strings.CutPrefix(line, "data:"); found {
+			data = append(data, strings.TrimPrefix(value, " "))
+		}
+	}
+}
@@ -0,0 +1,115 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"unicode"
+)
+
+// EnvPrefix задает префикс переменных окружения: флаг maxQueueNum задается переменной SIMPLEBROKER_MAX_QUEUE_NUM
+const EnvPrefix = "SIMPLEBROKER_"
+
+// Apply задает значения флагам из fs, которые не были явно указаны в командной строке.
+// Значение берется из переменной окружения, найденной через lookupEnv, а если её нет, то из файла file.
+// Таким образом приоритет: флаг > переменная окружения > файл конфигурации > значение флага по умолчанию.
+// Файл содержит JSON объект вида {"port": 8080, "visibilityTimeout": "30s"} с именами флагов в качестве ключей.
+// Пустой file означает, что файла конфигурации нет. Флаги из skip не меняются
+func Apply(fs *flag.FlagSet, file string, lookupEnv func(string) (string, bool), skip ...string) error {
+	fileValues, err := load(file)
+	if err != nil {
+		return err
+	}
+	for name := range fileValues {
+		if fs.Lookup(name) == nil {
+			return fmt.Errorf("config file %s: unknown option [%s]", file, name)
+		}
+	}
+	explicit := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) {
+		explicit[f.Name] = true
+	})
+	for _, name := range skip {
+		explicit[name] = true
+	}
+	var res error
+	fs.VisitAll(func(f *flag.Flag) {
+		if res != nil || explicit[f.Name] {
+			return
+		}
+		if value, ok := lookupEnv(EnvName(f.Name)); ok {
+			if err := fs.Set(f.Name, value); err != nil {
+				res = fmt.Errorf("environment variable %s: %w", EnvName(f.Name), err)
+			}
+			return
+		}
+		if value, ok := fileValues[f.Name]; ok {
+			if err := fs.Set(f.Name, value); err != nil {
+				res = fmt.Errorf("config file %s: option [%s]: %w", file, f.Name, err)
+			}
+		}
+	})
+	return res
+}
+
+// EnvName возвращает имя переменной окружения для флага name
+func EnvName(name string) string {
+	var sb strings.Builder
+	sb.WriteString(EnvPrefix)
+	prev := rune(0)
+	for _, r := range name {
+		// Слово начинается с заглавной после строчной, поэтому аббревиатуры вроде CA не разбиваются
+		if unicode.IsUpper(r) && unicode.IsLower(prev) {
+			sb.WriteByte('_')
+		}
+		sb.WriteRune(unicode.ToUpper(r))
+		prev = r
+	}
+	return sb.String()
+}
+
+// load читает файл конфигурации и возвращает значения в виде строк, как они были бы заданы флагами
+func load(file string) (map[string]string, error) {
+	if file == "" {
+		return nil, nil
+	}
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	// Числа оставляем в исходной записи, чтобы флаги разбирали их сами
+	decoder.UseNumber()
+	var raw map[string]any
+	if err := decoder.Decode(&raw); err != nil {
+		return nil, fmt.Errorf("config file %s: %w", file, err)
+	}
+	values := make(map[string]string, len(raw))
+	for name, value := range raw {
+		switch v := value.(type) {
+		case string:
+			values[name] = v
+		case json.Number:
+			values[name] = v.String()
+		case bool:
+			values[name] = fmt.Sprint(v)
+		case []any:
+			// Списки, например, apiKeys, флаги принимают через запятую
+			items := make([]string, 0, len(v))
+			for _, item := range v {
+				s, ok := item.(string)
+				if !ok {
+					return nil, fmt.Errorf("config file %s: option [%s]: list items must be strings", file, name)
+				}
+				items = append(items, s)
+			}
+			values[name] = strings.Join(items, ",")
+		default:
+			return nil, fmt.Errorf("config file %s: option [%s]: unsupported value %v", file, name, value)
+		}
+	}
+	return values, nil
+}
@@ -0,0 +1,129 @@
+package config
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func writeConfig(t *testing.T, content string) string {
+	file := filepath.Join(t.TempDir(), "config.json")
+	if err := os.WriteFile(file, []byte(content), 0o600); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return file
+}
+
+// TestApplyPrecedence проверяет приоритет: флаг > переменная окружения > файл > значение по умолчанию
+func TestApplyPrecedence(t *testing.T) {
+	file := writeConfig(t, `{
+		"port": 9000,
+		"timeout": 7,
+		"maxQueueNum": 50,
+		"visibilityTimeout": "1m",
+		"apiKeys": ["key1", "key2"]
+	}`)
+	env := map[string]string{
+		"SIMPLEBROKER_TIMEOUT":       "8",
+		"SIMPLEBROKER_MAX_QUEUE_NUM": "60",
+	}
+	lookupEnv := func(name string) (string, bool) {
+		value, ok := env[name]
+		return value, ok
+	}
+
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	port := fs.Int("port", 8080, "")
+	timeout := fs.Int("timeout", 5, "")
+	maxQueueNum := fs.Int("maxQueueNum", 100, "")
+	maxMessageNum := fs.Int("maxMessageNumPerQueue", 10_000, "")
+	visibilityTimeout := fs.Duration("visibilityTimeout", 30*time.Second, "")
+	apiKeys := fs.String("apiKeys", "", "")
+	if err := fs.Parse([]string{"-maxQueueNum", "70"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := Apply(fs, file, lookupEnv); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	testCases := []struct {
+		description string
+		got, want   any
+	}{
+		{"file over default", *port, 9000},
+		{"env over file", *timeout, 8},
+		{"flag over env and file", *maxQueueNum, 70},
+		{"default", *maxMessageNum, 10_000},
+		{"duration from file", *visibilityTimeout, time.Minute},
+		{"list from file", *apiKeys, "key1,key2"},
+	}
+	for _, tc := range testCases {
+		if tc.got != tc.want {
+			t.Errorf("%s: got %v want %v", tc.description, tc.got, tc.want)
+		}
+	}
+}
+
+// TestApplyErrors проверяет, что ошибки в конфигурации понятно указывают на их источник
+func TestApplyErrors(t *testing.T) {
+	testCases := []struct {
+		description string
+		content     string
+		env         map[string]string
+		expected    string
+	}{
+		{
+			description: "Malformed JSON",
+			content:     `{"port": 9000`,
+			expected:    "config file",
+		},
+		{
+			description: "Unknown option",
+			content:     `{"prot": 9000}`,
+			expected:    "unknown option [prot]",
+		},
+		{
+			description: "Wrong value type",
+			content:     `{"port": "many"}`,
+			expected:    "option [port]",
+		},
+		{
+			description: "Wrong env value",
+			content:     `{}`,
+			env:         map[string]string{"SIMPLEBROKER_PORT": "many"},
+			expected:    "SIMPLEBROKER_PORT",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			file := writeConfig(t, tc.content)
+			fs := flag.NewFlagSet("test", flag.ContinueOnError)
+			fs.Int("port", 8080, "")
+			err := Apply(fs, file, func(name string) (string, bool) {
+				value, ok := tc.env[name]
+				return value, ok
+			})
+			if err == nil || !strings.Contains(err.Error(), tc.expected) {
+				t.Errorf("wrong error: got [%v] want containing [%s]", err, tc.expected)
+			}
+		})
+	}
+}
+
+func TestEnvName(t *testing.T) {
+	testCases := []struct {
+		name, expected string
+	}{
+		{"port", "SIMPLEBROKER_PORT"},
+		{"maxMessageNumPerQueue", "SIMPLEBROKER_MAX_MESSAGE_NUM_PER_QUEUE"},
+		{"tlsClientCA", "SIMPLEBROKER_TLS_CLIENT_CA"},
+	}
+	for _, tc := range testCases {
+		if got := EnvName(tc.name); got != tc.expected {
+			t.Errorf("wrong env name: got %v want %v", got, tc.expected)
+		}
+	}
+}
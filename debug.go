@@ -0,0 +1,163 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"expvar"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/http/pprof"
+	"time"
+
+	"github.com/nebotan/simplebroker/handler"
+	"github.com/nebotan/simplebroker/queue"
+)
+
+// newDebugServer создает сервер с pprof и expvar на адресе addr.
+// Сервер отделен от публичного API, поэтому его стоит слушать только на localhost
+func newDebugServer(addr string, queueManager queue.QueueManager) *http.Server {
+	expvar.Publish("queues", expvar.Func(func() any {
+		return len(queueManager.List())
+	}))
+	expvar.Publish("totalMessages", expvar.Func(func() any {
+		return totalMessages(queueManager)
+	}))
+	expvar.Publish("getWaitLatency", expvar.Func(func() any {
+		stats := queueManager.WaitLatency()
+		return map[string]histogramDto{
+			"delivered": newHistogramDto(stats.Delivered),
+			"expired":   newHistogramDto(stats.Expired),
+		}
+	}))
+
+	mux := http.NewServeMux()
+	mux.Handle("/debug/vars", expvar.Handler())
+	mux.Handle("/metrics", handler.NewMetricsHandler(queueManager))
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	return &http.Server{
+		Addr:    addr,
+		Handler: mux,
+	}
+}
+
+// totalMessages считает сообщения, ожидающие доставки и находящиеся в обработке, во всех очередях.
+// Топики пропускаются, так как у них нет собственной статистики
+func totalMessages(queueManager queue.QueueManager) int64 {
+	var total int64
+	for _, name := range queueManager.List() {
+		stats, err := queueManager.Stats(name)
+		if err != nil {
+			continue
+		}
+		total += stats.Depth + stats.InFlight
+	}
+	return total
+}
+
+// histogramDto задает гистограмму в expvar, длительности в секундах
+type histogramDto struct {
+	Buckets []float64 `json:"buckets"` // верхние границы корзин, последняя корзина в counts - больше всех границ
+	Counts  []int64   `json:"counts"`
+	Count   int64     `json:"count"`
+	Sum     float64   `json:"sum"`
+}
+
+func newHistogramDto(stats queue.HistogramStats) histogramDto {
+	buckets := make([]float64, len(stats.Bounds))
+	for i, bound := range stats.Bounds {
+		buckets[i] = bound.Seconds()
+	}
+	return histogramDto{
+		Buckets: buckets,
+		Counts:  stats.Counts,
+		Count:   stats.Count,
+		Sum:     stats.Sum.Seconds(),
+	}
+}
+
+// queueStatsDump задает статистику одной очереди в дампе по сигналу
+type queueStatsDump struct {
+	Name   string `json:"name"`
+	Depth  int64  `json:"depth"`
+	Puts   int64  `json:"puts"`
+	Gets   int64  `json:"gets"`
+	Errors int64  `json:"errors"`
+}
+
+// dumpStats пишет в w статистику всех очередей в виде JSON. Топики пропускаются, как и в totalMessages
+func dumpStats(w io.Writer, queueManager queue.QueueManager) error {
+	dump := []queueStatsDump{}
+	for _, name := range queueManager.List() {
+		stats, err := queueManager.Stats(name)
+		if err != nil {
+			continue
+		}
+		dump = append(dump, queueStatsDump{
+			Name:   name,
+			Depth:  stats.Depth,
+			Puts:   stats.Produced,
+			Gets:   stats.Consumed,
+			Errors: stats.Errors,
+		})
+	}
+	data, err := json.MarshalIndent(dump, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "Queue stats: %s\n", data)
+	return err
+}
+
+// healthLogQueue задает глубину одной очереди в периодическом журнале здоровья
+type healthLogQueue struct {
+	Name  string `json:"name"`
+	Depth int64  `json:"depth"`
+}
+
+// healthLogDto задает строку периодического журнала здоровья
+type healthLogDto struct {
+	Timestamp string           `json:"ts"`
+	Queues    []healthLogQueue `json:"queues"`
+}
+
+// healthSummary возвращает глубины всех очередей на момент now в виде JSON. Топики пропускаются, как и в totalMessages
+func healthSummary(queueManager queue.QueueManager, now time.Time) ([]byte, error) {
+	dto := healthLogDto{
+		Timestamp: now.UTC().Format(time.RFC3339),
+		Queues:    []healthLogQueue{},
+	}
+	for _, name := range queueManager.List() {
+		stats, err := queueManager.Stats(name)
+		if err != nil {
+			continue
+		}
+		dto.Queues = append(dto.Queues, healthLogQueue{Name: name, Depth: stats.Depth})
+	}
+	return json.Marshal(dto)
+}
+
+// runHealthLog каждые interval пишет в logger глубины очередей, пока не отменят ctx, и закрывает done при выходе
+func runHealthLog(ctx context.Context, logger *log.Logger, queueManager queue.QueueManager, interval time.Duration, done chan<- struct{}) {
+	defer close(done)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			data, err := healthSummary(queueManager, now)
+			if err != nil {
+				logger.Printf("[ERROR]: health log error: %v\n", err)
+				continue
+			}
+			logger.Printf("%s\n", data)
+		}
+	}
+}
@@ -0,0 +1,112 @@
+package grpc
+
+import (
+	"context"
+	"errors"
+	"log"
+	"os"
+
+	"github.com/nebotan/simplebroker/proto"
+	"github.com/nebotan/simplebroker/queue"
+	gogrpc "google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+var (
+	errorLogger = log.New(os.Stderr, "[ERROR]:GRPC:", log.Ldate|log.Ltime|log.Lmicroseconds)
+)
+
+// NewServer создает gRPC сервер с сервисом Broker поверх queueManager.
+// Сервер работает с теми же очередями, что и HTTP API, если ему передан тот же менеджер
+func NewServer(queueManager queue.QueueManager, defaultTimeout int) *gogrpc.Server {
+	server := gogrpc.NewServer()
+	proto.RegisterBrokerServer(server, &grpcServer{
+		queueManager:   queueManager,
+		defaultTimeout: defaultTimeout,
+	})
+	return server
+}
+
+// grpcServer реализует сервис Broker из simplebroker.proto
+type grpcServer struct {
+	proto.UnimplementedBrokerServer
+	queueManager   queue.QueueManager
+	defaultTimeout int
+}
+
+func (s *grpcServer) Put(ctx context.Context, req *proto.PutRequest) (*proto.PutResponse, error) {
+	if req.GetQueue() == "" {
+		return nil, status.Error(codes.InvalidArgument, "empty queue name")
+	}
+	if err := s.queueManager.Put(ctx, req.GetQueue(), req.GetMessage()); err != nil {
+		return nil, toStatus("Put", err)
+	}
+	return &proto.PutResponse{}, nil
+}
+
+func (s *grpcServer) Get(ctx context.Context, req *proto.GetRequest) (*proto.GetResponse, error) {
+	timeout, err := s.timeout(req.GetQueue(), req.GetTimeout())
+	if err != nil {
+		return nil, err
+	}
+	message, err := s.queueManager.Get(ctx, req.GetQueue(), timeout)
+	if err != nil {
+		return nil, toStatus("Get", err)
+	}
+	return &proto.GetResponse{Message: message.Body}, nil
+}
+
+func (s *grpcServer) GetStream(req *proto.GetStreamRequest, stream proto.Broker_GetStreamServer) error {
+	timeout, err := s.timeout(req.GetQueue(), req.GetTimeout())
+	if err != nil {
+		return err
+	}
+	err = queue.Stream(stream.Context(), s.queueManager, req.GetQueue(), timeout, func(message string) error {
+		return stream.Send(&proto.GetResponse{Message: message})
+	})
+	if err != nil {
+		return toStatus("GetStream", err)
+	}
+	return nil
+}
+
+// timeout проверяет параметры чтения и возвращает таймаут ожидания, 0 заменяется таймаутом по умолчанию
+func (s *grpcServer) timeout(name string, timeout int32) (int, error) {
+	if name == "" {
+		return 0, status.Error(codes.InvalidArgument, "empty queue name")
+	}
+	if timeout < 0 {
+		return 0, status.Error(codes.InvalidArgument, "negative timeout")
+	}
+	if timeout == 0 {
+		return s.defaultTimeout, nil
+	}
+	return int(timeout), nil
+}
+
+// toStatus переводит ошибки менеджера очередей в коды gRPC так же, как HTTP API переводит их в коды HTTP
+func toStatus(method string, err error) error {
+	switch {
+	case errors.Is(err, queue.ErrNoMessage), errors.Is(err, queue.ErrQueueNotFound):
+		return status.Error(codes.NotFound, err.Error())
+	case errors.Is(err, queue.ErrWrongQueueType), errors.Is(err, queue.ErrInvalidQueueName), errors.Is(err, queue.ErrMessageTooLarge):
+		return status.Error(codes.InvalidArgument, err.Error())
+	case errors.Is(err, queue.ErrTooManyItems):
+		return status.Error(codes.ResourceExhausted, err.Error())
+	case errors.Is(err, queue.ErrShuttingDown), errors.Is(err, queue.ErrTooManyWaiters):
+		return status.Error(codes.Unavailable, err.Error())
+	case errors.Is(err, queue.ErrQueueSuspended):
+		return status.Error(codes.FailedPrecondition, err.Error())
+	case errors.Is(err, queue.ErrCanceled):
+		return status.Error(codes.Canceled, err.Error())
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		return status.FromContextError(err).Err()
+	}
+	if _, ok := status.FromError(err); ok {
+		// Ошибка отправки в поток уже содержит код gRPC
+		return err
+	}
+	errorLogger.Printf("%s QueueManager error: %v\n", method, err)
+	return status.Error(codes.Internal, "")
+}
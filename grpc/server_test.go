@@ -0,0 +1,145 @@
+package grpc
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/nebotan/simplebroker/proto"
+	"github.com/nebotan/simplebroker/queue"
+	gogrpc "google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// newTestClient запускает сервер поверх соединения в памяти и возвращает клиента к нему
+func newTestClient(t *testing.T, queueManager queue.QueueManager) proto.BrokerClient {
+	listener := bufconn.Listen(1 << 20)
+	server := NewServer(queueManager, 1)
+	go func() {
+		_ = server.Serve(listener)
+	}()
+	t.Cleanup(server.Stop)
+	conn, err := gogrpc.NewClient("passthrough:///bufnet",
+		gogrpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return listener.DialContext(ctx)
+		}),
+		gogrpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		t.Fatalf("dial error: %v", err)
+	}
+	t.Cleanup(func() {
+		conn.Close()
+	})
+	return proto.NewBrokerClient(conn)
+}
+
+func TestPutGet(t *testing.T) {
+	manager := queue.NewQueueManager(queue.QueueManagerConfig{MaxQueueNum: 1, MaxMessageNumPerQueue: 1})
+	defer manager.Stop()
+	client := newTestClient(t, manager)
+	ctx := context.Background()
+
+	if _, err := client.Put(ctx, &proto.PutRequest{Queue: "name1", Message: "message1"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	testCases := []struct {
+		description string
+		call        func() error
+		code        codes.Code
+	}{
+		{
+			description: "Queue is full",
+			call: func() error {
+				_, err := client.Put(ctx, &proto.PutRequest{Queue: "name1", Message: "message2"})
+				return err
+			},
+			code: codes.ResourceExhausted,
+		},
+		{
+			description: "Too many queues",
+			call: func() error {
+				_, err := client.Put(ctx, &proto.PutRequest{Queue: "name2", Message: "message2"})
+				return err
+			},
+			code: codes.ResourceExhausted,
+		},
+		{
+			description: "Empty queue name",
+			call: func() error {
+				_, err := client.Get(ctx, &proto.GetRequest{})
+				return err
+			},
+			code: codes.InvalidArgument,
+		},
+		{
+			description: "Negative timeout",
+			call: func() error {
+				_, err := client.Get(ctx, &proto.GetRequest{Queue: "name1", Timeout: -1})
+				return err
+			},
+			code: codes.InvalidArgument,
+		},
+		{
+			description: "OK",
+			call: func() error {
+				res, err := client.Get(ctx, &proto.GetRequest{Queue: "name1"})
+				if err == nil && res.GetMessage() != "message1" {
+					t.Errorf("wrong message: got %v want %v", res.GetMessage(), "message1")
+				}
+				return err
+			},
+			code: codes.OK,
+		},
+		{
+			description: "No message",
+			call: func() error {
+				_, err := client.Get(ctx, &proto.GetRequest{Queue: "name1", Timeout: 1})
+				return err
+			},
+			code: codes.NotFound,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			if code := status.Code(tc.call()); code != tc.code {
+				t.Errorf("wrong code: got %v want %v", code, tc.code)
+			}
+		})
+	}
+}
+
+// TestGetStream проверяет, что поток отдает сообщения по мере поступления, в том числе записанные через тот же менеджер
+func TestGetStream(t *testing.T) {
+	manager := queue.NewQueueManager(queue.QueueManagerConfig{MaxQueueNum: 10, MaxMessageNumPerQueue: 10})
+	defer manager.Stop()
+	client := newTestClient(t, manager)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	if err := manager.Put(ctx, "name1", "message1"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	stream, err := client.GetStream(ctx, &proto.GetStreamRequest{Queue: "name1"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	res, err := stream.Recv()
+	if err != nil || res.GetMessage() != "message1" {
+		t.Errorf("wrong Recv result: got [%v] [%v] want [%v]", res.GetMessage(), err, "message1")
+	}
+	if _, err := client.Put(ctx, &proto.PutRequest{Queue: "name1", Message: "message2"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	res, err = stream.Recv()
+	if err != nil || res.GetMessage() != "message2" {
+		t.Errorf("wrong Recv result: got [%v] [%v] want [%v]", res.GetMessage(), err, "message2")
+	}
+	cancel()
+	if _, err := stream.Recv(); status.Code(err) != codes.Canceled {
+		t.Errorf("wrong code: got %v want %v", status.Code(err), codes.Canceled)
+	}
+}
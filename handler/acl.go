@@ -0,0 +1,115 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path"
+	"slices"
+	"strings"
+)
+
+const (
+	accessRead  = "read"  // чтение сообщений из очереди
+	accessWrite = "write" // запись сообщений в очередь и управление очередью
+)
+
+// ACLRule разрешает операции над очередями, имена которых подходят под шаблон Queue.
+// Шаблон задается в синтаксисе path.Match, например, "orders.*"
+type ACLRule struct {
+	Queue  string   `json:"queue"`
+	Access []string `json:"access"` // "read" и/или "write"
+}
+
+// ACL задает для каждого API ключа список правил доступа к очередям
+type ACL map[string][]ACLRule
+
+// LoadACL читает ACL из JSON файла вида {"key": [{"queue": "orders.*", "access": ["read"]}]}
+func LoadACL(file string) (ACL, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	var acl ACL
+	if err := json.Unmarshal(data, &acl); err != nil {
+		return nil, err
+	}
+	for key, rules := range acl {
+		for _, rule := range rules {
+			// Проверяем шаблон заранее, чтобы ошибка в конфигурации не всплыла на первом запросе
+			if _, err := path.Match(rule.Queue, ""); err != nil {
+				return nil, fmt.Errorf("key [%s] queue pattern [%s]: %w", key, rule.Queue, err)
+			}
+			for _, access := range rule.Access {
+				if access != accessRead && access != accessWrite {
+					return nil, fmt.Errorf("key [%s] queue pattern [%s]: unknown access [%s]", key, rule.Queue, access)
+				}
+			}
+		}
+	}
+	return acl, nil
+}
+
+// allows проверяет, разрешена ли ключу key операция access над очередью name.
+// Ключу, которого нет в ACL, не разрешено ничего
+func (acl ACL) allows(key, name, access string) bool {
+	for _, rule := range acl[key] {
+		if matched, _ := path.Match(rule.Queue, name); matched && slices.Contains(rule.Access, access) {
+			return true
+		}
+	}
+	return false
+}
+
+// accessResolver определяет для запроса имя очереди и требуемую операцию
+type accessResolver func(r *http.Request) (name, access string)
+
+// withACL оборачивает handler проверкой прав ключа из заголовка Authorization на операцию над очередью.
+// Должен вызываться после проверки ключа в withAPIKeys. При нарушении прав возвращается 403.
+// Если ACL пуст, то проверка отключена и handler возвращается как есть
+func withACL(handler http.Handler, acl ACL, resolve accessResolver) http.Handler {
+	if len(acl) == 0 {
+		return handler
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key, _ := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		name, access := resolve(r)
+		if !acl.allows(key, name, access) {
+			http.Error(w, "", http.StatusForbidden)
+			return
+		}
+		handler.ServeHTTP(w, r)
+	})
+}
+
+// resolveReadAccess задает права для маршрутов, которые получают сообщения или статистику очереди {queue}.
+// Подтверждение сообщения тоже считается частью чтения
+func resolveReadAccess(r *http.Request) (string, string) {
+	return r.PathValue("queue"), accessRead
+}
+
+// resolveWriteAccess задает права для маршрутов, которые пишут в очередь {queue} или управляют ей
+func resolveWriteAccess(r *http.Request) (string, string) {
+	return r.PathValue("queue"), accessWrite
+}
+
+// resolveMoveDestAccess задает права на очередь назначения для /queue/{queue}/move?dest=
+func resolveMoveDestAccess(r *http.Request) (string, string) {
+	return r.URL.Query().Get("dest"), accessWrite
+}
+
+// resolveReplaySourceAccess задает права на исходную очередь для /queue/{queue}/replay, где {queue} - очередь
+// недоставленных сообщений. Для других имен проверка совпадает с resolveWriteAccess, а ошибку вернет обработчик
+func resolveReplaySourceAccess(r *http.Request) (string, string) {
+	name := r.PathValue("queue")
+	if src, ok := strings.CutSuffix(name, ".dlq"); ok {
+		name = src
+	}
+	return name, accessWrite
+}
+
+// resolveAliasAccess задает права на псевдоним для /admin/queue/{queue}/alias/{alias}
+func resolveAliasAccess(r *http.Request) (string, string) {
+	return r.PathValue("alias"), accessWrite
+}
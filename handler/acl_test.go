@@ -0,0 +1,144 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestACL(t *testing.T) {
+	acl := ACL{
+		"reader": {{Queue: "orders.*", Access: []string{accessRead}}},
+		"writer": {{Queue: "orders.*", Access: []string{accessWrite}}},
+		"admin":  {{Queue: "*", Access: []string{accessRead, accessWrite}}},
+	}
+	testCases := []struct {
+		description string
+		key         string
+		method      string
+		url         string
+		httpCode    int
+	}{
+		{
+			description: "Read-only key reads",
+			key:         "reader",
+			method:      http.MethodGet,
+			url:         "/queue/orders.new",
+			httpCode:    http.StatusOK,
+		},
+		{
+			description: "Read-only key writes",
+			key:         "reader",
+			method:      http.MethodPut,
+			url:         "/queue/orders.new",
+			httpCode:    http.StatusForbidden,
+		},
+		{
+			description: "Write-only key writes",
+			key:         "writer",
+			method:      http.MethodPut,
+			url:         "/queue/orders.new",
+			httpCode:    http.StatusOK,
+		},
+		{
+			description: "Write-only key reads",
+			key:         "writer",
+			method:      http.MethodGet,
+			url:         "/queue/orders.new",
+			httpCode:    http.StatusForbidden,
+		},
+		{
+			description: "Pattern does not match",
+			key:         "reader",
+			method:      http.MethodGet,
+			url:         "/queue/payments.new",
+			httpCode:    http.StatusForbidden,
+		},
+		{
+			description: "Wildcard for any queue",
+			key:         "admin",
+			method:      http.MethodDelete,
+			url:         "/queue/payments.new",
+			httpCode:    http.StatusOK,
+		},
+		{
+			description: "Key is not in ACL",
+			key:         "unknown",
+			method:      http.MethodGet,
+			url:         "/queue/orders.new",
+			httpCode:    http.StatusForbidden,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			callsNum := 0
+			countCalls := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				callsNum++
+			})
+			// Права выбираются по маршруту, как в Setup: GET читает, PUT и DELETE меняют очередь
+			handler := http.NewServeMux()
+			handler.Handle("GET /queue/{queue}", withACL(countCalls, acl, resolveReadAccess))
+			handler.Handle("PUT /queue/{queue}", withACL(countCalls, acl, resolveWriteAccess))
+			handler.Handle("DELETE /queue/{queue}", withACL(countCalls, acl, resolveWriteAccess))
+
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest(tc.method, tc.url, nil)
+			req.Header.Set("Authorization", "Bearer "+tc.key)
+			handler.ServeHTTP(w, req)
+
+			if w.Code != tc.httpCode {
+				t.Errorf("wrong status code: got %v want %v", w.Code, tc.httpCode)
+			}
+			expectedCallsNum := 0
+			if tc.httpCode == http.StatusOK {
+				expectedCallsNum = 1
+			}
+			if callsNum != expectedCallsNum {
+				t.Errorf("wrong handler calls number: got %v want %v", callsNum, expectedCallsNum)
+			}
+		})
+	}
+}
+
+func TestLoadACL(t *testing.T) {
+	testCases := []struct {
+		description string
+		content     string
+		isValid     bool
+	}{
+		{
+			description: "Valid",
+			content:     `{"key1": [{"queue": "orders.*", "access": ["read", "write"]}]}`,
+			isValid:     true,
+		},
+		{
+			description: "Invalid pattern",
+			content:     `{"key1": [{"queue": "orders.[", "access": ["read"]}]}`,
+		},
+		{
+			description: "Unknown access",
+			content:     `{"key1": [{"queue": "orders.*", "access": ["delete"]}]}`,
+		},
+		{
+			description: "JSON with invalid syntax",
+			content:     `{"key1": `,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			file := filepath.Join(t.TempDir(), "acl.json")
+			if err := os.WriteFile(file, []byte(tc.content), 0o600); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			_, err := LoadACL(file)
+			if tc.isValid && err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+			if !tc.isValid && err == nil {
+				t.Errorf("error is expected")
+			}
+		})
+	}
+}
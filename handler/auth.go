@@ -0,0 +1,41 @@
+package handler
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+)
+
+// withAPIKeys оборачивает handler проверкой заголовка Authorization: Bearer <key>.
+// Запрос без ключа или с неизвестным ключом получает 401.
+// Если список ключей пуст, то аутентификация отключена и handler возвращается как есть
+func withAPIKeys(handler http.Handler, apiKeys []string) http.Handler {
+	if len(apiKeys) == 0 {
+		return handler
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key, found := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !found || !isValidAPIKey(key, apiKeys) {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			http.Error(w, "", http.StatusUnauthorized)
+			return
+		}
+		handler.ServeHTTP(w, r)
+	})
+}
+
+func isValidAPIKey(key string, apiKeys []string) bool {
+	valid := false
+	// Сравниваем со всеми ключами за постоянное время, чтобы не давать подсказок по времени ответа
+	for _, apiKey := range apiKeys {
+		if subtle.ConstantTimeCompare([]byte(key), []byte(apiKey)) == 1 {
+			valid = true
+		}
+	}
+	return valid
+}
+
+// serveHealth отвечает 200 на GET /health, проверка доступна без ключа
+func serveHealth(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusOK)
+}
@@ -0,0 +1,95 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestAPIKeys(t *testing.T) {
+	testCases := []struct {
+		description   string
+		apiKeys       []string
+		authorization string
+		httpCode      int
+	}{
+		{
+			description:   "Valid key",
+			apiKeys:       []string{"key1", "key2"},
+			authorization: "Bearer key2",
+			httpCode:      http.StatusOK,
+		},
+		{
+			description:   "Invalid key",
+			apiKeys:       []string{"key1", "key2"},
+			authorization: "Bearer key3",
+			httpCode:      http.StatusUnauthorized,
+		},
+		{
+			description:   "Not a bearer",
+			apiKeys:       []string{"key1"},
+			authorization: "Basic key1",
+			httpCode:      http.StatusUnauthorized,
+		},
+		{
+			description: "Missing header",
+			apiKeys:     []string{"key1"},
+			httpCode:    http.StatusUnauthorized,
+		},
+		{
+			description: "Authentication is disabled",
+			httpCode:    http.StatusOK,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			callsNum := 0
+			handler := withAPIKeys(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				callsNum++
+			}), tc.apiKeys)
+
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodGet, "/queue/name1", nil)
+			if tc.authorization != "" {
+				req.Header.Set("Authorization", tc.authorization)
+			}
+			handler.ServeHTTP(w, req)
+
+			if w.Code != tc.httpCode {
+				t.Errorf("wrong status code: got %v want %v", w.Code, tc.httpCode)
+			}
+			expectedCallsNum := 0
+			if tc.httpCode == http.StatusOK {
+				expectedCallsNum = 1
+			}
+			if callsNum != expectedCallsNum {
+				t.Errorf("wrong handler calls number: got %v want %v", callsNum, expectedCallsNum)
+			}
+		})
+	}
+}
+
+// TestHealthWithoutAPIKey проверяет, что /health доступен без ключа, а очереди - нет
+func TestHealthWithoutAPIKey(t *testing.T) {
+	mux := http.NewServeMux()
+	Setup(mux, &MockQueueManager{}, HandlerConfig{DefaultTimeout: 1, APIKeys: []string{"key1"}})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	res, err := http.Get(server.URL + "/health")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		t.Errorf("wrong status code: got %v want %v", res.StatusCode, http.StatusOK)
+	}
+	res, err = http.Get(server.URL + "/queue/name1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusUnauthorized {
+		t.Errorf("wrong status code: got %v want %v", res.StatusCode, http.StatusUnauthorized)
+	}
+}
@@ -0,0 +1,146 @@
+package handler
+
+import (
+	"encoding/json"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// Форматы тела запроса и ответа, по умолчанию используется JSON
+const (
+	contentTypeJSON    = "application/json"
+	contentTypeText    = "text/plain"
+	contentTypeMsgpack = "application/msgpack"
+	contentTypeNDJSON  = "application/x-ndjson" // построчный JSON для выгрузки многих сообщений
+)
+
+// messageIDHeader передает идентификатор сообщения в режиме подтверждения, когда тело ответа - текст без обертки
+const messageIDHeader = "X-Message-Id"
+
+type errorDto struct {
+	Error string `json:"error"`
+}
+
+// decodeMessage читает messageDto из тела запроса в формате, заданном Content-Type
+func decodeMessage(r *http.Request, m *messageDto) error {
+	if isMsgpack(r.Header.Get("Content-Type")) {
+		return msgpack.NewDecoder(r.Body).Decode(m)
+	}
+	return json.NewDecoder(r.Body).Decode(m)
+}
+
+// encodeMessage пишет messageDto в ответ в формате, выбранном negotiate по Accept:
+// JSON с оберткой, MessagePack или само сообщение текстом
+func encodeMessage(w http.ResponseWriter, r *http.Request, m messageDto) error {
+	contentType, _ := negotiate(r.Header.Get("Accept"))
+	switch contentType {
+	case contentTypeMsgpack:
+		w.Header().Set("Content-Type", contentTypeMsgpack)
+		return msgpack.NewEncoder(w).Encode(m)
+	case contentTypeText:
+		if m.ID != "" {
+			w.Header().Set(messageIDHeader, m.ID)
+		}
+		w.Header().Set("Content-Type", contentTypeText+"; charset=utf-8")
+		_, err := io.WriteString(w, m.Message)
+		return err
+	}
+	w.Header().Set("Content-Type", contentTypeJSON)
+	return json.NewEncoder(w).Encode(m)
+}
+
+// writeError отвечает кодом ошибки в формате, который клиент явно запросил в Accept: {"error": "..."} для JSON
+// и текст для text/plain. Без явного запроса тело остается пустым, как и раньше, а MessagePack для ошибок
+// не используется, так как клиенты разбирают его только для сообщений
+func writeError(w http.ResponseWriter, r *http.Request, code int) {
+	contentType, explicit := negotiate(r.Header.Get("Accept"))
+	if !explicit {
+		http.Error(w, "", code)
+		return
+	}
+	switch contentType {
+	case contentTypeJSON:
+		writeJSONError(w, code, http.StatusText(code))
+	case contentTypeText:
+		http.Error(w, http.StatusText(code), code)
+	default:
+		http.Error(w, "", code)
+	}
+}
+
+// writeJSONError отвечает кодом code с телом {"error": message} независимо от Accept.
+// Используется, когда клиенту нужна причина отказа, а не только код
+func writeJSONError(w http.ResponseWriter, code int, message string) {
+	w.Header().Set("Content-Type", contentTypeJSON)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(code)
+	if err := json.NewEncoder(w).Encode(errorDto{Error: message}); err != nil {
+		errorLogger.Println("error Body JSON encode error:", err)
+	}
+}
+
+// negotiate выбирает формат ответа по заголовку Accept с учетом q: JSON, text/plain или MessagePack.
+// Без Accept, для */* и для неподдерживаемых типов выбирается JSON. explicit сообщает,
+// что клиент назвал выбранный тип явно, а не получил его по умолчанию или через */*
+func negotiate(accept string) (contentType string, explicit bool) {
+	contentType = contentTypeJSON
+	bestQ := 0.0
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		q := 1.0
+		if qAsStr, ok := params["q"]; ok {
+			if q, err = strconv.ParseFloat(qAsStr, 64); err != nil {
+				continue
+			}
+		}
+		// При равном q побеждает тип, указанный раньше
+		if q <= bestQ {
+			continue
+		}
+		switch mediaType {
+		case contentTypeJSON:
+			contentType, explicit = contentTypeJSON, true
+		case contentTypeText, "text/*":
+			contentType, explicit = contentTypeText, true
+		case contentTypeMsgpack:
+			contentType, explicit = contentTypeMsgpack, true
+		case "*/*", "application/*":
+			contentType, explicit = contentTypeJSON, false
+		default:
+			continue
+		}
+		bestQ = q
+	}
+	return contentType, explicit
+}
+
+// acceptsNDJSON проверяет, просит ли клиент построчный JSON в Accept и не запрещен ли он через q=0.
+// Построчный формат есть только у ответов со многими сообщениями, поэтому negotiate его не выбирает
+func acceptsNDJSON(r *http.Request) bool {
+	for _, part := range strings.Split(r.Header.Get("Accept"), ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil || mediaType != contentTypeNDJSON {
+			continue
+		}
+		qAsStr, ok := params["q"]
+		if !ok {
+			return true
+		}
+		q, err := strconv.ParseFloat(qAsStr, 64)
+		return err == nil && q > 0
+	}
+	return false
+}
+
+func isMsgpack(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	return err == nil && mediaType == contentTypeMsgpack
+}
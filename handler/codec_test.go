@@ -0,0 +1,253 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/nebotan/simplebroker/queue"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// TestMessagePackRoundTrip проверяет, что одно и то же сообщение проходит PUT и GET
+// одинаково в JSON и в MessagePack
+func TestMessagePackRoundTrip(t *testing.T) {
+	const payload = `{"price": 12.5, "qty": [1, 2, 3]} сообщение`
+	testCases := []struct {
+		description string
+		contentType string
+		marshal     func(any) ([]byte, error)
+		unmarshal   func([]byte, any) error
+	}{
+		{
+			description: "JSON",
+			contentType: "application/json",
+			marshal:     json.Marshal,
+			unmarshal:   json.Unmarshal,
+		},
+		{
+			description: "MessagePack",
+			contentType: contentTypeMsgpack,
+			marshal:     msgpack.Marshal,
+			unmarshal:   msgpack.Unmarshal,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			manager := &MockQueueManager{}
+			handler := setupMux(manager, HandlerConfig{DefaultTimeout: 1, RetryAfter: retryAfter})
+
+			body, err := tc.marshal(messageDto{Message: payload})
+			if err != nil {
+				t.Fatalf("marshal error: %v", err)
+			}
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodPut, "/queue/name1", bytes.NewReader(body))
+			req.Header.Set("Content-Type", tc.contentType)
+			handler.ServeHTTP(w, req)
+			if w.Code != http.StatusOK {
+				t.Fatalf("wrong PUT status code: got %v want %v", w.Code, http.StatusOK)
+			}
+			if manager.putIn.message != payload {
+				t.Errorf("wrong stored message: got %v want %v", manager.putIn.message, payload)
+			}
+
+			// Возвращаем из очереди то, что в неё было записано
+			manager.getOut.id = "1"
+			manager.getOut.message = manager.putIn.message
+			w = httptest.NewRecorder()
+			req = httptest.NewRequest(http.MethodGet, "/queue/name1?ack=true", nil)
+			req.Header.Set("Accept", tc.contentType)
+			handler.ServeHTTP(w, req)
+			if w.Code != http.StatusOK {
+				t.Fatalf("wrong GET status code: got %v want %v", w.Code, http.StatusOK)
+			}
+			var dto messageDto
+			if err := tc.unmarshal(w.Body.Bytes(), &dto); err != nil {
+				t.Fatalf("unmarshal error: %v", err)
+			}
+			expected := messageDto{ID: "1", Message: payload}
+			if dto != expected {
+				t.Errorf("wrong message: got %+v want %+v", dto, expected)
+			}
+		})
+	}
+}
+
+func TestMessagePackContentType(t *testing.T) {
+	testCases := []struct {
+		accept, contentType string
+	}{
+		{"", ""},
+		{"application/json", ""},
+		{"application/msgpack", contentTypeMsgpack},
+		{"text/html, application/msgpack;q=0.9", contentTypeMsgpack},
+	}
+	for _, tc := range testCases {
+		manager := &MockQueueManager{getOut: GetOut{message: "message1"}}
+		handler := setupMux(manager, HandlerConfig{DefaultTimeout: 1, RetryAfter: retryAfter})
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/queue/name1", nil)
+		req.Header.Set("Accept", tc.accept)
+		handler.ServeHTTP(w, req)
+		if got := w.Header().Get("Content-Type"); (tc.contentType == "" && got == contentTypeMsgpack) || (tc.contentType != "" && got != tc.contentType) {
+			t.Errorf("wrong Content-Type for Accept [%s]: got %v want %v", tc.accept, got, tc.contentType)
+		}
+	}
+}
+
+func TestNegotiate(t *testing.T) {
+	testCases := []struct {
+		accept      string
+		contentType string
+		explicit    bool
+	}{
+		{"", contentTypeJSON, false},
+		{"*/*", contentTypeJSON, false},
+		{"application/json", contentTypeJSON, true},
+		{"application/json; charset=utf-8", contentTypeJSON, true},
+		{"text/plain", contentTypeText, true},
+		{"text/*", contentTypeText, true},
+		{"application/msgpack", contentTypeMsgpack, true},
+		{"image/png", contentTypeJSON, false},
+		{"text/plain;q=0.5, application/json", contentTypeJSON, true},
+		{"application/json;q=0.5, text/plain", contentTypeText, true},
+		{"text/plain, application/json", contentTypeText, true},
+		{"text/plain;q=0, */*", contentTypeJSON, false},
+		{"*/*;q=0.1, text/plain;q=0.2", contentTypeText, true},
+		{"text/plain;q=abc, application/json", contentTypeJSON, true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.accept, func(t *testing.T) {
+			contentType, explicit := negotiate(tc.accept)
+			if contentType != tc.contentType || explicit != tc.explicit {
+				t.Errorf("wrong result: got [%v, %v] want [%v, %v]", contentType, explicit, tc.contentType, tc.explicit)
+			}
+		})
+	}
+}
+
+func TestGetContentNegotiation(t *testing.T) {
+	testCases := []struct {
+		description string
+		accept      string
+		url         string
+		err         error
+		httpCode    int
+		contentType string
+		body        string
+		messageID   string
+	}{
+		{
+			description: "No Accept",
+			url:         "/queue/name1",
+			httpCode:    http.StatusOK,
+			contentType: contentTypeJSON,
+			body:        `{"message":"message1"}` + "\n",
+		},
+		{
+			description: "Any",
+			accept:      "*/*",
+			url:         "/queue/name1",
+			httpCode:    http.StatusOK,
+			contentType: contentTypeJSON,
+			body:        `{"message":"message1"}` + "\n",
+		},
+		{
+			description: "JSON",
+			accept:      "application/json",
+			url:         "/queue/name1",
+			httpCode:    http.StatusOK,
+			contentType: contentTypeJSON,
+			body:        `{"message":"message1"}` + "\n",
+		},
+		{
+			description: "Text",
+			accept:      "text/plain",
+			url:         "/queue/name1",
+			httpCode:    http.StatusOK,
+			contentType: "text/plain; charset=utf-8",
+			body:        "message1",
+		},
+		{
+			description: "Text with ack",
+			accept:      "text/plain",
+			url:         "/queue/name1?ack=true",
+			httpCode:    http.StatusOK,
+			contentType: "text/plain; charset=utf-8",
+			body:        "message1",
+			messageID:   "7",
+		},
+		{
+			description: "No message without Accept",
+			url:         "/queue/name1",
+			err:         queue.ErrNoMessage,
+			httpCode:    http.StatusNotFound,
+			body:        "\n",
+		},
+		{
+			description: "No message as JSON",
+			accept:      "application/json",
+			url:         "/queue/name1",
+			err:         queue.ErrNoMessage,
+			httpCode:    http.StatusNotFound,
+			contentType: contentTypeJSON,
+			body:        `{"error":"Not Found"}` + "\n",
+		},
+		{
+			description: "No message as text",
+			accept:      "text/plain",
+			url:         "/queue/name1",
+			err:         queue.ErrNoMessage,
+			httpCode:    http.StatusNotFound,
+			contentType: "text/plain; charset=utf-8",
+			body:        "Not Found\n",
+		},
+		{
+			description: "Internal error as JSON",
+			accept:      "application/json",
+			url:         "/queue/name1",
+			err:         errors.New("some error"),
+			httpCode:    http.StatusInternalServerError,
+			contentType: contentTypeJSON,
+			body:        `{"error":"Internal Server Error"}` + "\n",
+		},
+		{
+			description: "No message as MessagePack",
+			accept:      contentTypeMsgpack,
+			url:         "/queue/name1",
+			err:         queue.ErrNoMessage,
+			httpCode:    http.StatusNotFound,
+			body:        "\n",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			manager := &MockQueueManager{getOut: GetOut{id: "7", message: "message1", err: tc.err}}
+			handler := setupMux(manager, HandlerConfig{DefaultTimeout: 1, RetryAfter: retryAfter})
+
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodGet, tc.url, nil)
+			if tc.accept != "" {
+				req.Header.Set("Accept", tc.accept)
+			}
+			handler.ServeHTTP(w, req)
+
+			if w.Code != tc.httpCode {
+				t.Errorf("wrong status code: got %v want %v", w.Code, tc.httpCode)
+			}
+			if contentType := w.Header().Get("Content-Type"); tc.contentType != "" && contentType != tc.contentType {
+				t.Errorf("wrong Content-Type: got %v want %v", contentType, tc.contentType)
+			}
+			if body := w.Body.String(); body != tc.body {
+				t.Errorf("wrong body: got [%v] want [%v]", body, tc.body)
+			}
+			if messageID := w.Header().Get(messageIDHeader); messageID != tc.messageID {
+				t.Errorf("wrong %s: got [%v] want [%v]", messageIDHeader, messageID, tc.messageID)
+			}
+		})
+	}
+}
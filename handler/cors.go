@@ -0,0 +1,47 @@
+package handler
+
+import (
+	"net/http"
+	"slices"
+)
+
+const (
+	corsAllowMethods  = "GET, PUT, POST, DELETE"
+	corsAllowHeaders  = "Authorization, Content-Type"
+	corsExposeHeaders = "Retry-After"
+	corsMaxAge        = "600"
+)
+
+// withCORS оборачивает handler обработкой CORS для браузерных клиентов.
+// Разрешенный Origin из allowedOrigins (или любой, если там есть "*") возвращается в Access-Control-Allow-Origin.
+// Preflight запросы OPTIONS обрабатываются здесь же и не доходят ни до аутентификации, ни до очередей.
+// Если список пуст, то CORS отключен и handler возвращается как есть
+func withCORS(handler http.Handler, allowedOrigins []string) http.Handler {
+	if len(allowedOrigins) == 0 {
+		return handler
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get("Origin")
+		allowed := origin != "" && (slices.Contains(allowedOrigins, "*") || slices.Contains(allowedOrigins, origin))
+		if origin != "" {
+			// Ответ зависит от Origin, кэши не должны отдавать его другим источникам
+			w.Header().Add("Vary", "Origin")
+		}
+		if allowed {
+			w.Header().Set("Access-Control-Allow-Origin", origin)
+			w.Header().Set("Access-Control-Expose-Headers", corsExposeHeaders)
+		}
+		if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
+			if !allowed {
+				http.Error(w, "", http.StatusForbidden)
+				return
+			}
+			w.Header().Set("Access-Control-Allow-Methods", corsAllowMethods)
+			w.Header().Set("Access-Control-Allow-Headers", corsAllowHeaders)
+			w.Header().Set("Access-Control-Max-Age", corsMaxAge)
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		handler.ServeHTTP(w, r)
+	})
+}
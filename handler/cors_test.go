@@ -0,0 +1,93 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCORS(t *testing.T) {
+	testCases := []struct {
+		description   string
+		method        string
+		origin        string
+		requestMethod string // Access-Control-Request-Method, задается только для preflight
+		httpCode      int
+		allowOrigin   string
+		callsNum      int
+	}{
+		{
+			description:   "Preflight from allowed origin",
+			method:        http.MethodOptions,
+			origin:        "https://app.example.com",
+			requestMethod: http.MethodPut,
+			httpCode:      http.StatusNoContent,
+			allowOrigin:   "https://app.example.com",
+		},
+		{
+			description:   "Preflight from unknown origin",
+			method:        http.MethodOptions,
+			origin:        "https://evil.example.com",
+			requestMethod: http.MethodPut,
+			httpCode:      http.StatusForbidden,
+		},
+		{
+			description: "Cross-origin GET from allowed origin",
+			method:      http.MethodGet,
+			origin:      "https://app.example.com",
+			httpCode:    http.StatusOK,
+			allowOrigin: "https://app.example.com",
+			callsNum:    1,
+		},
+		{
+			description: "Cross-origin GET from unknown origin",
+			method:      http.MethodGet,
+			origin:      "https://evil.example.com",
+			httpCode:    http.StatusOK,
+			callsNum:    1,
+		},
+		{
+			description: "Same-origin GET",
+			method:      http.MethodGet,
+			httpCode:    http.StatusOK,
+			callsNum:    1,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			callsNum := 0
+			handler := withCORS(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				callsNum++
+			}), []string{"https://app.example.com"})
+
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest(tc.method, "/queue/name1", nil)
+			if tc.origin != "" {
+				req.Header.Set("Origin", tc.origin)
+			}
+			if tc.requestMethod != "" {
+				req.Header.Set("Access-Control-Request-Method", tc.requestMethod)
+			}
+			handler.ServeHTTP(w, req)
+
+			if w.Code != tc.httpCode {
+				t.Errorf("wrong status code: got %v want %v", w.Code, tc.httpCode)
+			}
+			if v := w.Header().Get("Access-Control-Allow-Origin"); v != tc.allowOrigin {
+				t.Errorf("wrong Access-Control-Allow-Origin: got [%v] want [%v]", v, tc.allowOrigin)
+			}
+			if tc.httpCode == http.StatusNoContent {
+				if v := w.Header().Get("Access-Control-Allow-Methods"); v != corsAllowMethods {
+					t.Errorf("wrong Access-Control-Allow-Methods: got [%v] want [%v]", v, corsAllowMethods)
+				}
+				if v := w.Header().Get("Access-Control-Allow-Headers"); v != corsAllowHeaders {
+					t.Errorf("wrong Access-Control-Allow-Headers: got [%v] want [%v]", v, corsAllowHeaders)
+				}
+			}
+			// Preflight не должен доходить до очередей
+			if callsNum != tc.callsNum {
+				t.Errorf("wrong handler calls number: got %v want %v", callsNum, tc.callsNum)
+			}
+		})
+	}
+}
@@ -0,0 +1,76 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+// drainPollInterval задает, как часто Wait проверяет число GET в процессе
+const drainPollInterval = 10 * time.Millisecond
+
+// Drain считает GET запросы, ожидающие сообщения, чтобы при остановке дать им завершиться
+// до остановки очередей, а после Close отклоняет новые запросы к очередям. Nil Drain ничего не считает
+type Drain struct {
+	inFlight atomic.Int64
+	closed   atomic.Bool
+}
+
+// Close начинает остановку: новые запросы к очередям получают 503, а уже начатые продолжаются.
+// Вызывается до остановки очередей, чтобы новые запросы не попали в останавливающиеся очереди
+func (d *Drain) Close() {
+	d.closed.Store(true)
+}
+
+func (d *Drain) isClosed() bool {
+	return d != nil && d.closed.Load()
+}
+
+func (d *Drain) begin() {
+	if d != nil {
+		d.inFlight.Add(1)
+	}
+}
+
+func (d *Drain) end() {
+	if d != nil {
+		d.inFlight.Add(-1)
+	}
+}
+
+// InFlight возвращает число GET запросов в процессе
+func (d *Drain) InFlight() int64 {
+	return d.inFlight.Load()
+}
+
+// Wait ждет, пока не останется GET запросов в процессе. Возвращает ошибку ctx,
+// если он завершился раньше
+func (d *Drain) Wait(ctx context.Context) error {
+	ticker := time.NewTicker(drainPollInterval)
+	defer ticker.Stop()
+	for d.InFlight() > 0 {
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return nil
+}
+
+// withDrain оборачивает handler отказом 503 после Drain.Close. Заголовок Connection: close закрывает соединение,
+// чтобы клиент переподключился, например, через балансировщик к другому экземпляру
+func withDrain(handler http.Handler, drain *Drain) http.Handler {
+	if drain == nil {
+		return handler
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if drain.isClosed() {
+			w.Header().Set("Connection", "close")
+			writeError(w, r, http.StatusServiceUnavailable)
+			return
+		}
+		handler.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,111 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nebotan/simplebroker/queue"
+)
+
+// blockingQueueManager держит Get, пока не закроют release
+type blockingQueueManager struct {
+	MockQueueManager
+	started chan struct{}
+	release chan struct{}
+}
+
+func (m *blockingQueueManager) Get(ctx context.Context, name string, timeout int) (queue.Message, error) {
+	close(m.started)
+	<-m.release
+	return queue.Message{Body: "message"}, nil
+}
+
+func TestDrainWaitsForGet(t *testing.T) {
+	manager := &blockingQueueManager{started: make(chan struct{}), release: make(chan struct{})}
+	drain := &Drain{}
+	handler := setupMux(manager, HandlerConfig{DefaultTimeout: 1, RetryAfter: retryAfter, Drain: drain})
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/queue/name", nil))
+	}()
+	<-manager.started
+	if drain.InFlight() != 1 {
+		t.Errorf("wrong in-flight number: got %v want %v", drain.InFlight(), 1)
+	}
+	// Пока Get не завершился, Wait выходит по таймауту
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := drain.Wait(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("wrong error: got [%v] want [%v]", err, context.DeadlineExceeded)
+	}
+	close(manager.release)
+	<-done
+	ctx, cancel = context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := drain.Wait(ctx); err != nil {
+		t.Errorf("Unexpected exception: %v", err)
+	}
+}
+
+func TestDrainClose(t *testing.T) {
+	testCases := []struct {
+		description string
+		method      string
+		url         string
+		httpCode    int
+	}{
+		{
+			description: "GET",
+			method:      http.MethodGet,
+			url:         "/queue/name",
+			httpCode:    http.StatusServiceUnavailable,
+		},
+		{
+			description: "PUT",
+			method:      http.MethodPut,
+			url:         "/queue/name",
+			httpCode:    http.StatusServiceUnavailable,
+		},
+		{
+			description: "Stats",
+			method:      http.MethodGet,
+			url:         "/queue/name/stats",
+			httpCode:    http.StatusServiceUnavailable,
+		},
+		{
+			description: "Health check",
+			method:      http.MethodGet,
+			url:         "/health",
+			httpCode:    http.StatusOK,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			manager := &MockQueueManager{}
+			drain := &Drain{}
+			handler := setupMux(manager, HandlerConfig{DefaultTimeout: 1, RetryAfter: retryAfter, Drain: drain})
+			drain.Close()
+
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest(tc.method, tc.url, strings.NewReader(`{"message": "message"}`))
+			handler.ServeHTTP(w, req)
+
+			if w.Code != tc.httpCode {
+				t.Errorf("wrong status code: got %v want %v", w.Code, tc.httpCode)
+			}
+			if tc.httpCode == http.StatusServiceUnavailable && w.Header().Get("Connection") != "close" {
+				t.Errorf("wrong Connection header: got [%v] want [close]", w.Header().Get("Connection"))
+			}
+			if manager.getIn.callsNum != 0 || manager.putIn.callsNum != 0 {
+				t.Errorf("queue manager called after Close: GET %v, PUT %v", manager.getIn.callsNum, manager.putIn.callsNum)
+			}
+		})
+	}
+}
@@ -1,61 +1,394 @@
 package handler
 
 import (
+	"bufio"
+	"context"
 	"encoding/json"
 	"errors"
+	"io"
 	"log"
 	"net/http"
+	"net/url"
 	"os"
+	"path"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/nebotan/simplebroker/queue"
+	"go.opentelemetry.io/otel/trace"
 )
 
 type messageDto struct {
-	Message string `json:"message"`
+	ID      string `json:"id,omitempty" msgpack:"id,omitempty"` // идентификатор сообщения, есть только в режиме подтверждения и в потоке подписки
+	Message string `json:"message" msgpack:"message"`
 }
 
+type statsDto struct {
+	Depth    int64 `json:"depth"`
+	InFlight int64 `json:"inFlight"`
+	Waiting  int64 `json:"waiting"`
+	Produced int64 `json:"produced"`
+	Consumed int64 `json:"consumed"`
+	Errors   int64 `json:"errors"`
+	Dropped  int64 `json:"dropped"`
+	Expired  int64 `json:"expired"`
+
+	Suspended      bool      `json:"suspended"`      // очередь приостановлена после неудачных доставок подряд
+	CreatedAt      time.Time `json:"createdAt"`      // момент создания очереди в UTC
+	LastActivityAt time.Time `json:"lastActivityAt"` // момент последнего PUT, выдачи или подтверждения в UTC
+
+	// Groups задает статистику групп потребителей по имени группы, нет поля - нет групп
+	Groups map[string]groupStatsDto `json:"groups,omitempty"`
+}
+
+type groupStatsDto struct {
+	Members  int   `json:"members"`
+	Consumed int64 `json:"consumed"`
+	Lag      int64 `json:"lag"`
+}
+
+type webhookDto struct {
+	URL string `json:"url"`
+}
+
+// exportDto задает тело ответов export и sample и тело запроса import
+type exportDto struct {
+	Messages []string `json:"messages"`
+}
+
+type purgeDto struct {
+	Purged int `json:"purged"`
+}
+
+type replayDto struct {
+	Replayed int `json:"replayed"`
+}
+
+type configDto struct {
+	MaxMessages int `json:"maxMessages"`
+}
+
+// queueConfigDto задает тело PUT /queue/{queue}/config и ответа на GET, нулевые поля в запросе - значения по умолчанию
+type queueConfigDto struct {
+	MaxMessageNum  int    `json:"maxMessageNum"`
+	OverflowPolicy string `json:"overflowPolicy"`
+	TTLSeconds     int    `json:"ttlSeconds"`
+	// MaxConsecutiveFailures задает число неподтвержденных сообщений подряд, после которого очередь приостанавливается
+	MaxConsecutiveFailures int `json:"maxConsecutiveFailures"`
+	// MaxRetries задает число повторных попыток после nack с retry, после которого сообщение уходит в .dlq
+	MaxRetries int `json:"maxRetries"`
+}
+
+// statusClientClosedRequest - нестандартный код nginx для запросов, которые клиент закрыл до ответа
+const statusClientClosedRequest = 499
+
+const (
+	enqueuedAtHeader    = "X-Enqueued-At"      // момент приема сообщения очередью в RFC 3339
+	messageAgeHeader    = "X-Message-Age-Ms"   // сколько миллисекунд сообщение ждало в очереди до выдачи
+	queueLengthHeader   = "X-Queue-Length"     // число сообщений, ожидающих доставки, в ответе на HEAD, то же, что X-Queue-Depth
+	queueNotFoundHeader = "X-Queue-Not-Found"  // в ответе 404 на GET, если очереди нет, а не она пуста
+	fillRatioHeader     = "X-Queue-Fill-Ratio" // заполненность очереди при выдаче сообщения, от 0 до 1
+	queueDepthHeader    = "X-Queue-Depth"      // число сообщений, оставшихся в очереди после выдачи
+	attemptsHeader      = "X-Message-Attempts" // число повторных попыток после nack с retry, если они были
+	consumerIDHeader    = "X-Consumer-Id"      // идентификатор потребителя для взвешенного выбора ожидающего GET
+	timeoutUsedHeader   = "X-Timeout-Used"     // таймаут GET в секундах, из запроса или по умолчанию
+)
+
 var (
 	errorLogger = log.New(os.Stderr, "[ERROR]:HTTP:", log.Ldate|log.Ltime|log.Lmicroseconds)
 )
 
-func Setup(queueManager queue.QueueManager, defaultTimeout int) {
-	http.Handle("/queue/{queue}", createHandler(queueManager, defaultTimeout))
+// HandlerConfig задает настройки HTTP интерфейса
+type HandlerConfig struct {
+	DefaultTimeout int      // таймаут GET в секундах, если он не задан в запросе
+	APIKeys        []string // допустимые API ключи, пустой список отключает аутентификацию
+	ACL            ACL      // права ключей на очереди, пустой ACL отключает проверку прав
+	// RateLimit ограничивает частоту GET и PUT для каждой очереди, нулевой Rate отключает ограничение
+	RateLimit RateLimit
+	// RateLimitOverrides задает ограничения отдельных очередей вместо RateLimit
+	RateLimitOverrides map[string]RateLimit
+	// RetryAfter задает в секундах, через сколько клиенту повторить запрос, отклоненный из-за лимита очередей
+	RetryAfter int
+	// Drain считает GET запросы в процессе, чтобы при остановке дождаться их, и после Close отклоняет новые запросы
+	// к очередям. Проверка здоровья и спецификация API доступны и после Close. Nil отключает подсчет
+	Drain *Drain
+	// CORSOrigins задает источники, которым разрешены запросы из браузера, пустой список отключает CORS
+	CORSOrigins []string
+	// AccessLog задает, куда писать журнал запросов по строке на запрос, nil отключает журнал
+	AccessLog io.Writer
+	// MaxMessageBytes задает ограничение на размер сообщения, как в настройках менеджера очередей, 0 - без ограничения
+	MaxMessageBytes int
+	// MaxBodyBytes ограничивает тело PUT /queue/{queue}, 0 - MaxMessageBytes с запасом messageOverheadBytes
+	// на JSON обертку, а без MaxMessageBytes - defaultMaxBodyBytes. Отрицательное значение снимает ограничение
+	MaxBodyBytes int64
+	// RejectEmptyMessages отклоняет PUT с пустым сообщением кодом 400, по умолчанию пустые сообщения допустимы
+	RejectEmptyMessages bool
+	// TracerProvider создает спаны GET и PUT /queue/{queue} с контекстом из traceparent, nil отключает трассировку
+	TracerProvider trace.TracerProvider
+	// MaxTimeout ограничивает в секундах таймаут GET и PUT с block=true, больший таймаут получает 400. Если такой
+	// запрос не завершился за MaxTimeout с запасом timeoutGrace, то он прерывается с 503. 0 - без ограничения
+	MaxTimeout int
+	// PutTimeout ограничивает время обработки PUT без block=true, по его истечении клиент получает 503, 0 - без ограничения
+	PutTimeout time.Duration
+	// MaxSampleSize ограничивает n в GET /queue/{queue}/sample, 0 - defaultMaxSampleSize
+	MaxSampleSize int
+}
+
+const (
+	defaultSampleSize    = 10  // размер выборки, если n не задан в запросе
+	defaultMaxSampleSize = 100 // ограничение на размер выборки, если MaxSampleSize не задан
+)
+
+// maxSampleSize возвращает ограничение на размер выборки сообщений
+func (c HandlerConfig) maxSampleSize() int {
+	if c.MaxSampleSize <= 0 {
+		return defaultMaxSampleSize
+	}
+	return c.MaxSampleSize
+}
+
+// messageOverheadBytes задает запас тела PUT сверх MaxMessageBytes на {"message": ""} и экранирование символов,
+// чтобы тело допустимого сообщения не отклонялось раньше проверки размера в очереди
+const messageOverheadBytes = 1024
+
+// defaultMaxBodyBytes ограничивает тело PUT, если не задан ни MaxBodyBytes, ни MaxMessageBytes, чтобы клиент
+// не мог передавать бесконечное тело, пока разбор JSON не завершится ошибкой
+const defaultMaxBodyBytes = 64 << 20
+
+// waitTimeout возвращает срок обработки запросов, ожидающих сообщения или места в очереди, 0 - без ограничения
+func (c HandlerConfig) waitTimeout() time.Duration {
+	if c.MaxTimeout <= 0 {
+		return 0
+	}
+	return time.Duration(c.MaxTimeout)*time.Second + timeoutGrace
+}
+
+// maxBodyBytes возвращает ограничение на тело PUT, 0 - без ограничения
+func (c HandlerConfig) maxBodyBytes() int64 {
+	switch {
+	case c.MaxBodyBytes < 0:
+		return 0
+	case c.MaxBodyBytes > 0:
+		return c.MaxBodyBytes
+	case c.MaxMessageBytes > 0:
+		return int64(c.MaxMessageBytes) + messageOverheadBytes
+	default:
+		return defaultMaxBodyBytes
+	}
+}
+
+// Setup регистрирует обработчики API в mux. Отдельный mux, а не http.DefaultServeMux,
+// не дает попасть в публичный API обработчикам, которые пакеты вроде net/http/pprof регистрируют сами.
+// Метод и путь разбирает mux: на неподдерживаемый метод он отвечает 405, а имя очереди доступно через PathValue
+func Setup(mux *http.ServeMux, queueManager queue.QueueManager, config HandlerConfig) {
+	setup(mux, queueManager, config)
+}
+
+// routeRegistrar регистрирует обработчик маршрута, как http.ServeMux. Тесты подменяют его, чтобы получить
+// список маршрутов
+type routeRegistrar interface {
+	Handle(pattern string, handler http.Handler)
+}
+
+func setup(mux routeRegistrar, queueManager queue.QueueManager, config HandlerConfig) {
+	preflightPaths := make(map[string]bool)
+	accessLogger := newAccessLogger(config.AccessLog)
+	register := func(method, path string, handler http.Handler) {
+		// CORS снаружи, так как preflight запросы приходят без ключа, а журнал еще снаружи, чтобы попадали и отказы
+		handler = withCORS(withDrain(withAPIKeys(handler, config.APIKeys), config.Drain), config.CORSOrigins)
+		mux.Handle(method+" "+path, loggingMiddleware(handler, accessLogger))
+		if len(config.CORSOrigins) != 0 && !preflightPaths[path] {
+			// Preflight приходит методом OPTIONS, на который без отдельного маршрута mux ответил бы 405
+			preflightPaths[path] = true
+			mux.Handle(http.MethodOptions+" "+path, loggingMiddleware(withCORS(http.HandlerFunc(methodNotAllowed), config.CORSOrigins), accessLogger))
+		}
+	}
+	handle := func(method, path string, handler http.Handler, resolve accessResolver) {
+		register(method, path, withACL(withQueueName(handler, queueManager), config.ACL, resolve))
+	}
+	// GET маршруты mux сопоставляет и с HEAD, а чтение из очереди извлекает сообщение, которое HEAD потерял бы
+	handleConsumingGet := func(path string, handler http.Handler) {
+		handle(http.MethodGet, path, handler, resolveReadAccess)
+		mux.Handle(http.MethodHead+" "+path, http.HandlerFunc(methodNotAllowed))
+	}
+
+	queueHandler := createHandler(queueManager, config)
+	limit := func(handler http.Handler) http.Handler {
+		return handler
+	}
+	if config.RateLimit.Rate > 0 || len(config.RateLimitOverrides) != 0 {
+		// Один limiter на GET и PUT, чтобы они расходовали общий лимит очереди
+		limiter := newRateLimiter(config.RateLimit, config.RateLimitOverrides)
+		limit = func(handler http.Handler) http.Handler {
+			return withRateLimit(handler, limiter)
+		}
+	}
+	// Сжатие только для обычных ответов: потоковые обработчики сами управляют отправкой.
+	// Спан снаружи ограничения частоты, чтобы в трассировку попадали и отклоненные запросы
+	wrapQueue := func(handler http.HandlerFunc, operation string) http.Handler {
+		return withTracing(limit(gzipMiddleware(handler)), config.TracerProvider, operation)
+	}
+	// Срок GET неизвестен, пока обработчик не разберет timeout, поэтому снаружи действует общий срок с запасом,
+	// а точный срок ожидания задает контекст внутри очереди
+	handle(http.MethodGet, "/queue/{queue}", withTimeout(wrapQueue(queueHandler.serveGet, "receive"), config.waitTimeout()), resolveReadAccess)
+	// Отдельный маршрут HEAD, иначе mux отдал бы его в serveGet, который извлекает сообщение
+	handle(http.MethodHead, "/queue/{queue}", http.HandlerFunc(queueHandler.serveHead), resolveReadAccess)
+	putHandler := withPutTimeout(wrapQueue(queueHandler.servePut, "send"), config.PutTimeout, config.waitTimeout())
+	handle(http.MethodPut, "/queue/{queue}", putHandler, resolveWriteAccess)
+	// POST без тела создает пустую очередь, а с телом - синоним PUT для клиентов и HTML форм,
+	// которые по умолчанию отправляют POST. Пустое тело в PUT недопустимо, поэтому запросы не путаются
+	handle(http.MethodPost, "/queue/{queue}", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !hasBody(r) {
+			queueHandler.serveCreate(w, r)
+			return
+		}
+		putHandler.ServeHTTP(w, r)
+	}), resolveWriteAccess)
+	handle(http.MethodDelete, "/queue/{queue}", http.HandlerFunc(queueHandler.serveDelete), resolveWriteAccess)
+	handle(http.MethodPost, "/queue/{queue}/pause", createPauseHandler(queueManager, true), resolveWriteAccess)
+	handle(http.MethodPost, "/queue/{queue}/resume", createPauseHandler(queueManager, false), resolveWriteAccess)
+	handle(http.MethodPost, "/queue/{queue}/restart", createRestartHandler(queueManager), resolveWriteAccess)
+	handle(http.MethodPost, "/queue/{queue}/bind", createBindHandler(queueManager, true), resolveWriteAccess)
+	handle(http.MethodPut, "/queue/{queue}/unbind", createBindHandler(queueManager, false), resolveWriteAccess)
+	handle(http.MethodPost, "/queue/{queue}/subscriptions", createWebhookHandler(queueManager), resolveReadAccess)
+	handle(http.MethodDelete, "/queue/{queue}/message/{id}", createAckHandler(queueManager), resolveReadAccess)
+	handle(http.MethodDelete, "/queue/{queue}/nack/{id}", createNackHandler(queueManager), resolveReadAccess)
+	handle(http.MethodPost, "/queue/{queue}/purge", createPurgeHandler(queueManager), resolveWriteAccess)
+	handle(http.MethodPost, "/queue/{queue}/config", createConfigHandler(queueManager), resolveWriteAccess)
+	queueConfigHandler := createQueueConfigHandler(queueManager)
+	handle(http.MethodPut, "/queue/{queue}/config", http.HandlerFunc(queueConfigHandler.servePut), resolveWriteAccess)
+	handle(http.MethodGet, "/queue/{queue}/config", http.HandlerFunc(queueConfigHandler.serveGet), resolveReadAccess)
+	// Перенос меняет обе очереди, поэтому права на запись нужны и для dest
+	handle(http.MethodPost, "/queue/{queue}/move", withACL(createMoveHandler(queueManager), config.ACL, resolveMoveDestAccess), resolveWriteAccess)
+	// Недоставленные сообщения возвращаются в исходную очередь, поэтому права на запись нужны и для неё
+	handle(http.MethodPost, "/queue/{queue}/replay", withACL(createReplayHandler(queueManager), config.ACL, resolveReplaySourceAccess), resolveWriteAccess)
+	handle(http.MethodGet, "/queue/{queue}/stats", gzipMiddleware(createStatsHandler(queueManager)), resolveReadAccess)
+	handle(http.MethodGet, "/queue/{queue}/sample", withoutGzipForNDJSON(createSampleHandler(queueManager, config.maxSampleSize())), resolveReadAccess)
+	// Экспорт и импорт переносят очередь целиком, поэтому сжатие для них особенно полезно.
+	// Построчные выборка и экспорт не сжимаются, чтобы строки доходили до клиента сразу
+	handle(http.MethodPost, "/admin/queue/{queue}/export", withoutGzipForNDJSON(createExportHandler(queueManager)), resolveReadAccess)
+	handle(http.MethodPost, "/admin/queue/{queue}/import", gzipMiddleware(createImportHandler(queueManager)), resolveWriteAccess)
+	handle(http.MethodPost, "/admin/queue/{queue}/resume", createUnsuspendHandler(queueManager), resolveWriteAccess)
+	// Через псевдоним пишут и читают так же, как через саму очередь, поэтому права на запись нужны и для него
+	aliasHandler := createAliasHandler(queueManager)
+	handle(http.MethodGet, "/admin/queue/{queue}/alias", http.HandlerFunc(aliasHandler.serveList), resolveReadAccess)
+	handle(http.MethodPost, "/admin/queue/{queue}/alias/{alias}", withACL(http.HandlerFunc(aliasHandler.serveAdd), config.ACL, resolveAliasAccess), resolveWriteAccess)
+	handle(http.MethodDelete, "/admin/queue/{queue}/alias/{alias}", withACL(http.HandlerFunc(aliasHandler.serveDelete), config.ACL, resolveAliasAccess), resolveWriteAccess)
+	// Поиск не относится к одной очереди, поэтому права проверяются не на маршрут, а на каждую найденную очередь
+	register(http.MethodGet, "/queues/search", gzipMiddleware(createSearchHandler(queueManager, config.ACL)))
+	handleConsumingGet("/ws/queue/{queue}", createWebSocketHandler(queueManager, config.DefaultTimeout))
+	handleConsumingGet("/sse/queue/{queue}", createSSEHandler(queueManager, config.DefaultTimeout))
+	// Проверка здоровья не требует ключа, чтобы её могли использовать балансировщики и оркестраторы.
+	// В журнал она не пишется, чтобы частые проверки не забивали его
+	mux.Handle("GET /health", http.HandlerFunc(serveHealth))
+	// Спецификация тоже доступна без ключа: по ней клиенты узнают, как работать с API
+	mux.Handle("GET /openapi.yaml", createOpenAPIHandler(openAPIYAML, "application/yaml"))
+	mux.Handle("GET /openapi.json", createOpenAPIHandler(openAPIJSON, "application/json"))
+}
+
+// hasBody сообщает, есть ли у запроса непустое тело. Длина тела с Transfer-Encoding: chunked заранее неизвестна,
+// поэтому первый байт читается и возвращается в r.Body. Ошибку чтения увидит обработчик тела
+func hasBody(r *http.Request) bool {
+	if r.ContentLength >= 0 {
+		return r.ContentLength > 0
+	}
+	reader := bufio.NewReader(r.Body)
+	if _, err := reader.Peek(1); errors.Is(err, io.EOF) {
+		return false
+	}
+	r.Body = struct {
+		io.Reader
+		io.Closer
+	}{reader, r.Body}
+	return true
+}
+
+// withoutGzipForNDJSON сжимает ответы handler, кроме построчного JSON: сжатие копит ответ и не отправляет
+// строки по мере записи
+func withoutGzipForNDJSON(handler http.Handler) http.Handler {
+	compressed := gzipMiddleware(handler)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if acceptsNDJSON(r) {
+			handler.ServeHTTP(w, r)
+			return
+		}
+		compressed.ServeHTTP(w, r)
+	})
+}
+
+// methodNotAllowed отвечает 405 на метод, который mux сопоставил с маршрутом, но который не поддерживается
+func methodNotAllowed(w http.ResponseWriter, _ *http.Request) {
+	http.Error(w, "", http.StatusMethodNotAllowed)
 }
 
-func createHandler(queueManager queue.QueueManager, defaultTimeout int) http.Handler {
+// withQueueName оборачивает handler проверкой имени очереди {queue} из пути, чтобы недопустимое имя
+// не доходило до QueueManager. На недопустимое имя отвечает 400 с текстом ошибки
+func withQueueName(handler http.Handler, queueManager queue.QueueManager) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := queueManager.ValidateName(r.PathValue("queue")); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		handler.ServeHTTP(w, r)
+	})
+}
+
+// createHandler создает обработчики GET, HEAD, PUT и DELETE /queue/{queue}, которые Setup регистрирует по отдельности
+func createHandler(queueManager queue.QueueManager, config HandlerConfig) *handlerImpl {
 	return &handlerImpl{
 		queueManager:   queueManager,
-		defaultTimeout: defaultTimeout,
+		defaultTimeout: config.DefaultTimeout,
+		maxTimeout:     config.MaxTimeout,
+		retryAfter:     config.RetryAfter,
+		maxBodyBytes:   config.maxBodyBytes(),
+		rejectEmpty:    config.RejectEmptyMessages,
+		drain:          config.Drain,
 	}
 }
 
 type handlerImpl struct {
 	queueManager   queue.QueueManager
 	defaultTimeout int
-}
-
-func (h *handlerImpl) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	switch r.Method {
-	case http.MethodGet:
-		h.serveGet(w, r)
-	case http.MethodPut:
-		h.servePut(w, r)
-	default:
-		http.Error(w, "", http.StatusBadRequest)
-		return
-	}
+	maxTimeout     int    // ограничение на таймаут из запроса, 0 - без ограничения
+	retryAfter     int    // значение заголовка Retry-After для ответов 429
+	maxBodyBytes   int64  // ограничение на тело PUT, 0 - без ограничения
+	rejectEmpty    bool   // отклонять PUT с пустым сообщением
+	drain          *Drain // счетчик GET в процессе для остановки, nil - не считать
 }
 
 func (h *handlerImpl) serveGet(w http.ResponseWriter, r *http.Request) {
-	// name := r.PathValue("queue") // При использовании httptest без поднятия сервера PathValue не работает
-	name := getName(r) // Самописная ф-ция для извлечения из Path имени очереди
+	name := r.PathValue("queue")
 	timeout := h.defaultTimeout
+	ack := false
+	sub := r.URL.Query().Get("sub")
+	group := r.URL.Query().Get("group")
+	var filter queue.MessageFilter
 	isValid := func() bool {
-		if name == "" {
+		if ackAsStr := r.URL.Query().Get("ack"); ackAsStr != "" {
+			v, err := strconv.ParseBool(ackAsStr)
+			if err != nil {
+				errorLogger.Printf("GET ack [%s] parse error:%v\n", ackAsStr, err)
+				return false
+			}
+			ack = v
+		}
+		// Подписки топиков не поддерживают режим подтверждения, а подписка сама отделяет своих читателей
+		if sub != "" && (ack || group != "") {
 			return false
 		}
+		if filterAsStr := r.URL.Query().Get("filter"); filterAsStr != "" {
+			// Фильтр относится к подписке, у обычной очереди его нет
+			if sub == "" {
+				return false
+			}
+			v, err := queue.ParseFilter(filterAsStr)
+			if err != nil {
+				errorLogger.Printf("GET filter [%s] parse error:%v\n", filterAsStr, err)
+				return false
+			}
+			filter = v
+		}
 		timeoutAsStr := r.URL.Query().Get("timeout")
 		if timeoutAsStr != "" {
 			v, err := strconv.Atoi(timeoutAsStr)
@@ -63,7 +396,7 @@ func (h *handlerImpl) serveGet(w http.ResponseWriter, r *http.Request) {
 				errorLogger.Printf("GET timeout [%s] parse error:%v\n", timeoutAsStr, err)
 				return false
 			}
-			if v <= 0 {
+			if v <= 0 || !h.isValidTimeout(v) {
 				return false
 			}
 			timeout = v
@@ -74,52 +407,1034 @@ func (h *handlerImpl) serveGet(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "", http.StatusBadRequest)
 		return
 	}
-	message, err := h.queueManager.Get(r.Context(), name, timeout)
+	// Клиент, который полагается на таймаут по умолчанию, видит, сколько на самом деле ждал запрос
+	w.Header().Set(timeoutUsedHeader, strconv.Itoa(timeout))
+	h.drain.begin()
+	defer h.drain.end()
+	ctx := r.Context()
+	if group != "" {
+		// Участник уходит из группы, когда завершается контекст запроса
+		ctx = queue.WithConsumerGroup(ctx, group)
+	}
+	if consumer := r.Header.Get(consumerIDHeader); consumer != "" {
+		ctx = queue.WithConsumerID(ctx, consumer)
+	}
+	var message queue.Message
+	var err error
+	if sub != "" {
+		// Если задана подписка, то name - это топик в режиме pub/sub. Фильтр задается при создании подписки,
+		// поэтому подписка создается до ожидания сообщения
+		if filter != nil {
+			err = h.queueManager.Subscribe(name, sub, filter)
+		}
+		if err == nil {
+			message, err = h.queueManager.GetSub(ctx, name, sub, timeout)
+		}
+	} else if ack {
+		// Сообщение остается в обработке до DELETE /queue/{queue}/message/{id}
+		message, err = h.queueManager.GetAck(ctx, name, timeout)
+	} else {
+		message, err = h.queueManager.Get(ctx, name, timeout)
+	}
 	if err != nil {
+		// Ошибки отдаются в формате, который клиент запросил для сообщения
 		if errors.Is(err, queue.ErrNoMessage) {
-			http.Error(w, "", http.StatusNotFound)
+			writeError(w, r, http.StatusNotFound)
+		} else if errors.Is(err, queue.ErrQueueNotFound) {
+			// Код тот же, что и для пустой очереди, чтобы не менять поведение существующих клиентов
+			w.Header().Set(queueNotFoundHeader, "true")
+			writeError(w, r, http.StatusNotFound)
+		} else if errors.Is(err, queue.ErrWrongQueueType) || errors.Is(err, queue.ErrInvalidFilter) {
+			// Фильтр существующей подписки не совпадает с запрошенным
+			writeError(w, r, http.StatusBadRequest)
+		} else if errors.Is(err, queue.ErrTooManyItems) {
+			h.tooManyRequests(w)
+		} else if errors.Is(err, queue.ErrShuttingDown) {
+			// Очередь удалили или сервис останавливается, пока запрос ждал сообщения
+			writeError(w, r, http.StatusServiceUnavailable)
+		} else if errors.Is(err, queue.ErrCanceled) {
+			// Клиент ушел, не дождавшись сообщения, это не ошибка сервиса. Ответ он уже не прочитает,
+			// а код 499 (Client Closed Request) отличает такие запросы в логах прокси
+			http.Error(w, "", statusClientClosedRequest)
+		} else if errors.Is(err, queue.ErrTooManyWaiters) {
+			// Сообщения ждет слишком много запросов, новый отклоняется, не занимая ресурсы
+			w.Header().Set("Retry-After", strconv.Itoa(h.retryAfter))
+			writeError(w, r, http.StatusServiceUnavailable)
+		} else if errors.Is(err, queue.ErrQueueSuspended) {
+			// Очередь приостановлена после неудачных доставок и ждет POST /admin/queue/{queue}/resume
+			writeError(w, r, http.StatusConflict)
 		} else {
 			errorLogger.Println("GET QueueManager error:", err)
-			http.Error(w, "", http.StatusInternalServerError)
+			writeError(w, r, http.StatusInternalServerError)
 		}
 		return
 	}
-	if err := json.NewEncoder(w).Encode(messageDto{Message: message}); err != nil {
-		errorLogger.Println("GET Body JSON encode error:", err)
+	// Возраст считается в момент выдачи, чтобы читатель видел, сколько сообщение ждало в очереди
+	w.Header().Set(enqueuedAtHeader, message.EnqueuedAt.UTC().Format(time.RFC3339Nano))
+	w.Header().Set(messageAgeHeader, strconv.FormatInt(time.Since(message.EnqueuedAt).Milliseconds(), 10))
+	// Писатели, которые делят соединение с читателем, узнают о нагрузке без отдельного запроса статистики
+	w.Header().Set(fillRatioHeader, strconv.FormatFloat(message.FillRatio, 'f', 3, 64))
+	w.Header().Set(queueDepthHeader, strconv.Itoa(message.Depth))
+	if message.Attempts > 0 {
+		w.Header().Set(attemptsHeader, strconv.Itoa(message.Attempts))
+	}
+	dto := messageDto{Message: message.Body}
+	if ack {
+		// Идентификатор нужен читателю только для подтверждения
+		dto.ID = message.ID
+	}
+	if err := encodeMessage(w, r, dto); err != nil {
+		errorLogger.Println("GET Body encode error:", err)
 		http.Error(w, "", http.StatusInternalServerError)
 	}
 }
 
 func (h *handlerImpl) servePut(w http.ResponseWriter, r *http.Request) {
-	// name := r.PathValue("queue") // При использовании httptest без поднятия сервера PathValue не работает
-	name := getName(r) // Самописная ф-ция для извлечения из Path имени очереди
+	name := r.PathValue("queue")
+	block := false
+	confirm := true
+	timeout := h.defaultTimeout
+	isValid := func() bool {
+		if blockAsStr := r.URL.Query().Get("block"); blockAsStr != "" {
+			v, err := strconv.ParseBool(blockAsStr)
+			if err != nil {
+				errorLogger.Printf("PUT block [%s] parse error:%v\n", blockAsStr, err)
+				return false
+			}
+			block = v
+		}
+		if confirmAsStr := r.URL.Query().Get("confirm"); confirmAsStr != "" {
+			v, err := strconv.ParseBool(confirmAsStr)
+			if err != nil {
+				errorLogger.Printf("PUT confirm [%s] parse error:%v\n", confirmAsStr, err)
+				return false
+			}
+			confirm = v
+		}
+		// Ожидание места в очереди бессмысленно, если писатель не ждет и подтверждения
+		if block && !confirm {
+			return false
+		}
+		if timeoutAsStr := r.URL.Query().Get("timeout"); timeoutAsStr != "" {
+			v, err := strconv.Atoi(timeoutAsStr)
+			if err != nil || v <= 0 {
+				errorLogger.Printf("PUT timeout [%s] parse error:%v\n", timeoutAsStr, err)
+				return false
+			}
+			if !h.isValidTimeout(v) {
+				return false
+			}
+			timeout = v
+		}
+		return true
+	}()
+	if !isValid {
+		http.Error(w, "", http.StatusBadRequest)
+		return
+	}
+	if h.maxBodyBytes > 0 {
+		// Тело уже распаковано gzipMiddleware, поэтому ограничивается его настоящий размер
+		r.Body = http.MaxBytesReader(w, r.Body, h.maxBodyBytes)
+	}
 	var m messageDto
-	if err := json.NewDecoder(r.Body).Decode(&m); err != nil {
-		errorLogger.Println("PUT Body JSON decode error:", err)
+	if err := decodeMessage(r, &m); err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			http.Error(w, "", http.StatusRequestEntityTooLarge)
+			return
+		}
+		errorLogger.Println("PUT Body decode error:", err)
 		http.Error(w, "", http.StatusBadRequest)
 		return
 	}
-	if err := h.queueManager.Put(name, m.Message); err != nil {
+	if h.rejectEmpty && m.Message == "" {
+		// Писатель должен отличать этот отказ от неразобранного тела
+		writeJSONError(w, http.StatusBadRequest, "empty message not allowed")
+		return
+	}
+	var err error
+	if block {
+		// Ожидание места ограничено timeout так же, как ожидание сообщения в GET
+		ctx, cancel := context.WithTimeout(r.Context(), time.Duration(timeout)*time.Second)
+		defer cancel()
+		err = h.queueManager.PutBlocking(ctx, name, m.Message)
+	} else if !confirm {
+		err = h.queueManager.PutAsync(r.Context(), name, m.Message)
+	} else {
+		err = h.queueManager.Put(r.Context(), name, m.Message)
+	}
+	if err != nil {
 		if errors.Is(err, queue.ErrTooManyItems) {
 			// Мы уперлись в ограничение на число очередей или на число элементов в очереди,
 			// поэтому отдаём  StatusTooManyRequests
-			http.Error(w, "", http.StatusTooManyRequests)
+			h.tooManyRequests(w)
+			return
+		}
+		if errors.Is(err, queue.ErrCanceled) {
+			// Клиент ушел, не дождавшись места в очереди
+			http.Error(w, "", statusClientClosedRequest)
+			return
+		}
+		if errors.Is(err, queue.ErrMessageTooLarge) {
+			http.Error(w, "", http.StatusRequestEntityTooLarge)
+			return
+		}
+		if errors.Is(err, queue.ErrWrongQueueType) {
+			// Без подтверждения нельзя писать в топик
+			http.Error(w, "", http.StatusBadRequest)
+			return
 		}
 		errorLogger.Println("PUT QueueManager error:", err)
 		http.Error(w, "", http.StatusInternalServerError)
+		return
+	}
+	if !confirm {
+		// Сообщение передано очереди, но еще может быть отброшено при переполнении
+		w.WriteHeader(http.StatusAccepted)
+	}
+}
+
+// isValidTimeout проверяет таймаут из запроса: больший MaxTimeout запрос прервался бы раньше, чем истечет таймаут
+func (h *handlerImpl) isValidTimeout(timeout int) bool {
+	return h.maxTimeout <= 0 || timeout <= h.maxTimeout
+}
+
+// tooManyRequests отвечает 429 с подсказкой клиенту, когда повторить запрос
+func (h *handlerImpl) tooManyRequests(w http.ResponseWriter) {
+	w.Header().Set("Retry-After", strconv.Itoa(h.retryAfter))
+	http.Error(w, "", http.StatusTooManyRequests)
+}
+
+// serveHead сообщает, есть ли очередь, и её длину в X-Queue-Length, не извлекая сообщений.
+// Для топика длины нет, поэтому он считается существующим без заголовка
+func (h *handlerImpl) serveHead(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("queue")
+	stats, err := h.queueManager.Stats(name)
+	if err != nil {
+		if errors.Is(err, queue.ErrQueueNotFound) {
+			// Как и в GET, клиент отличает несуществующую очередь от пустой
+			w.Header().Set(queueNotFoundHeader, "true")
+			w.WriteHeader(http.StatusNotFound)
+		} else if !errors.Is(err, queue.ErrWrongQueueType) {
+			errorLogger.Println("HEAD QueueManager error:", err)
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+		return
+	}
+	depth := strconv.FormatInt(stats.Depth, 10)
+	w.Header().Set(queueLengthHeader, depth)
+	w.Header().Set(queueDepthHeader, depth)
+	// Опрашивающий клиент по коду узнает, будет ли GET ждать, ничего не извлекая
+	if stats.Depth == 0 {
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+// serveCreate создает пустую очередь, чтобы читатели могли ждать в ней сообщений до первого PUT.
+// Отвечает 201, если очередь создана, и 200, если она уже была
+func (h *handlerImpl) serveCreate(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("queue")
+	created, err := h.queueManager.EnsureQueue(name)
+	if err != nil {
+		if errors.Is(err, queue.ErrTooManyItems) {
+			h.tooManyRequests(w)
+		} else if errors.Is(err, queue.ErrWrongQueueType) {
+			http.Error(w, "", http.StatusBadRequest)
+		} else {
+			errorLogger.Println("POST QueueManager error:", err)
+			http.Error(w, "", http.StatusInternalServerError)
+		}
+		return
+	}
+	if created {
+		w.WriteHeader(http.StatusCreated)
+	}
+}
+
+func (h *handlerImpl) serveDelete(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("queue")
+	if err := h.queueManager.Delete(name); err != nil {
+		if errors.Is(err, queue.ErrQueueNotFound) {
+			http.Error(w, "", http.StatusNotFound)
+			return
+		}
+		errorLogger.Println("DELETE QueueManager error:", err)
+		http.Error(w, "", http.StatusInternalServerError)
+	}
+}
+
+func createPauseHandler(queueManager queue.QueueManager, pause bool) http.Handler {
+	return &pauseHandlerImpl{
+		queueManager: queueManager,
+		pause:        pause,
+	}
+}
+
+// pauseHandlerImpl обрабатывает POST /queue/{queue}/pause и POST /queue/{queue}/resume
+type pauseHandlerImpl struct {
+	queueManager queue.QueueManager
+	pause        bool // true - приостановить доставку, false - возобновить
+}
+
+func (h *pauseHandlerImpl) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("queue")
+	var err error
+	if h.pause {
+		err = h.queueManager.Pause(name)
+	} else {
+		err = h.queueManager.Resume(name)
+	}
+	if err != nil {
+		if errors.Is(err, queue.ErrQueueNotFound) {
+			http.Error(w, "", http.StatusNotFound)
+			return
+		}
+		errorLogger.Println("POST pause/resume QueueManager error:", err)
+		http.Error(w, "", http.StatusInternalServerError)
+	}
+}
+
+func createRestartHandler(queueManager queue.QueueManager) http.Handler {
+	return &restartHandlerImpl{
+		queueManager: queueManager,
+	}
+}
+
+// restartHandlerImpl обрабатывает POST /queue/{queue}/restart, перезапуская горутину очереди с сохранением сообщений
+type restartHandlerImpl struct {
+	queueManager queue.QueueManager
+}
+
+func (h *restartHandlerImpl) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if err := h.queueManager.Restart(r.Context(), r.PathValue("queue")); err != nil {
+		if errors.Is(err, queue.ErrQueueNotFound) {
+			http.Error(w, "", http.StatusNotFound)
+		} else if errors.Is(err, queue.ErrWrongQueueType) {
+			// У топика нет своей горутины, только у подписок
+			http.Error(w, "", http.StatusBadRequest)
+		} else if errors.Is(err, queue.ErrShuttingDown) || r.Context().Err() != nil {
+			// Очередь удалили или запрос завершился раньше, чем очередь приняла перезапуск
+			http.Error(w, "", http.StatusServiceUnavailable)
+		} else {
+			errorLogger.Println("POST restart QueueManager error:", err)
+			http.Error(w, "", http.StatusInternalServerError)
+		}
+	}
+}
+
+func createUnsuspendHandler(queueManager queue.QueueManager) http.Handler {
+	return &unsuspendHandlerImpl{
+		queueManager: queueManager,
+	}
+}
+
+// unsuspendHandlerImpl обрабатывает POST /admin/queue/{queue}/resume, возобновляя очередь,
+// приостановленную после неудачных доставок
+type unsuspendHandlerImpl struct {
+	queueManager queue.QueueManager
+}
+
+func (h *unsuspendHandlerImpl) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if err := h.queueManager.Unsuspend(r.PathValue("queue")); err != nil {
+		if errors.Is(err, queue.ErrQueueNotFound) {
+			http.Error(w, "", http.StatusNotFound)
+			return
+		}
+		errorLogger.Println("POST admin resume QueueManager error:", err)
+		http.Error(w, "", http.StatusInternalServerError)
+	}
+}
+
+func createBindHandler(queueManager queue.QueueManager, bind bool) http.Handler {
+	return &bindHandlerImpl{
+		queueManager: queueManager,
+		bind:         bind,
+	}
+}
+
+// bindHandlerImpl обрабатывает POST /queue/{queue}/bind?target= и PUT /queue/{queue}/unbind?target=
+type bindHandlerImpl struct {
+	queueManager queue.QueueManager
+	bind         bool // true - привязать очередь target, false - отвязать
+}
+
+func (h *bindHandlerImpl) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("queue")
+	target := r.URL.Query().Get("target")
+	// Привязка очереди к самой себе удваивала бы каждое сообщение
+	if target == "" || target == name {
+		http.Error(w, "", http.StatusBadRequest)
+		return
+	}
+	if err := h.queueManager.ValidateName(target); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if h.bind {
+		h.queueManager.Bind(name, target)
+	} else {
+		h.queueManager.Unbind(name, target)
+	}
+}
+
+func createWebhookHandler(queueManager queue.QueueManager) http.Handler {
+	return &webhookHandlerImpl{
+		queueManager: queueManager,
+	}
+}
+
+// webhookHandlerImpl обрабатывает POST /queue/{queue}/subscriptions, регистрируя webhook для очереди
+type webhookHandlerImpl struct {
+	queueManager queue.QueueManager
+}
+
+func (h *webhookHandlerImpl) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("queue")
+	var dto webhookDto
+	if err := json.NewDecoder(r.Body).Decode(&dto); err != nil {
+		errorLogger.Println("POST subscriptions Body JSON decode error:", err)
+		http.Error(w, "", http.StatusBadRequest)
+		return
+	}
+	// Доставка возможна только на абсолютный http(s) URL
+	callbackURL, err := url.ParseRequestURI(dto.URL)
+	if err != nil || (callbackURL.Scheme != "http" && callbackURL.Scheme != "https") || callbackURL.Host == "" {
+		http.Error(w, "", http.StatusBadRequest)
+		return
+	}
+	if err := h.queueManager.AddWebhook(name, dto.URL); err != nil {
+		if errors.Is(err, queue.ErrWrongQueueType) {
+			http.Error(w, "", http.StatusBadRequest)
+			return
+		}
+		if errors.Is(err, queue.ErrTooManyItems) {
+			http.Error(w, "", http.StatusTooManyRequests)
+			return
+		}
+		errorLogger.Println("POST subscriptions QueueManager error:", err)
+		http.Error(w, "", http.StatusInternalServerError)
+	}
+}
+
+func createAckHandler(queueManager queue.QueueManager) http.Handler {
+	return &ackHandlerImpl{
+		queueManager: queueManager,
+	}
+}
+
+// ackHandlerImpl обрабатывает DELETE /queue/{queue}/message/{id}, подтверждая обработку сообщения
+type ackHandlerImpl struct {
+	queueManager queue.QueueManager
+}
+
+func (h *ackHandlerImpl) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("queue")
+	id := r.PathValue("id")
+	if err := h.queueManager.Ack(name, id); err != nil {
+		if errors.Is(err, queue.ErrQueueNotFound) || errors.Is(err, queue.ErrMessageNotFound) {
+			http.Error(w, "", http.StatusNotFound)
+			return
+		}
+		errorLogger.Println("DELETE message QueueManager error:", err)
+		http.Error(w, "", http.StatusInternalServerError)
+	}
+}
+
+func createNackHandler(queueManager queue.QueueManager) http.Handler {
+	return &nackHandlerImpl{
+		queueManager: queueManager,
+	}
+}
+
+// nackHandlerImpl обрабатывает DELETE /queue/{queue}/nack/{id}?retry=, возвращая сообщение в очередь
+type nackHandlerImpl struct {
+	queueManager queue.QueueManager
+}
+
+func (h *nackHandlerImpl) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("queue")
+	id := r.PathValue("id")
+	retry := false
+	if retryAsStr := r.URL.Query().Get("retry"); retryAsStr != "" {
+		v, err := strconv.ParseBool(retryAsStr)
+		if err != nil {
+			errorLogger.Printf("nack retry [%s] parse error:%v\n", retryAsStr, err)
+			http.Error(w, "", http.StatusBadRequest)
+			return
+		}
+		retry = v
+	}
+	if err := h.queueManager.Nack(name, id, retry); err != nil {
+		if errors.Is(err, queue.ErrQueueNotFound) || errors.Is(err, queue.ErrMessageNotFound) {
+			http.Error(w, "", http.StatusNotFound)
+		} else if errors.Is(err, queue.ErrTooManyItems) {
+			// Очередь недоставленных сообщений переполнена, сообщение осталось в обработке
+			http.Error(w, "", http.StatusTooManyRequests)
+		} else {
+			errorLogger.Println("DELETE nack QueueManager error:", err)
+			http.Error(w, "", http.StatusInternalServerError)
+		}
+	}
+}
+
+func createStatsHandler(queueManager queue.QueueManager) http.Handler {
+	return &statsHandlerImpl{
+		queueManager: queueManager,
+	}
+}
+
+// statsHandlerImpl обрабатывает GET /queue/{queue}/stats, отдавая статистику очереди в JSON
+type statsHandlerImpl struct {
+	queueManager queue.QueueManager
+}
+
+func (h *statsHandlerImpl) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("queue")
+	stats, err := h.queueManager.Stats(name)
+	if err != nil {
+		if errors.Is(err, queue.ErrQueueNotFound) {
+			http.Error(w, "", http.StatusNotFound)
+		} else if errors.Is(err, queue.ErrWrongQueueType) {
+			http.Error(w, "", http.StatusBadRequest)
+		} else {
+			errorLogger.Println("GET stats QueueManager error:", err)
+			http.Error(w, "", http.StatusInternalServerError)
+		}
+		return
+	}
+	groups, err := h.queueManager.ConsumerGroups(name)
+	if err != nil {
+		if errors.Is(err, queue.ErrQueueNotFound) {
+			// Очередь удалили между запросами статистики
+			http.Error(w, "", http.StatusNotFound)
+		} else {
+			errorLogger.Println("GET stats groups QueueManager error:", err)
+			http.Error(w, "", http.StatusInternalServerError)
+		}
+		return
+	}
+	dto := statsDto{
+		Depth:    stats.Depth,
+		InFlight: stats.InFlight,
+		Waiting:  stats.Waiting,
+		Produced: stats.Produced,
+		Consumed: stats.Consumed,
+		Errors:   stats.Errors,
+		Dropped:  stats.Dropped,
+		Expired:  stats.Expired,
+
+		Suspended:      stats.Suspended,
+		CreatedAt:      stats.CreatedAt.UTC(),
+		LastActivityAt: stats.LastActivityAt.UTC(),
+	}
+	if len(groups) != 0 {
+		dto.Groups = make(map[string]groupStatsDto, len(groups))
+		for _, group := range groups {
+			dto.Groups[group.Name] = groupStatsDto{Members: group.Members, Consumed: group.Consumed, Lag: group.Lag}
+		}
+	}
+	if err := json.NewEncoder(w).Encode(dto); err != nil {
+		errorLogger.Println("GET stats Body JSON encode error:", err)
+		http.Error(w, "", http.StatusInternalServerError)
+	}
+}
+
+func createConfigHandler(queueManager queue.QueueManager) http.Handler {
+	return &configHandlerImpl{
+		queueManager: queueManager,
+	}
+}
+
+// configHandlerImpl обрабатывает POST /queue/{queue}/config, меняя настройки существующей очереди
+type configHandlerImpl struct {
+	queueManager queue.QueueManager
+}
+
+func (h *configHandlerImpl) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("queue")
+	var dto configDto
+	if err := json.NewDecoder(r.Body).Decode(&dto); err != nil {
+		errorLogger.Println("POST config Body JSON decode error:", err)
+		http.Error(w, "", http.StatusBadRequest)
+		return
+	}
+	if dto.MaxMessages <= 0 {
+		http.Error(w, "", http.StatusBadRequest)
+		return
+	}
+	if err := h.queueManager.Resize(name, dto.MaxMessages); err != nil {
+		if errors.Is(err, queue.ErrQueueNotFound) {
+			http.Error(w, "", http.StatusNotFound)
+		} else if errors.Is(err, queue.ErrWrongQueueType) {
+			http.Error(w, "", http.StatusBadRequest)
+		} else if errors.Is(err, queue.ErrTooManyItems) {
+			// Новый лимит меньше текущего числа сообщений в очереди
+			http.Error(w, "", http.StatusConflict)
+		} else {
+			errorLogger.Println("POST config QueueManager error:", err)
+			http.Error(w, "", http.StatusInternalServerError)
+		}
+	}
+}
+
+// createQueueConfigHandler создает обработчики PUT и GET /queue/{queue}/config
+func createQueueConfigHandler(queueManager queue.QueueManager) *queueConfigHandlerImpl {
+	return &queueConfigHandlerImpl{
+		queueManager: queueManager,
+	}
+}
+
+// queueConfigHandlerImpl переопределяет настройки очереди, в том числе еще не созданной, и возвращает действующие
+type queueConfigHandlerImpl struct {
+	queueManager queue.QueueManager
+}
+
+func (h *queueConfigHandlerImpl) servePut(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("queue")
+	var dto queueConfigDto
+	if err := json.NewDecoder(r.Body).Decode(&dto); err != nil {
+		errorLogger.Println("PUT config Body JSON decode error:", err)
+		http.Error(w, "", http.StatusBadRequest)
+		return
+	}
+	config, err := h.queueManager.SetConfig(name, queue.QueueConfig{
+		MaxMessageNum:  dto.MaxMessageNum,
+		OverflowPolicy: queue.OverflowPolicy(dto.OverflowPolicy),
+		TTL:            time.Duration(dto.TTLSeconds) * time.Second,
+
+		MaxConsecutiveFailures: dto.MaxConsecutiveFailures,
+		MaxRetries:             dto.MaxRetries,
+	})
+	if err != nil {
+		if errors.Is(err, queue.ErrInvalidConfig) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		} else if errors.Is(err, queue.ErrWrongQueueType) {
+			http.Error(w, "", http.StatusBadRequest)
+		} else if errors.Is(err, queue.ErrTooManyItems) {
+			// Новый лимит меньше текущего числа сообщений в очереди
+			http.Error(w, "", http.StatusConflict)
+		} else {
+			errorLogger.Println("PUT config QueueManager error:", err)
+			http.Error(w, "", http.StatusInternalServerError)
+		}
+		return
+	}
+	h.writeConfig(w, config)
+}
+
+func (h *queueConfigHandlerImpl) serveGet(w http.ResponseWriter, r *http.Request) {
+	config, err := h.queueManager.Config(r.PathValue("queue"))
+	if err != nil {
+		if errors.Is(err, queue.ErrWrongQueueType) {
+			http.Error(w, "", http.StatusBadRequest)
+		} else {
+			errorLogger.Println("GET config QueueManager error:", err)
+			http.Error(w, "", http.StatusInternalServerError)
+		}
+		return
+	}
+	h.writeConfig(w, config)
+}
+
+func (h *queueConfigHandlerImpl) writeConfig(w http.ResponseWriter, config queue.QueueConfig) {
+	dto := queueConfigDto{
+		MaxMessageNum:  config.MaxMessageNum,
+		OverflowPolicy: string(config.OverflowPolicy),
+		TTLSeconds:     int(config.TTL / time.Second),
+
+		MaxConsecutiveFailures: config.MaxConsecutiveFailures,
+		MaxRetries:             config.MaxRetries,
+	}
+	if err := json.NewEncoder(w).Encode(dto); err != nil {
+		errorLogger.Println("config Body JSON encode error:", err)
+		http.Error(w, "", http.StatusInternalServerError)
+	}
+}
+
+func createMoveHandler(queueManager queue.QueueManager) http.Handler {
+	return &moveHandlerImpl{
+		queueManager: queueManager,
+	}
+}
+
+// moveHandlerImpl обрабатывает POST /queue/{queue}/move?dest=, перекладывая первое сообщение очереди в dest
+type moveHandlerImpl struct {
+	queueManager queue.QueueManager
+}
+
+func (h *moveHandlerImpl) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("queue")
+	dest := r.URL.Query().Get("dest")
+	if dest == "" || dest == name {
+		http.Error(w, "", http.StatusBadRequest)
+		return
+	}
+	if err := h.queueManager.ValidateName(dest); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := h.queueManager.Move(r.Context(), name, dest); err != nil {
+		if errors.Is(err, queue.ErrShuttingDown) {
+			// Очередь удалили или остановили во время переноса, поэтому сообщение в неё уже не вернулось
+			http.Error(w, "", http.StatusServiceUnavailable)
+		} else if errors.Is(err, queue.ErrQueueNotFound) || errors.Is(err, queue.ErrNoMessage) {
+			http.Error(w, "", http.StatusNotFound)
+		} else if errors.Is(err, queue.ErrWrongQueueType) {
+			http.Error(w, "", http.StatusBadRequest)
+		} else if errors.Is(err, queue.ErrTooManyItems) {
+			// Сообщение осталось в исходной очереди
+			http.Error(w, "", http.StatusTooManyRequests)
+		} else if errors.Is(err, queue.ErrQueueSuspended) {
+			// Исходная очередь - очередь недоставленных сообщений приостановленной dest, сообщение осталось в ней
+			http.Error(w, "", http.StatusConflict)
+		} else {
+			errorLogger.Println("POST move QueueManager error:", err)
+			http.Error(w, "", http.StatusInternalServerError)
+		}
+	}
+}
+
+func createReplayHandler(queueManager queue.QueueManager) http.Handler {
+	return &replayHandlerImpl{
+		queueManager: queueManager,
+	}
+}
+
+// replayHandlerImpl обрабатывает POST /queue/{queue}/replay?n=N, возвращая до N сообщений (по умолчанию все)
+// из очереди недоставленных сообщений {queue} в исходную очередь
+type replayHandlerImpl struct {
+	queueManager queue.QueueManager
+}
+
+func (h *replayHandlerImpl) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("queue")
+	limit := 0
+	if nAsStr := r.URL.Query().Get("n"); nAsStr != "" {
+		v, err := strconv.Atoi(nAsStr)
+		if err != nil || v <= 0 {
+			errorLogger.Printf("POST replay n [%s] parse error:%v\n", nAsStr, err)
+			http.Error(w, "", http.StatusBadRequest)
+			return
+		}
+		limit = v
+	}
+	n, err := h.queueManager.Replay(r.Context(), name, limit)
+	if err != nil && (!errors.Is(err, queue.ErrTooManyItems) || errors.Is(err, queue.ErrShuttingDown)) {
+		if errors.Is(err, queue.ErrShuttingDown) {
+			http.Error(w, "", http.StatusServiceUnavailable)
+		} else if errors.Is(err, queue.ErrQueueNotFound) {
+			http.Error(w, "", http.StatusNotFound)
+		} else if errors.Is(err, queue.ErrInvalidQueueName) || errors.Is(err, queue.ErrWrongQueueType) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		} else if errors.Is(err, queue.ErrQueueSuspended) {
+			// Исходная очередь приостановлена и ждет POST /admin/queue/{queue}/resume
+			http.Error(w, "", http.StatusConflict)
+		} else {
+			errorLogger.Println("POST replay QueueManager error:", err)
+			http.Error(w, "", http.StatusInternalServerError)
+		}
+		return
+	}
+	if err != nil {
+		// Исходная очередь заполнилась, остальные сообщения остались в очереди недоставленных сообщений,
+		// а число уже перенесенных клиент получает в теле, как и при полном переносе
+		w.WriteHeader(http.StatusTooManyRequests)
+	}
+	if err := json.NewEncoder(w).Encode(replayDto{Replayed: n}); err != nil {
+		errorLogger.Println("POST replay Body JSON encode error:", err)
 	}
 }
 
-func getName(r *http.Request) string {
-	// Имя очереди ожидается в последнем компоненте пути
-	// В пути должно быть минимум 2 компонента
-	// Пустое имя трактуется вызывающим кодом, как некорретный запрос
-	pathComponets := strings.Split(r.URL.Path, "/")
-	if len(pathComponets) < 2 {
-		return ""
+func createExportHandler(queueManager queue.QueueManager) http.Handler {
+	return &exportHandlerImpl{
+		queueManager: queueManager,
 	}
-	if len(pathComponets[len(pathComponets)-2]) == 0 {
-		return ""
+}
+
+// exportHandlerImpl обрабатывает POST /admin/queue/{queue}/export, возвращая все сообщения очереди без их извлечения
+type exportHandlerImpl struct {
+	queueManager queue.QueueManager
+}
+
+func (h *exportHandlerImpl) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("queue")
+	messages, err := h.queueManager.Snapshot(name)
+	if err != nil {
+		if errors.Is(err, queue.ErrQueueNotFound) {
+			http.Error(w, "", http.StatusNotFound)
+		} else if errors.Is(err, queue.ErrWrongQueueType) {
+			http.Error(w, "", http.StatusBadRequest)
+		} else {
+			errorLogger.Println("POST export QueueManager error:", err)
+			http.Error(w, "", http.StatusInternalServerError)
+		}
+		return
+	}
+	if acceptsNDJSON(r) {
+		if err := writeNDJSON(w, messages); err != nil {
+			errorLogger.Println("POST export NDJSON write error:", err)
+		}
+		return
+	}
+	if messages == nil {
+		// Пустая очередь выгружается как [], а не null
+		messages = []string{}
+	}
+	if err := json.NewEncoder(w).Encode(exportDto{Messages: messages}); err != nil {
+		errorLogger.Println("POST export Body JSON encode error:", err)
+		http.Error(w, "", http.StatusInternalServerError)
+	}
+}
+
+// writeNDJSON пишет каждое сообщение отдельной строкой JSON и сразу отправляет её, чтобы клиент мог обрабатывать
+// сообщения, не дожидаясь конца ответа. Ошибку после начала ответа клиенту уже не передать, поэтому вызывающий
+// её только логирует
+func writeNDJSON(w http.ResponseWriter, messages []string) error {
+	w.Header().Set("Content-Type", contentTypeNDJSON)
+	flusher, _ := w.(http.Flusher)
+	encoder := json.NewEncoder(w)
+	for _, message := range messages {
+		if err := encoder.Encode(message); err != nil {
+			return err
+		}
+		if flusher != nil {
+			flusher.Flush()
+		}
+	}
+	return nil
+}
+
+func createSampleHandler(queueManager queue.QueueManager, maxSize int) http.Handler {
+	return &sampleHandlerImpl{
+		queueManager: queueManager,
+		maxSize:      maxSize,
+	}
+}
+
+// sampleHandlerImpl обрабатывает GET /queue/{queue}/sample?n=K, возвращая выборку сообщений без их извлечения
+type sampleHandlerImpl struct {
+	queueManager queue.QueueManager
+	maxSize      int // больший n уменьшается до maxSize, чтобы выборка из большой очереди не стала её выгрузкой
+}
+
+func (h *sampleHandlerImpl) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("queue")
+	n := defaultSampleSize
+	if nAsStr := r.URL.Query().Get("n"); nAsStr != "" {
+		v, err := strconv.Atoi(nAsStr)
+		if err != nil || v <= 0 {
+			errorLogger.Printf("GET sample n [%s] parse error:%v\n", nAsStr, err)
+			http.Error(w, "", http.StatusBadRequest)
+			return
+		}
+		n = v
+	}
+	messages, err := h.queueManager.Sample(name, min(n, h.maxSize))
+	if err != nil {
+		if errors.Is(err, queue.ErrQueueNotFound) {
+			http.Error(w, "", http.StatusNotFound)
+		} else if errors.Is(err, queue.ErrWrongQueueType) {
+			http.Error(w, "", http.StatusBadRequest)
+		} else {
+			errorLogger.Println("GET sample QueueManager error:", err)
+			http.Error(w, "", http.StatusInternalServerError)
+		}
+		return
+	}
+	if acceptsNDJSON(r) {
+		if err := writeNDJSON(w, messages); err != nil {
+			errorLogger.Println("GET sample NDJSON write error:", err)
+		}
+		return
+	}
+	if messages == nil {
+		messages = []string{}
+	}
+	if err := json.NewEncoder(w).Encode(exportDto{Messages: messages}); err != nil {
+		errorLogger.Println("GET sample Body JSON encode error:", err)
+		http.Error(w, "", http.StatusInternalServerError)
+	}
+}
+
+func createSearchHandler(queueManager queue.QueueManager, acl ACL) http.Handler {
+	return &searchHandlerImpl{
+		queueManager: queueManager,
+		acl:          acl,
+	}
+}
+
+// searchHandlerImpl обрабатывает GET /queues/search?pattern=P&empty=B, возвращая имена и глубину очередей,
+// имена которых подходят под шаблон P в синтаксисе path.Match. Без шаблона возвращаются все очереди.
+// Топики не возвращаются, так как у них нет глубины. С ACL возвращаются только очереди, которые ключ может читать
+type searchHandlerImpl struct {
+	queueManager queue.QueueManager
+	acl          ACL
+}
+
+// searchResultDto задает найденную очередь
+type searchResultDto struct {
+	Name  string `json:"name"`
+	Depth int64  `json:"depth"`
+}
+
+func (h *searchHandlerImpl) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	pattern := r.URL.Query().Get("pattern")
+	if pattern == "" {
+		pattern = "*"
+	}
+	// path.Match сообщает об ошибке в шаблоне и при несовпадении, поэтому проверяем его заранее на пустом имени
+	if _, err := path.Match(pattern, ""); err != nil {
+		http.Error(w, "invalid pattern", http.StatusBadRequest)
+		return
+	}
+	var empty *bool
+	if emptyAsStr := r.URL.Query().Get("empty"); emptyAsStr != "" {
+		v, err := strconv.ParseBool(emptyAsStr)
+		if err != nil {
+			errorLogger.Printf("GET search empty [%s] parse error:%v\n", emptyAsStr, err)
+			http.Error(w, "", http.StatusBadRequest)
+			return
+		}
+		empty = &v
+	}
+	key, _ := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	// List держит блокировку менеджера только на время копирования имен, сопоставление идет уже без неё
+	result := []searchResultDto{}
+	for _, name := range h.queueManager.List() {
+		if matched, _ := path.Match(pattern, name); !matched {
+			continue
+		}
+		if len(h.acl) != 0 && !h.acl.allows(key, name, accessRead) {
+			continue
+		}
+		// Топик или очередь, удаленная после получения списка
+		stats, err := h.queueManager.Stats(name)
+		if err != nil {
+			continue
+		}
+		if empty != nil && *empty != (stats.Depth == 0) {
+			continue
+		}
+		result = append(result, searchResultDto{Name: name, Depth: stats.Depth})
+	}
+	if err := json.NewEncoder(w).Encode(result); err != nil {
+		errorLogger.Println("GET search Body JSON encode error:", err)
+		http.Error(w, "", http.StatusInternalServerError)
+	}
+}
+
+func createPurgeHandler(queueManager queue.QueueManager) http.Handler {
+	return &purgeHandlerImpl{
+		queueManager: queueManager,
+	}
+}
+
+// purgeHandlerImpl обрабатывает POST /queue/{queue}/purge, удаляя все сообщения, но сохраняя очередь
+type purgeHandlerImpl struct {
+	queueManager queue.QueueManager
+}
+
+func (h *purgeHandlerImpl) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("queue")
+	n, err := h.queueManager.Purge(name)
+	if err != nil {
+		if errors.Is(err, queue.ErrQueueNotFound) {
+			http.Error(w, "", http.StatusNotFound)
+		} else if errors.Is(err, queue.ErrWrongQueueType) {
+			http.Error(w, "", http.StatusBadRequest)
+		} else {
+			errorLogger.Println("POST purge QueueManager error:", err)
+			http.Error(w, "", http.StatusInternalServerError)
+		}
+		return
+	}
+	if err := json.NewEncoder(w).Encode(purgeDto{Purged: n}); err != nil {
+		errorLogger.Println("POST purge Body JSON encode error:", err)
+		http.Error(w, "", http.StatusInternalServerError)
+	}
+}
+
+func createImportHandler(queueManager queue.QueueManager) http.Handler {
+	return &importHandlerImpl{
+		queueManager: queueManager,
+	}
+}
+
+// importHandlerImpl обрабатывает POST /admin/queue/{queue}/import, помещая в очередь все сообщения или ни одного
+type importHandlerImpl struct {
+	queueManager queue.QueueManager
+}
+
+func (h *importHandlerImpl) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("queue")
+	var dto exportDto
+	if err := json.NewDecoder(r.Body).Decode(&dto); err != nil {
+		errorLogger.Println("POST import Body JSON decode error:", err)
+		http.Error(w, "", http.StatusBadRequest)
+		return
+	}
+	if err := h.queueManager.PutBatch(r.Context(), name, dto.Messages); err != nil {
+		if errors.Is(err, queue.ErrTooManyItems) {
+			// Сообщения не помещаются в лимит, очередь осталась без изменений
+			http.Error(w, "", http.StatusUnprocessableEntity)
+		} else if errors.Is(err, queue.ErrMessageTooLarge) {
+			http.Error(w, "", http.StatusRequestEntityTooLarge)
+		} else if errors.Is(err, queue.ErrWrongQueueType) {
+			http.Error(w, "", http.StatusBadRequest)
+		} else {
+			errorLogger.Println("POST import QueueManager error:", err)
+			http.Error(w, "", http.StatusInternalServerError)
+		}
+	}
+}
+
+func createAliasHandler(queueManager queue.QueueManager) *aliasHandlerImpl {
+	return &aliasHandlerImpl{
+		queueManager: queueManager,
+	}
+}
+
+// aliasHandlerImpl задает, удаляет и перечисляет псевдонимы очереди {queue}
+type aliasHandlerImpl struct {
+	queueManager queue.QueueManager
+}
+
+// aliasDto задает псевдоним name очереди alias_of
+type aliasDto struct {
+	Name    string `json:"name"`
+	AliasOf string `json:"alias_of"`
+}
+
+func (h *aliasHandlerImpl) serveAdd(w http.ResponseWriter, r *http.Request) {
+	if err := h.queueManager.AddAlias(r.PathValue("queue"), r.PathValue("alias")); err != nil {
+		if errors.Is(err, queue.ErrInvalidAlias) || errors.Is(err, queue.ErrInvalidQueueName) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		} else {
+			errorLogger.Println("POST alias QueueManager error:", err)
+			http.Error(w, "", http.StatusInternalServerError)
+		}
+	}
+}
+
+func (h *aliasHandlerImpl) serveDelete(w http.ResponseWriter, r *http.Request) {
+	if err := h.queueManager.RemoveAlias(r.PathValue("queue"), r.PathValue("alias")); err != nil {
+		if errors.Is(err, queue.ErrQueueNotFound) {
+			http.Error(w, "", http.StatusNotFound)
+		} else {
+			errorLogger.Println("DELETE alias QueueManager error:", err)
+			http.Error(w, "", http.StatusInternalServerError)
+		}
+	}
+}
+
+func (h *aliasHandlerImpl) serveList(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("queue")
+	dto := []aliasDto{}
+	for _, alias := range h.queueManager.Aliases(name) {
+		dto = append(dto, aliasDto{Name: alias, AliasOf: name})
+	}
+	if err := json.NewEncoder(w).Encode(dto); err != nil {
+		errorLogger.Println("GET alias Body JSON encode error:", err)
+		http.Error(w, "", http.StatusInternalServerError)
 	}
-	return pathComponets[len(pathComponets)-1]
 }
@@ -1,6 +1,9 @@
 package handler
 
 import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
 	"context"
 	"encoding/json"
 	"errors"
@@ -8,52 +11,440 @@ import (
 	"io"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"slices"
+	"strconv"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/nebotan/simplebroker/queue"
 )
 
+// retryAfter задает значение заголовка Retry-After для ответов 429 во всех тестах
+const retryAfter = 3
+
 type GetIn struct {
 	callsNum int
+	ctx      context.Context
 	name     string
+	sub      string
+	filter   string
+	ack      bool
 	timeout  int
 }
 
 type PutIn struct {
 	callsNum      int
+	ctx           context.Context
 	name, message string
+	block         bool
+	async         bool
+	hasDeadline   bool
 }
 
 type GetOut struct {
-	message string
-	err     error
+	id         string
+	message    string
+	enqueuedAt time.Time
+	err        error
+}
+
+func (o GetOut) result() (queue.Message, error) {
+	return queue.Message{ID: o.id, Body: o.message, EnqueuedAt: o.enqueuedAt}, o.err
 }
 
 type PutOut struct {
 	err error
 }
 
+type PauseIn struct {
+	pauseCallsNum, resumeCallsNum, unsuspendCallsNum, restartCallsNum int
+	name                                                              string
+}
+
+type PauseOut struct {
+	err error
+}
+
+type BindIn struct {
+	bindCallsNum, unbindCallsNum int
+	name, target                 string
+}
+
+type WebhookIn struct {
+	callsNum  int
+	name, url string
+}
+
+type WebhookOut struct {
+	err error
+}
+
+type DeleteIn struct {
+	callsNum int
+	name     string
+}
+
+type DeleteOut struct {
+	err error
+}
+
+type AckIn struct {
+	callsNum int
+	name, id string
+	nack     bool
+	retry    bool
+}
+
+type AckOut struct {
+	err error
+}
+
+type ResizeIn struct {
+	callsNum int
+	name     string
+	newMax   int
+}
+
+type ResizeOut struct {
+	err error
+}
+
+type SetConfigIn struct {
+	callsNum int
+	name     string
+	config   queue.QueueConfig
+}
+
+type ConfigOut struct {
+	config queue.QueueConfig
+	err    error
+}
+
+type MoveIn struct {
+	callsNum int
+	src      string
+	dest     string
+}
+
+type MoveOut struct {
+	err error
+}
+
+type ReplayIn struct {
+	callsNum int
+	name     string
+	limit    int
+}
+
+type ReplayOut struct {
+	n   int
+	err error
+}
+
+type PurgeIn struct {
+	callsNum int
+	name     string
+}
+
+type PurgeOut struct {
+	purged int
+	err    error
+}
+
+type PutBatchIn struct {
+	callsNum int
+	name     string
+	messages []string
+}
+
+type SampleIn struct {
+	name string
+	n    int
+}
+
+type SnapshotOut struct {
+	messages []string
+	err      error
+}
+
+type StatsOut struct {
+	stats  queue.QueueStats
+	groups []queue.ConsumerGroupStats
+	err    error
+	names  []string                    // результат List
+	byName map[string]queue.QueueStats // если задано, статистика по имени, а для остальных имен - ErrWrongQueueType
+}
+
 type MockQueueManager struct {
-	getIn  GetIn
-	putIn  PutIn
-	getOut GetOut
-	putOut PutOut
+	getIn       GetIn
+	putIn       PutIn
+	pauseIn     PauseIn
+	bindIn      BindIn
+	webhookIn   WebhookIn
+	deleteIn    DeleteIn
+	ackIn       AckIn
+	resizeIn    ResizeIn
+	setConfigIn SetConfigIn
+	moveIn      MoveIn
+	replayIn    ReplayIn
+	purgeIn     PurgeIn
+	putBatchIn  PutBatchIn
+	sampleIn    SampleIn
+	getOut      GetOut
+	putOut      PutOut
+	pauseOut    PauseOut
+	webhookOut  WebhookOut
+	deleteOut   DeleteOut
+	ackOut      AckOut
+	resizeOut   ResizeOut
+	configOut   ConfigOut
+	moveOut     MoveOut
+	replayOut   ReplayOut
+	purgeOut    PurgeOut
+	snapshotOut SnapshotOut
+	statsOut    StatsOut
+}
+
+// setupMux регистрирует обработчики через Setup, чтобы запросы в тестах проходили маршрутизацию mux и PathValue
+func setupMux(queueManager queue.QueueManager, config HandlerConfig) http.Handler {
+	mux := http.NewServeMux()
+	Setup(mux, queueManager, config)
+	return mux
+}
+
+func (m *MockQueueManager) Get(ctx context.Context, name string, timeout int) (queue.Message, error) {
+	m.getIn.callsNum++
+	m.getIn.ctx = ctx
+	m.getIn.name = name
+	m.getIn.timeout = timeout
+	return m.getOut.result()
+}
+
+func (m *MockQueueManager) GetAck(ctx context.Context, name string, timeout int) (queue.Message, error) {
+	m.getIn.callsNum++
+	m.getIn.ctx = ctx
+	m.getIn.name = name
+	m.getIn.ack = true
+	m.getIn.timeout = timeout
+	return m.getOut.result()
+}
+
+func (m *MockQueueManager) Ack(name, id string) error {
+	m.ackIn.callsNum++
+	m.ackIn.name = name
+	m.ackIn.id = id
+	return m.ackOut.err
 }
 
-func (m *MockQueueManager) Get(ctx context.Context, name string, timeout int) (string, error) {
+func (m *MockQueueManager) Nack(name, id string, retry bool) error {
+	m.Ack(name, id)
+	m.ackIn.nack = true
+	m.ackIn.retry = retry
+	return m.ackOut.err
+}
+
+func (m *MockQueueManager) GetSub(ctx context.Context, name, sub string, timeout int) (queue.Message, error) {
 	m.getIn.callsNum++
 	m.getIn.name = name
+	m.getIn.sub = sub
 	m.getIn.timeout = timeout
-	return m.getOut.message, m.getOut.err
+	return m.getOut.result()
+}
+
+func (m *MockQueueManager) Subscribe(name, sub string, filter queue.MessageFilter) error {
+	if filter != nil {
+		m.getIn.filter = filter.String()
+	}
+	return nil
+}
+
+func (m *MockQueueManager) ResumeSub(name, sub, cursor string) ([]queue.Message, error) {
+	return nil, nil
 }
-func (m *MockQueueManager) Put(name, message string) error {
+
+func (m *MockQueueManager) Put(ctx context.Context, name, message string) error {
 	m.putIn.callsNum++
+	m.putIn.ctx = ctx
 	m.putIn.name = name
 	m.putIn.message = message
 	return m.putOut.err
 }
 
+func (m *MockQueueManager) PutBlocking(ctx context.Context, name, message string) error {
+	m.Put(ctx, name, message)
+	m.putIn.block = true
+	_, m.putIn.hasDeadline = ctx.Deadline()
+	return m.putOut.err
+}
+
+func (m *MockQueueManager) PutAsync(ctx context.Context, name, message string) error {
+	m.Put(ctx, name, message)
+	m.putIn.async = true
+	return m.putOut.err
+}
+
+func (m *MockQueueManager) PutBatch(_ context.Context, name string, messages []string) error {
+	m.putBatchIn.callsNum++
+	m.putBatchIn.name = name
+	m.putBatchIn.messages = messages
+	return m.putOut.err
+}
+
+func (m *MockQueueManager) Bind(name, target string) {
+	m.bindIn.bindCallsNum++
+	m.bindIn.name = name
+	m.bindIn.target = target
+}
+
+func (m *MockQueueManager) Unbind(name, target string) {
+	m.bindIn.unbindCallsNum++
+	m.bindIn.name = name
+	m.bindIn.target = target
+}
+
+func (m *MockQueueManager) AddWebhook(name, url string) error {
+	m.webhookIn.callsNum++
+	m.webhookIn.name = name
+	m.webhookIn.url = url
+	return m.webhookOut.err
+}
+
+func (m *MockQueueManager) Pause(name string) error {
+	m.pauseIn.pauseCallsNum++
+	m.pauseIn.name = name
+	return m.pauseOut.err
+}
+
+func (m *MockQueueManager) Resume(name string) error {
+	m.pauseIn.resumeCallsNum++
+	m.pauseIn.name = name
+	return m.pauseOut.err
+}
+
+func (m *MockQueueManager) Unsuspend(name string) error {
+	m.pauseIn.unsuspendCallsNum++
+	m.pauseIn.name = name
+	return m.pauseOut.err
+}
+
+func (m *MockQueueManager) Restart(ctx context.Context, name string) error {
+	m.pauseIn.restartCallsNum++
+	m.pauseIn.name = name
+	return m.pauseOut.err
+}
+
+func (m *MockQueueManager) Delete(name string) error {
+	m.deleteIn.callsNum++
+	m.deleteIn.name = name
+	return m.deleteOut.err
+}
+
+func (m *MockQueueManager) SetConfig(name string, config queue.QueueConfig) (queue.QueueConfig, error) {
+	m.setConfigIn.callsNum++
+	m.setConfigIn.name = name
+	m.setConfigIn.config = config
+	return m.configOut.config, m.configOut.err
+}
+
+func (m *MockQueueManager) Config(_ string) (queue.QueueConfig, error) {
+	return m.configOut.config, m.configOut.err
+}
+
+func (m *MockQueueManager) Resize(name string, newMax int) error {
+	m.resizeIn.callsNum++
+	m.resizeIn.name = name
+	m.resizeIn.newMax = newMax
+	return m.resizeOut.err
+}
+
+func (m *MockQueueManager) Move(_ context.Context, src, dest string) error {
+	m.moveIn.callsNum++
+	m.moveIn.src = src
+	m.moveIn.dest = dest
+	return m.moveOut.err
+}
+
+func (m *MockQueueManager) Replay(_ context.Context, name string, limit int) (int, error) {
+	m.replayIn.callsNum++
+	m.replayIn.name = name
+	m.replayIn.limit = limit
+	return m.replayOut.n, m.replayOut.err
+}
+
+func (m *MockQueueManager) Purge(name string) (int, error) {
+	m.purgeIn.callsNum++
+	m.purgeIn.name = name
+	return m.purgeOut.purged, m.purgeOut.err
+}
+
+func (m *MockQueueManager) Snapshot(name string) ([]string, error) {
+	return m.snapshotOut.messages, m.snapshotOut.err
+}
+
+func (m *MockQueueManager) Sample(name string, n int) ([]string, error) {
+	m.sampleIn.name = name
+	m.sampleIn.n = n
+	return m.snapshotOut.messages, m.snapshotOut.err
+}
+
+func (m *MockQueueManager) Stats(name string) (queue.QueueStats, error) {
+	if m.statsOut.byName != nil {
+		stats, ok := m.statsOut.byName[name]
+		if !ok {
+			return queue.QueueStats{}, queue.ErrWrongQueueType
+		}
+		return stats, nil
+	}
+	return m.statsOut.stats, m.statsOut.err
+}
+
+func (m *MockQueueManager) ConsumerGroups(name string) ([]queue.ConsumerGroupStats, error) {
+	return m.statsOut.groups, m.statsOut.err
+}
+
+func (m *MockQueueManager) List() []string {
+	return m.statsOut.names
+}
+
+func (m *MockQueueManager) AddAlias(_, _ string) error {
+	return nil
+}
+
+func (m *MockQueueManager) RemoveAlias(_, _ string) error {
+	return nil
+}
+
+func (m *MockQueueManager) Aliases(string) []string {
+	return nil
+}
+
+func (m *MockQueueManager) Begin() queue.Transaction {
+	return nil
+}
+
+func (m *MockQueueManager) EnsureQueue(_ string) (bool, error) {
+	return false, nil
+}
+
+func (m *MockQueueManager) CreatePartitioned(_ string, _ int) error {
+	return nil
+}
+
+func (m *MockQueueManager) MessageWait(string) (queue.HistogramStats, error) {
+	return queue.HistogramStats{}, nil
+}
+
+func (m *MockQueueManager) WaitLatency() queue.WaitLatencyStats {
+	return queue.WaitLatencyStats{}
+}
+
+func (m *MockQueueManager) ValidateName(name string) error {
+	return queue.ValidateQueueName(name)
+}
+
 func (m *MockQueueManager) Stop() {
 }
 
@@ -62,15 +453,84 @@ func (m *MockQueueManager) Stop() {
 
  */
 
+// TestGetMessageAge проверяет заголовки с моментом приема сообщения и его возрастом на момент выдачи
+func TestGetMessageAge(t *testing.T) {
+	for _, delay := range []time.Duration{0, 2 * time.Second} {
+		t.Run(delay.String(), func(t *testing.T) {
+			enqueuedAt := time.Now().Add(-delay)
+			manager := &MockQueueManager{getOut: GetOut{message: "message1", enqueuedAt: enqueuedAt}}
+			handler := setupMux(manager, HandlerConfig{DefaultTimeout: 1, RetryAfter: retryAfter})
+
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodGet, "/queue/name1", nil)
+			handler.ServeHTTP(w, req)
+
+			if w.Code != http.StatusOK {
+				t.Fatalf("wrong status code: got %v want %v", w.Code, http.StatusOK)
+			}
+			got, err := time.Parse(time.RFC3339Nano, w.Header().Get("X-Enqueued-At"))
+			if err != nil {
+				t.Fatalf("X-Enqueued-At parse error: %v", err)
+			}
+			if !got.Equal(enqueuedAt) {
+				t.Errorf("wrong X-Enqueued-At: got [%v] want [%v]", got, enqueuedAt)
+			}
+			age, err := strconv.ParseInt(w.Header().Get("X-Message-Age-Ms"), 10, 64)
+			if err != nil {
+				t.Fatalf("X-Message-Age-Ms parse error: %v", err)
+			}
+			if age < delay.Milliseconds() || age > delay.Milliseconds()+1000 {
+				t.Errorf("wrong X-Message-Age-Ms: got %v want about %v", age, delay.Milliseconds())
+			}
+		})
+	}
+}
+
+// TestGetFillRatio проверяет, что заголовки X-Queue-Fill-Ratio и X-Queue-Depth показывают заполненность очереди после выдачи
+func TestGetFillRatio(t *testing.T) {
+	const N = 10
+	manager := queue.NewQueueManager(queue.QueueManagerConfig{MaxQueueNum: 10, MaxMessageNumPerQueue: N})
+	defer manager.Stop()
+	handler := setupMux(manager, HandlerConfig{DefaultTimeout: 1, RetryAfter: retryAfter})
+	for range N {
+		if err := manager.Put(context.Background(), "name1", "message"); err != nil {
+			t.Fatalf("unexpected error at Put [%v]", err)
+		}
+	}
+
+	for _, expected := range []struct{ ratio, depth string }{{"0.900", "9"}, {"0.800", "8"}} {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/queue/name1", nil)
+		handler.ServeHTTP(w, req)
+
+		if w.Code != http.StatusOK {
+			t.Fatalf("wrong status code: got %v want %v", w.Code, http.StatusOK)
+		}
+		if ratio := w.Header().Get("X-Queue-Fill-Ratio"); ratio != expected.ratio {
+			t.Errorf("wrong X-Queue-Fill-Ratio: got %v want %v", ratio, expected.ratio)
+		}
+		if depth := w.Header().Get("X-Queue-Depth"); depth != expected.depth {
+			t.Errorf("wrong X-Queue-Depth: got %v want %v", depth, expected.depth)
+		}
+	}
+}
+
 func TestValidGetRequests(t *testing.T) {
 	testCases := []struct {
 		description    string
 		httpCode       int
 		name           string
+		sub            string
+		filter         string
+		group          string
+		consumer       string // заголовок X-Consumer-Id
+		ack            bool
 		timeout        int
 		defaultTimeout int
+		id             string
 		message        string
 		err            error
+		queueNotFound  bool
 	}{
 		{
 			description: "OK with explicit timeout",
@@ -87,6 +547,14 @@ func TestValidGetRequests(t *testing.T) {
 			message:     "message2",
 			err:         queue.ErrNoMessage,
 		},
+		{
+			description:   "No queue",
+			httpCode:      http.StatusNotFound,
+			name:          "name_missing",
+			timeout:       7,
+			err:           queue.ErrQueueNotFound,
+			queueNotFound: true,
+		},
 		{
 			description:    "OK with default timeout",
 			httpCode:       http.StatusOK,
@@ -94,6 +562,13 @@ func TestValidGetRequests(t *testing.T) {
 			defaultTimeout: 10,
 			message:        "message3",
 		},
+		{
+			description:    "No message with default timeout",
+			httpCode:       http.StatusNotFound,
+			name:           "name3",
+			defaultTimeout: 4,
+			err:            queue.ErrNoMessage,
+		},
 		{
 			description: "Some error",
 			httpCode:    http.StatusInternalServerError,
@@ -102,25 +577,150 @@ func TestValidGetRequests(t *testing.T) {
 			message:     "message4",
 			err:         errors.New("Some error"),
 		},
+		{
+			description: "OK with subscription",
+			httpCode:    http.StatusOK,
+			name:        "name5",
+			sub:         "sub5",
+			timeout:     3,
+			message:     "message5",
+		},
+		{
+			description: "Subscription to queue",
+			httpCode:    http.StatusBadRequest,
+			name:        "name6",
+			sub:         "sub6",
+			timeout:     3,
+			err:         queue.ErrWrongQueueType,
+		},
+		{
+			description: "Client gone",
+			httpCode:    statusClientClosedRequest,
+			name:        "name_canceled",
+			timeout:     3,
+			err:         queue.ErrCanceled,
+		},
+		{
+			description: "Too many waiters",
+			httpCode:    http.StatusServiceUnavailable,
+			name:        "name_waiters",
+			timeout:     3,
+			err:         queue.ErrTooManyWaiters,
+		},
+		{
+			description: "Queue suspended",
+			httpCode:    http.StatusConflict,
+			name:        "name_suspended",
+			timeout:     3,
+			err:         queue.ErrQueueSuspended,
+		},
+		{
+			description: "Queue stopped while waiting",
+			httpCode:    http.StatusServiceUnavailable,
+			name:        "name_stopped",
+			timeout:     3,
+			err:         queue.ErrShuttingDown,
+		},
+		{
+			description: "Too many subscriptions",
+			httpCode:    http.StatusTooManyRequests,
+			name:        "name7",
+			sub:         "sub7",
+			timeout:     3,
+			err:         queue.ErrTooManyItems,
+		},
+		{
+			description: "OK with group",
+			httpCode:    http.StatusOK,
+			name:        "name_group",
+			group:       "workers",
+			timeout:     3,
+			message:     "message_group",
+		},
+		{
+			description: "OK with group and ack",
+			httpCode:    http.StatusOK,
+			name:        "name_group",
+			group:       "workers",
+			ack:         true,
+			timeout:     3,
+			id:          "9",
+			message:     "message_group",
+		},
+		{
+			description: "OK with consumer",
+			httpCode:    http.StatusOK,
+			name:        "name_consumer",
+			consumer:    "worker1",
+			timeout:     3,
+			message:     "message_consumer",
+		},
+		{
+			description: "OK with filter",
+			httpCode:    http.StatusOK,
+			name:        "name_filter",
+			sub:         "orders",
+			filter:      "prefix:orders.",
+			timeout:     3,
+			message:     "orders.1",
+		},
+		{
+			description: "Subscription with other filter",
+			httpCode:    http.StatusBadRequest,
+			name:        "name_filter",
+			sub:         "orders",
+			filter:      "prefix:payments.",
+			timeout:     3,
+			err:         queue.ErrInvalidFilter,
+		},
+		{
+			description: "OK with ack",
+			httpCode:    http.StatusOK,
+			name:        "name8",
+			ack:         true,
+			timeout:     3,
+			id:          "8",
+			message:     "message8",
+		},
 	}
 	for _, tc := range testCases {
 		t.Run(tc.description, func(t *testing.T) {
-			manager := &MockQueueManager{getOut: GetOut{message: tc.message, err: tc.err}}
-			handler := createHandler(manager, tc.defaultTimeout)
+			manager := &MockQueueManager{getOut: GetOut{id: tc.id, message: tc.message, err: tc.err}}
+			handler := setupMux(manager, HandlerConfig{DefaultTimeout: tc.defaultTimeout, RetryAfter: retryAfter})
 
 			w := httptest.NewRecorder()
-			var url string
+			query := url.Values{}
 			if tc.timeout != 0 {
-				url = fmt.Sprintf("/queue/%s?timeout=%d", tc.name, tc.timeout)
-			} else {
-				url = fmt.Sprintf("/queue/%s", tc.name)
+				query.Set("timeout", strconv.Itoa(tc.timeout))
+			}
+			if tc.sub != "" {
+				query.Set("sub", tc.sub)
+			}
+			if tc.filter != "" {
+				query.Set("filter", tc.filter)
+			}
+			if tc.group != "" {
+				query.Set("group", tc.group)
+			}
+			if tc.ack {
+				query.Set("ack", "true")
+			}
+			reqURL := fmt.Sprintf("/queue/%s", tc.name)
+			if len(query) != 0 {
+				reqURL += "?" + query.Encode()
+			}
+			req := httptest.NewRequest(http.MethodGet, reqURL, nil)
+			if tc.consumer != "" {
+				req.Header.Set("X-Consumer-Id", tc.consumer)
 			}
-			req := httptest.NewRequest(http.MethodGet, url, nil)
 			handler.ServeHTTP(w, req)
 
 			if w.Code != tc.httpCode {
 				t.Errorf("wrong status code: got %v want %v", w.Code, tc.httpCode)
 			}
+			if notFound := w.Header().Get("X-Queue-Not-Found") == "true"; notFound != tc.queueNotFound {
+				t.Errorf("wrong X-Queue-Not-Found: got %v want %v", notFound, tc.queueNotFound)
+			}
 			if manager.getIn.callsNum != 1 {
 				t.Errorf("wrong GET calls number: got %v want %v", manager.getIn.callsNum, 1)
 			}
@@ -130,6 +730,23 @@ func TestValidGetRequests(t *testing.T) {
 			if manager.getIn.name != tc.name {
 				t.Errorf("wrong status code: got %v want %v", manager.getIn.name, tc.name)
 			}
+			if manager.getIn.sub != tc.sub {
+				t.Errorf("wrong subscription: got %v want %v", manager.getIn.sub, tc.sub)
+			}
+			if manager.getIn.filter != tc.filter {
+				t.Errorf("wrong filter: got %v want %v", manager.getIn.filter, tc.filter)
+			}
+			if manager.getIn.ctx != nil {
+				if group := queue.ConsumerGroupFromContext(manager.getIn.ctx); group != tc.group {
+					t.Errorf("wrong group: got %v want %v", group, tc.group)
+				}
+				if consumer := queue.ConsumerIDFromContext(manager.getIn.ctx); consumer != tc.consumer {
+					t.Errorf("wrong consumer: got %v want %v", consumer, tc.consumer)
+				}
+			}
+			if manager.getIn.ack != tc.ack {
+				t.Errorf("wrong ack: got %v want %v", manager.getIn.ack, tc.ack)
+			}
 			effectiveTimeout := tc.timeout
 			if effectiveTimeout == 0 {
 				effectiveTimeout = tc.defaultTimeout
@@ -137,6 +754,10 @@ func TestValidGetRequests(t *testing.T) {
 			if manager.getIn.timeout != effectiveTimeout {
 				t.Errorf("wrong timeout : got %v want %v", manager.getIn.timeout, effectiveTimeout)
 			}
+			// Клиент видит примененный таймаут и в ответе 404, и в ответе с сообщением
+			if timeoutUsed := w.Header().Get("X-Timeout-Used"); timeoutUsed != strconv.Itoa(effectiveTimeout) {
+				t.Errorf("wrong X-Timeout-Used: got %v want %v", timeoutUsed, effectiveTimeout)
+			}
 			if manager.getOut.message != tc.message {
 				t.Errorf("wrong message: got %v want %v", manager.getOut.message, tc.message)
 			}
@@ -154,6 +775,9 @@ func TestValidGetRequests(t *testing.T) {
 				if dto.Message != tc.message {
 					t.Errorf("wrong message: got %v want %v", dto.Message, tc.message)
 				}
+				if dto.ID != tc.id {
+					t.Errorf("wrong id: got %v want %v", dto.ID, tc.id)
+				}
 			} else {
 				bytes, _ := io.ReadAll(res.Body)
 				if string(bytes) != "\n" {
@@ -169,14 +793,6 @@ func TestInvalidGetRequests(t *testing.T) {
 		description string
 		url         string
 	}{
-		{
-			description: "Name is empty",
-			url:         "/queue/",
-		},
-		{
-			description: "Name is missed",
-			url:         "/queue",
-		},
 		{
 			description: "Timeout is not a number",
 			url:         "/queue/name1?timeout=some_string",
@@ -189,12 +805,32 @@ func TestInvalidGetRequests(t *testing.T) {
 			description: "Timeout is zero",
 			url:         "/queue/name3?timeout=0",
 		},
+		{
+			description: "Ack is not a boolean",
+			url:         "/queue/name4?ack=some_string",
+		},
+		{
+			description: "Ack with subscription",
+			url:         "/queue/name5?ack=true&sub=sub5",
+		},
+		{
+			description: "Group with subscription",
+			url:         "/queue/name8?sub=sub8&group=workers",
+		},
+		{
+			description: "Filter without subscription",
+			url:         "/queue/name6?filter=prefix:orders.",
+		},
+		{
+			description: "Unknown filter",
+			url:         "/queue/name7?sub=sub7&filter=regexp:orders",
+		},
 	}
 	for _, tc := range testCases {
 		t.Run(tc.description, func(t *testing.T) {
 			manager := &MockQueueManager{}
 			const defaultTimeout = 10
-			handler := createHandler(manager, defaultTimeout)
+			handler := setupMux(manager, HandlerConfig{DefaultTimeout: defaultTimeout, RetryAfter: retryAfter})
 
 			w := httptest.NewRecorder()
 			req := httptest.NewRequest(http.MethodGet, tc.url, nil)
@@ -232,11 +868,13 @@ func TestValidPutRequests(t *testing.T) {
 		{
 			description: "Too many requests",
 			httpCode:    http.StatusTooManyRequests,
+			name:        "name2",
 			err:         queue.ErrTooManyItems,
 		},
 		{
 			description: "Some unexpected error",
 			httpCode:    http.StatusInternalServerError,
+			name:        "name3",
 			err:         errors.New("Some unxepected error"),
 		},
 	}
@@ -248,7 +886,7 @@ func TestValidPutRequests(t *testing.T) {
 				},
 			}
 			const defaultTimeout = 10
-			handler := createHandler(manager, defaultTimeout)
+			handler := setupMux(manager, HandlerConfig{DefaultTimeout: defaultTimeout, RetryAfter: retryAfter})
 
 			w := httptest.NewRecorder()
 			body := strings.NewReader(fmt.Sprintf(`{"message": "%s"}`, tc.message))
@@ -275,6 +913,19 @@ func TestValidPutRequests(t *testing.T) {
 			if !errors.Is(manager.putOut.err, tc.err) {
 				t.Errorf("wrong error: got %v want %v", manager.getOut.err, tc.err)
 			}
+			if w.Code == http.StatusTooManyRequests {
+				v, err := strconv.Atoi(w.Header().Get("Retry-After"))
+				if err != nil {
+					t.Errorf("Retry-After parse error: %v", err)
+				}
+				if v != retryAfter {
+					t.Errorf("wrong Retry-After: got %v want %v", v, retryAfter)
+				}
+			}
+			// Ошибка должна быть записана в ответ один раз
+			if body := w.Body.String(); w.Code != http.StatusOK && body != "\n" {
+				t.Errorf("responce body is expected to be empty with \n but got: [%s]", body)
+			}
 		})
 	}
 }
@@ -285,14 +936,6 @@ func TestInvalidPutRequests(t *testing.T) {
 		url         string
 		body        string
 	}{
-		{
-			description: "Name is empty",
-			url:         "/queue/",
-		},
-		{
-			description: "Name is missed",
-			url:         "/queue",
-		},
 		{
 			description: "JSON with invalid syntax 1",
 			url:         "/queue/name1",
@@ -308,7 +951,7 @@ func TestInvalidPutRequests(t *testing.T) {
 		t.Run(tc.description, func(t *testing.T) {
 			manager := &MockQueueManager{}
 			const defaultTimeout = 10
-			handler := createHandler(manager, defaultTimeout)
+			handler := setupMux(manager, HandlerConfig{DefaultTimeout: defaultTimeout, RetryAfter: retryAfter})
 
 			w := httptest.NewRecorder()
 			body := strings.NewReader(tc.body)
@@ -329,3 +972,2435 @@ func TestInvalidPutRequests(t *testing.T) {
 		})
 	}
 }
+
+func TestEmptyMessages(t *testing.T) {
+	testCases := []struct {
+		description string
+		reject      bool
+		body        string
+		httpCode    int
+		response    string
+		putCalls    int
+	}{
+		{
+			description: "Empty message allowed by default",
+			body:        `{"message": ""}`,
+			httpCode:    http.StatusOK,
+			putCalls:    1,
+		},
+		{
+			description: "Missing message allowed by default",
+			body:        `{}`,
+			httpCode:    http.StatusOK,
+			putCalls:    1,
+		},
+		{
+			description: "Empty message rejected",
+			reject:      true,
+			body:        `{"message": ""}`,
+			httpCode:    http.StatusBadRequest,
+			response:    "{\"error\":\"empty message not allowed\"}\n",
+		},
+		{
+			description: "Missing message rejected",
+			reject:      true,
+			body:        `{}`,
+			httpCode:    http.StatusBadRequest,
+			response:    "{\"error\":\"empty message not allowed\"}\n",
+		},
+		{
+			description: "Whitespace message accepted",
+			reject:      true,
+			body:        `{"message": " "}`,
+			httpCode:    http.StatusOK,
+			putCalls:    1,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			manager := &MockQueueManager{}
+			handler := setupMux(manager, HandlerConfig{DefaultTimeout: 1, RetryAfter: retryAfter, RejectEmptyMessages: tc.reject})
+
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodPut, "/queue/name1", strings.NewReader(tc.body))
+			handler.ServeHTTP(w, req)
+
+			if w.Code != tc.httpCode {
+				t.Errorf("wrong status code: got %v want %v", w.Code, tc.httpCode)
+			}
+			if manager.putIn.callsNum != tc.putCalls {
+				t.Errorf("wrong PUT calls number: got %v want %v", manager.putIn.callsNum, tc.putCalls)
+			}
+			if tc.response != "" && w.Body.String() != tc.response {
+				t.Errorf("wrong response: got %q want %q", w.Body.String(), tc.response)
+			}
+		})
+	}
+}
+
+func TestBlockingPutRequests(t *testing.T) {
+	testCases := []struct {
+		description      string
+		url              string
+		err              error
+		httpCode         int
+		expectedCallsNum int
+		expectedBlock    bool
+	}{
+		{
+			description:      "Blocking",
+			url:              "/queue/name1?block=true",
+			httpCode:         http.StatusOK,
+			expectedCallsNum: 1,
+			expectedBlock:    true,
+		},
+		{
+			description:      "Blocking with timeout",
+			url:              "/queue/name1?block=1&timeout=3",
+			httpCode:         http.StatusOK,
+			expectedCallsNum: 1,
+			expectedBlock:    true,
+		},
+		{
+			description:      "Not blocking",
+			url:              "/queue/name1?block=false",
+			httpCode:         http.StatusOK,
+			expectedCallsNum: 1,
+		},
+		{
+			description:      "No space before timeout",
+			url:              "/queue/name1?block=true",
+			err:              queue.ErrTooManyItems,
+			httpCode:         http.StatusTooManyRequests,
+			expectedCallsNum: 1,
+			expectedBlock:    true,
+		},
+		{
+			description:      "Canceled",
+			url:              "/queue/name1?block=true",
+			err:              queue.ErrCanceled,
+			httpCode:         statusClientClosedRequest,
+			expectedCallsNum: 1,
+			expectedBlock:    true,
+		},
+		{
+			description: "Invalid block",
+			url:         "/queue/name1?block=maybe",
+			httpCode:    http.StatusBadRequest,
+		},
+		{
+			description: "Invalid timeout",
+			url:         "/queue/name1?block=true&timeout=0",
+			httpCode:    http.StatusBadRequest,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			manager := &MockQueueManager{putOut: PutOut{err: tc.err}}
+			handler := setupMux(manager, HandlerConfig{DefaultTimeout: 1, RetryAfter: retryAfter})
+
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodPut, tc.url, strings.NewReader(`{"message": "message1"}`))
+			handler.ServeHTTP(w, req)
+
+			if w.Code != tc.httpCode {
+				t.Errorf("wrong status code: got %v want %v", w.Code, tc.httpCode)
+			}
+			if manager.putIn.callsNum != tc.expectedCallsNum {
+				t.Errorf("wrong PUT calls number: got %v want %v", manager.putIn.callsNum, tc.expectedCallsNum)
+			}
+			if manager.putIn.block != tc.expectedBlock {
+				t.Errorf("wrong block: got %v want %v", manager.putIn.block, tc.expectedBlock)
+			}
+			// Ожидание места всегда ограничено таймаутом
+			if manager.putIn.block && !manager.putIn.hasDeadline {
+				t.Errorf("blocking PUT without deadline")
+			}
+		})
+	}
+}
+
+func TestUnconfirmedPutRequests(t *testing.T) {
+	testCases := []struct {
+		description      string
+		url              string
+		err              error
+		httpCode         int
+		expectedCallsNum int
+		expectedAsync    bool
+	}{
+		{
+			description:      "Unconfirmed",
+			url:              "/queue/name1?confirm=false",
+			httpCode:         http.StatusAccepted,
+			expectedCallsNum: 1,
+			expectedAsync:    true,
+		},
+		{
+			description:      "Confirmed",
+			url:              "/queue/name1?confirm=true",
+			httpCode:         http.StatusOK,
+			expectedCallsNum: 1,
+		},
+		{
+			description:      "Buffer full",
+			url:              "/queue/name1?confirm=false",
+			err:              queue.ErrTooManyItems,
+			httpCode:         http.StatusTooManyRequests,
+			expectedCallsNum: 1,
+			expectedAsync:    true,
+		},
+		{
+			description:      "Topic",
+			url:              "/queue/name1?confirm=false",
+			err:              queue.ErrWrongQueueType,
+			httpCode:         http.StatusBadRequest,
+			expectedCallsNum: 1,
+			expectedAsync:    true,
+		},
+		{
+			description: "Invalid confirm",
+			url:         "/queue/name1?confirm=maybe",
+			httpCode:    http.StatusBadRequest,
+		},
+		{
+			description: "Blocking",
+			url:         "/queue/name1?confirm=false&block=true",
+			httpCode:    http.StatusBadRequest,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			manager := &MockQueueManager{putOut: PutOut{err: tc.err}}
+			handler := setupMux(manager, HandlerConfig{DefaultTimeout: 1, RetryAfter: retryAfter})
+
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodPut, tc.url, strings.NewReader(`{"message": "message1"}`))
+			handler.ServeHTTP(w, req)
+
+			if w.Code != tc.httpCode {
+				t.Errorf("wrong status code: got %v want %v", w.Code, tc.httpCode)
+			}
+			if manager.putIn.callsNum != tc.expectedCallsNum {
+				t.Errorf("wrong PUT calls number: got %v want %v", manager.putIn.callsNum, tc.expectedCallsNum)
+			}
+			if manager.putIn.async != tc.expectedAsync {
+				t.Errorf("wrong async: got %v want %v", manager.putIn.async, tc.expectedAsync)
+			}
+		})
+	}
+}
+
+func TestMessageSizeLimit(t *testing.T) {
+	testCases := []struct {
+		description      string
+		config           HandlerConfig
+		message          string
+		body             io.Reader // тело запроса вместо JSON с message
+		gzip             bool
+		err              error
+		httpCode         int
+		expectedCallsNum int
+	}{
+		{
+			description:      "Below default body limit",
+			message:          strings.Repeat("a", 100_000),
+			httpCode:         http.StatusOK,
+			expectedCallsNum: 1,
+		},
+		{
+			description: "Endless body over default body limit",
+			// Незакрытая строка JSON не дает разбору завершиться раньше, чем сработает ограничение
+			body:     io.MultiReader(strings.NewReader(`{"message": "`), io.LimitReader(repeatReader('a'), defaultMaxBodyBytes)),
+			httpCode: http.StatusRequestEntityTooLarge,
+		},
+		{
+			description:      "No limit",
+			config:           HandlerConfig{MaxBodyBytes: -1},
+			message:          strings.Repeat("a", 100_000),
+			httpCode:         http.StatusOK,
+			expectedCallsNum: 1,
+		},
+		{
+			description: "Malformed JSON below limit",
+			config:      HandlerConfig{MaxBodyBytes: 1000},
+			body:        strings.NewReader(`{"message": "a"`),
+			httpCode:    http.StatusBadRequest,
+		},
+		{
+			description:      "Message at the limit",
+			config:           HandlerConfig{MaxMessageBytes: 100},
+			message:          strings.Repeat("a", 100),
+			httpCode:         http.StatusOK,
+			expectedCallsNum: 1,
+		},
+		{
+			description:      "Escaped message at the limit",
+			config:           HandlerConfig{MaxMessageBytes: 100},
+			message:          strings.Repeat(`"`, 100),
+			httpCode:         http.StatusOK,
+			expectedCallsNum: 1,
+		},
+		{
+			description:      "Rejected by queue",
+			config:           HandlerConfig{MaxMessageBytes: 100},
+			message:          strings.Repeat("a", 101),
+			err:              queue.ErrMessageTooLarge,
+			httpCode:         http.StatusRequestEntityTooLarge,
+			expectedCallsNum: 1,
+		},
+		{
+			description: "Body over message limit",
+			config:      HandlerConfig{MaxMessageBytes: 100},
+			message:     strings.Repeat("a", 100+messageOverheadBytes),
+			httpCode:    http.StatusRequestEntityTooLarge,
+		},
+		{
+			description: "Body over explicit limit",
+			config:      HandlerConfig{MaxMessageBytes: 100, MaxBodyBytes: 50},
+			message:     strings.Repeat("a", 60),
+			httpCode:    http.StatusRequestEntityTooLarge,
+		},
+		{
+			description: "Decompressed body over limit",
+			config:      HandlerConfig{MaxBodyBytes: 1000},
+			message:     strings.Repeat("a", 10_000),
+			gzip:        true,
+			httpCode:    http.StatusRequestEntityTooLarge,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			manager := &MockQueueManager{putOut: PutOut{err: tc.err}}
+			handler := setupMux(manager, tc.config)
+
+			data, err := json.Marshal(messageDto{Message: tc.message})
+			if err != nil {
+				t.Fatalf("marshal error: %v", err)
+			}
+			if tc.gzip {
+				var buf bytes.Buffer
+				zw := gzip.NewWriter(&buf)
+				zw.Write(data)
+				zw.Close()
+				data = buf.Bytes()
+			}
+			var body io.Reader = bytes.NewReader(data)
+			if tc.body != nil {
+				body = tc.body
+			}
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodPut, "/queue/name1", body)
+			if tc.gzip {
+				req.Header.Set("Content-Encoding", "gzip")
+			}
+			handler.ServeHTTP(w, req)
+
+			if w.Code != tc.httpCode {
+				t.Errorf("wrong status code: got %v want %v", w.Code, tc.httpCode)
+			}
+			if manager.putIn.callsNum != tc.expectedCallsNum {
+				t.Errorf("wrong PUT calls number: got %v want %v", manager.putIn.callsNum, tc.expectedCallsNum)
+			}
+		})
+	}
+}
+
+// repeatReader бесконечно отдает один и тот же байт
+type repeatReader byte
+
+func (r repeatReader) Read(p []byte) (int, error) {
+	for i := range p {
+		p[i] = byte(r)
+	}
+	return len(p), nil
+}
+
+// TestPostRequests проверяет, что POST кладет сообщение в очередь так же, как PUT
+func TestPostRequests(t *testing.T) {
+	manager := queue.NewQueueManager(queue.QueueManagerConfig{MaxQueueNum: 10, MaxMessageNumPerQueue: 10})
+	defer manager.Stop()
+	handler := setupMux(manager, HandlerConfig{DefaultTimeout: 1, RetryAfter: retryAfter})
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/queue/name1", strings.NewReader(`{"message": "message1"}`))
+	handler.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("wrong POST status code: got %v want %v", w.Code, http.StatusOK)
+	}
+
+	w = httptest.NewRecorder()
+	req = httptest.NewRequest(http.MethodGet, "/queue/name1", nil)
+	handler.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("wrong GET status code: got %v want %v", w.Code, http.StatusOK)
+	}
+	var m messageDto
+	if err := json.NewDecoder(w.Body).Decode(&m); err != nil {
+		t.Fatalf("GET body decode error: %v", err)
+	}
+	if m.Message != "message1" {
+		t.Errorf("wrong message: got %v want %v", m.Message, "message1")
+	}
+
+	// Параметры PUT действуют и для POST
+	w = httptest.NewRecorder()
+	req = httptest.NewRequest(http.MethodPost, "/queue/name1?confirm=false", strings.NewReader(`{"message": "message2"}`))
+	handler.ServeHTTP(w, req)
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("wrong unconfirmed POST status code: got %v want %v", w.Code, http.StatusAccepted)
+	}
+	if message, err := manager.Get(context.Background(), "name1", 1); err != nil || message.Body != "message2" {
+		t.Errorf("wrong Get: got [%v] [%v] want [message2]", message.Body, err)
+	}
+
+	// Неподдерживаемый метод получает список допустимых, в том числе POST
+	w = httptest.NewRecorder()
+	req = httptest.NewRequest(http.MethodPatch, "/queue/name1", nil)
+	handler.ServeHTTP(w, req)
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Fatalf("wrong PATCH status code: got %v want %v", w.Code, http.StatusMethodNotAllowed)
+	}
+	allow := strings.Split(w.Header().Get("Allow"), ", ")
+	for _, method := range []string{http.MethodGet, http.MethodPut, http.MethodPost, http.MethodDelete} {
+		if !slices.Contains(allow, method) {
+			t.Errorf("method %v is missed in Allow: %v", method, allow)
+		}
+	}
+}
+
+// TestCreateRequests проверяет, что POST без тела создает пустую очередь, не кладя в неё сообщений
+func TestCreateRequests(t *testing.T) {
+	manager := queue.NewQueueManager(queue.QueueManagerConfig{MaxQueueNum: 1, MaxMessageNumPerQueue: 10})
+	defer manager.Stop()
+	handler := setupMux(manager, HandlerConfig{DefaultTimeout: 1, RetryAfter: retryAfter})
+
+	// Шаги выполняются по порядку на одном менеджере
+	testCases := []struct {
+		description string
+		name        string
+		httpCode    int
+	}{
+		{
+			description: "Created",
+			name:        "name1",
+			httpCode:    http.StatusCreated,
+		},
+		{
+			description: "Already exists",
+			name:        "name1",
+			httpCode:    http.StatusOK,
+		},
+		{
+			description: "Too many queues",
+			name:        "name2",
+			httpCode:    http.StatusTooManyRequests,
+		},
+	}
+	for _, tc := range testCases {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, "/queue/"+tc.name, nil)
+		handler.ServeHTTP(w, req)
+		if w.Code != tc.httpCode {
+			t.Errorf("%s: wrong status code: got %v want %v", tc.description, w.Code, tc.httpCode)
+		}
+	}
+
+	stats, err := manager.Stats("name1")
+	if err != nil {
+		t.Fatalf("unexpected Stats error: %v", err)
+	}
+	if stats.Depth != 0 {
+		t.Errorf("wrong depth: got %v want 0", stats.Depth)
+	}
+}
+
+// TestCreateChunkedRequests проверяет, что POST с Transfer-Encoding: chunked создает очередь, только если тело пустое
+func TestCreateChunkedRequests(t *testing.T) {
+	testCases := []struct {
+		description string
+		body        string
+		httpCode    int
+		depth       int64
+	}{
+		{
+			description: "Empty body",
+			httpCode:    http.StatusCreated,
+		},
+		{
+			description: "Message",
+			body:        `{"message": "message1"}`,
+			httpCode:    http.StatusOK,
+			depth:       1,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			manager := queue.NewQueueManager(queue.QueueManagerConfig{MaxQueueNum: 1, MaxMessageNumPerQueue: 10})
+			defer manager.Stop()
+			handler := setupMux(manager, HandlerConfig{DefaultTimeout: 1, RetryAfter: retryAfter})
+
+			w := httptest.NewRecorder()
+			// Тело без известной длины, как у запроса с Transfer-Encoding: chunked
+			req := httptest.NewRequest(http.MethodPost, "/queue/name1", io.NopCloser(strings.NewReader(tc.body)))
+			req.TransferEncoding = []string{"chunked"}
+			if req.ContentLength != -1 {
+				t.Fatalf("wrong ContentLength: got %v want -1", req.ContentLength)
+			}
+			handler.ServeHTTP(w, req)
+
+			if w.Code != tc.httpCode {
+				t.Errorf("wrong status code: got %v want %v", w.Code, tc.httpCode)
+			}
+			stats, err := manager.Stats("name1")
+			if err != nil {
+				t.Fatalf("unexpected Stats error: %v", err)
+			}
+			if stats.Depth != tc.depth {
+				t.Errorf("wrong depth: got %v want %v", stats.Depth, tc.depth)
+			}
+		})
+	}
+}
+
+func TestRouting(t *testing.T) {
+	testCases := []struct {
+		description string
+		httpCode    int
+		method      string
+		url         string
+	}{
+		{
+			description: "Name is empty",
+			httpCode:    http.StatusNotFound,
+			method:      http.MethodGet,
+			url:         "/queue/",
+		},
+		{
+			description: "Name is missed",
+			httpCode:    http.StatusNotFound,
+			method:      http.MethodPut,
+			url:         "/queue",
+		},
+		{
+			description: "Unknown action",
+			httpCode:    http.StatusNotFound,
+			method:      http.MethodPost,
+			url:         "/queue/name1/unknown",
+		},
+		{
+			description: "Unsupported method",
+			httpCode:    http.StatusMethodNotAllowed,
+			method:      http.MethodPatch,
+			url:         "/queue/name1",
+		},
+		{
+			description: "HEAD does not consume a message",
+			// Очередь мока пуста, поэтому HEAD отвечает 404
+			httpCode: http.StatusNotFound,
+			method:   http.MethodHead,
+			url:      "/queue/name1",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			manager := &MockQueueManager{}
+			handler := setupMux(manager, HandlerConfig{DefaultTimeout: 1, RetryAfter: retryAfter})
+
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest(tc.method, tc.url, strings.NewReader(`{"message": "message1"}`))
+			handler.ServeHTTP(w, req)
+
+			if w.Code != tc.httpCode {
+				t.Errorf("wrong status code: got %v want %v", w.Code, tc.httpCode)
+			}
+			if manager.getIn.callsNum != 0 {
+				t.Errorf("wrong GET calls number: got %v want %v", manager.getIn.callsNum, 0)
+			}
+			if manager.putIn.callsNum != 0 {
+				t.Errorf("wrong PUT calls number: got %v want %v", manager.putIn.callsNum, 0)
+			}
+		})
+	}
+}
+
+func TestInvalidQueueNames(t *testing.T) {
+	testCases := []struct {
+		description string
+		method      string
+		url         string
+	}{
+		{
+			description: "GET with dot",
+			method:      http.MethodGet,
+			url:         "/queue/name.1",
+		},
+		{
+			description: "PUT with escaped slash",
+			method:      http.MethodPut,
+			url:         "/queue/name%2F1",
+		},
+		{
+			description: "HEAD with space",
+			method:      http.MethodHead,
+			url:         "/queue/name%201",
+		},
+		{
+			description: "DELETE with unicode",
+			method:      http.MethodDelete,
+			url:         "/queue/%D0%BE%D1%87%D0%B5%D1%80%D0%B5%D0%B4%D1%8C",
+		},
+		{
+			description: "Stats of too long name",
+			method:      http.MethodGet,
+			url:         "/queue/" + strings.Repeat("a", 129) + "/stats",
+		},
+		{
+			description: "Bind to invalid target",
+			method:      http.MethodPost,
+			url:         "/queue/name1/bind?target=name%3F2",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			manager := &MockQueueManager{}
+			handler := setupMux(manager, HandlerConfig{DefaultTimeout: 1, RetryAfter: retryAfter})
+
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest(tc.method, tc.url, strings.NewReader(`{"message": "message1"}`))
+			handler.ServeHTTP(w, req)
+
+			if w.Code != http.StatusBadRequest {
+				t.Errorf("wrong status code: got %v want %v", w.Code, http.StatusBadRequest)
+			}
+			if tc.method != http.MethodHead && !strings.Contains(w.Body.String(), queue.ErrInvalidQueueName.Error()) {
+				t.Errorf("wrong body: got [%v] want validation error", w.Body.String())
+			}
+			if manager.getIn.callsNum != 0 || manager.putIn.callsNum != 0 || manager.bindIn.bindCallsNum != 0 {
+				t.Errorf("QueueManager is called with invalid name")
+			}
+		})
+	}
+}
+
+func TestPauseResumeRequests(t *testing.T) {
+	testCases := []struct {
+		description string
+		httpCode    int
+		method      string
+		url         string
+		pause       bool
+		unsuspend   bool
+		restart     bool
+		name        string
+		err         error
+	}{
+		{
+			description: "Pause OK",
+			httpCode:    http.StatusOK,
+			method:      http.MethodPost,
+			url:         "/queue/name1/pause",
+			pause:       true,
+			name:        "name1",
+		},
+		{
+			description: "Resume OK",
+			httpCode:    http.StatusOK,
+			method:      http.MethodPost,
+			url:         "/queue/name2/resume",
+			name:        "name2",
+		},
+		{
+			description: "No queue",
+			httpCode:    http.StatusNotFound,
+			method:      http.MethodPost,
+			url:         "/queue/name3/pause",
+			pause:       true,
+			name:        "name3",
+			err:         queue.ErrQueueNotFound,
+		},
+		{
+			description: "Some error",
+			httpCode:    http.StatusInternalServerError,
+			method:      http.MethodPost,
+			url:         "/queue/name4/resume",
+			name:        "name4",
+			err:         errors.New("Some error"),
+		},
+		{
+			description: "Wrong method",
+			httpCode:    http.StatusMethodNotAllowed,
+			method:      http.MethodGet,
+			url:         "/queue/name5/pause",
+			pause:       true,
+		},
+		{
+			description: "Unsuspend OK",
+			httpCode:    http.StatusOK,
+			method:      http.MethodPost,
+			url:         "/admin/queue/name6/resume",
+			unsuspend:   true,
+			name:        "name6",
+		},
+		{
+			description: "Unsuspend no queue",
+			httpCode:    http.StatusNotFound,
+			method:      http.MethodPost,
+			url:         "/admin/queue/name7/resume",
+			unsuspend:   true,
+			name:        "name7",
+			err:         queue.ErrQueueNotFound,
+		},
+		{
+			description: "Restart OK",
+			httpCode:    http.StatusOK,
+			method:      http.MethodPost,
+			url:         "/queue/name8/restart",
+			restart:     true,
+			name:        "name8",
+		},
+		{
+			description: "Restart no queue",
+			httpCode:    http.StatusNotFound,
+			method:      http.MethodPost,
+			url:         "/queue/name9/restart",
+			restart:     true,
+			name:        "name9",
+			err:         queue.ErrQueueNotFound,
+		},
+		{
+			description: "Restart topic",
+			httpCode:    http.StatusBadRequest,
+			method:      http.MethodPost,
+			url:         "/queue/name10/restart",
+			restart:     true,
+			name:        "name10",
+			err:         queue.ErrWrongQueueType,
+		},
+		{
+			description: "Restart stopped queue",
+			httpCode:    http.StatusServiceUnavailable,
+			method:      http.MethodPost,
+			url:         "/queue/name11/restart",
+			restart:     true,
+			name:        "name11",
+			err:         queue.ErrShuttingDown,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			manager := &MockQueueManager{pauseOut: PauseOut{err: tc.err}}
+			handler := setupMux(manager, HandlerConfig{})
+
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest(tc.method, tc.url, nil)
+			handler.ServeHTTP(w, req)
+
+			if w.Code != tc.httpCode {
+				t.Errorf("wrong status code: got %v want %v", w.Code, tc.httpCode)
+			}
+			expectedCallsNum := 0
+			if tc.name != "" {
+				expectedCallsNum = 1
+			}
+			callsNum := manager.pauseIn.resumeCallsNum
+			if tc.pause {
+				callsNum = manager.pauseIn.pauseCallsNum
+			} else if tc.unsuspend {
+				callsNum = manager.pauseIn.unsuspendCallsNum
+			} else if tc.restart {
+				callsNum = manager.pauseIn.restartCallsNum
+			}
+			if callsNum != expectedCallsNum {
+				t.Errorf("wrong pause/resume calls number: got %v want %v", callsNum, expectedCallsNum)
+			}
+			if manager.pauseIn.name != tc.name {
+				t.Errorf("wrong name: got %v want %v", manager.pauseIn.name, tc.name)
+			}
+		})
+	}
+}
+
+func TestBindUnbindRequests(t *testing.T) {
+	testCases := []struct {
+		description string
+		httpCode    int
+		method      string
+		url         string
+		bind        bool
+		name        string
+		target      string
+	}{
+		{
+			description: "Bind OK",
+			httpCode:    http.StatusOK,
+			method:      http.MethodPost,
+			url:         "/queue/name1/bind?target=target1",
+			bind:        true,
+			name:        "name1",
+			target:      "target1",
+		},
+		{
+			description: "Unbind OK",
+			httpCode:    http.StatusOK,
+			method:      http.MethodPut,
+			url:         "/queue/name2/unbind?target=target2",
+			name:        "name2",
+			target:      "target2",
+		},
+		{
+			description: "Bind with wrong method",
+			httpCode:    http.StatusMethodNotAllowed,
+			method:      http.MethodPut,
+			url:         "/queue/name3/bind?target=target3",
+			bind:        true,
+		},
+		{
+			description: "Target is missed",
+			httpCode:    http.StatusBadRequest,
+			method:      http.MethodPost,
+			url:         "/queue/name4/bind",
+			bind:        true,
+		},
+		{
+			description: "Target is the same queue",
+			httpCode:    http.StatusBadRequest,
+			method:      http.MethodPost,
+			url:         "/queue/name5/bind?target=name5",
+			bind:        true,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			manager := &MockQueueManager{}
+			handler := setupMux(manager, HandlerConfig{})
+
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest(tc.method, tc.url, nil)
+			handler.ServeHTTP(w, req)
+
+			if w.Code != tc.httpCode {
+				t.Errorf("wrong status code: got %v want %v", w.Code, tc.httpCode)
+			}
+			expectedCallsNum := 0
+			if tc.name != "" {
+				expectedCallsNum = 1
+			}
+			callsNum := manager.bindIn.unbindCallsNum
+			if tc.bind {
+				callsNum = manager.bindIn.bindCallsNum
+			}
+			if callsNum != expectedCallsNum {
+				t.Errorf("wrong bind/unbind calls number: got %v want %v", callsNum, expectedCallsNum)
+			}
+			if manager.bindIn.name != tc.name {
+				t.Errorf("wrong name: got %v want %v", manager.bindIn.name, tc.name)
+			}
+			if manager.bindIn.target != tc.target {
+				t.Errorf("wrong target: got %v want %v", manager.bindIn.target, tc.target)
+			}
+		})
+	}
+}
+
+func TestWebhookRequests(t *testing.T) {
+	testCases := []struct {
+		description string
+		httpCode    int
+		method      string
+		url         string
+		body        string
+		name        string
+		callbackURL string
+		err         error
+	}{
+		{
+			description: "OK",
+			httpCode:    http.StatusOK,
+			method:      http.MethodPost,
+			url:         "/queue/name1/subscriptions",
+			body:        `{"url": "http://localhost:9090/callback"}`,
+			name:        "name1",
+			callbackURL: "http://localhost:9090/callback",
+		},
+		{
+			description: "Topic",
+			httpCode:    http.StatusBadRequest,
+			method:      http.MethodPost,
+			url:         "/queue/name2/subscriptions",
+			body:        `{"url": "https://example.com/callback"}`,
+			name:        "name2",
+			callbackURL: "https://example.com/callback",
+			err:         queue.ErrWrongQueueType,
+		},
+		{
+			description: "Too many queues",
+			httpCode:    http.StatusTooManyRequests,
+			method:      http.MethodPost,
+			url:         "/queue/name3/subscriptions",
+			body:        `{"url": "https://example.com/callback"}`,
+			name:        "name3",
+			callbackURL: "https://example.com/callback",
+			err:         queue.ErrTooManyItems,
+		},
+		{
+			description: "Wrong method",
+			httpCode:    http.StatusMethodNotAllowed,
+			method:      http.MethodPut,
+			url:         "/queue/name4/subscriptions",
+			body:        `{"url": "https://example.com/callback"}`,
+		},
+		{
+			description: "URL is not absolute",
+			httpCode:    http.StatusBadRequest,
+			method:      http.MethodPost,
+			url:         "/queue/name5/subscriptions",
+			body:        `{"url": "/callback"}`,
+		},
+		{
+			description: "URL scheme is not supported",
+			httpCode:    http.StatusBadRequest,
+			method:      http.MethodPost,
+			url:         "/queue/name6/subscriptions",
+			body:        `{"url": "ftp://example.com/callback"}`,
+		},
+		{
+			description: "JSON with invalid syntax",
+			httpCode:    http.StatusBadRequest,
+			method:      http.MethodPost,
+			url:         "/queue/name7/subscriptions",
+			body:        `{"url": `,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			manager := &MockQueueManager{webhookOut: WebhookOut{err: tc.err}}
+			handler := setupMux(manager, HandlerConfig{})
+
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest(tc.method, tc.url, strings.NewReader(tc.body))
+			handler.ServeHTTP(w, req)
+
+			if w.Code != tc.httpCode {
+				t.Errorf("wrong status code: got %v want %v", w.Code, tc.httpCode)
+			}
+			expectedCallsNum := 0
+			if tc.name != "" {
+				expectedCallsNum = 1
+			}
+			if manager.webhookIn.callsNum != expectedCallsNum {
+				t.Errorf("wrong AddWebhook calls number: got %v want %v", manager.webhookIn.callsNum, expectedCallsNum)
+			}
+			if manager.webhookIn.name != tc.name {
+				t.Errorf("wrong name: got %v want %v", manager.webhookIn.name, tc.name)
+			}
+			if manager.webhookIn.url != tc.callbackURL {
+				t.Errorf("wrong url: got %v want %v", manager.webhookIn.url, tc.callbackURL)
+			}
+		})
+	}
+}
+
+func TestDeleteRequests(t *testing.T) {
+	testCases := []struct {
+		description string
+		httpCode    int
+		url         string
+		name        string
+		err         error
+	}{
+		{
+			description: "OK",
+			httpCode:    http.StatusOK,
+			url:         "/queue/name1",
+			name:        "name1",
+		},
+		{
+			description: "No queue",
+			httpCode:    http.StatusNotFound,
+			url:         "/queue/name2",
+			name:        "name2",
+			err:         queue.ErrQueueNotFound,
+		},
+		{
+			description: "Some error",
+			httpCode:    http.StatusInternalServerError,
+			url:         "/queue/name3",
+			name:        "name3",
+			err:         errors.New("Some error"),
+		},
+		{
+			description: "Name is empty",
+			httpCode:    http.StatusNotFound,
+			url:         "/queue/",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			manager := &MockQueueManager{deleteOut: DeleteOut{err: tc.err}}
+			const defaultTimeout = 10
+			handler := setupMux(manager, HandlerConfig{DefaultTimeout: defaultTimeout, RetryAfter: retryAfter})
+
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodDelete, tc.url, nil)
+			handler.ServeHTTP(w, req)
+
+			if w.Code != tc.httpCode {
+				t.Errorf("wrong status code: got %v want %v", w.Code, tc.httpCode)
+			}
+			expectedCallsNum := 0
+			if tc.name != "" {
+				expectedCallsNum = 1
+			}
+			if manager.deleteIn.callsNum != expectedCallsNum {
+				t.Errorf("wrong DELETE calls number: got %v want %v", manager.deleteIn.callsNum, expectedCallsNum)
+			}
+			if manager.deleteIn.name != tc.name {
+				t.Errorf("wrong name: got %v want %v", manager.deleteIn.name, tc.name)
+			}
+			if manager.getIn.callsNum != 0 {
+				t.Errorf("wrong GET calls number: got %v want %v", manager.getIn.callsNum, 0)
+			}
+			if manager.putIn.callsNum != 0 {
+				t.Errorf("wrong PUT calls number: got %v want %v", manager.putIn.callsNum, 0)
+			}
+		})
+	}
+}
+
+func TestAckRequests(t *testing.T) {
+	testCases := []struct {
+		description string
+		httpCode    int
+		method      string
+		url         string
+		name        string
+		id          string
+		err         error
+	}{
+		{
+			description: "OK",
+			httpCode:    http.StatusOK,
+			method:      http.MethodDelete,
+			url:         "/queue/name1/message/1",
+			name:        "name1",
+			id:          "1",
+		},
+		{
+			description: "No queue",
+			httpCode:    http.StatusNotFound,
+			method:      http.MethodDelete,
+			url:         "/queue/name2/message/2",
+			name:        "name2",
+			id:          "2",
+			err:         queue.ErrQueueNotFound,
+		},
+		{
+			description: "No message in flight",
+			httpCode:    http.StatusNotFound,
+			method:      http.MethodDelete,
+			url:         "/queue/name3/message/3",
+			name:        "name3",
+			id:          "3",
+			err:         queue.ErrMessageNotFound,
+		},
+		{
+			description: "Wrong method",
+			httpCode:    http.StatusMethodNotAllowed,
+			method:      http.MethodGet,
+			url:         "/queue/name4/message/4",
+		},
+		{
+			description: "Id is empty",
+			httpCode:    http.StatusNotFound,
+			method:      http.MethodDelete,
+			url:         "/queue/name5/message/",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			manager := &MockQueueManager{ackOut: AckOut{err: tc.err}}
+			handler := setupMux(manager, HandlerConfig{})
+
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest(tc.method, tc.url, nil)
+			handler.ServeHTTP(w, req)
+
+			if w.Code != tc.httpCode {
+				t.Errorf("wrong status code: got %v want %v", w.Code, tc.httpCode)
+			}
+			expectedCallsNum := 0
+			if tc.name != "" {
+				expectedCallsNum = 1
+			}
+			if manager.ackIn.callsNum != expectedCallsNum {
+				t.Errorf("wrong Ack calls number: got %v want %v", manager.ackIn.callsNum, expectedCallsNum)
+			}
+			if manager.ackIn.name != tc.name {
+				t.Errorf("wrong name: got %v want %v", manager.ackIn.name, tc.name)
+			}
+			if manager.ackIn.id != tc.id {
+				t.Errorf("wrong id: got %v want %v", manager.ackIn.id, tc.id)
+			}
+		})
+	}
+}
+
+func TestNackRequests(t *testing.T) {
+	testCases := []struct {
+		description string
+		httpCode    int
+		url         string
+		id          string
+		retry       bool
+		err         error
+	}{
+		{
+			description: "Requeue",
+			httpCode:    http.StatusOK,
+			url:         "/queue/name1/nack/1",
+			id:          "1",
+		},
+		{
+			description: "Retry",
+			httpCode:    http.StatusOK,
+			url:         "/queue/name1/nack/2?retry=true",
+			id:          "2",
+			retry:       true,
+		},
+		{
+			description: "No message in flight",
+			httpCode:    http.StatusNotFound,
+			url:         "/queue/name1/nack/3?retry=true",
+			id:          "3",
+			retry:       true,
+			err:         queue.ErrMessageNotFound,
+		},
+		{
+			description: "Dead letter queue full",
+			httpCode:    http.StatusTooManyRequests,
+			url:         "/queue/name1/nack/4?retry=true",
+			id:          "4",
+			retry:       true,
+			err:         queue.ErrTooManyItems,
+		},
+		{
+			description: "Invalid retry",
+			httpCode:    http.StatusBadRequest,
+			url:         "/queue/name1/nack/5?retry=maybe",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			manager := &MockQueueManager{ackOut: AckOut{err: tc.err}}
+			handler := setupMux(manager, HandlerConfig{})
+
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodDelete, tc.url, nil)
+			handler.ServeHTTP(w, req)
+
+			if w.Code != tc.httpCode {
+				t.Errorf("wrong status code: got %v want %v", w.Code, tc.httpCode)
+			}
+			if tc.id == "" {
+				if manager.ackIn.callsNum != 0 {
+					t.Errorf("unexpected Nack call")
+				}
+				return
+			}
+			if !manager.ackIn.nack || manager.ackIn.id != tc.id || manager.ackIn.retry != tc.retry {
+				t.Errorf("wrong Nack call: got %+v want id %v retry %v", manager.ackIn, tc.id, tc.retry)
+			}
+		})
+	}
+}
+
+// TestNackRetryDeadLetter проверяет, что сообщение после трех повторных попыток на четвертый nack уходит в .dlq
+// с числом попыток в заголовке
+func TestNackRetryDeadLetter(t *testing.T) {
+	manager := queue.NewQueueManager(queue.QueueManagerConfig{
+		MaxQueueNum:           10,
+		MaxMessageNumPerQueue: 10,
+		// Повторные попытки возвращает таймер visibility timeout, который срабатывает раз в его десятую часть
+		VisibilityTimeout: 500 * time.Millisecond,
+		NackRetryDelay:    time.Millisecond,
+	})
+	defer manager.Stop()
+	if _, err := manager.SetConfig("name1", queue.QueueConfig{MaxRetries: 3}); err != nil {
+		t.Fatalf("unexpected error at SetConfig [%v]", err)
+	}
+	if err := manager.Put(context.Background(), "name1", "message1"); err != nil {
+		t.Fatalf("unexpected error at Put [%v]", err)
+	}
+	handler := setupMux(manager, HandlerConfig{DefaultTimeout: 1, RetryAfter: retryAfter})
+
+	for attempt := range 4 {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/queue/name1?ack=true", nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("attempt %d: wrong GET status code: got %v want %v", attempt, w.Code, http.StatusOK)
+		}
+		if attempts := w.Header().Get("X-Message-Attempts"); attempt > 0 && attempts != strconv.Itoa(attempt) {
+			t.Errorf("attempt %d: wrong X-Message-Attempts: got %v", attempt, attempts)
+		}
+		var dto messageDto
+		if err := json.NewDecoder(w.Body).Decode(&dto); err != nil {
+			t.Fatalf("GET Body decode error: %v", err)
+		}
+
+		w = httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(http.MethodDelete, "/queue/name1/nack/"+dto.ID+"?retry=true", nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("attempt %d: wrong nack status code: got %v want %v", attempt, w.Code, http.StatusOK)
+		}
+	}
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/queue/name1.dlq", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("wrong dead letter GET status code: got %v want %v", w.Code, http.StatusOK)
+	}
+	if attempts := w.Header().Get("X-Message-Attempts"); attempts != "3" {
+		t.Errorf("wrong dead letter X-Message-Attempts: got %v want 3", attempts)
+	}
+	if stats, err := manager.Stats("name1"); err != nil || stats.Depth != 0 || stats.InFlight != 0 {
+		t.Errorf("message left in the queue: %+v, [%v]", stats, err)
+	}
+}
+
+func TestStatsRequests(t *testing.T) {
+	testCases := []struct {
+		description string
+		httpCode    int
+		method      string
+		url         string
+		stats       queue.QueueStats
+		groups      []queue.ConsumerGroupStats
+		err         error
+	}{
+		{
+			description: "OK",
+			httpCode:    http.StatusOK,
+			method:      http.MethodGet,
+			url:         "/queue/name1/stats",
+			stats: queue.QueueStats{Depth: 1, InFlight: 2, Waiting: 6, Produced: 3, Consumed: 4, Errors: 5,
+				CreatedAt:      time.Date(2024, 5, 1, 13, 0, 0, 0, time.FixedZone("MSK", 3*60*60)),
+				LastActivityAt: time.Date(2024, 5, 1, 12, 30, 15, 500, time.UTC),
+			},
+		},
+		{
+			description: "OK with groups",
+			httpCode:    http.StatusOK,
+			method:      http.MethodGet,
+			url:         "/queue/name5/stats",
+			stats:       queue.QueueStats{Produced: 10, Consumed: 7},
+			groups: []queue.ConsumerGroupStats{
+				{Name: "audit", Consumed: 2, Lag: 8},
+				{Name: "workers", Members: 3, Consumed: 5, Lag: 5},
+			},
+		},
+		{
+			description: "No queue",
+			httpCode:    http.StatusNotFound,
+			method:      http.MethodGet,
+			url:         "/queue/name2/stats",
+			err:         queue.ErrQueueNotFound,
+		},
+		{
+			description: "Topic",
+			httpCode:    http.StatusBadRequest,
+			method:      http.MethodGet,
+			url:         "/queue/name3/stats",
+			err:         queue.ErrWrongQueueType,
+		},
+		{
+			description: "Wrong method",
+			httpCode:    http.StatusMethodNotAllowed,
+			method:      http.MethodPost,
+			url:         "/queue/name4/stats",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			manager := &MockQueueManager{statsOut: StatsOut{stats: tc.stats, groups: tc.groups, err: tc.err}}
+			handler := setupMux(manager, HandlerConfig{})
+
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest(tc.method, tc.url, nil)
+			handler.ServeHTTP(w, req)
+
+			if w.Code != tc.httpCode {
+				t.Errorf("wrong status code: got %v want %v", w.Code, tc.httpCode)
+			}
+			if w.Code != http.StatusOK {
+				return
+			}
+			var dto statsDto
+			if err := json.NewDecoder(w.Result().Body).Decode(&dto); err != nil {
+				t.Errorf("json decoding error: %v", err)
+			}
+			expected := statsDto{
+				Depth:    tc.stats.Depth,
+				InFlight: tc.stats.InFlight,
+				Waiting:  tc.stats.Waiting,
+				Produced: tc.stats.Produced,
+				Consumed: tc.stats.Consumed,
+				Errors:   tc.stats.Errors,
+
+				CreatedAt:      tc.stats.CreatedAt.UTC(),
+				LastActivityAt: tc.stats.LastActivityAt.UTC(),
+			}
+			// Мапа групп не сравнивается через ==, поэтому проверяется отдельно
+			if len(dto.Groups) != len(tc.groups) {
+				t.Errorf("wrong groups number: got %v want %v", len(dto.Groups), len(tc.groups))
+			}
+			for _, group := range tc.groups {
+				expectedGroup := groupStatsDto{Members: group.Members, Consumed: group.Consumed, Lag: group.Lag}
+				if dto.Groups[group.Name] != expectedGroup {
+					t.Errorf("wrong group [%s]: got %+v want %+v", group.Name, dto.Groups[group.Name], expectedGroup)
+				}
+			}
+			dto.Groups = nil
+			if !reflect.DeepEqual(dto, expected) {
+				t.Errorf("wrong stats: got %+v want %+v", dto, expected)
+			}
+		})
+	}
+}
+
+func TestHeadRequests(t *testing.T) {
+	testCases := []struct {
+		description string
+		httpCode    int
+		url         string
+		stats       queue.QueueStats
+		err         error
+		length      string
+		notFound    bool
+	}{
+		{
+			description: "Existing queue",
+			httpCode:    http.StatusOK,
+			url:         "/queue/name1",
+			stats:       queue.QueueStats{Depth: 3, InFlight: 1},
+			length:      "3",
+		},
+		{
+			description: "Empty queue",
+			httpCode:    http.StatusNotFound,
+			url:         "/queue/name2",
+			length:      "0",
+		},
+		{
+			description: "Only messages in flight",
+			httpCode:    http.StatusNotFound,
+			url:         "/queue/name5",
+			stats:       queue.QueueStats{InFlight: 2},
+			length:      "0",
+		},
+		{
+			description: "No queue",
+			httpCode:    http.StatusNotFound,
+			url:         "/queue/name3",
+			err:         queue.ErrQueueNotFound,
+			notFound:    true,
+		},
+		{
+			description: "Topic",
+			httpCode:    http.StatusOK,
+			url:         "/queue/name4",
+			err:         queue.ErrWrongQueueType,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			manager := &MockQueueManager{statsOut: StatsOut{stats: tc.stats, err: tc.err}}
+			handler := setupMux(manager, HandlerConfig{DefaultTimeout: 1, RetryAfter: retryAfter})
+
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodHead, tc.url, nil)
+			handler.ServeHTTP(w, req)
+
+			if w.Code != tc.httpCode {
+				t.Errorf("wrong status code: got %v want %v", w.Code, tc.httpCode)
+			}
+			if length := w.Header().Get("X-Queue-Length"); length != tc.length {
+				t.Errorf("wrong X-Queue-Length: got [%v] want [%v]", length, tc.length)
+			}
+			if depth := w.Header().Get("X-Queue-Depth"); depth != tc.length {
+				t.Errorf("wrong X-Queue-Depth: got [%v] want [%v]", depth, tc.length)
+			}
+			if notFound := w.Header().Get("X-Queue-Not-Found") == "true"; notFound != tc.notFound {
+				t.Errorf("wrong X-Queue-Not-Found: got %v want %v", notFound, tc.notFound)
+			}
+			if w.Body.Len() != 0 {
+				t.Errorf("unexpected body: %q", w.Body.String())
+			}
+			// HEAD не должен извлекать сообщения
+			if manager.getIn.callsNum != 0 {
+				t.Errorf("wrong GET calls number: got %v want %v", manager.getIn.callsNum, 0)
+			}
+		})
+	}
+}
+
+func TestConfigRequests(t *testing.T) {
+	testCases := []struct {
+		description      string
+		httpCode         int
+		method           string
+		url              string
+		body             string
+		expectedCallsNum int
+		expectedName     string
+		expectedNewMax   int
+		err              error
+	}{
+		{
+			description:      "OK",
+			httpCode:         http.StatusOK,
+			method:           http.MethodPost,
+			url:              "/queue/name1/config",
+			body:             `{"maxMessages":500}`,
+			expectedCallsNum: 1,
+			expectedName:     "name1",
+			expectedNewMax:   500,
+		},
+		{
+			description:      "No queue",
+			httpCode:         http.StatusNotFound,
+			method:           http.MethodPost,
+			url:              "/queue/name2/config",
+			body:             `{"maxMessages":500}`,
+			expectedCallsNum: 1,
+			expectedName:     "name2",
+			expectedNewMax:   500,
+			err:              queue.ErrQueueNotFound,
+		},
+		{
+			description:      "Limit below depth",
+			httpCode:         http.StatusConflict,
+			method:           http.MethodPost,
+			url:              "/queue/name3/config",
+			body:             `{"maxMessages":1}`,
+			expectedCallsNum: 1,
+			expectedName:     "name3",
+			expectedNewMax:   1,
+			err:              queue.ErrTooManyItems,
+		},
+		{
+			description:      "Topic",
+			httpCode:         http.StatusBadRequest,
+			method:           http.MethodPost,
+			url:              "/queue/name4/config",
+			body:             `{"maxMessages":500}`,
+			expectedCallsNum: 1,
+			expectedName:     "name4",
+			expectedNewMax:   500,
+			err:              queue.ErrWrongQueueType,
+		},
+		{
+			description: "Zero limit",
+			httpCode:    http.StatusBadRequest,
+			method:      http.MethodPost,
+			url:         "/queue/name5/config",
+			body:        `{"maxMessages":0}`,
+		},
+		{
+			description: "Bad JSON",
+			httpCode:    http.StatusBadRequest,
+			method:      http.MethodPost,
+			url:         "/queue/name6/config",
+			body:        `{"maxMessages":`,
+		},
+		{
+			description: "Wrong method",
+			httpCode:    http.StatusMethodNotAllowed,
+			method:      http.MethodDelete,
+			url:         "/queue/name7/config",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			manager := &MockQueueManager{resizeOut: ResizeOut{err: tc.err}}
+			handler := setupMux(manager, HandlerConfig{})
+
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest(tc.method, tc.url, strings.NewReader(tc.body))
+			handler.ServeHTTP(w, req)
+
+			if w.Code != tc.httpCode {
+				t.Errorf("wrong status code: got %v want %v", w.Code, tc.httpCode)
+			}
+			if manager.resizeIn.callsNum != tc.expectedCallsNum {
+				t.Errorf("wrong Resize calls number: got %v want %v", manager.resizeIn.callsNum, tc.expectedCallsNum)
+			}
+			if manager.resizeIn.name != tc.expectedName {
+				t.Errorf("wrong name: got %v want %v", manager.resizeIn.name, tc.expectedName)
+			}
+			if manager.resizeIn.newMax != tc.expectedNewMax {
+				t.Errorf("wrong maxMessages: got %v want %v", manager.resizeIn.newMax, tc.expectedNewMax)
+			}
+		})
+	}
+}
+
+func TestQueueConfigRequests(t *testing.T) {
+	effective := queue.QueueConfig{MaxMessageNum: 5, OverflowPolicy: queue.OverflowDropOldest, TTL: time.Minute, MaxConsecutiveFailures: 3, MaxRetries: 2}
+	testCases := []struct {
+		description      string
+		httpCode         int
+		method           string
+		body             string
+		err              error
+		expectedCallsNum int
+		expectedConfig   queue.QueueConfig
+		expectedBody     string
+	}{
+		{
+			description:      "Set",
+			httpCode:         http.StatusOK,
+			method:           http.MethodPut,
+			body:             `{"maxMessageNum":5,"overflowPolicy":"dropOldest","ttlSeconds":60,"maxConsecutiveFailures":3,"maxRetries":2}`,
+			expectedCallsNum: 1,
+			expectedConfig:   effective,
+			expectedBody:     `{"maxMessageNum":5,"overflowPolicy":"dropOldest","ttlSeconds":60,"maxConsecutiveFailures":3,"maxRetries":2}`,
+		},
+		{
+			description:      "Set only limit",
+			httpCode:         http.StatusOK,
+			method:           http.MethodPut,
+			body:             `{"maxMessageNum":5}`,
+			expectedCallsNum: 1,
+			expectedConfig:   queue.QueueConfig{MaxMessageNum: 5},
+			expectedBody:     `{"maxMessageNum":5,"overflowPolicy":"dropOldest","ttlSeconds":60,"maxConsecutiveFailures":3,"maxRetries":2}`,
+		},
+		{
+			description:      "Invalid config",
+			httpCode:         http.StatusBadRequest,
+			method:           http.MethodPut,
+			body:             `{"overflowPolicy":"dropNewest"}`,
+			err:              queue.ErrInvalidConfig,
+			expectedCallsNum: 1,
+			expectedConfig:   queue.QueueConfig{OverflowPolicy: "dropNewest"},
+		},
+		{
+			description:      "Limit below depth",
+			httpCode:         http.StatusConflict,
+			method:           http.MethodPut,
+			body:             `{"maxMessageNum":1}`,
+			err:              queue.ErrTooManyItems,
+			expectedCallsNum: 1,
+			expectedConfig:   queue.QueueConfig{MaxMessageNum: 1},
+		},
+		{
+			description:      "Set topic",
+			httpCode:         http.StatusBadRequest,
+			method:           http.MethodPut,
+			body:             `{"maxMessageNum":1}`,
+			err:              queue.ErrWrongQueueType,
+			expectedCallsNum: 1,
+			expectedConfig:   queue.QueueConfig{MaxMessageNum: 1},
+		},
+		{
+			description: "Bad JSON",
+			httpCode:    http.StatusBadRequest,
+			method:      http.MethodPut,
+			body:        `{"maxMessageNum":`,
+		},
+		{
+			description:  "Get",
+			httpCode:     http.StatusOK,
+			method:       http.MethodGet,
+			expectedBody: `{"maxMessageNum":5,"overflowPolicy":"dropOldest","ttlSeconds":60,"maxConsecutiveFailures":3,"maxRetries":2}`,
+		},
+		{
+			description: "Get topic",
+			httpCode:    http.StatusBadRequest,
+			method:      http.MethodGet,
+			err:         queue.ErrWrongQueueType,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			manager := &MockQueueManager{configOut: ConfigOut{config: effective, err: tc.err}}
+			handler := setupMux(manager, HandlerConfig{})
+
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest(tc.method, "/queue/name1/config", strings.NewReader(tc.body))
+			handler.ServeHTTP(w, req)
+
+			if w.Code != tc.httpCode {
+				t.Errorf("wrong status code: got %v want %v", w.Code, tc.httpCode)
+			}
+			if manager.setConfigIn.callsNum != tc.expectedCallsNum {
+				t.Errorf("wrong SetConfig calls number: got %v want %v", manager.setConfigIn.callsNum, tc.expectedCallsNum)
+			}
+			if manager.setConfigIn.config != tc.expectedConfig {
+				t.Errorf("wrong config: got %+v want %+v", manager.setConfigIn.config, tc.expectedConfig)
+			}
+			if tc.expectedBody != "" && strings.TrimSpace(w.Body.String()) != tc.expectedBody {
+				t.Errorf("wrong body: got %v want %v", w.Body.String(), tc.expectedBody)
+			}
+		})
+	}
+}
+
+func TestMoveRequests(t *testing.T) {
+	testCases := []struct {
+		description      string
+		httpCode         int
+		method           string
+		url              string
+		expectedCallsNum int
+		expectedSrc      string
+		expectedDest     string
+		err              error
+	}{
+		{
+			description:      "OK",
+			httpCode:         http.StatusOK,
+			method:           http.MethodPost,
+			url:              "/queue/name1/move?dest=dest1",
+			expectedCallsNum: 1,
+			expectedSrc:      "name1",
+			expectedDest:     "dest1",
+		},
+		{
+			description:      "Empty source",
+			httpCode:         http.StatusNotFound,
+			method:           http.MethodPost,
+			url:              "/queue/name2/move?dest=dest2",
+			expectedCallsNum: 1,
+			expectedSrc:      "name2",
+			expectedDest:     "dest2",
+			err:              queue.ErrNoMessage,
+		},
+		{
+			description:      "No source",
+			httpCode:         http.StatusNotFound,
+			method:           http.MethodPost,
+			url:              "/queue/name3/move?dest=dest3",
+			expectedCallsNum: 1,
+			expectedSrc:      "name3",
+			expectedDest:     "dest3",
+			err:              queue.ErrQueueNotFound,
+		},
+		{
+			description:      "Destination full",
+			httpCode:         http.StatusTooManyRequests,
+			method:           http.MethodPost,
+			url:              "/queue/name4/move?dest=dest4",
+			expectedCallsNum: 1,
+			expectedSrc:      "name4",
+			expectedDest:     "dest4",
+			err:              queue.ErrTooManyItems,
+		},
+		{
+			description:      "Source deleted while destination full",
+			httpCode:         http.StatusServiceUnavailable,
+			method:           http.MethodPost,
+			url:              "/queue/name4/move?dest=dest4",
+			expectedCallsNum: 1,
+			expectedSrc:      "name4",
+			expectedDest:     "dest4",
+			err:              fmt.Errorf("%w, message is not returned to [name4]: %w", queue.ErrTooManyItems, queue.ErrShuttingDown),
+		},
+		{
+			description:      "Suspended destination of its dead letter queue",
+			httpCode:         http.StatusConflict,
+			method:           http.MethodPost,
+			url:              "/queue/name4.dlq/move?dest=name4",
+			expectedCallsNum: 1,
+			expectedSrc:      "name4.dlq",
+			expectedDest:     "name4",
+			err:              queue.ErrQueueSuspended,
+		},
+		{
+			description:      "Topic",
+			httpCode:         http.StatusBadRequest,
+			method:           http.MethodPost,
+			url:              "/queue/name5/move?dest=dest5",
+			expectedCallsNum: 1,
+			expectedSrc:      "name5",
+			expectedDest:     "dest5",
+			err:              queue.ErrWrongQueueType,
+		},
+		{
+			description: "No dest",
+			httpCode:    http.StatusBadRequest,
+			method:      http.MethodPost,
+			url:         "/queue/name6/move",
+		},
+		{
+			description: "Same dest",
+			httpCode:    http.StatusBadRequest,
+			method:      http.MethodPost,
+			url:         "/queue/name7/move?dest=name7",
+		},
+		{
+			description: "Wrong method",
+			httpCode:    http.StatusMethodNotAllowed,
+			method:      http.MethodGet,
+			url:         "/queue/name8/move?dest=dest8",
+		},
+		{
+			description: "Invalid dest",
+			httpCode:    http.StatusBadRequest,
+			method:      http.MethodPost,
+			url:         "/queue/name9/move?dest=dest%2F9",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			manager := &MockQueueManager{moveOut: MoveOut{err: tc.err}}
+			handler := setupMux(manager, HandlerConfig{})
+
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest(tc.method, tc.url, nil)
+			handler.ServeHTTP(w, req)
+
+			if w.Code != tc.httpCode {
+				t.Errorf("wrong status code: got %v want %v", w.Code, tc.httpCode)
+			}
+			if manager.moveIn.callsNum != tc.expectedCallsNum {
+				t.Errorf("wrong Move calls number: got %v want %v", manager.moveIn.callsNum, tc.expectedCallsNum)
+			}
+			if manager.moveIn.src != tc.expectedSrc {
+				t.Errorf("wrong src: got %v want %v", manager.moveIn.src, tc.expectedSrc)
+			}
+			if manager.moveIn.dest != tc.expectedDest {
+				t.Errorf("wrong dest: got %v want %v", manager.moveIn.dest, tc.expectedDest)
+			}
+		})
+	}
+}
+
+func TestExportRequests(t *testing.T) {
+	testCases := []struct {
+		description string
+		httpCode    int
+		method      string
+		url         string
+		messages    []string
+		expected    string
+		err         error
+	}{
+		{
+			description: "OK",
+			httpCode:    http.StatusOK,
+			method:      http.MethodPost,
+			url:         "/admin/queue/name1/export",
+			messages:    []string{"m1", "m2"},
+			expected:    `{"messages":["m1","m2"]}`,
+		},
+		{
+			description: "Empty queue",
+			httpCode:    http.StatusOK,
+			method:      http.MethodPost,
+			url:         "/admin/queue/name2/export",
+			expected:    `{"messages":[]}`,
+		},
+		{
+			description: "No queue",
+			httpCode:    http.StatusNotFound,
+			method:      http.MethodPost,
+			url:         "/admin/queue/name3/export",
+			err:         queue.ErrQueueNotFound,
+		},
+		{
+			description: "Topic",
+			httpCode:    http.StatusBadRequest,
+			method:      http.MethodPost,
+			url:         "/admin/queue/name4/export",
+			err:         queue.ErrWrongQueueType,
+		},
+		{
+			description: "Wrong method",
+			httpCode:    http.StatusMethodNotAllowed,
+			method:      http.MethodGet,
+			url:         "/admin/queue/name5/export",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			manager := &MockQueueManager{snapshotOut: SnapshotOut{messages: tc.messages, err: tc.err}}
+			handler := setupMux(manager, HandlerConfig{})
+
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest(tc.method, tc.url, nil)
+			handler.ServeHTTP(w, req)
+
+			if w.Code != tc.httpCode {
+				t.Errorf("wrong status code: got %v want %v", w.Code, tc.httpCode)
+			}
+			if w.Code != http.StatusOK {
+				return
+			}
+			if body := strings.TrimSpace(w.Body.String()); body != tc.expected {
+				t.Errorf("wrong body: got %v want %v", body, tc.expected)
+			}
+		})
+	}
+}
+
+func TestSampleRequests(t *testing.T) {
+	testCases := []struct {
+		description string
+		httpCode    int
+		url         string
+		messages    []string
+		n           int
+		expected    string
+		err         error
+	}{
+		{
+			description: "Default size",
+			httpCode:    http.StatusOK,
+			url:         "/queue/name1/sample",
+			messages:    []string{"m1", "m5"},
+			n:           defaultSampleSize,
+			expected:    `{"messages":["m1","m5"]}`,
+		},
+		{
+			description: "Size from request",
+			httpCode:    http.StatusOK,
+			url:         "/queue/name2/sample?n=3",
+			messages:    []string{"m1", "m2", "m3"},
+			n:           3,
+			expected:    `{"messages":["m1","m2","m3"]}`,
+		},
+		{
+			description: "Size above limit",
+			httpCode:    http.StatusOK,
+			url:         "/queue/name3/sample?n=1000",
+			n:           20,
+			expected:    `{"messages":[]}`,
+		},
+		{
+			description: "Wrong size",
+			httpCode:    http.StatusBadRequest,
+			url:         "/queue/name4/sample?n=0",
+		},
+		{
+			description: "No queue",
+			httpCode:    http.StatusNotFound,
+			url:         "/queue/name5/sample",
+			n:           defaultSampleSize,
+			err:         queue.ErrQueueNotFound,
+		},
+		{
+			description: "Topic",
+			httpCode:    http.StatusBadRequest,
+			url:         "/queue/name6/sample",
+			n:           defaultSampleSize,
+			err:         queue.ErrWrongQueueType,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			manager := &MockQueueManager{snapshotOut: SnapshotOut{messages: tc.messages, err: tc.err}}
+			handler := setupMux(manager, HandlerConfig{MaxSampleSize: 20})
+
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodGet, tc.url, nil)
+			handler.ServeHTTP(w, req)
+
+			if w.Code != tc.httpCode {
+				t.Errorf("wrong status code: got %v want %v", w.Code, tc.httpCode)
+			}
+			if manager.sampleIn.n != tc.n {
+				t.Errorf("wrong sample size: got %v want %v", manager.sampleIn.n, tc.n)
+			}
+			if w.Code != http.StatusOK {
+				return
+			}
+			if body := strings.TrimSpace(w.Body.String()); body != tc.expected {
+				t.Errorf("wrong body: got %v want %v", body, tc.expected)
+			}
+		})
+	}
+}
+
+func TestReplayRequests(t *testing.T) {
+	testCases := []struct {
+		description string
+		url         string
+		acl         ACL
+		out         ReplayOut
+		httpCode    int
+		callsNum    int
+		limit       int
+		expected    string
+	}{
+		{
+			description: "All messages",
+			url:         "/queue/orders.dlq/replay",
+			out:         ReplayOut{n: 3},
+			httpCode:    http.StatusOK,
+			callsNum:    1,
+			expected:    `{"replayed":3}`,
+		},
+		{
+			description: "Limited",
+			url:         "/queue/orders.dlq/replay?n=2",
+			out:         ReplayOut{n: 2},
+			httpCode:    http.StatusOK,
+			callsNum:    1,
+			limit:       2,
+			expected:    `{"replayed":2}`,
+		},
+		{
+			description: "Source queue is full",
+			url:         "/queue/orders.dlq/replay",
+			out:         ReplayOut{n: 1, err: queue.ErrTooManyItems},
+			httpCode:    http.StatusTooManyRequests,
+			callsNum:    1,
+			expected:    `{"replayed":1}`,
+		},
+		{
+			description: "Dead letter queue deleted during replay",
+			url:         "/queue/orders.dlq/replay",
+			out:         ReplayOut{n: 1, err: fmt.Errorf("%w, message is not returned to [orders.dlq]: %w", queue.ErrTooManyItems, queue.ErrShuttingDown)},
+			httpCode:    http.StatusServiceUnavailable,
+			callsNum:    1,
+		},
+		{
+			description: "No queue",
+			url:         "/queue/orders.dlq/replay",
+			out:         ReplayOut{err: queue.ErrQueueNotFound},
+			httpCode:    http.StatusNotFound,
+			callsNum:    1,
+		},
+		{
+			description: "Suspended source queue",
+			url:         "/queue/orders.dlq/replay",
+			out:         ReplayOut{err: queue.ErrQueueSuspended},
+			httpCode:    http.StatusConflict,
+			callsNum:    1,
+		},
+		{
+			description: "Not a dead letter queue",
+			url:         "/queue/orders/replay",
+			out:         ReplayOut{err: fmt.Errorf("%w: [orders] is not a dead letter queue", queue.ErrInvalidQueueName)},
+			httpCode:    http.StatusBadRequest,
+			callsNum:    1,
+		},
+		{
+			description: "Wrong size",
+			url:         "/queue/orders.dlq/replay?n=0",
+			httpCode:    http.StatusBadRequest,
+		},
+		{
+			description: "No write access to the source queue",
+			url:         "/queue/orders.dlq/replay",
+			acl:         ACL{"key": {{Queue: "*.dlq", Access: []string{accessRead, accessWrite}}}},
+			httpCode:    http.StatusForbidden,
+		},
+		{
+			description: "Write access to both queues",
+			url:         "/queue/orders.dlq/replay",
+			acl:         ACL{"key": {{Queue: "orders*", Access: []string{accessWrite}}}},
+			out:         ReplayOut{n: 1},
+			httpCode:    http.StatusOK,
+			callsNum:    1,
+			expected:    `{"replayed":1}`,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			manager := &MockQueueManager{replayOut: tc.out}
+			handler := setupMux(manager, HandlerConfig{ACL: tc.acl})
+
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodPost, tc.url, nil)
+			req.Header.Set("Authorization", "Bearer key")
+			handler.ServeHTTP(w, req)
+
+			if w.Code != tc.httpCode {
+				t.Errorf("wrong status code: got %v want %v", w.Code, tc.httpCode)
+			}
+			if manager.replayIn.callsNum != tc.callsNum {
+				t.Errorf("wrong Replay calls: got %v want %v", manager.replayIn.callsNum, tc.callsNum)
+			}
+			if manager.replayIn.limit != tc.limit {
+				t.Errorf("wrong limit: got %v want %v", manager.replayIn.limit, tc.limit)
+			}
+			if tc.expected == "" {
+				return
+			}
+			if body := strings.TrimSpace(w.Body.String()); body != tc.expected {
+				t.Errorf("wrong body: got %v want %v", body, tc.expected)
+			}
+		})
+	}
+}
+
+func TestSearchRequests(t *testing.T) {
+	// Топик "orders.topic" есть в списке, но без статистики
+	names := []string{"orders.1", "orders.2", "orders.eu", "orders.topic", "orders.us", "payments.1"}
+	byName := map[string]queue.QueueStats{
+		"orders.1":   {Depth: 3},
+		"orders.2":   {},
+		"orders.eu":  {Depth: 1},
+		"orders.us":  {},
+		"payments.1": {},
+	}
+	testCases := []struct {
+		description string
+		url         string
+		acl         ACL
+		httpCode    int
+		expected    string
+	}{
+		{
+			description: "All queues without pattern",
+			url:         "/queues/search",
+			httpCode:    http.StatusOK,
+			expected: `[{"name":"orders.1","depth":3},{"name":"orders.2","depth":0},{"name":"orders.eu","depth":1},` +
+				`{"name":"orders.us","depth":0},{"name":"payments.1","depth":0}]`,
+		},
+		{
+			description: "Star",
+			url:         "/queues/search?pattern=orders.*",
+			httpCode:    http.StatusOK,
+			expected: `[{"name":"orders.1","depth":3},{"name":"orders.2","depth":0},{"name":"orders.eu","depth":1},` +
+				`{"name":"orders.us","depth":0}]`,
+		},
+		{
+			description: "Question mark",
+			url:         "/queues/search?pattern=orders.?",
+			httpCode:    http.StatusOK,
+			expected:    `[{"name":"orders.1","depth":3},{"name":"orders.2","depth":0}]`,
+		},
+		{
+			description: "Character class",
+			url:         "/queues/search?pattern=orders.[eu][us]",
+			httpCode:    http.StatusOK,
+			expected:    `[{"name":"orders.eu","depth":1},{"name":"orders.us","depth":0}]`,
+		},
+		{
+			description: "Negated character range",
+			url:         "/queues/search?pattern=*.[^0-1]",
+			httpCode:    http.StatusOK,
+			expected:    `[{"name":"orders.2","depth":0}]`,
+		},
+		{
+			description: "Empty queues",
+			url:         "/queues/search?pattern=orders.*&empty=true",
+			httpCode:    http.StatusOK,
+			expected:    `[{"name":"orders.2","depth":0},{"name":"orders.us","depth":0}]`,
+		},
+		{
+			description: "Non-empty queues",
+			url:         "/queues/search?pattern=orders.*&empty=false",
+			httpCode:    http.StatusOK,
+			expected:    `[{"name":"orders.1","depth":3},{"name":"orders.eu","depth":1}]`,
+		},
+		{
+			description: "Nothing found",
+			url:         "/queues/search?pattern=logs.*",
+			httpCode:    http.StatusOK,
+			expected:    `[]`,
+		},
+		{
+			description: "Only readable queues with ACL",
+			url:         "/queues/search?pattern=*.1",
+			acl:         ACL{"key": {{Queue: "orders.*", Access: []string{accessRead}}, {Queue: "payments.*", Access: []string{accessWrite}}}},
+			httpCode:    http.StatusOK,
+			expected:    `[{"name":"orders.1","depth":3}]`,
+		},
+		{
+			description: "Invalid pattern",
+			url:         "/queues/search?pattern=orders.[",
+			httpCode:    http.StatusBadRequest,
+		},
+		{
+			description: "Invalid empty filter",
+			url:         "/queues/search?empty=yes",
+			httpCode:    http.StatusBadRequest,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			manager := &MockQueueManager{statsOut: StatsOut{names: names, byName: byName}}
+			handler := setupMux(manager, HandlerConfig{ACL: tc.acl})
+
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodGet, tc.url, nil)
+			req.Header.Set("Authorization", "Bearer key")
+			handler.ServeHTTP(w, req)
+
+			if w.Code != tc.httpCode {
+				t.Errorf("wrong status code: got %v want %v", w.Code, tc.httpCode)
+			}
+			if w.Code != http.StatusOK {
+				return
+			}
+			if body := strings.TrimSpace(w.Body.String()); body != tc.expected {
+				t.Errorf("wrong body: got %v want %v", body, tc.expected)
+			}
+		})
+	}
+}
+
+// TestNDJSON проверяет построчную выдачу выборки и выгрузки: каждая строка ответа - отдельное сообщение в JSON
+func TestNDJSON(t *testing.T) {
+	testCases := []struct {
+		description string
+		method      string
+		url         string
+		accept      string
+		messages    []string
+		ndjson      bool
+	}{
+		{
+			description: "Sample NDJSON",
+			method:      http.MethodGet,
+			url:         "/queue/name/sample",
+			accept:      "application/x-ndjson",
+			messages:    []string{"m1", "line1\nline2", `{"json":"inside"}`},
+			ndjson:      true,
+		},
+		{
+			description: "Sample NDJSON refused",
+			method:      http.MethodGet,
+			url:         "/queue/name/sample",
+			accept:      "application/x-ndjson;q=0",
+			messages:    []string{"m1"},
+		},
+		{
+			description: "NDJSON",
+			method:      http.MethodPost,
+			url:         "/admin/queue/name/export",
+			accept:      "application/x-ndjson",
+			messages:    []string{"m1", "line1\nline2", `{"json":"inside"}`},
+			ndjson:      true,
+		},
+		{
+			description: "NDJSON preferred with gzip",
+			method:      http.MethodPost,
+			url:         "/admin/queue/name/export",
+			accept:      "application/json;q=0.5, application/x-ndjson",
+			messages:    []string{strings.Repeat("m", 1000)},
+			ndjson:      true,
+		},
+		{
+			description: "Empty queue",
+			method:      http.MethodPost,
+			url:         "/admin/queue/name/export",
+			accept:      "application/x-ndjson",
+			ndjson:      true,
+		},
+		{
+			description: "NDJSON refused",
+			method:      http.MethodPost,
+			url:         "/admin/queue/name/export",
+			accept:      "application/x-ndjson;q=0",
+			messages:    []string{"m1"},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			manager := &MockQueueManager{snapshotOut: SnapshotOut{messages: tc.messages}}
+			handler := setupMux(manager, HandlerConfig{})
+
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest(tc.method, tc.url, nil)
+			req.Header.Set("Accept", tc.accept)
+			req.Header.Set("Accept-Encoding", "gzip")
+			handler.ServeHTTP(w, req)
+
+			if w.Code != http.StatusOK {
+				t.Fatalf("wrong status code: got %v want %v", w.Code, http.StatusOK)
+			}
+			if !tc.ndjson {
+				if contentType := w.Header().Get("Content-Type"); contentType == contentTypeNDJSON {
+					t.Errorf("unexpected Content-Type %v", contentType)
+				}
+				return
+			}
+			if contentType := w.Header().Get("Content-Type"); contentType != contentTypeNDJSON {
+				t.Errorf("wrong Content-Type: got %v want %v", contentType, contentTypeNDJSON)
+			}
+			// Построчный ответ не сжимается, чтобы строки уходили клиенту сразу
+			if encoding := w.Header().Get("Content-Encoding"); encoding != "" {
+				t.Errorf("unexpected Content-Encoding %v", encoding)
+			}
+			var messages []string
+			scanner := bufio.NewScanner(w.Body)
+			for scanner.Scan() {
+				var message string
+				if err := json.Unmarshal(scanner.Bytes(), &message); err != nil {
+					t.Fatalf("line [%s] decoding error: %v", scanner.Text(), err)
+				}
+				messages = append(messages, message)
+			}
+			if err := scanner.Err(); err != nil {
+				t.Fatalf("scan error: %v", err)
+			}
+			if !slices.Equal(messages, tc.messages) {
+				t.Errorf("wrong messages: got %q want %q", messages, tc.messages)
+			}
+			if len(tc.messages) != 0 && !w.Flushed {
+				t.Error("NDJSON response is not flushed")
+			}
+		})
+	}
+}
+
+func TestPurgeRequests(t *testing.T) {
+	testCases := []struct {
+		description      string
+		httpCode         int
+		method           string
+		url              string
+		purged           int
+		expected         string
+		expectedCallsNum int
+		expectedName     string
+		err              error
+	}{
+		{
+			description:      "OK",
+			httpCode:         http.StatusOK,
+			method:           http.MethodPost,
+			url:              "/queue/name1/purge",
+			purged:           5,
+			expected:         `{"purged":5}`,
+			expectedCallsNum: 1,
+			expectedName:     "name1",
+		},
+		{
+			description:      "No queue",
+			httpCode:         http.StatusNotFound,
+			method:           http.MethodPost,
+			url:              "/queue/name2/purge",
+			expectedCallsNum: 1,
+			expectedName:     "name2",
+			err:              queue.ErrQueueNotFound,
+		},
+		{
+			description:      "Topic",
+			httpCode:         http.StatusBadRequest,
+			method:           http.MethodPost,
+			url:              "/queue/name3/purge",
+			expectedCallsNum: 1,
+			expectedName:     "name3",
+			err:              queue.ErrWrongQueueType,
+		},
+		{
+			description: "Wrong method",
+			httpCode:    http.StatusMethodNotAllowed,
+			method:      http.MethodDelete,
+			url:         "/queue/name4/purge",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			manager := &MockQueueManager{purgeOut: PurgeOut{purged: tc.purged, err: tc.err}}
+			handler := setupMux(manager, HandlerConfig{})
+
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest(tc.method, tc.url, nil)
+			handler.ServeHTTP(w, req)
+
+			if w.Code != tc.httpCode {
+				t.Errorf("wrong status code: got %v want %v", w.Code, tc.httpCode)
+			}
+			if manager.purgeIn.callsNum != tc.expectedCallsNum {
+				t.Errorf("wrong Purge calls number: got %v want %v", manager.purgeIn.callsNum, tc.expectedCallsNum)
+			}
+			if manager.purgeIn.name != tc.expectedName {
+				t.Errorf("wrong name: got %v want %v", manager.purgeIn.name, tc.expectedName)
+			}
+			if w.Code != http.StatusOK {
+				return
+			}
+			if body := strings.TrimSpace(w.Body.String()); body != tc.expected {
+				t.Errorf("wrong body: got %v want %v", body, tc.expected)
+			}
+		})
+	}
+}
+
+func TestImportRequests(t *testing.T) {
+	testCases := []struct {
+		description      string
+		httpCode         int
+		method           string
+		url              string
+		body             string
+		expectedCallsNum int
+		expectedName     string
+		expectedMessages []string
+		err              error
+	}{
+		{
+			description:      "OK",
+			httpCode:         http.StatusOK,
+			method:           http.MethodPost,
+			url:              "/admin/queue/name1/import",
+			body:             `{"messages":["m1","m2"]}`,
+			expectedCallsNum: 1,
+			expectedName:     "name1",
+			expectedMessages: []string{"m1", "m2"},
+		},
+		{
+			description:      "Over limit",
+			httpCode:         http.StatusUnprocessableEntity,
+			method:           http.MethodPost,
+			url:              "/admin/queue/name2/import",
+			body:             `{"messages":["m1","m2"]}`,
+			expectedCallsNum: 1,
+			expectedName:     "name2",
+			expectedMessages: []string{"m1", "m2"},
+			err:              queue.ErrTooManyItems,
+		},
+		{
+			description:      "Topic",
+			httpCode:         http.StatusBadRequest,
+			method:           http.MethodPost,
+			url:              "/admin/queue/name3/import",
+			body:             `{"messages":["m1"]}`,
+			expectedCallsNum: 1,
+			expectedName:     "name3",
+			expectedMessages: []string{"m1"},
+			err:              queue.ErrWrongQueueType,
+		},
+		{
+			description:      "Message too large",
+			httpCode:         http.StatusRequestEntityTooLarge,
+			method:           http.MethodPost,
+			url:              "/admin/queue/name6/import",
+			body:             `{"messages":["m1"]}`,
+			expectedCallsNum: 1,
+			expectedName:     "name6",
+			expectedMessages: []string{"m1"},
+			err:              queue.ErrMessageTooLarge,
+		},
+		{
+			description: "Bad JSON",
+			httpCode:    http.StatusBadRequest,
+			method:      http.MethodPost,
+			url:         "/admin/queue/name4/import",
+			body:        `{"messages":[`,
+		},
+		{
+			description: "Wrong method",
+			httpCode:    http.StatusMethodNotAllowed,
+			method:      http.MethodPut,
+			url:         "/admin/queue/name5/import",
+			body:        `{"messages":["m1"]}`,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			manager := &MockQueueManager{putOut: PutOut{err: tc.err}}
+			handler := setupMux(manager, HandlerConfig{})
+
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest(tc.method, tc.url, strings.NewReader(tc.body))
+			handler.ServeHTTP(w, req)
+
+			if w.Code != tc.httpCode {
+				t.Errorf("wrong status code: got %v want %v", w.Code, tc.httpCode)
+			}
+			if manager.putBatchIn.callsNum != tc.expectedCallsNum {
+				t.Errorf("wrong PutBatch calls number: got %v want %v", manager.putBatchIn.callsNum, tc.expectedCallsNum)
+			}
+			if manager.putBatchIn.name != tc.expectedName {
+				t.Errorf("wrong name: got %v want %v", manager.putBatchIn.name, tc.expectedName)
+			}
+			if !slices.Equal(manager.putBatchIn.messages, tc.expectedMessages) {
+				t.Errorf("wrong messages: got %v want %v", manager.putBatchIn.messages, tc.expectedMessages)
+			}
+		})
+	}
+}
+
+func TestAliasRequests(t *testing.T) {
+	manager := queue.NewQueueManager(queue.QueueManagerConfig{MaxQueueNum: 10, MaxMessageNumPerQueue: 10})
+	defer manager.Stop()
+	handler := setupMux(manager, HandlerConfig{DefaultTimeout: 1, RetryAfter: retryAfter})
+
+	testCases := []struct {
+		description string
+		method      string
+		url         string
+		request     string
+		httpCode    int
+		body        string
+	}{
+		{
+			description: "Add",
+			method:      http.MethodPost,
+			url:         "/admin/queue/name1/alias/alias1",
+			httpCode:    http.StatusOK,
+		},
+		{
+			description: "Put by alias",
+			method:      http.MethodPut,
+			url:         "/queue/alias1",
+			request:     `{"message": "message1"}`,
+			httpCode:    http.StatusOK,
+		},
+		{
+			description: "Get by queue",
+			method:      http.MethodGet,
+			url:         "/queue/name1",
+			httpCode:    http.StatusOK,
+			body:        `{"message":"message1"}` + "\n",
+		},
+		{
+			description: "Cycle",
+			method:      http.MethodPost,
+			url:         "/admin/queue/alias1/alias/name1",
+			httpCode:    http.StatusBadRequest,
+		},
+		{
+			description: "Invalid alias",
+			method:      http.MethodPost,
+			url:         "/admin/queue/name1/alias/bad%20name",
+			httpCode:    http.StatusBadRequest,
+		},
+		{
+			description: "List",
+			method:      http.MethodGet,
+			url:         "/admin/queue/name1/alias",
+			httpCode:    http.StatusOK,
+			body:        `[{"name":"alias1","alias_of":"name1"}]` + "\n",
+		},
+		{
+			description: "Remove from other queue",
+			method:      http.MethodDelete,
+			url:         "/admin/queue/name2/alias/alias1",
+			httpCode:    http.StatusNotFound,
+		},
+		{
+			description: "Remove",
+			method:      http.MethodDelete,
+			url:         "/admin/queue/name1/alias/alias1",
+			httpCode:    http.StatusOK,
+		},
+		{
+			description: "List empty",
+			method:      http.MethodGet,
+			url:         "/admin/queue/name1/alias",
+			httpCode:    http.StatusOK,
+			body:        "[]\n",
+		},
+	}
+	for _, tc := range testCases {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(tc.method, tc.url, strings.NewReader(tc.request))
+		handler.ServeHTTP(w, req)
+
+		if w.Code != tc.httpCode {
+			t.Errorf("%s: wrong status code: got %v want %v", tc.description, w.Code, tc.httpCode)
+		}
+		if tc.body != "" && w.Body.String() != tc.body {
+			t.Errorf("%s: wrong body: got %q want %q", tc.description, w.Body.String(), tc.body)
+		}
+	}
+}
@@ -0,0 +1,119 @@
+package handler
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nebotan/simplebroker/queue"
+)
+
+// MetricsContentType задает тип ответа с метриками: текстовый формат Prometheus версии 0.0.4
+const MetricsContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// QueueStats задает статистику очереди Name для метрик
+type QueueStats struct {
+	Name string
+	queue.QueueStats
+	MessageWait queue.HistogramStats // время сообщений в очереди от PUT до выдачи GET
+}
+
+// CollectQueueStats собирает статистику всех очередей. Топики пропускаются, так как у них нет собственной статистики,
+// как и очереди, удаленные во время сбора
+func CollectQueueStats(queueManager queue.QueueManager) []QueueStats {
+	var result []QueueStats
+	for _, name := range queueManager.List() {
+		stats, err := queueManager.Stats(name)
+		if err != nil {
+			continue
+		}
+		messageWait, err := queueManager.MessageWait(name)
+		if err != nil {
+			continue
+		}
+		result = append(result, QueueStats{Name: name, QueueStats: stats, MessageWait: messageWait})
+	}
+	return result
+}
+
+// NewMetricsHandler возвращает обработчик, который отдает статистику очередей в текстовом формате Prometheus
+func NewMetricsHandler(queueManager queue.QueueManager) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", MetricsContentType)
+		if err := (TextRenderer{}).Render(w, CollectQueueStats(queueManager)); err != nil {
+			errorLogger.Printf("metrics write error: %v\n", err)
+		}
+	})
+}
+
+// queueMetric задает метрику Prometheus из одного поля статистики очереди
+type queueMetric struct {
+	name       string
+	help       string
+	metricType string
+	value      func(stats QueueStats) int64
+}
+
+var queueMetrics = []queueMetric{
+	{"simplebroker_queue_depth", "Number of messages waiting for delivery.", "gauge",
+		func(stats QueueStats) int64 { return stats.Depth }},
+	{"simplebroker_queue_in_flight", "Number of messages delivered with ack and not acknowledged yet.", "gauge",
+		func(stats QueueStats) int64 { return stats.InFlight }},
+	{"simplebroker_queue_produced_total", "Number of messages accepted by the queue.", "counter",
+		func(stats QueueStats) int64 { return stats.Produced }},
+	{"simplebroker_queue_consumed_total", "Number of messages delivered to readers, redeliveries included.", "counter",
+		func(stats QueueStats) int64 { return stats.Consumed }},
+	{"simplebroker_queue_errors_total", "Number of PUT rejected by limits and GET that got no message.", "counter",
+		func(stats QueueStats) int64 { return stats.Errors }},
+	{"simplebroker_queue_dropped_total", "Number of messages removed without delivery by TTL or overflow policy.", "counter",
+		func(stats QueueStats) int64 { return stats.Dropped }},
+	{"simplebroker_queue_expired_total", "Number of messages removed without delivery by TTL.", "counter",
+		func(stats QueueStats) int64 { return stats.Expired }},
+}
+
+// messageWaitMetric задает имя гистограммы времени сообщений в очереди
+const messageWaitMetric = "simplebroker_message_wait_duration_seconds"
+
+// labelEscaper экранирует значение метки в текстовом формате Prometheus
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// TextRenderer пишет статистику очередей в текстовом формате Prometheus 0.0.4. Формат простой,
+// поэтому пишется вручную, без клиентской библиотеки. Каждая метрика пишется одним блоком:
+// строки HELP и TYPE, затем значения для всех очередей с меткой queue
+type TextRenderer struct{}
+
+// Render пишет в w метрики очередей stats
+func (TextRenderer) Render(w io.Writer, stats []QueueStats) error {
+	var b strings.Builder
+	for _, metric := range queueMetrics {
+		fmt.Fprintf(&b, "# HELP %s %s\n", metric.name, metric.help)
+		fmt.Fprintf(&b, "# TYPE %s %s\n", metric.name, metric.metricType)
+		for _, s := range stats {
+			fmt.Fprintf(&b, "%s{queue=\"%s\"} %d\n", metric.name, labelEscaper.Replace(s.Name), metric.value(s))
+		}
+	}
+	fmt.Fprintf(&b, "# HELP %s Time a message waited in the queue from PUT until it was delivered to GET.\n", messageWaitMetric)
+	fmt.Fprintf(&b, "# TYPE %s histogram\n", messageWaitMetric)
+	for _, s := range stats {
+		label := labelEscaper.Replace(s.Name)
+		// Корзины Prometheus накопительные: каждая включает все предыдущие
+		var cumulative int64
+		for i, bound := range s.MessageWait.Bounds {
+			cumulative += s.MessageWait.Counts[i]
+			fmt.Fprintf(&b, "%s_bucket{queue=\"%s\",le=\"%s\"} %d\n", messageWaitMetric, label, formatSeconds(bound), cumulative)
+		}
+		fmt.Fprintf(&b, "%s_bucket{queue=\"%s\",le=\"+Inf\"} %d\n", messageWaitMetric, label, s.MessageWait.Count)
+		fmt.Fprintf(&b, "%s_sum{queue=\"%s\"} %s\n", messageWaitMetric, label, formatSeconds(s.MessageWait.Sum))
+		fmt.Fprintf(&b, "%s_count{queue=\"%s\"} %d\n", messageWaitMetric, label, s.MessageWait.Count)
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// formatSeconds записывает длительность в секундах без лишних нулей, например, 0.001
+func formatSeconds(d time.Duration) string {
+	return strconv.FormatFloat(d.Seconds(), 'g', -1, 64)
+}
@@ -0,0 +1,158 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nebotan/simplebroker/queue"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+)
+
+func TestTextRenderer(t *testing.T) {
+	stats := []QueueStats{
+		{
+			Name:       "name1",
+			QueueStats: queue.QueueStats{Depth: 42, InFlight: 2, Produced: 50, Consumed: 8, Errors: 3, Dropped: 1, Expired: 1},
+			MessageWait: queue.HistogramStats{
+				Bounds: []time.Duration{time.Millisecond, time.Second},
+				Counts: []int64{1, 4, 2},
+				Count:  7,
+				Sum:    3500 * time.Millisecond,
+			},
+		},
+		{
+			// Значение метки экранируется
+			Name:       `quote"name`,
+			QueueStats: queue.QueueStats{Depth: 1},
+		},
+	}
+	var b strings.Builder
+	if err := (TextRenderer{}).Render(&b, stats); err != nil {
+		t.Fatalf("Unexpected exception: %v", err)
+	}
+	var parser expfmt.TextParser
+	families, err := parser.TextToMetricFamilies(strings.NewReader(b.String()))
+	if err != nil {
+		t.Fatalf("invalid Prometheus text format: %v\n%s", err, b.String())
+	}
+
+	testCases := []struct {
+		metric     string
+		metricType dto.MetricType
+		queue      string
+		value      float64
+	}{
+		{"simplebroker_queue_depth", dto.MetricType_GAUGE, "name1", 42},
+		{"simplebroker_queue_depth", dto.MetricType_GAUGE, `quote"name`, 1},
+		{"simplebroker_queue_in_flight", dto.MetricType_GAUGE, "name1", 2},
+		{"simplebroker_queue_produced_total", dto.MetricType_COUNTER, "name1", 50},
+		{"simplebroker_queue_consumed_total", dto.MetricType_COUNTER, "name1", 8},
+		{"simplebroker_queue_errors_total", dto.MetricType_COUNTER, "name1", 3},
+		{"simplebroker_queue_dropped_total", dto.MetricType_COUNTER, "name1", 1},
+		{"simplebroker_queue_expired_total", dto.MetricType_COUNTER, "name1", 1},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.metric+" "+tc.queue, func(t *testing.T) {
+			family, ok := families[tc.metric]
+			if !ok {
+				t.Fatalf("metric not found")
+			}
+			if family.GetType() != tc.metricType {
+				t.Errorf("wrong type: got %v want %v", family.GetType(), tc.metricType)
+			}
+			if family.GetHelp() == "" {
+				t.Errorf("missing HELP")
+			}
+			metric := findMetric(family, tc.queue)
+			if metric == nil {
+				t.Fatalf("queue not found")
+			}
+			value := metric.GetGauge().GetValue() + metric.GetCounter().GetValue()
+			if value != tc.value {
+				t.Errorf("wrong value: got %v want %v", value, tc.value)
+			}
+		})
+	}
+
+	family, ok := families[messageWaitMetric]
+	if !ok || family.GetType() != dto.MetricType_HISTOGRAM {
+		t.Fatalf("histogram not found:\n%s", b.String())
+	}
+	histogram := findMetric(family, "name1").GetHistogram()
+	if histogram.GetSampleCount() != 7 || histogram.GetSampleSum() != 3.5 {
+		t.Errorf("wrong histogram count and sum: got %v %v want 7 3.5", histogram.GetSampleCount(), histogram.GetSampleSum())
+	}
+	// Корзины накопительные, последняя - +Inf
+	var buckets []uint64
+	for _, bucket := range histogram.GetBucket() {
+		buckets = append(buckets, bucket.GetCumulativeCount())
+	}
+	if want := []uint64{1, 5, 7}; !slices.Equal(buckets, want) {
+		t.Errorf("wrong buckets: got %v want %v", buckets, want)
+	}
+}
+
+func findMetric(family *dto.MetricFamily, queueName string) *dto.Metric {
+	for _, metric := range family.GetMetric() {
+		for _, label := range metric.GetLabel() {
+			if label.GetName() == "queue" && label.GetValue() == queueName {
+				return metric
+			}
+		}
+	}
+	return nil
+}
+
+func TestMetricsHandler(t *testing.T) {
+	const delay = 20 * time.Millisecond
+	queueManager := queue.NewQueueManager(queue.QueueManagerConfig{MaxQueueNum: 10, MaxMessageNumPerQueue: 10})
+	defer queueManager.Stop()
+	ctx := context.Background()
+	if err := queueManager.Put(ctx, "name1", "message1"); err != nil {
+		t.Fatalf("Unexpected exception: %v", err)
+	}
+	time.Sleep(delay)
+	if _, err := queueManager.Get(ctx, "name1", 1); err != nil {
+		t.Fatalf("Unexpected exception: %v", err)
+	}
+	// Очередь без выданных сообщений тоже попадает в метрики с нулями
+	if err := queueManager.Put(ctx, "empty", "message"); err != nil {
+		t.Fatalf("Unexpected exception: %v", err)
+	}
+	// Топик пропускается, у него нет собственной статистики
+	if _, err := queueManager.GetSub(ctx, "topic", "sub", 1); err == nil {
+		t.Fatalf("Unexpected message from topic")
+	}
+
+	w := httptest.NewRecorder()
+	NewMetricsHandler(queueManager).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+	if contentType := w.Header().Get("Content-Type"); contentType != MetricsContentType {
+		t.Errorf("wrong Content-Type: got %v want %v", contentType, MetricsContentType)
+	}
+	lines := strings.Split(w.Body.String(), "\n")
+	for _, want := range []string{
+		`simplebroker_queue_depth{queue="name1"} 0`,
+		`simplebroker_queue_depth{queue="empty"} 1`,
+		`simplebroker_queue_consumed_total{queue="name1"} 1`,
+		`simplebroker_message_wait_duration_seconds_bucket{queue="name1",le="0.001"} 0`,
+		`simplebroker_message_wait_duration_seconds_bucket{queue="name1",le="0.01"} 0`,
+		`simplebroker_message_wait_duration_seconds_bucket{queue="name1",le="0.1"} 1`,
+		`simplebroker_message_wait_duration_seconds_bucket{queue="name1",le="+Inf"} 1`,
+		`simplebroker_message_wait_duration_seconds_count{queue="name1"} 1`,
+		`simplebroker_message_wait_duration_seconds_bucket{queue="empty",le="+Inf"} 0`,
+	} {
+		if !slices.Contains(lines, want) {
+			t.Errorf("line [%s] not found in metrics:\n%s", want, w.Body.String())
+		}
+	}
+	if strings.Contains(w.Body.String(), `queue="topic"`) {
+		t.Errorf("topic in metrics:\n%s", w.Body.String())
+	}
+}
@@ -0,0 +1,207 @@
+package handler
+
+import (
+	"bufio"
+	"compress/gzip"
+	"errors"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// gzipMinSize задает размер ответа, начиная с которого он сжимается: сжатие маленьких ответов не окупается
+const gzipMinSize = 256
+
+// gzipMiddleware оборачивает handler сжатием ответа, если клиент принимает Accept-Encoding: gzip,
+// и распаковкой тела запроса, если оно пришло с Content-Encoding: gzip.
+// Ответ копится в буфере до gzipMinSize байт и отправляется без сжатия, если оказался меньше.
+// Не подходит для потоковых обработчиков (SSE, WebSocket), так как не поддерживает Flush и Hijack
+func gzipMiddleware(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Ответ зависит от Accept-Encoding, кэши не должны отдавать сжатый ответ другим клиентам
+		w.Header().Add("Vary", "Accept-Encoding")
+		if strings.EqualFold(strings.TrimSpace(r.Header.Get("Content-Encoding")), "gzip") {
+			gz, err := gzip.NewReader(r.Body)
+			if err != nil {
+				errorLogger.Println("gzip request body error:", err)
+				http.Error(w, "", http.StatusBadRequest)
+				return
+			}
+			defer gz.Close()
+			// Обработчик получает уже распакованное тело, размер которого заранее неизвестен
+			r.Body = gz
+			r.Header.Del("Content-Encoding")
+			r.Header.Del("Content-Length")
+			r.ContentLength = -1
+		}
+		if !acceptsGzip(r) {
+			handler.ServeHTTP(w, r)
+			return
+		}
+		gw := &gzipResponseWriter{ResponseWriter: w}
+		defer gw.close()
+		handler.ServeHTTP(gw, r)
+	})
+}
+
+// acceptsGzip проверяет, есть ли gzip в Accept-Encoding и не запрещен ли он через q=0
+func acceptsGzip(r *http.Request) bool {
+	for _, encoding := range strings.Split(r.Header.Get("Accept-Encoding"), ",") {
+		name, params, _ := strings.Cut(encoding, ";")
+		if strings.TrimSpace(name) != "gzip" {
+			continue
+		}
+		q, found := strings.CutPrefix(strings.TrimSpace(params), "q=")
+		if !found {
+			return true
+		}
+		v, err := strconv.ParseFloat(q, 64)
+		return err == nil && v > 0
+	}
+	return false
+}
+
+// gzipResponseWriter откладывает выбор между сжатием и обычным ответом, пока не наберется gzipMinSize байт
+type gzipResponseWriter struct {
+	http.ResponseWriter
+	status int          // код ответа, отложенный до выбора сжатия
+	buf    []byte       // начало ответа до выбора сжатия
+	gz     *gzip.Writer // не nil, если ответ сжимается
+}
+
+func (w *gzipResponseWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+}
+
+func (w *gzipResponseWriter) Write(p []byte) (int, error) {
+	if w.gz != nil {
+		return w.gz.Write(p)
+	}
+	w.buf = append(w.buf, p...)
+	if len(w.buf) < gzipMinSize {
+		return len(p), nil
+	}
+	// Размер набрался, дальше весь ответ идет через gzip
+	w.Header().Del("Content-Length")
+	w.Header().Set("Content-Encoding", "gzip")
+	w.writeStatus()
+	w.gz = gzip.NewWriter(w.ResponseWriter)
+	if _, err := w.gz.Write(w.buf); err != nil {
+		return 0, err
+	}
+	w.buf = nil
+	return len(p), nil
+}
+
+func (w *gzipResponseWriter) writeStatus() {
+	if w.status != 0 {
+		w.ResponseWriter.WriteHeader(w.status)
+	}
+}
+
+// close дописывает сжатый ответ или отправляет накопленный маленький ответ как есть
+func (w *gzipResponseWriter) close() {
+	if w.gz != nil {
+		if err := w.gz.Close(); err != nil {
+			errorLogger.Println("gzip close error:", err)
+		}
+		return
+	}
+	w.writeStatus()
+	if len(w.buf) != 0 {
+		if _, err := w.ResponseWriter.Write(w.buf); err != nil {
+			errorLogger.Println("response write error:", err)
+		}
+	}
+}
+
+// requestIDHeader задает заголовок, из которого в журнал запросов попадает идентификатор запроса
+const requestIDHeader = "X-Request-ID"
+
+// newAccessLogger создает журнал запросов, пишущий в w. Для nil журнал не ведется и возвращается nil.
+// log.Logger сериализует записи, поэтому строки параллельных запросов не перемешиваются
+func newAccessLogger(w io.Writer) *log.Logger {
+	if w == nil {
+		return nil
+	}
+	return log.New(w, "", 0)
+}
+
+// loggingMiddleware оборачивает handler записью в logger строки "method path status latency request_id"
+// после завершения каждого запроса. Задержка пишется в микросекундах, так как большинство запросов быстрее миллисекунды.
+// Если идентификатора запроса нет в X-Request-ID, то вместо него пишется "-".
+// Если logger равен nil, то handler возвращается как есть
+func loggingMiddleware(handler http.Handler, logger *log.Logger) http.Handler {
+	if logger == nil {
+		return handler
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rw := &responseWriterWrapper{ResponseWriter: w}
+		handler.ServeHTTP(rw, r)
+		requestID := r.Header.Get(requestIDHeader)
+		if requestID == "" {
+			requestID = "-"
+		}
+		logger.Printf("%s %s %d %dus %s\n", r.Method, r.URL.Path, rw.statusCode(), time.Since(start).Microseconds(), requestID)
+	})
+}
+
+// responseWriterWrapper запоминает код ответа, который http.ResponseWriter не позволяет прочитать.
+// Flush и Hijack передаются дальше, чтобы через обертку работали SSE и WebSocket
+type responseWriterWrapper struct {
+	http.ResponseWriter
+	status int // первый записанный код ответа, 0 - ответ еще не начат
+}
+
+func (w *responseWriterWrapper) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *responseWriterWrapper) Write(p []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	return w.ResponseWriter.Write(p)
+}
+
+func (w *responseWriterWrapper) Flush() {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+func (w *responseWriterWrapper) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("hijacking is not supported")
+	}
+	// После перехвата соединения ответ пишет сам обработчик, для журнала это переключение протокола
+	w.status = http.StatusSwitchingProtocols
+	return hijacker.Hijack()
+}
+
+// Unwrap открывает исходный http.ResponseWriter для http.ResponseController
+func (w *responseWriterWrapper) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// statusCode возвращает код ответа, обработчик без записи в ответ получает от net/http код 200
+func (w *responseWriterWrapper) statusCode() int {
+	if w.status == 0 {
+		return http.StatusOK
+	}
+	return w.status
+}
@@ -0,0 +1,256 @@
+package handler
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/nebotan/simplebroker/queue"
+)
+
+func TestGzipMiddleware(t *testing.T) {
+	largeMessage := strings.Repeat("message ", 100)
+	testCases := []struct {
+		description    string
+		acceptEncoding string
+		message        string
+		gzipped        bool
+	}{
+		{
+			description:    "Large response",
+			acceptEncoding: "gzip, deflate",
+			message:        largeMessage,
+			gzipped:        true,
+		},
+		{
+			description:    "Small response",
+			acceptEncoding: "gzip",
+			message:        "message1",
+		},
+		{
+			description: "No Accept-Encoding",
+			message:     largeMessage,
+		},
+		{
+			description:    "Gzip disabled by q=0",
+			acceptEncoding: "gzip;q=0",
+			message:        largeMessage,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			manager := &MockQueueManager{getOut: GetOut{message: tc.message}}
+			handler := setupMux(manager, HandlerConfig{DefaultTimeout: 1, RetryAfter: retryAfter})
+
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodGet, "/queue/name1", nil)
+			req.Header.Set("Accept-Encoding", tc.acceptEncoding)
+			handler.ServeHTTP(w, req)
+
+			if w.Code != http.StatusOK {
+				t.Errorf("wrong status code: got %v want %v", w.Code, http.StatusOK)
+			}
+			body := io.Reader(w.Body)
+			if encoding := w.Header().Get("Content-Encoding"); (encoding == "gzip") != tc.gzipped {
+				t.Fatalf("wrong Content-Encoding: got [%v] gzipped %v", encoding, tc.gzipped)
+			}
+			if tc.gzipped {
+				gz, err := gzip.NewReader(w.Body)
+				if err != nil {
+					t.Fatalf("gzip reader error: %v", err)
+				}
+				body = gz
+			}
+			data, err := io.ReadAll(body)
+			if err != nil {
+				t.Fatalf("read error: %v", err)
+			}
+			expected, _ := json.Marshal(messageDto{Message: tc.message})
+			if strings.TrimSpace(string(data)) != string(expected) {
+				t.Errorf("wrong body: got [%s] want [%s]", data, expected)
+			}
+		})
+	}
+}
+
+// TestGzipMiddlewareError проверяет, что код ошибки и маленькое тело проходят через буфер без изменений
+func TestGzipMiddlewareError(t *testing.T) {
+	handler := gzipMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "", http.StatusNotFound)
+	}))
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/queue/name1", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	handler.ServeHTTP(w, req)
+	if w.Code != http.StatusNotFound {
+		t.Errorf("wrong status code: got %v want %v", w.Code, http.StatusNotFound)
+	}
+	if w.Header().Get("Content-Encoding") != "" {
+		t.Errorf("small error response is not expected to be gzipped")
+	}
+}
+
+func TestGzipRequest(t *testing.T) {
+	gzipped := func(body string) io.Reader {
+		var buf bytes.Buffer
+		gz := gzip.NewWriter(&buf)
+		_, _ = gz.Write([]byte(body))
+		_ = gz.Close()
+		return &buf
+	}
+	testCases := []struct {
+		description string
+		httpCode    int
+		body        io.Reader
+		message     string
+	}{
+		{
+			description: "Gzipped body",
+			httpCode:    http.StatusOK,
+			body:        gzipped(`{"message": "message1"}`),
+			message:     "message1",
+		},
+		{
+			description: "Body is not gzipped",
+			httpCode:    http.StatusBadRequest,
+			body:        strings.NewReader(`{"message": "message2"}`),
+		},
+		{
+			description: "Gzipped body with invalid JSON",
+			httpCode:    http.StatusBadRequest,
+			body:        gzipped(`{some strange things`),
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			manager := &MockQueueManager{}
+			handler := setupMux(manager, HandlerConfig{DefaultTimeout: 1, RetryAfter: retryAfter})
+
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodPut, "/queue/name1", tc.body)
+			req.Header.Set("Content-Encoding", "gzip")
+			handler.ServeHTTP(w, req)
+
+			if w.Code != tc.httpCode {
+				t.Errorf("wrong status code: got %v want %v", w.Code, tc.httpCode)
+			}
+			if tc.httpCode != http.StatusOK {
+				if manager.putIn.callsNum != 0 {
+					t.Errorf("wrong PUT calls number: got %v want %v", manager.putIn.callsNum, 0)
+				}
+				return
+			}
+			if manager.putIn.message != tc.message {
+				t.Errorf("wrong message: got [%v] want [%v]", manager.putIn.message, tc.message)
+			}
+		})
+	}
+}
+
+// TestGzipExport проверяет, что большой экспорт приходит сжатым и распаковывается в исходные сообщения
+func TestGzipExport(t *testing.T) {
+	messages := make([]string, 100)
+	for i := range messages {
+		messages[i] = strings.Repeat("message ", 10)
+	}
+	manager := &MockQueueManager{snapshotOut: SnapshotOut{messages: messages}}
+	handler := setupMux(manager, HandlerConfig{})
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/admin/queue/name1/export", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	handler.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("wrong status code: got %v want %v", w.Code, http.StatusOK)
+	}
+	if encoding := w.Header().Get("Content-Encoding"); encoding != "gzip" {
+		t.Fatalf("wrong Content-Encoding: got [%v] want [gzip]", encoding)
+	}
+	gz, err := gzip.NewReader(w.Body)
+	if err != nil {
+		t.Fatalf("gzip reader error: %v", err)
+	}
+	var dto exportDto
+	if err := json.NewDecoder(gz).Decode(&dto); err != nil {
+		t.Fatalf("JSON decode error: %v", err)
+	}
+	if !slices.Equal(dto.Messages, messages) {
+		t.Errorf("wrong messages: got %v want %v", dto.Messages, messages)
+	}
+}
+
+func TestLoggingMiddleware(t *testing.T) {
+	testCases := []struct {
+		description string
+		method      string
+		body        string
+		requestID   string
+		httpCode    int
+		managerErr  error
+		expected    string
+	}{
+		{
+			description: "PUT",
+			method:      http.MethodPut,
+			body:        `{"message": "message1"}`,
+			requestID:   "request1",
+			httpCode:    http.StatusOK,
+			expected:    "PUT /queue/name1 200 request1",
+		},
+		{
+			description: "GET without request id",
+			method:      http.MethodGet,
+			httpCode:    http.StatusOK,
+			expected:    "GET /queue/name1 200 -",
+		},
+		{
+			description: "GET without message",
+			method:      http.MethodGet,
+			requestID:   "request3",
+			httpCode:    http.StatusNotFound,
+			managerErr:  queue.ErrNoMessage,
+			expected:    "GET /queue/name1 404 request3",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			manager := &MockQueueManager{getOut: GetOut{message: "message1", err: tc.managerErr}}
+			var accessLog bytes.Buffer
+			handler := setupMux(manager, HandlerConfig{DefaultTimeout: 1, RetryAfter: retryAfter, AccessLog: &accessLog})
+
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest(tc.method, "/queue/name1", strings.NewReader(tc.body))
+			if tc.requestID != "" {
+				req.Header.Set("X-Request-ID", tc.requestID)
+			}
+			handler.ServeHTTP(w, req)
+
+			if w.Code != tc.httpCode {
+				t.Errorf("wrong status code: got %v want %v", w.Code, tc.httpCode)
+			}
+			lines := strings.Split(strings.TrimSuffix(accessLog.String(), "\n"), "\n")
+			if len(lines) != 1 {
+				t.Fatalf("wrong log lines number: got %v want %v", len(lines), 1)
+			}
+			// Задержка меняется от запуска к запуску, поэтому сравниваем остальные поля
+			fields := strings.Fields(lines[0])
+			if len(fields) != 5 {
+				t.Fatalf("wrong log line: got [%s]", lines[0])
+			}
+			if !strings.HasSuffix(fields[3], "us") {
+				t.Errorf("latency is expected in microseconds: got [%s]", fields[3])
+			}
+			got := strings.Join(slices.Delete(fields, 3, 4), " ")
+			if got != tc.expected {
+				t.Errorf("wrong log line: got [%s] want [%s]", got, tc.expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,42 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+
+	"github.com/nebotan/simplebroker/api"
+	"gopkg.in/yaml.v3"
+)
+
+// openAPIYAML читает встроенную спецификацию один раз при первом запросе
+var openAPIYAML = sync.OnceValues(func() ([]byte, error) {
+	return api.FS.ReadFile(api.SpecPath)
+})
+
+// openAPIJSON переводит спецификацию в JSON один раз при первом запросе
+var openAPIJSON = sync.OnceValues(func() ([]byte, error) {
+	spec, err := openAPIYAML()
+	if err != nil {
+		return nil, err
+	}
+	var doc any
+	if err := yaml.Unmarshal(spec, &doc); err != nil {
+		return nil, err
+	}
+	return json.Marshal(doc)
+})
+
+// createOpenAPIHandler возвращает обработчик, который отдает спецификацию API, полученную от spec
+func createOpenAPIHandler(spec func() ([]byte, error), contentType string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		body, err := spec()
+		if err != nil {
+			errorLogger.Printf("OpenAPI specification error: %v\n", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", contentType)
+		w.Write(body)
+	})
+}
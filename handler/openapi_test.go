@@ -0,0 +1,103 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/getkin/kin-openapi/openapi3"
+)
+
+func loadOpenAPI(t *testing.T) *openapi3.T {
+	t.Helper()
+	spec, err := openAPIYAML()
+	if err != nil {
+		t.Fatalf("read specification error: %v", err)
+	}
+	doc, err := openapi3.NewLoader().LoadFromData(spec)
+	if err != nil {
+		t.Fatalf("load specification error: %v", err)
+	}
+	return doc
+}
+
+func TestOpenAPISpec(t *testing.T) {
+	if err := loadOpenAPI(t).Validate(context.Background()); err != nil {
+		t.Errorf("invalid specification: %v", err)
+	}
+}
+
+// routeRecorder запоминает зарегистрированные маршруты вместо обработки запросов
+type routeRecorder struct {
+	patterns []string
+}
+
+func (r *routeRecorder) Handle(pattern string, _ http.Handler) {
+	r.patterns = append(r.patterns, pattern)
+}
+
+func TestOpenAPIRoutes(t *testing.T) {
+	doc := loadOpenAPI(t)
+	recorder := &routeRecorder{}
+	setup(recorder, &MockQueueManager{}, HandlerConfig{DefaultTimeout: 1})
+
+	// HEAD потоковых маршрутов только отвечает 405, чтобы mux не отдал его обработчику GET
+	notDocumented := map[string]bool{
+		"HEAD /ws/queue/{queue}":  true,
+		"HEAD /sse/queue/{queue}": true,
+	}
+	for _, pattern := range recorder.patterns {
+		if notDocumented[pattern] {
+			continue
+		}
+		method, path, _ := strings.Cut(pattern, " ")
+		pathItem := doc.Paths.Find(path)
+		if pathItem == nil || pathItem.GetOperation(method) == nil {
+			t.Errorf("route [%s] is missing in the specification", pattern)
+		}
+	}
+}
+
+func TestOpenAPIRequests(t *testing.T) {
+	testCases := []struct {
+		description string
+		path        string
+		contentType string
+	}{
+		{
+			description: "YAML",
+			path:        "/openapi.yaml",
+			contentType: "application/yaml",
+		},
+		{
+			description: "JSON",
+			path:        "/openapi.json",
+			contentType: "application/json",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			// Спецификация доступна без ключа
+			mux := setupMux(&MockQueueManager{}, HandlerConfig{DefaultTimeout: 1, APIKeys: []string{"key1"}})
+
+			w := httptest.NewRecorder()
+			mux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, tc.path, nil))
+
+			if w.Code != http.StatusOK {
+				t.Fatalf("wrong status code: got %v want %v", w.Code, http.StatusOK)
+			}
+			if contentType := w.Header().Get("Content-Type"); contentType != tc.contentType {
+				t.Errorf("wrong Content-Type: got %v want %v", contentType, tc.contentType)
+			}
+			doc, err := openapi3.NewLoader().LoadFromData(w.Body.Bytes())
+			if err != nil {
+				t.Fatalf("load specification error: %v", err)
+			}
+			if doc.Paths.Find("/queue/{queue}") == nil {
+				t.Errorf("specification has no /queue/{queue}")
+			}
+		})
+	}
+}
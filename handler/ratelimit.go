@@ -0,0 +1,107 @@
+package handler
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// rateLimitSweepInterval задает, как часто удаляются состояния очередей, к которым давно не обращались
+const rateLimitSweepInterval = time.Minute
+
+// RateLimit задает ограничение token bucket: Rate запросов в секунду в среднем и Burst запросов подряд.
+// Нулевой Rate отключает ограничение
+type RateLimit struct {
+	Rate  float64
+	Burst int
+}
+
+// tokenBucket хранит состояние ограничения одной очереди
+type tokenBucket struct {
+	tokens float64   // доступные запросы на момент last
+	last   time.Time // момент последнего пересчета tokens
+}
+
+// rateLimiter ограничивает частоту запросов к каждой очереди отдельно
+type rateLimiter struct {
+	defaultLimit RateLimit
+	overrides    map[string]RateLimit // ограничения для отдельных очередей вместо defaultLimit
+	buckets      map[string]*tokenBucket
+	lastSweep    time.Time
+	mutex        sync.Mutex
+	now          func() time.Time // позволяет подменять время в юнит тестах
+}
+
+func newRateLimiter(defaultLimit RateLimit, overrides map[string]RateLimit) *rateLimiter {
+	return &rateLimiter{
+		defaultLimit: defaultLimit,
+		overrides:    overrides,
+		buckets:      make(map[string]*tokenBucket),
+		lastSweep:    time.Now(),
+		now:          time.Now,
+	}
+}
+
+func (l *rateLimiter) limitFor(name string) RateLimit {
+	if limit, ok := l.overrides[name]; ok {
+		return limit
+	}
+	return l.defaultLimit
+}
+
+// allow расходует один запрос из лимита очереди name.
+// Если лимит исчерпан, то возвращает false и время, через которое запрос станет доступен
+func (l *rateLimiter) allow(name string) (bool, time.Duration) {
+	limit := l.limitFor(name)
+	if limit.Rate <= 0 {
+		return true, 0
+	}
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	now := l.now()
+	l.sweep(now)
+	bucket := l.buckets[name]
+	if bucket == nil {
+		bucket = &tokenBucket{tokens: float64(limit.Burst), last: now}
+		l.buckets[name] = bucket
+	}
+	bucket.tokens = math.Min(float64(limit.Burst), bucket.tokens+now.Sub(bucket.last).Seconds()*limit.Rate)
+	bucket.last = now
+	if bucket.tokens < 1 {
+		return false, time.Duration((1 - bucket.tokens) / limit.Rate * float64(time.Second))
+	}
+	bucket.tokens--
+	return true, 0
+}
+
+// sweep удаляет состояния очередей, которые успели полностью восстановить лимит.
+// Такое состояние ничем не отличается от нового, поэтому удаление ничего не меняет для клиентов
+func (l *rateLimiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < rateLimitSweepInterval {
+		return
+	}
+	l.lastSweep = now
+	for name, bucket := range l.buckets {
+		limit := l.limitFor(name)
+		if bucket.tokens+now.Sub(bucket.last).Seconds()*limit.Rate >= float64(limit.Burst) {
+			delete(l.buckets, name)
+		}
+	}
+}
+
+// withRateLimit оборачивает handler ограничением частоты GET и PUT запросов к очереди.
+// При превышении лимита возвращается 429 с заголовком Retry-After в секундах
+func withRateLimit(handler http.Handler, limiter *rateLimiter) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet || r.Method == http.MethodPut {
+			if ok, retryAfter := limiter.allow(r.PathValue("queue")); !ok {
+				w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+				http.Error(w, "", http.StatusTooManyRequests)
+				return
+			}
+		}
+		handler.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,84 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// TestRateLimitBurst проверяет, что запросы сверх burst получают 429 с Retry-After,
+// а лимит восстанавливается со временем
+func TestRateLimitBurst(t *testing.T) {
+	const burst = 3
+	limiter := newRateLimiter(RateLimit{Rate: 0.5, Burst: burst}, map[string]RateLimit{"unlimited": {}})
+	now := time.Now()
+	limiter.now = func() time.Time { return now }
+	callsNum := 0
+	// Имя очереди limiter получает через PathValue, поэтому запросы идут через mux
+	handler := http.NewServeMux()
+	handler.Handle("/queue/{queue}", withRateLimit(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		callsNum++
+	}), limiter))
+
+	serve := func(method, url string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(method, url, nil))
+		return w
+	}
+	for i := range burst {
+		if w := serve(http.MethodPut, "/queue/name1"); w.Code != http.StatusOK {
+			t.Errorf("wrong status code for request %d: got %v want %v", i, w.Code, http.StatusOK)
+		}
+	}
+	w := serve(http.MethodGet, "/queue/name1")
+	if w.Code != http.StatusTooManyRequests {
+		t.Errorf("wrong status code: got %v want %v", w.Code, http.StatusTooManyRequests)
+	}
+	// При 0.5 запроса в секунду следующий запрос станет доступен через 2 секунды
+	if v := w.Header().Get("Retry-After"); v != "2" {
+		t.Errorf("wrong Retry-After: got [%v] want [%v]", v, "2")
+	}
+	if callsNum != burst {
+		t.Errorf("wrong handler calls number: got %v want %v", callsNum, burst)
+	}
+	// Лимит считается для каждой очереди отдельно
+	if w := serve(http.MethodPut, "/queue/name2"); w.Code != http.StatusOK {
+		t.Errorf("wrong status code: got %v want %v", w.Code, http.StatusOK)
+	}
+	// Ограничение не распространяется на остальные методы
+	if w := serve(http.MethodDelete, "/queue/name1"); w.Code != http.StatusOK {
+		t.Errorf("wrong status code: got %v want %v", w.Code, http.StatusOK)
+	}
+	// Очередь с нулевым Rate в переопределениях не ограничивается
+	for range 2 * burst {
+		if w := serve(http.MethodPut, "/queue/unlimited"); w.Code != http.StatusOK {
+			t.Errorf("wrong status code: got %v want %v", w.Code, http.StatusOK)
+		}
+	}
+	now = now.Add(2 * time.Second)
+	if w := serve(http.MethodGet, "/queue/name1"); w.Code != http.StatusOK {
+		t.Errorf("wrong status code: got %v want %v", w.Code, http.StatusOK)
+	}
+}
+
+// TestRateLimitSweep проверяет, что состояния очередей, полностью восстановивших лимит, удаляются
+func TestRateLimitSweep(t *testing.T) {
+	limiter := newRateLimiter(RateLimit{Rate: 1, Burst: 1}, nil)
+	now := time.Now()
+	limiter.now = func() time.Time { return now }
+
+	if ok, _ := limiter.allow("name1"); !ok {
+		t.Errorf("request is expected to be allowed")
+	}
+	now = now.Add(rateLimitSweepInterval)
+	if ok, _ := limiter.allow("name2"); !ok {
+		t.Errorf("request is expected to be allowed")
+	}
+	if _, ok := limiter.buckets["name1"]; ok {
+		t.Errorf("idle queue state is expected to be removed")
+	}
+	if _, ok := limiter.buckets["name2"]; !ok {
+		t.Errorf("active queue state is expected to be kept")
+	}
+}
@@ -0,0 +1,118 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/nebotan/simplebroker/queue"
+)
+
+func createSSEHandler(queueManager queue.QueueManager, defaultTimeout int) http.Handler {
+	return &sseHandlerImpl{
+		queueManager:   queueManager,
+		defaultTimeout: defaultTimeout,
+	}
+}
+
+// sseHandlerImpl обрабатывает GET /sse/queue/{queue}?timeout=, отправляя каждое сообщение очереди
+// событием Server-Sent Events вида "data: {"message": "data"}", пока клиент не отключится.
+// С ?sub= читается подписка топика, а событие получает поле id с идентификатором сообщения:
+// браузер сам передает его в заголовке Last-Event-ID при переподключении, и поток продолжается с этого места
+type sseHandlerImpl struct {
+	queueManager   queue.QueueManager
+	defaultTimeout int // таймаут одного ожидания сообщения, если не задан timeout
+}
+
+func (h *sseHandlerImpl) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("queue")
+	timeout := h.defaultTimeout
+	if timeoutAsStr := r.URL.Query().Get("timeout"); timeoutAsStr != "" {
+		v, err := strconv.Atoi(timeoutAsStr)
+		if err != nil || v <= 0 {
+			errorLogger.Printf("SSE timeout [%s] parse error:%v\n", timeoutAsStr, err)
+			http.Error(w, "", http.StatusBadRequest)
+			return
+		}
+		timeout = v
+	}
+	sub := r.URL.Query().Get("sub")
+	cursor := r.Header.Get("Last-Event-ID")
+	if sub == "" && cursor != "" {
+		// Курсор есть только у подписки
+		http.Error(w, "", http.StatusBadRequest)
+		return
+	}
+	if sub != "" && !checkSubscription(w, r, h.queueManager, name, sub, cursor) {
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		errorLogger.Println("SSE ResponseWriter does not support flushing")
+		http.Error(w, "", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	// Отправляем заголовки сразу, чтобы клиент не ждал первого сообщения
+	flusher.Flush()
+	var err error
+	if sub != "" {
+		err = queue.StreamSub(r.Context(), h.queueManager, name, sub, cursor, timeout, func(message queue.Message) error {
+			return writeSSEEvent(w, flusher, message.ID, message.Body)
+		})
+	} else {
+		err = queue.Stream(r.Context(), h.queueManager, name, timeout, func(message string) error {
+			return writeSSEEvent(w, flusher, "", message)
+		})
+	}
+	if err != nil {
+		// Заголовки уже отправлены, поэтому код ответа не изменить, поток просто завершается
+		errorLogger.Println("SSE stream error:", err)
+	}
+}
+
+// writeSSEEvent отправляет сообщение событием SSE, id задается только для подписки
+func writeSSEEvent(w http.ResponseWriter, flusher http.Flusher, id, message string) error {
+	data, err := json.Marshal(messageDto{Message: message})
+	if err != nil {
+		return err
+	}
+	if id != "" {
+		if _, err := fmt.Fprintf(w, "id: %s\n", id); err != nil {
+			return err
+		}
+	}
+	if _, err := fmt.Fprintf(w, "data: %s\n\n", data); err != nil {
+		return err
+	}
+	flusher.Flush()
+	return nil
+}
+
+// checkSubscription до начала потока создает подписку sub топика name и проверяет курсор,
+// чтобы ошибку можно было вернуть кодом ответа. Возвращает false, если ответ с ошибкой уже отправлен
+func checkSubscription(w http.ResponseWriter, r *http.Request, queueManager queue.QueueManager, name, sub, cursor string) bool {
+	if cursor != "" {
+		if _, err := strconv.ParseUint(cursor, 10, 64); err != nil {
+			http.Error(w, "", http.StatusBadRequest)
+			return false
+		}
+	}
+	err := queueManager.Subscribe(name, sub, nil)
+	if err == nil {
+		return true
+	}
+	if errors.Is(err, queue.ErrWrongQueueType) || errors.Is(err, queue.ErrInvalidQueueName) {
+		writeError(w, r, http.StatusBadRequest)
+	} else if errors.Is(err, queue.ErrTooManyItems) {
+		writeError(w, r, http.StatusTooManyRequests)
+	} else {
+		errorLogger.Println("stream Subscribe error:", err)
+		writeError(w, r, http.StatusInternalServerError)
+	}
+	return false
+}
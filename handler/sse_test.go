@@ -0,0 +1,188 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nebotan/simplebroker/queue"
+)
+
+// TestSSEConsumer проверяет, что сообщения очереди приходят событиями data:, а отключение клиента
+// завершает обработчик, даже когда он ждет новых сообщений
+func TestSSEConsumer(t *testing.T) {
+	const N = 3
+	manager := queue.NewQueueManager(queue.QueueManagerConfig{MaxQueueNum: 10, MaxMessageNumPerQueue: 10})
+	defer manager.Stop()
+	for i := range N {
+		if err := manager.Put(context.Background(), "name1", fmt.Sprintf("message%d", i)); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	handler := setupMux(manager, HandlerConfig{DefaultTimeout: 1})
+
+	// Отключение клиента имитируется истечением контекста запроса, пока обработчик ждет сообщения
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	w := httptest.NewRecorder()
+	req := httptest.NewRequestWithContext(ctx, http.MethodGet, "/sse/queue/name1?timeout=5", nil)
+	handler.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Errorf("wrong status code: got %v want %v", w.Code, http.StatusOK)
+	}
+	if contentType := w.Header().Get("Content-Type"); contentType != "text/event-stream" {
+		t.Errorf("wrong Content-Type: got %v want %v", contentType, "text/event-stream")
+	}
+	events := strings.Split(strings.TrimSuffix(w.Body.String(), "\n\n"), "\n\n")
+	if len(events) != N {
+		t.Fatalf("wrong events number: got %v want %v, body [%s]", len(events), N, w.Body.String())
+	}
+	for i, event := range events {
+		data, found := strings.CutPrefix(event, "data: ")
+		if !found {
+			t.Errorf("event without data: [%s]", event)
+			continue
+		}
+		var dto messageDto
+		if err := json.Unmarshal([]byte(data), &dto); err != nil {
+			t.Errorf("json decoding error: %v", err)
+		}
+		if expected := fmt.Sprintf("message%d", i); dto.Message != expected {
+			t.Errorf("wrong message: got %v want %v", dto.Message, expected)
+		}
+	}
+}
+
+// TestSSESubscriptionResume проверяет, что переподключение подписки с Last-Event-ID возвращает сообщения,
+// которые ушли в разорванное соединение после этого события, а затем и пришедшие без читателя
+func TestSSESubscriptionResume(t *testing.T) {
+	manager := queue.NewQueueManager(queue.QueueManagerConfig{
+		MaxQueueNum:                10,
+		MaxMessageNumPerQueue:      10,
+		MaxSubscriptionNumPerTopic: 10,
+		SubscriptionRetention:      time.Minute,
+	})
+	defer manager.Stop()
+	if err := manager.Subscribe("topic1", "sub1", nil); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	handler := setupMux(manager, HandlerConfig{DefaultTimeout: 1})
+	// readEvents читает поток подписки до отключения клиента и возвращает идентификаторы и сообщения событий
+	readEvents := func(lastEventID string) ([]string, []string) {
+		ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+		defer cancel()
+		w := httptest.NewRecorder()
+		req := httptest.NewRequestWithContext(ctx, http.MethodGet, "/sse/queue/topic1?sub=sub1&timeout=5", nil)
+		if lastEventID != "" {
+			req.Header.Set("Last-Event-ID", lastEventID)
+		}
+		handler.ServeHTTP(w, req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("wrong status code: got %v want %v", w.Code, http.StatusOK)
+		}
+		var ids, messages []string
+		for _, event := range strings.Split(strings.TrimSuffix(w.Body.String(), "\n\n"), "\n\n") {
+			idLine, data, _ := strings.Cut(event, "\n")
+			id, found := strings.CutPrefix(idLine, "id: ")
+			if !found {
+				t.Fatalf("event without id: [%s]", event)
+			}
+			var dto messageDto
+			if err := json.Unmarshal([]byte(strings.TrimPrefix(data, "data: ")), &dto); err != nil {
+				t.Fatalf("json decoding error: %v", err)
+			}
+			ids = append(ids, id)
+			messages = append(messages, dto.Message)
+		}
+		return ids, messages
+	}
+
+	for _, message := range []string{"message0", "message1", "message2"} {
+		if err := manager.Put(context.Background(), "topic1", message); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	ids, messages := readEvents("")
+	if !slices.Equal(messages, []string{"message0", "message1", "message2"}) {
+		t.Fatalf("wrong messages: got %v", messages)
+	}
+	// Клиент успел обработать только первое событие, а следующее сообщение пришло, пока он был отключен
+	if err := manager.Put(context.Background(), "topic1", "message3"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	ids, messages = readEvents(ids[0])
+	if !slices.Equal(messages, []string{"message1", "message2", "message3"}) {
+		t.Fatalf("wrong resumed messages: got %v want [message1 message2 message3]", messages)
+	}
+	// Курсор последнего события подтверждает всё выданное, и поток продолжается только новыми сообщениями
+	if err := manager.Put(context.Background(), "topic1", "message4"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, messages := readEvents(ids[len(ids)-1]); !slices.Equal(messages, []string{"message4"}) {
+		t.Errorf("wrong messages after the last event: got %v want [message4]", messages)
+	}
+}
+
+func TestInvalidSSERequests(t *testing.T) {
+	testCases := []struct {
+		description string
+		httpCode    int
+		method      string
+		url         string
+		lastEventID string
+	}{
+		{
+			description: "Wrong method",
+			httpCode:    http.StatusMethodNotAllowed,
+			method:      http.MethodPut,
+			url:         "/sse/queue/name1",
+		},
+		{
+			description: "Wrong timeout",
+			httpCode:    http.StatusBadRequest,
+			method:      http.MethodGet,
+			url:         "/sse/queue/name2?timeout=abc",
+		},
+		{
+			description: "Zero timeout",
+			httpCode:    http.StatusBadRequest,
+			method:      http.MethodGet,
+			url:         "/sse/queue/name3?timeout=0",
+		},
+		{
+			description: "Cursor without subscription",
+			httpCode:    http.StatusBadRequest,
+			method:      http.MethodGet,
+			url:         "/sse/queue/name4",
+			lastEventID: "1",
+		},
+		{
+			description: "Wrong cursor",
+			httpCode:    http.StatusBadRequest,
+			method:      http.MethodGet,
+			url:         "/sse/queue/name5?sub=sub5",
+			lastEventID: "abc",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			handler := setupMux(&MockQueueManager{}, HandlerConfig{DefaultTimeout: 1})
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest(tc.method, tc.url, nil)
+			if tc.lastEventID != "" {
+				req.Header.Set("Last-Event-ID", tc.lastEventID)
+			}
+			handler.ServeHTTP(w, req)
+			if w.Code != tc.httpCode {
+				t.Errorf("wrong status code: got %v want %v", w.Code, tc.httpCode)
+			}
+		})
+	}
+}
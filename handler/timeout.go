@@ -0,0 +1,35 @@
+package handler
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// timeoutGrace задает запас сверх максимального таймаута для запросов, ожидающих сообщения или места в очереди.
+// Точный срок ожидания задает контекст внутри очереди, а внешний срок только страхует от зависших запросов
+const timeoutGrace = 5 * time.Second
+
+// withTimeout ограничивает обработку запроса сроком d через http.TimeoutHandler: по истечении срока клиент
+// получает 503, а контекст запроса отменяется. Ответ буферизуется до конца обработки, поэтому потоковые
+// обработчики не оборачиваются. Нулевой d отключает ограничение
+func withTimeout(handler http.Handler, d time.Duration) http.Handler {
+	if d <= 0 {
+		return handler
+	}
+	return http.TimeoutHandler(handler, d, "")
+}
+
+// withPutTimeout ограничивает PUT сроком putTimeout, а PUT с block=true, который ждет места в очереди
+// до своего таймаута, - сроком waitTimeout
+func withPutTimeout(handler http.Handler, putTimeout, waitTimeout time.Duration) http.Handler {
+	put, blockingPut := withTimeout(handler, putTimeout), withTimeout(handler, waitTimeout)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Недопустимое значение block отклонит сам обработчик
+		if block, _ := strconv.ParseBool(r.URL.Query().Get("block")); block {
+			blockingPut.ServeHTTP(w, r)
+			return
+		}
+		put.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,136 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nebotan/simplebroker/queue"
+)
+
+// slowQueueManager держит Put и PutBlocking в течение delay или до отмены контекста
+type slowQueueManager struct {
+	MockQueueManager
+	delay time.Duration
+}
+
+func (m *slowQueueManager) Put(ctx context.Context, name, message string) error {
+	select {
+	case <-time.After(m.delay):
+		return nil
+	case <-ctx.Done():
+		return queue.ErrCanceled
+	}
+}
+
+func (m *slowQueueManager) PutBlocking(ctx context.Context, name, message string) error {
+	return m.Put(ctx, name, message)
+}
+
+func TestPutTimeout(t *testing.T) {
+	testCases := []struct {
+		description string
+		url         string
+		delay       time.Duration
+		httpCode    int
+	}{
+		{
+			description: "In time",
+			url:         "/queue/name",
+			httpCode:    http.StatusOK,
+		},
+		{
+			description: "Too slow",
+			url:         "/queue/name",
+			delay:       time.Second,
+			httpCode:    http.StatusServiceUnavailable,
+		},
+		{
+			// Блокирующий PUT ждет места до своего таймаута, а не до PutTimeout
+			description: "Blocking PUT",
+			url:         "/queue/name?block=true&timeout=1",
+			delay:       100 * time.Millisecond,
+			httpCode:    http.StatusOK,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			manager := &slowQueueManager{delay: tc.delay}
+			handler := setupMux(manager, HandlerConfig{DefaultTimeout: 1, MaxTimeout: 1, PutTimeout: 50 * time.Millisecond})
+
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodPut, tc.url, strings.NewReader(`{"message": "message"}`))
+			handler.ServeHTTP(w, req)
+
+			if w.Code != tc.httpCode {
+				t.Errorf("wrong status code: got %v want %v", w.Code, tc.httpCode)
+			}
+		})
+	}
+}
+
+func TestMaxTimeout(t *testing.T) {
+	testCases := []struct {
+		description string
+		method      string
+		url         string
+		httpCode    int
+	}{
+		{
+			description: "GET at limit",
+			method:      http.MethodGet,
+			url:         "/queue/name?timeout=10",
+			httpCode:    http.StatusOK,
+		},
+		{
+			description: "GET above limit",
+			method:      http.MethodGet,
+			url:         "/queue/name?timeout=11",
+			httpCode:    http.StatusBadRequest,
+		},
+		{
+			description: "Blocking PUT above limit",
+			method:      http.MethodPut,
+			url:         "/queue/name?block=true&timeout=11",
+			httpCode:    http.StatusBadRequest,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			manager := &MockQueueManager{getOut: GetOut{message: "message"}}
+			handler := setupMux(manager, HandlerConfig{DefaultTimeout: 1, MaxTimeout: 10})
+
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest(tc.method, tc.url, strings.NewReader(`{"message": "message"}`))
+			handler.ServeHTTP(w, req)
+
+			if w.Code != tc.httpCode {
+				t.Errorf("wrong status code: got %v want %v", w.Code, tc.httpCode)
+			}
+		})
+	}
+}
+
+// TestWithTimeout проверяет, что запрос, превысивший срок, получает 503, а его контекст отменяется
+func TestWithTimeout(t *testing.T) {
+	canceled := make(chan struct{})
+	handler := withTimeout(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+		close(canceled)
+	}), 50*time.Millisecond)
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/queue/name", nil))
+
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("wrong status code: got %v want %v", w.Code, http.StatusServiceUnavailable)
+	}
+	select {
+	case <-canceled:
+	case <-time.After(time.Second):
+		t.Errorf("request context is not canceled")
+	}
+}
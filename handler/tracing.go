@@ -0,0 +1,76 @@
+package handler
+
+import (
+	"net/http"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracerName задает имя инструментации, под которым спаны брокера попадают в трассировку
+const tracerName = "github.com/nebotan/simplebroker/handler"
+
+// Атрибуты спанов операций с очередью. Имена из семантических соглашений OpenTelemetry для систем сообщений
+const (
+	messagingSystemKey      = attribute.Key("messaging.system")
+	messagingOperationKey   = attribute.Key("messaging.operation.name")
+	messagingDestinationKey = attribute.Key("messaging.destination.name")
+	statusCodeKey           = attribute.Key("http.response.status_code")
+	outcomeKey              = attribute.Key("simplebroker.outcome")
+)
+
+// traceContext извлекает контекст трассировки из заголовков traceparent и tracestate
+var traceContext = propagation.TraceContext{}
+
+// withTracing оборачивает handler спаном операции operation с очередью {queue}. Спан продолжает трассировку
+// из заголовка traceparent и передается обработчику в контексте запроса, поэтому доходит до QueueManager.
+// По коду ответа спан получает исход операции, а ответы 5xx отмечаются как ошибка.
+// Если tracerProvider равен nil, то handler возвращается как есть
+func withTracing(handler http.Handler, tracerProvider trace.TracerProvider, operation string) http.Handler {
+	if tracerProvider == nil {
+		return handler
+	}
+	tracer := tracerProvider.Tracer(tracerName)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := traceContext.Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+		name := r.PathValue("queue")
+		ctx, span := tracer.Start(ctx, operation+" "+name,
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(
+				messagingSystemKey.String("simplebroker"),
+				messagingOperationKey.String(operation),
+				messagingDestinationKey.String(name),
+			))
+		defer span.End()
+		rw := &responseWriterWrapper{ResponseWriter: w}
+		handler.ServeHTTP(rw, r.WithContext(ctx))
+		status := rw.statusCode()
+		span.SetAttributes(statusCodeKey.Int(status), outcomeKey.String(outcome(status)))
+		if status >= http.StatusInternalServerError {
+			span.SetStatus(codes.Error, http.StatusText(status))
+		}
+	})
+}
+
+// outcome возвращает исход операции с очередью по коду ответа
+func outcome(status int) string {
+	switch {
+	case status < http.StatusBadRequest:
+		return "ok"
+	case status == http.StatusNotFound:
+		// GET не дождался сообщения
+		return "no_message"
+	case status == http.StatusTooManyRequests:
+		return "rejected"
+	case status == statusClientClosedRequest:
+		return "canceled"
+	case status < http.StatusInternalServerError:
+		return "invalid"
+	case status == http.StatusServiceUnavailable:
+		return "unavailable"
+	default:
+		return "error"
+	}
+}
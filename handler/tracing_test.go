@@ -0,0 +1,128 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/nebotan/simplebroker/queue"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestTracing(t *testing.T) {
+	const (
+		traceID      = "4bf92f3577b34da6a3ce929d0e0e4736"
+		parentSpanID = "00f067aa0ba902b7"
+	)
+	testCases := []struct {
+		name        string
+		method      string
+		body        string
+		getErr      error
+		putErr      error
+		traceparent string
+		wantName    string
+		wantCode    int
+		wantOutcome string
+		isErr       bool
+	}{
+		{name: "get", method: http.MethodGet, wantName: "receive name1", wantCode: http.StatusOK, wantOutcome: "ok"},
+		{name: "get with parent", method: http.MethodGet, traceparent: "00-" + traceID + "-" + parentSpanID + "-01",
+			wantName: "receive name1", wantCode: http.StatusOK, wantOutcome: "ok"},
+		{name: "get no message", method: http.MethodGet, getErr: queue.ErrNoMessage,
+			wantName: "receive name1", wantCode: http.StatusNotFound, wantOutcome: "no_message"},
+		{name: "get error", method: http.MethodGet, getErr: errors.New("storage error"),
+			wantName: "receive name1", wantCode: http.StatusInternalServerError, wantOutcome: "error", isErr: true},
+		{name: "put", method: http.MethodPut, body: `{"message": "message1"}`, traceparent: "00-" + traceID + "-" + parentSpanID + "-01",
+			wantName: "send name1", wantCode: http.StatusOK, wantOutcome: "ok"},
+		{name: "put rejected", method: http.MethodPut, body: `{"message": "message1"}`, putErr: queue.ErrTooManyItems,
+			wantName: "send name1", wantCode: http.StatusTooManyRequests, wantOutcome: "rejected"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			exporter := tracetest.NewInMemoryExporter()
+			tracerProvider := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+			manager := &MockQueueManager{
+				getOut: GetOut{message: "message1", err: tc.getErr},
+				putOut: PutOut{err: tc.putErr},
+			}
+			handler := setupMux(manager, HandlerConfig{DefaultTimeout: 1, RetryAfter: retryAfter, TracerProvider: tracerProvider})
+
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest(tc.method, "/queue/name1", strings.NewReader(tc.body))
+			if tc.traceparent != "" {
+				req.Header.Set("traceparent", tc.traceparent)
+			}
+			handler.ServeHTTP(w, req)
+
+			if w.Code != tc.wantCode {
+				t.Fatalf("wrong status code: got %v want %v", w.Code, tc.wantCode)
+			}
+			spans := exporter.GetSpans()
+			if len(spans) != 1 {
+				t.Fatalf("wrong number of spans: got %v want %v", len(spans), 1)
+			}
+			span := spans[0]
+			if span.Name != tc.wantName {
+				t.Errorf("wrong span name: got %v want %v", span.Name, tc.wantName)
+			}
+			if span.SpanKind != trace.SpanKindServer {
+				t.Errorf("wrong span kind: got %v want %v", span.SpanKind, trace.SpanKindServer)
+			}
+			attrs := attribute.NewSet(span.Attributes...)
+			for key, want := range map[attribute.Key]attribute.Value{
+				messagingDestinationKey: attribute.StringValue("name1"),
+				outcomeKey:              attribute.StringValue(tc.wantOutcome),
+				statusCodeKey:           attribute.IntValue(tc.wantCode),
+			} {
+				if got, _ := attrs.Value(key); got != want {
+					t.Errorf("wrong attribute %v: got %v want %v", key, got.Emit(), want.Emit())
+				}
+			}
+			if (span.Status.Code == codes.Error) != tc.isErr {
+				t.Errorf("wrong span status: got %v want error %v", span.Status.Code, tc.isErr)
+			}
+			if tc.traceparent != "" {
+				if got := span.Parent.TraceID().String(); got != traceID {
+					t.Errorf("wrong parent trace id: got %v want %v", got, traceID)
+				}
+				if got := span.Parent.SpanID().String(); got != parentSpanID {
+					t.Errorf("wrong parent span id: got %v want %v", got, parentSpanID)
+				}
+			} else if span.Parent.IsValid() {
+				t.Errorf("unexpected parent: %v", span.Parent)
+			}
+			// Спан доходит до QueueManager в контексте запроса
+			ctx := manager.getIn.ctx
+			if tc.method == http.MethodPut {
+				ctx = manager.putIn.ctx
+			}
+			if got := trace.SpanContextFromContext(ctx); got.SpanID() != span.SpanContext.SpanID() {
+				t.Errorf("wrong span in QueueManager context: got %v want %v", got.SpanID(), span.SpanContext.SpanID())
+			}
+		})
+	}
+}
+
+func TestTracingDisabled(t *testing.T) {
+	manager := &MockQueueManager{getOut: GetOut{message: "message1"}}
+	handler := setupMux(manager, HandlerConfig{DefaultTimeout: 1, RetryAfter: retryAfter})
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/queue/name1", nil)
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	handler.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("wrong status code: got %v want %v", w.Code, http.StatusOK)
+	}
+	if span := trace.SpanContextFromContext(manager.getIn.ctx); span.IsValid() {
+		t.Errorf("unexpected span in QueueManager context: %v", span)
+	}
+}
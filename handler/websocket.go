@@ -0,0 +1,75 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/nebotan/simplebroker/queue"
+	"golang.org/x/net/websocket"
+)
+
+func createWebSocketHandler(queueManager queue.QueueManager, defaultTimeout int) http.Handler {
+	return &webSocketHandlerImpl{
+		queueManager:   queueManager,
+		defaultTimeout: defaultTimeout,
+	}
+}
+
+// webSocketHandlerImpl обрабатывает GET /ws/queue/{queue}: соединение переводится на WebSocket,
+// и каждое сообщение очереди отправляется клиенту JSON кадром вида {"message": "data"}.
+// С ?sub= читается подписка топика, а кадр содержит и id сообщения, который клиент при переподключении
+// передает в ?cursor=, чтобы продолжить с этого места
+type webSocketHandlerImpl struct {
+	queueManager   queue.QueueManager
+	defaultTimeout int // таймаут одного ожидания сообщения, по его истечении ожидание повторяется
+}
+
+func (h *webSocketHandlerImpl) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("queue")
+	sub := r.URL.Query().Get("sub")
+	cursor := r.URL.Query().Get("cursor")
+	if sub == "" && cursor != "" {
+		// Курсор есть только у подписки
+		http.Error(w, "", http.StatusBadRequest)
+		return
+	}
+	if sub != "" && !checkSubscription(w, r, h.queueManager, name, sub, cursor) {
+		return
+	}
+	// Origin не проверяется: доступ к очередям ограничивают API ключи
+	server := websocket.Server{
+		Handler: func(conn *websocket.Conn) {
+			h.serve(conn, name, sub, cursor)
+		},
+	}
+	server.ServeHTTP(w, r)
+}
+
+// serve пересылает сообщения очереди name или подписки sub в соединение, пока клиент его не закроет
+func (h *webSocketHandlerImpl) serve(conn *websocket.Conn, name, sub, cursor string) {
+	ctx, cancel := context.WithCancel(conn.Request().Context())
+	defer cancel()
+	// Клиент ничего не присылает, поэтому чтение нужно только для того, чтобы заметить закрытие соединения
+	go func() {
+		defer cancel()
+		var discard []byte
+		for {
+			if err := websocket.Message.Receive(conn, &discard); err != nil {
+				return
+			}
+		}
+	}()
+	var err error
+	if sub != "" {
+		err = queue.StreamSub(ctx, h.queueManager, name, sub, cursor, h.defaultTimeout, func(message queue.Message) error {
+			return websocket.JSON.Send(conn, messageDto{ID: message.ID, Message: message.Body})
+		})
+	} else {
+		err = queue.Stream(ctx, h.queueManager, name, h.defaultTimeout, func(message string) error {
+			return websocket.JSON.Send(conn, messageDto{Message: message})
+		})
+	}
+	if err != nil {
+		errorLogger.Println("WS stream error:", err)
+	}
+}
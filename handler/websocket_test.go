@@ -0,0 +1,79 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nebotan/simplebroker/queue"
+	"golang.org/x/net/websocket"
+)
+
+// TestWebSocketConsumer проверяет, что сообщения очереди приходят в WebSocket по мере поступления,
+// а закрытие соединения клиентом завершает обработчик
+func TestWebSocketConsumer(t *testing.T) {
+	manager := queue.NewQueueManager(queue.QueueManagerConfig{MaxQueueNum: 10, MaxMessageNumPerQueue: 10})
+	defer manager.Stop()
+	// Первое сообщение лежит в очереди до подключения
+	if err := manager.Put(context.Background(), "name1", "message1"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	handlerDone := make(chan struct{})
+	handler := setupMux(manager, HandlerConfig{DefaultTimeout: 1})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer close(handlerDone)
+		handler.ServeHTTP(w, r)
+	}))
+	defer server.Close()
+
+	url := "ws" + strings.TrimPrefix(server.URL, "http") + "/ws/queue/name1"
+	conn, err := websocket.Dial(url, "", server.URL)
+	if err != nil {
+		t.Fatalf("dial error: %v", err)
+	}
+	var dto messageDto
+	if err := websocket.JSON.Receive(conn, &dto); err != nil {
+		t.Fatalf("receive error: %v", err)
+	}
+	if dto.Message != "message1" {
+		t.Errorf("wrong message: got %v want %v", dto.Message, "message1")
+	}
+	// Второе сообщение приходит без повторного запроса
+	if err := manager.Put(context.Background(), "name1", "message2"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := websocket.JSON.Receive(conn, &dto); err != nil {
+		t.Fatalf("receive error: %v", err)
+	}
+	if dto.Message != "message2" {
+		t.Errorf("wrong message: got %v want %v", dto.Message, "message2")
+	}
+
+	conn.Close()
+	select {
+	case <-handlerDone:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("handler is not finished after client close")
+	}
+	// После закрытия соединения сообщения остаются в очереди
+	if err := manager.Put(context.Background(), "name1", "message3"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if message, err := manager.Get(context.Background(), "name1", 1); err != nil || message.Body != "message3" {
+		t.Errorf("wrong Get result: got [%v] [%v] want [%v]", message.Body, err, "message3")
+	}
+}
+
+func TestWebSocketWrongMethod(t *testing.T) {
+	handler := setupMux(&MockQueueManager{}, HandlerConfig{DefaultTimeout: 1})
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPut, "/ws/queue/name1", nil)
+	handler.ServeHTTP(w, req)
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("wrong status code: got %v want %v", w.Code, http.StatusMethodNotAllowed)
+	}
+}
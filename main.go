@@ -2,53 +2,468 @@ package main
 
 import (
 	"context"
+	"crypto/tls"
+	"crypto/x509"
 	"errors"
 	"flag"
 	"fmt"
+	"io"
 	"log"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
+	"regexp"
+	"strconv"
+	"strings"
 	"syscall"
 	"time"
 
+	"github.com/nebotan/simplebroker/config"
+	brokergrpc "github.com/nebotan/simplebroker/grpc"
 	"github.com/nebotan/simplebroker/handler"
 	"github.com/nebotan/simplebroker/queue"
+	"google.golang.org/grpc"
 )
 
 func main() {
+	host := flag.String("host", "", "host or IP address to listen on for HTTP and gRPC, empty means all interfaces")
 	port := flag.Int("port", 8080, "HTTP port number")
+	grpcPort := flag.Int("grpcPort", 0, "gRPC port number, gRPC is disabled when 0")
 	defaultTimeout := flag.Int("timeout", 5, "default timeout in seconds")
+	maxTimeout := flag.Int("maxTimeout", 300, "maximum GET and blocking PUT timeout in seconds, such requests are aborted with 503 after it plus 5 seconds; 0 means no limit")
+	putTimeout := flag.Duration("putTimeout", 5*time.Second, "time after which a non-blocking PUT is aborted with 503, 0 means no limit")
 	maxQueueNum := flag.Int("maxQueueNum", 100, "maximum number of queues")
 	maxMessageNumPerQueue := flag.Int("maxMessageNumPerQueue", 10_000, "maximum number of messages in any queue")
+	maxMessageBytes := flag.Int("maxMessageBytes", 0, "maximum message size in bytes, 0 means no limit")
+	maxTotalMessages := flag.Int("maxTotalMessages", 0, "maximum number of messages in all queues together, 0 means no limit")
+	rejectEmptyMessages := flag.Bool("rejectEmptyMessages", false, "reject PUT with an empty message with 400")
+	maxWaitersPerQueue := flag.Int("maxWaitersPerQueue", 0, "maximum number of GET requests waiting for messages in any queue, 0 means no limit")
+	dataDir := flag.String("dataDir", "", "directory for queue write-ahead logs, queues are kept only in memory when empty")
+	syncMode := flag.String("syncMode", "sync", "when queue logs are flushed to disk: none, async (every second) or sync (before PUT is confirmed)")
+	maxLogBytes := flag.Int64("maxLogBytes", 64<<20, "queue log size in bytes after which it is rewritten with only unconsumed messages")
+	sqlitePath := flag.String("sqlitePath", "", "SQLite database file for queue messages, takes precedence over dataDir")
+	queueNamePattern := flag.String("queueNamePattern", "", "regular expression for the whole queue name, empty means [a-zA-Z0-9_-]{1,128}")
+	maxSampleSize := flag.Int("maxSampleSize", 100, "maximum number of messages returned by GET /queue/{queue}/sample")
+	maxSubscriptionNumPerTopic := flag.Int("maxSubscriptionNumPerTopic", 100, "maximum number of subscriptions in any topic")
+	webhookMaxRetries := flag.Int("webhookMaxRetries", 5, "number of webhook delivery retries before dead letter")
+	webhookRetryDelay := flag.Duration("webhookRetryDelay", time.Second, "delay before the first webhook delivery retry, doubled on each next one")
+	subscriptionRetention := flag.Duration("subscriptionRetention", 0, "time a subscription keeps delivered messages so a reconnecting SSE or WebSocket stream resumes from its cursor, 0 disables it")
+	visibilityTimeout := flag.Duration("visibilityTimeout", 30*time.Second, "time a message received in ack mode stays invisible until it is acknowledged")
+	apiKeys := flag.String("apiKeys", "", "comma separated list of API keys, authentication is disabled when empty")
+	apiKeysFile := flag.String("apiKeysFile", "", "file with API keys, one per line")
+	aclFile := flag.String("aclFile", "", "JSON file with per queue access rules for API keys, keys from it are valid API keys")
+	rateLimit := flag.Float64("rateLimit", 0, "average GET and PUT requests per second allowed for any queue, 0 disables rate limiting")
+	rateBurst := flag.Int("rateBurst", 10, "GET and PUT requests allowed in a burst for any queue")
+	rateLimitOverrides := flag.String("rateLimitOverrides", "", "comma separated per queue rate limits as name=rate:burst")
+	readerWeights := flag.String("readerWeights", "", "comma separated consumer weights as id=weight; when set, messages are shared among GET requests waiting at the same time in proportion to the weights of their X-Consumer-Id, other consumers weigh 1; empty means strict arrival order")
+	circuitBreakerThreshold := flag.Int("circuitBreakerThreshold", 0, "consecutive PUT rejections of a full queue after which PUT to it is rejected at once for circuitBreakerCooldown, 0 disables it")
+	circuitBreakerCooldown := flag.Duration("circuitBreakerCooldown", time.Second, "time PUT to a queue is rejected at once before a probe PUT is allowed")
+	retryAfter := flag.Int("retryAfter", 1, "seconds in Retry-After header when a request is rejected because of queue limits")
+	waitLatencyBuckets := flag.String("waitLatencyBuckets", "", "comma separated upper bounds of GET wait latency histogram buckets, e.g. 100ms,1s,5s; empty means 10ms,50ms,100ms,500ms,1s,5s,10s,30s")
+	healthLogInterval := flag.Int("healthLogInterval", 0, "seconds between log lines with depths of all queues, 0 disables them")
+	debugAddr := flag.String("debugAddr", "", "address of the pprof and expvar server, e.g. localhost:6060; empty disables it")
+	corsOrigins := flag.String("corsOrigins", "", "comma separated list of origins allowed for browser clients, * allows any, CORS is disabled when empty")
+	tlsCert := flag.String("tlsCert", "", "TLS certificate file, HTTPS is enabled when both tlsCert and tlsKey are set")
+	tlsKey := flag.String("tlsKey", "", "TLS private key file")
+	tlsMinVersion := flag.String("tlsMinVersion", "1.2", "minimum TLS version: 1.2 or 1.3")
+	tlsClientCA := flag.String("tlsClientCA", "", "CA certificate file to verify client certificates (mTLS), client certificates are not required when empty")
+	accessLog := flag.Bool("accessLog", false, "write a line per HTTP request to stdout")
+	drainTimeout := flag.Int("drainTimeout", 5, "seconds to wait on shutdown for GET requests waiting for messages before queues are stopped")
+	shutdownTimeout := flag.Int("shutdownTimeout", 10, "seconds to wait on shutdown for active requests and streams before servers are closed")
+	configFile := flag.String("config", "", "JSON config file with flag names as keys, explicit flags and SIMPLEBROKER_* environment variables take precedence")
 	flag.Parse()
+	if err := config.Apply(flag.CommandLine, *configFile, os.LookupEnv, "config"); err != nil {
+		log.Fatalf("[ERROR]: config loading error: %v\n", err)
+	}
+
+	if *shutdownTimeout <= 0 || *drainTimeout <= 0 {
+		log.Fatalln("[ERROR]: shutdownTimeout and drainTimeout must be positive")
+	}
+	if *maxTimeout > 0 && *defaultTimeout > *maxTimeout {
+		log.Fatalln("[ERROR]: timeout must not exceed maxTimeout")
+	}
+	if *healthLogInterval < 0 {
+		log.Fatalln("[ERROR]: healthLogInterval must not be negative")
+	}
+
+	addr, err := listenAddr(*host, *port)
+	if err != nil {
+		log.Fatalf("[ERROR]: invalid listen address: %v\n", err)
+	}
+
+	var namePattern *regexp.Regexp
+	if *queueNamePattern != "" {
+		// Шаблон проверяет имя целиком, а не его часть
+		if namePattern, err = regexp.Compile(`^(?:` + *queueNamePattern + `)$`); err != nil {
+			log.Fatalf("[ERROR]: invalid queueNamePattern: %v\n", err)
+		}
+	}
+
+	logSyncMode, err := queue.ParseSyncMode(*syncMode)
+	if err != nil {
+		log.Fatalf("[ERROR]: invalid syncMode: %v\n", err)
+	}
 
+	latencyBuckets, err := parseDurations(*waitLatencyBuckets)
+	if err != nil {
+		log.Fatalf("[ERROR]: invalid waitLatencyBuckets: %v\n", err)
+	}
+
+	var storage queue.StorageBackend
+	if *sqlitePath != "" {
+		if storage, err = queue.NewSQLiteBackend(*sqlitePath); err != nil {
+			log.Fatalf("[ERROR]: SQLite storage error: %v\n", err)
+		}
+	}
+
+	useTLS := *tlsCert != "" || *tlsKey != ""
+	if useTLS && (*tlsCert == "" || *tlsKey == "") {
+		log.Fatalln("[ERROR]: both tlsCert and tlsKey must be set")
+	}
+	var tlsConfig *tls.Config
+	if useTLS {
+		var err error
+		if tlsConfig, err = newTLSConfig(*tlsMinVersion, *tlsClientCA); err != nil {
+			log.Fatalf("[ERROR]: TLS config error: %v\n", err)
+		}
+	}
+
+	tracerProvider, shutdownTracing, err := newTracerProvider(context.Background(), os.LookupEnv)
+	if err != nil {
+		log.Fatalf("[ERROR]: tracing setup error: %v\n", err)
+	}
+
+	weights, err := parseReaderWeights(*readerWeights)
+	if err != nil {
+		log.Fatalf("[ERROR]: reader weights parsing error: %v\n", err)
+	}
 	queueManager := queue.NewQueueManager(
 		queue.QueueManagerConfig{
-			MaxQueueNum:           *maxQueueNum,
-			MaxMessageNumPerQueue: *maxMessageNumPerQueue,
+			MaxQueueNum:                *maxQueueNum,
+			MaxMessageNumPerQueue:      *maxMessageNumPerQueue,
+			MaxTotalMessages:           *maxTotalMessages,
+			MaxWaitersPerQueue:         *maxWaitersPerQueue,
+			MaxSubscriptionNumPerTopic: *maxSubscriptionNumPerTopic,
+			WebhookMaxRetries:          *webhookMaxRetries,
+			WebhookRetryDelay:          *webhookRetryDelay,
+			VisibilityTimeout:          *visibilityTimeout,
+			QueueNamePattern:           namePattern,
+			MaxMessageBytes:            *maxMessageBytes,
+			DataDir:                    *dataDir,
+			SyncMode:                   logSyncMode,
+			MaxLogBytes:                *maxLogBytes,
+			Storage:                    storage,
+			Tracer:                     tracerProvider.Tracer("github.com/nebotan/simplebroker/queue"),
+			WaitLatencyBuckets:         latencyBuckets,
+			CircuitBreakerThreshold:    *circuitBreakerThreshold,
+			CircuitBreakerCooldown:     *circuitBreakerCooldown,
+			ReaderWeights:              weights,
+			SubscriptionRetention:      *subscriptionRetention,
 		})
-	handler.Setup(queueManager, *defaultTimeout)
+	keys, err := loadAPIKeys(*apiKeys, *apiKeysFile)
+	if err != nil {
+		log.Fatalf("[ERROR]: API keys loading error: %v\n", err)
+	}
+	var acl handler.ACL
+	if *aclFile != "" {
+		if acl, err = handler.LoadACL(*aclFile); err != nil {
+			log.Fatalf("[ERROR]: ACL loading error: %v\n", err)
+		}
+		// Ключи из ACL допустимы без явного перечисления в apiKeys
+		for key := range acl {
+			keys = append(keys, key)
+		}
+	}
+	overrides, err := parseRateLimitOverrides(*rateLimitOverrides)
+	if err != nil {
+		log.Fatalf("[ERROR]: rate limit overrides parsing error: %v\n", err)
+	}
+	mux := http.NewServeMux()
+	drain := &handler.Drain{}
+	var accessLogWriter io.Writer
+	if *accessLog {
+		accessLogWriter = os.Stdout
+	}
+	handler.Setup(mux, queueManager, handler.HandlerConfig{
+		DefaultTimeout:      *defaultTimeout,
+		APIKeys:             keys,
+		ACL:                 acl,
+		RateLimit:           handler.RateLimit{Rate: *rateLimit, Burst: *rateBurst},
+		RateLimitOverrides:  overrides,
+		RetryAfter:          *retryAfter,
+		CORSOrigins:         splitList(*corsOrigins),
+		Drain:               drain,
+		AccessLog:           accessLogWriter,
+		MaxMessageBytes:     *maxMessageBytes,
+		RejectEmptyMessages: *rejectEmptyMessages,
+		TracerProvider:      tracerProvider,
+		MaxTimeout:          *maxTimeout,
+		PutTimeout:          *putTimeout,
+		MaxSampleSize:       *maxSampleSize,
+	})
 
 	server := &http.Server{
-		Addr:    fmt.Sprintf(":%d", *port),
-		Handler: nil,
+		Addr:      addr,
+		Handler:   mux,
+		TLSConfig: tlsConfig,
 	}
 	go func() {
-		if err := server.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+		var err error
+		if useTLS {
+			log.Printf("Starting HTTPS server on %s, mTLS: %t\n", server.Addr, *tlsClientCA != "")
+			err = server.ListenAndServeTLS(*tlsCert, *tlsKey)
+		} else {
+			log.Printf("Starting HTTP server on %s\n", server.Addr)
+			err = server.ListenAndServe()
+		}
+		if !errors.Is(err, http.ErrServerClosed) {
 			log.Printf("[ERROR]: HTTP server error: %v\n", err)
 		}
 	}()
 
+	var grpcServer *grpc.Server
+	if *grpcPort != 0 {
+		grpcAddr, err := listenAddr(*host, *grpcPort)
+		if err != nil {
+			log.Fatalf("[ERROR]: invalid gRPC listen address: %v\n", err)
+		}
+		listener, err := net.Listen("tcp", grpcAddr)
+		if err != nil {
+			log.Fatalf("[ERROR]: gRPC listen error: %v\n", err)
+		}
+		// gRPC работает с тем же менеджером, поэтому очереди общие с HTTP API
+		grpcServer = brokergrpc.NewServer(queueManager, *defaultTimeout)
+		go func() {
+			log.Printf("Starting gRPC server on %s\n", listener.Addr())
+			if err := grpcServer.Serve(listener); err != nil {
+				log.Printf("[ERROR]: gRPC server error: %v\n", err)
+			}
+		}()
+	}
+
+	var debugServer *http.Server
+	if *debugAddr != "" {
+		debugServer = newDebugServer(*debugAddr, queueManager)
+		go func() {
+			log.Printf("Starting debug server on %s\n", debugServer.Addr)
+			if err := debugServer.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+				log.Printf("[ERROR]: debug server error: %v\n", err)
+			}
+		}()
+	}
+
+	watchStatsSignal(queueManager)
+
+	healthLogCtx, stopHealthLog := context.WithCancel(context.Background())
+	healthLogDone := make(chan struct{})
+	if *healthLogInterval > 0 {
+		go runHealthLog(healthLogCtx, log.Default(), queueManager, time.Duration(*healthLogInterval)*time.Second, healthLogDone)
+	} else {
+		close(healthLogDone)
+	}
+
 	signalCh := make(chan os.Signal, 2)
 	signal.Notify(signalCh, os.Interrupt, syscall.SIGTERM)
 	<-signalCh
+	// Журнал здоровья останавливается первым, чтобы не читать статистику останавливаемых очередей
+	stopHealthLog()
+	<-healthLogDone
+	// Новые запросы к очередям сразу получают 503, а проверки здоровья проходят
+	drain.Close()
 
-	queueManager.Stop()
-	shutdownCtx, shutdownRelease := context.WithTimeout(context.Background(), 10*time.Second)
+	// Shutdown сразу перестает принимать соединения, но ждет активные запросы, в том числе потоковые,
+	// которые завершатся только вместе с очередями, поэтому запускаем его до остановки очередей
+	shutdownCtx, shutdownRelease, shutdownErrCh := startShutdown(server, time.Duration(*shutdownTimeout)*time.Second)
 	defer shutdownRelease()
+	// Даем ожидающим GET получить сообщение или дождаться своего таймаута
+	drainCtx, drainRelease := context.WithTimeout(context.Background(), time.Duration(*drainTimeout)*time.Second)
+	if err := drain.Wait(drainCtx); err != nil {
+		log.Printf("[ERROR]: drain timeout, %d GET requests still waiting\n", drain.InFlight())
+	}
+	drainRelease()
+	queueManager.Stop()
+	if storage != nil {
+		if err := storage.Close(); err != nil {
+			log.Printf("[ERROR]: storage close error: %v\n", err)
+		}
+	}
 
-	if err := server.Shutdown(shutdownCtx); err != nil {
+	if err := <-shutdownErrCh; err != nil {
 		log.Printf("[ERROR]: HTTP server shutdown error: %v\n", err)
 	}
+	if grpcServer != nil {
+		// Потоки GetStream завершаются вместе с очередями, поэтому ждать их можно не дольше общего таймаута
+		stopped := make(chan struct{})
+		go func() {
+			grpcServer.GracefulStop()
+			close(stopped)
+		}()
+		select {
+		case <-stopped:
+		case <-shutdownCtx.Done():
+			grpcServer.Stop()
+		}
+	}
+	if debugServer != nil {
+		if err := debugServer.Shutdown(shutdownCtx); err != nil {
+			log.Printf("[ERROR]: debug server shutdown error: %v\n", err)
+		}
+	}
+	// Спаны последних запросов отправляются после остановки серверов
+	if err := shutdownTracing(shutdownCtx); err != nil {
+		log.Printf("[ERROR]: tracing shutdown error: %v\n", err)
+	}
+}
+
+// shutdowner задает остановку сервера, как у http.Server, и позволяет подменить сервер в тестах
+type shutdowner interface {
+	Shutdown(ctx context.Context) error
+}
+
+// startShutdown запускает остановку server в отдельной горутине, ожидая активные запросы не дольше timeout.
+// Возвращает контекст с этим таймаутом для остановки остальных серверов и канал с результатом Shutdown
+func startShutdown(server shutdowner, timeout time.Duration) (context.Context, context.CancelFunc, <-chan error) {
+	ctx, release := context.WithTimeout(context.Background(), timeout)
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- server.Shutdown(ctx)
+	}()
+	return ctx, release, errCh
+}
+
+// listenAddr собирает адрес для прослушивания из host и port и проверяет его, чтобы ошибка в флагах
+// обнаружилась при запуске, а не в горутине сервера. Пустой host означает все интерфейсы
+func listenAddr(host string, port int) (string, error) {
+	if port < 0 || port > 65535 {
+		return "", fmt.Errorf("port %d is out of range", port)
+	}
+	addr := net.JoinHostPort(host, strconv.Itoa(port))
+	if _, err := net.ResolveTCPAddr("tcp", addr); err != nil {
+		return "", err
+	}
+	return addr, nil
+}
+
+// newTLSConfig создает конфигурацию TLS с минимальной версией minVersion.
+// Если задан clientCAFile, то клиенты обязаны предъявить сертификат, подписанный этим CA
+func newTLSConfig(minVersion, clientCAFile string) (*tls.Config, error) {
+	config := &tls.Config{}
+	switch minVersion {
+	case "1.2":
+		config.MinVersion = tls.VersionTLS12
+	case "1.3":
+		config.MinVersion = tls.VersionTLS13
+	default:
+		return nil, fmt.Errorf("unsupported TLS version %q", minVersion)
+	}
+	if clientCAFile != "" {
+		pem, err := os.ReadFile(clientCAFile)
+		if err != nil {
+			return nil, err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in %s", clientCAFile)
+		}
+		config.ClientCAs = pool
+		config.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	return config, nil
+}
+
+// loadAPIKeys собирает API ключи из списка через запятую и из файла с ключом на каждой строке.
+// Пустые строки пропускаются
+func loadAPIKeys(list, file string) ([]string, error) {
+	keys := splitList(list)
+	if file != "" {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		for _, key := range strings.Split(string(data), "\n") {
+			if key = strings.TrimSpace(key); key != "" {
+				keys = append(keys, key)
+			}
+		}
+	}
+	return keys, nil
+}
+
+// parseRateLimitOverrides разбирает ограничения отдельных очередей вида name=rate:burst через запятую
+func parseRateLimitOverrides(list string) (map[string]handler.RateLimit, error) {
+	overrides := make(map[string]handler.RateLimit)
+	for _, item := range strings.Split(list, ",") {
+		if item = strings.TrimSpace(item); item == "" {
+			continue
+		}
+		name, limit, found := strings.Cut(item, "=")
+		if !found {
+			return nil, fmt.Errorf("no '=' in [%s]", item)
+		}
+		rateAsStr, burstAsStr, found := strings.Cut(limit, ":")
+		if !found {
+			return nil, fmt.Errorf("no ':' in [%s]", item)
+		}
+		rate, err := strconv.ParseFloat(rateAsStr, 64)
+		if err != nil {
+			return nil, err
+		}
+		burst, err := strconv.Atoi(burstAsStr)
+		if err != nil {
+			return nil, err
+		}
+		overrides[name] = handler.RateLimit{Rate: rate, Burst: burst}
+	}
+	return overrides, nil
+}
+
+// parseReaderWeights разбирает веса потребителей вида id=weight через запятую, для пустого списка возвращает nil
+func parseReaderWeights(list string) (map[string]int, error) {
+	var res map[string]int
+	for _, item := range splitList(list) {
+		id, weightAsStr, found := strings.Cut(item, "=")
+		if !found {
+			return nil, fmt.Errorf("no '=' in [%s]", item)
+		}
+		weight, err := strconv.Atoi(weightAsStr)
+		if err != nil {
+			return nil, err
+		}
+		if weight <= 0 {
+			return nil, fmt.Errorf("non-positive weight in [%s]", item)
+		}
+		if res == nil {
+			res = make(map[string]int)
+		}
+		res[id] = weight
+	}
+	return res, nil
+}
+
+// parseDurations разбирает список длительностей через запятую, для пустого списка возвращает nil
+func parseDurations(list string) ([]time.Duration, error) {
+	var res []time.Duration
+	for _, item := range splitList(list) {
+		d, err := time.ParseDuration(item)
+		if err != nil {
+			return nil, err
+		}
+		if d <= 0 {
+			return nil, fmt.Errorf("non-positive duration %s", item)
+		}
+		res = append(res, d)
+	}
+	return res, nil
+}
+
+// splitList разбирает список через запятую, пропуская пустые элементы
+func splitList(list string) []string {
+	var res []string
+	for _, item := range strings.Split(list, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			res = append(res, item)
+		}
+	}
+	return res
 }
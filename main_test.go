@@ -0,0 +1,256 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"maps"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nebotan/simplebroker/queue"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+// mockServer ждет в Shutdown отмены контекста, как http.Server с незавершенными запросами
+type mockServer struct {
+	deadlineCh chan time.Time
+}
+
+func (s *mockServer) Shutdown(ctx context.Context) error {
+	deadline, _ := ctx.Deadline()
+	s.deadlineCh <- deadline
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+func TestStartShutdown(t *testing.T) {
+	for _, timeout := range []time.Duration{50 * time.Millisecond, 200 * time.Millisecond} {
+		t.Run(timeout.String(), func(t *testing.T) {
+			server := &mockServer{deadlineCh: make(chan time.Time, 1)}
+			start := time.Now()
+			_, release, errCh := startShutdown(server, timeout)
+			defer release()
+
+			deadline := <-server.deadlineCh
+			if expected := start.Add(timeout); deadline.Before(expected) || deadline.After(expected.Add(100*time.Millisecond)) {
+				t.Errorf("wrong Shutdown deadline: got %v want about %v", deadline.Sub(start), timeout)
+			}
+			select {
+			case err := <-errCh:
+				if !errors.Is(err, context.DeadlineExceeded) {
+					t.Errorf("wrong error: got [%v] want [%v]", err, context.DeadlineExceeded)
+				}
+			case <-time.After(timeout + time.Second):
+				t.Fatalf("Shutdown is not finished after timeout")
+			}
+			if elapsed := time.Since(start); elapsed < timeout {
+				t.Errorf("Shutdown finished too early: got %v want at least %v", elapsed, timeout)
+			}
+		})
+	}
+}
+
+// TestRunHealthLog проверяет строки журнала здоровья и выход из горутины при отмене контекста
+func TestRunHealthLog(t *testing.T) {
+	manager := queue.NewQueueManager(queue.QueueManagerConfig{MaxQueueNum: 10, MaxMessageNumPerQueue: 10})
+	defer manager.Stop()
+	for _, name := range []string{"name1", "name1", "name2"} {
+		if err := manager.Put(context.Background(), name, "message"); err != nil {
+			t.Fatalf("unexpected error at Put [%v]", err)
+		}
+	}
+
+	// Журнал читается только после выхода горутины, поэтому синхронизация буфера не нужна
+	var buf bytes.Buffer
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go runHealthLog(ctx, log.New(&buf, "", 0), manager, 10*time.Millisecond, done)
+	time.Sleep(50 * time.Millisecond)
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("health log is not stopped after cancel")
+	}
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) == 0 || lines[0] == "" {
+		t.Fatal("health log is empty")
+	}
+	var dto healthLogDto
+	if err := json.Unmarshal([]byte(lines[0]), &dto); err != nil {
+		t.Fatalf("line [%s] decoding error: %v", lines[0], err)
+	}
+	if _, err := time.Parse(time.RFC3339, dto.Timestamp); err != nil {
+		t.Errorf("wrong ts [%s]: %v", dto.Timestamp, err)
+	}
+	expected := []healthLogQueue{{Name: "name1", Depth: 2}, {Name: "name2", Depth: 1}}
+	if !slices.Equal(dto.Queues, expected) {
+		t.Errorf("wrong queues: got %v want %v", dto.Queues, expected)
+	}
+}
+
+func TestListenAddr(t *testing.T) {
+	testCases := []struct {
+		description string
+		host        string
+		port        int
+		addr        string
+		isErr       bool
+	}{
+		{
+			description: "All interfaces",
+			port:        8080,
+			addr:        ":8080",
+		},
+		{
+			description: "IPv4",
+			host:        "127.0.0.1",
+			port:        8080,
+			addr:        "127.0.0.1:8080",
+		},
+		{
+			description: "IPv6",
+			host:        "::1",
+			port:        8080,
+			addr:        "[::1]:8080",
+		},
+		{
+			description: "Port out of range",
+			host:        "127.0.0.1",
+			port:        70000,
+			isErr:       true,
+		},
+		{
+			description: "Malformed host",
+			host:        "[::1]",
+			port:        8080,
+			isErr:       true,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			addr, err := listenAddr(tc.host, tc.port)
+			if (err != nil) != tc.isErr {
+				t.Fatalf("wrong error: got [%v] want error %v", err, tc.isErr)
+			}
+			if addr != tc.addr {
+				t.Errorf("wrong address: got [%v] want [%v]", addr, tc.addr)
+			}
+		})
+	}
+}
+
+func TestParseReaderWeights(t *testing.T) {
+	testCases := []struct {
+		description string
+		list        string
+		weights     map[string]int
+		isErr       bool
+	}{
+		{
+			description: "Empty",
+		},
+		{
+			description: "Several",
+			list:        "worker1=3, worker2=1,",
+			weights:     map[string]int{"worker1": 3, "worker2": 1},
+		},
+		{
+			description: "No weight",
+			list:        "worker1",
+			isErr:       true,
+		},
+		{
+			description: "Zero weight",
+			list:        "worker1=0",
+			isErr:       true,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			weights, err := parseReaderWeights(tc.list)
+			if (err != nil) != tc.isErr {
+				t.Fatalf("wrong error: got [%v] want error %v", err, tc.isErr)
+			}
+			if !maps.Equal(weights, tc.weights) {
+				t.Errorf("wrong weights: got %v want %v", weights, tc.weights)
+			}
+		})
+	}
+}
+
+func TestParseDurations(t *testing.T) {
+	testCases := []struct {
+		description string
+		list        string
+		durations   []time.Duration
+		isErr       bool
+	}{
+		{
+			description: "Empty",
+		},
+		{
+			description: "Several",
+			list:        "100ms, 1s,,5s",
+			durations:   []time.Duration{100 * time.Millisecond, time.Second, 5 * time.Second},
+		},
+		{
+			description: "Wrong duration",
+			list:        "100ms,second",
+			isErr:       true,
+		},
+		{
+			description: "Zero duration",
+			list:        "0s",
+			isErr:       true,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			durations, err := parseDurations(tc.list)
+			if (err != nil) != tc.isErr {
+				t.Fatalf("wrong error: got [%v] want error %v", err, tc.isErr)
+			}
+			if !slices.Equal(durations, tc.durations) {
+				t.Errorf("wrong durations: got %v want %v", durations, tc.durations)
+			}
+		})
+	}
+}
+
+func TestNewTracerProvider(t *testing.T) {
+	testCases := []struct {
+		name  string
+		env   map[string]string
+		isSDK bool
+	}{
+		{name: "not configured"},
+		{name: "empty endpoint", env: map[string]string{"OTEL_EXPORTER_OTLP_ENDPOINT": ""}},
+		{name: "endpoint", env: map[string]string{"OTEL_EXPORTER_OTLP_ENDPOINT": "http://localhost:4318"}, isSDK: true},
+		{name: "traces endpoint", env: map[string]string{"OTEL_EXPORTER_OTLP_TRACES_ENDPOINT": "http://localhost:4318/v1/traces"}, isSDK: true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			lookupEnv := func(key string) (string, bool) {
+				v, ok := tc.env[key]
+				return v, ok
+			}
+			tracerProvider, shutdown, err := newTracerProvider(context.Background(), lookupEnv)
+			if err != nil {
+				t.Fatalf("Unexpected exception: %v", err)
+			}
+			if _, ok := tracerProvider.(*sdktrace.TracerProvider); ok != tc.isSDK {
+				t.Errorf("wrong tracer provider: got %T want SDK %v", tracerProvider, tc.isSDK)
+			}
+			if err := shutdown(context.Background()); err != nil {
+				t.Errorf("Unexpected shutdown exception: %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,87 @@
+package queue
+
+import (
+	"fmt"
+	"slices"
+)
+
+func (q *shardedQueueManager) AddAlias(name, alias string) error {
+	if err := q.ValidateName(alias); err != nil {
+		return err
+	}
+	// Псевдоним не должен скрывать существующую очередь: Put и Get перестали бы до неё доходить
+	if foundQueue, foundTopic := q.find(alias); foundQueue != nil || foundTopic != nil {
+		return fmt.Errorf("%w: %q is a queue", ErrInvalidAlias, alias)
+	}
+	q.aliasesMutex.Lock()
+	defer q.aliasesMutex.Unlock()
+	// Цепочка от name не должна вернуться к alias, иначе разрешение псевдонима не закончилось бы
+	for target := name; ; {
+		if target == alias {
+			return fmt.Errorf("%w: %q refers to itself through %q", ErrInvalidAlias, alias, name)
+		}
+		next, ok := q.aliases[target]
+		if !ok {
+			break
+		}
+		target = next
+	}
+	q.aliases[alias] = name
+	return nil
+}
+
+func (q *shardedQueueManager) RemoveAlias(name, alias string) error {
+	q.aliasesMutex.Lock()
+	defer q.aliasesMutex.Unlock()
+	if target, ok := q.aliases[alias]; !ok || target != name {
+		return ErrQueueNotFound
+	}
+	delete(q.aliases, alias)
+	return nil
+}
+
+func (q *shardedQueueManager) Aliases(name string) []string {
+	q.aliasesMutex.RLock()
+	defer q.aliasesMutex.RUnlock()
+	var aliases []string
+	for alias, target := range q.aliases {
+		if target == name {
+			aliases = append(aliases, alias)
+		}
+	}
+	slices.Sort(aliases)
+	return aliases
+}
+
+// resolveAlias возвращает имя очереди, на которую указывает псевдоним name, проходя всю цепочку псевдонимов.
+// Для имени, которое не является псевдонимом, возвращает его само
+func (q *shardedQueueManager) resolveAlias(name string) string {
+	q.aliasesMutex.RLock()
+	defer q.aliasesMutex.RUnlock()
+	// AddAlias не допускает циклов, поэтому цепочка конечна
+	for {
+		target, ok := q.aliases[name]
+		if !ok {
+			return name
+		}
+		name = target
+	}
+}
+
+// removeAliasesOf удаляет псевдонимы удаленной очереди name, в том числе указывающие на неё через другие псевдонимы,
+// чтобы Put по оставшемуся псевдониму не создал очередь с именем удаленного псевдонима
+func (q *shardedQueueManager) removeAliasesOf(name string) {
+	q.aliasesMutex.Lock()
+	defer q.aliasesMutex.Unlock()
+	removed := []string{name}
+	for len(removed) != 0 {
+		target := removed[len(removed)-1]
+		removed = removed[:len(removed)-1]
+		for alias, aliasTarget := range q.aliases {
+			if aliasTarget == target {
+				delete(q.aliases, alias)
+				removed = append(removed, alias)
+			}
+		}
+	}
+}
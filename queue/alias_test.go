@@ -0,0 +1,133 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+)
+
+// TestQueueManagerAlias проверяет, что Put и Get по псевдониму работают с самой очередью
+func TestQueueManagerAlias(t *testing.T) {
+	manager := newQueueManager(
+		QueueManagerConfig{
+			MaxQueueNum:           10,
+			MaxMessageNumPerQueue: 10,
+		},
+		newMemoryQueue,
+	)
+	defer manager.Stop()
+	ctx := context.Background()
+
+	if err := manager.AddAlias("name", "alias1"); err != nil {
+		t.Fatalf("unexpected error at AddAlias [%v]", err)
+	}
+	// Псевдоним псевдонима ведет к той же очереди
+	if err := manager.AddAlias("alias1", "alias2"); err != nil {
+		t.Fatalf("unexpected error at AddAlias [%v]", err)
+	}
+	if err := manager.Put(ctx, "alias2", "message1"); err != nil {
+		t.Fatalf("unexpected error at Put [%v]", err)
+	}
+	if err := manager.PutBatch(ctx, "alias1", []string{"message2"}); err != nil {
+		t.Fatalf("unexpected error at PutBatch [%v]", err)
+	}
+	if names := manager.List(); !slices.Equal(names, []string{"name"}) {
+		t.Errorf("wrong queues: got %v want [name]", names)
+	}
+	message, err := manager.GetAck(ctx, "alias1", 1)
+	if err != nil {
+		t.Fatalf("unexpected error at GetAck [%v]", err)
+	}
+	if message.Body != "message1" {
+		t.Errorf("wrong message: got [%v] want [%v]", message.Body, "message1")
+	}
+	if err := manager.Ack("alias2", message.ID); err != nil {
+		t.Errorf("unexpected error at Ack [%v]", err)
+	}
+	if message, err := manager.Get(ctx, "name", 1); err != nil || message.Body != "message2" {
+		t.Errorf("wrong Get: got [%v], [%v] want [message2]", message.Body, err)
+	}
+	if aliases := manager.Aliases("name"); !slices.Equal(aliases, []string{"alias1"}) {
+		t.Errorf("wrong aliases: got %v want [alias1]", aliases)
+	}
+
+	testCases := []struct {
+		description string
+		name        string
+		alias       string
+		err         error
+	}{
+		{
+			description: "Self",
+			name:        "name",
+			alias:       "name",
+			err:         ErrInvalidAlias,
+		},
+		{
+			description: "Cycle",
+			name:        "alias2",
+			alias:       "name",
+			err:         ErrInvalidAlias,
+		},
+		{
+			description: "Invalid name",
+			name:        "name",
+			alias:       "bad name",
+			err:         ErrInvalidQueueName,
+		},
+	}
+	for _, tc := range testCases {
+		if err := manager.AddAlias(tc.name, tc.alias); !errors.Is(err, tc.err) {
+			t.Errorf("%s: wrong error: got [%v] want [%v]", tc.description, err, tc.err)
+		}
+	}
+
+	// Псевдоним удаляется только у той очереди, на которую указывает
+	if err := manager.RemoveAlias("other", "alias1"); !errors.Is(err, ErrQueueNotFound) {
+		t.Errorf("wrong RemoveAlias error: got [%v] want [%v]", err, ErrQueueNotFound)
+	}
+	// Удаление очереди удаляет и цепочку её псевдонимов
+	if err := manager.Delete("name"); err != nil {
+		t.Fatalf("unexpected error at Delete [%v]", err)
+	}
+	if aliases := manager.Aliases("alias1"); len(aliases) != 0 {
+		t.Errorf("aliases left after Delete: %v", aliases)
+	}
+	if _, err := manager.Get(ctx, "alias2", 1); !errors.Is(err, ErrQueueNotFound) {
+		t.Errorf("wrong Get error: got [%v] want [%v]", err, ErrQueueNotFound)
+	}
+}
+
+// TestQueueManagerRemoveAlias проверяет, что удаление псевдонима не затрагивает очередь
+func TestQueueManagerRemoveAlias(t *testing.T) {
+	manager := newQueueManager(
+		QueueManagerConfig{
+			MaxQueueNum:           10,
+			MaxMessageNumPerQueue: 10,
+		},
+		newMemoryQueue,
+	)
+	defer manager.Stop()
+	ctx := context.Background()
+
+	if err := manager.Put(ctx, "name", "message"); err != nil {
+		t.Fatalf("unexpected error at Put [%v]", err)
+	}
+	if err := manager.AddAlias("name", "alias"); err != nil {
+		t.Fatalf("unexpected error at AddAlias [%v]", err)
+	}
+	// Имя существующей очереди псевдонимом стать не может
+	if err := manager.AddAlias("alias", "name"); !errors.Is(err, ErrInvalidAlias) {
+		t.Errorf("wrong AddAlias error: got [%v] want [%v]", err, ErrInvalidAlias)
+	}
+	if err := manager.RemoveAlias("name", "alias"); err != nil {
+		t.Fatalf("unexpected error at RemoveAlias [%v]", err)
+	}
+	if _, err := manager.Get(ctx, "alias", 1); !errors.Is(err, ErrQueueNotFound) {
+		t.Errorf("wrong Get error: got [%v] want [%v]", err, ErrQueueNotFound)
+	}
+	if stats, err := manager.Stats("name"); err != nil || stats.Depth != 1 {
+		t.Errorf("wrong Stats: got %+v, [%v] want 1 message", stats, err)
+	}
+}
@@ -0,0 +1,55 @@
+package queue
+
+import (
+	"sync/atomic"
+)
+
+// messageBudget ограничивает суммарное число сообщений во всех очередях менеджера.
+// Общий для всех очередей, резервируется и освобождается из их горутин dispatch
+type messageBudget struct {
+	limit int64 // 0 отключает ограничение
+	used  atomic.Int64
+}
+
+func newMessageBudget(limit int) *messageBudget {
+	return &messageBudget{limit: int64(limit)}
+}
+
+// reserve занимает место под одно сообщение, возвращает false, если лимит исчерпан.
+// Nil бюджет ничего не ограничивает
+func (b *messageBudget) reserve() bool {
+	return b.reserveN(1)
+}
+
+// reserveN занимает место сразу под n сообщений или не занимает ничего, если все не помещаются
+func (b *messageBudget) reserveN(n int) bool {
+	if b == nil {
+		return true
+	}
+	for {
+		used := b.used.Load()
+		if b.limit > 0 && used+int64(n) > b.limit {
+			return false
+		}
+		if b.used.CompareAndSwap(used, used+int64(n)) {
+			return true
+		}
+	}
+}
+
+// force занимает место под одно сообщение, даже если лимит исчерпан.
+// Нужен, чтобы вернуть на место сообщение, которое не удалось переложить
+func (b *messageBudget) force() {
+	if b == nil {
+		return
+	}
+	b.used.Add(1)
+}
+
+// release освобождает место под n сообщений
+func (b *messageBudget) release(n int) {
+	if b == nil || n == 0 {
+		return
+	}
+	b.used.Add(-int64(n))
+}
@@ -0,0 +1,98 @@
+package queue
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// defaultCircuitBreakerCooldown задает время, на которое размыкается предохранитель, если оно не задано
+const defaultCircuitBreakerCooldown = time.Second
+
+// circuitState задает состояние предохранителя
+type circuitState int
+
+const (
+	circuitClosed   circuitState = iota // Put проходят в очередь
+	circuitOpen                         // Put отклоняются сразу, не доходя до очереди
+	circuitHalfOpen                     // после паузы одна пробная Put проверяет, освободилось ли место
+)
+
+// circuitBreaker отклоняет Put в очередь, которая раз за разом оказывается переполненной. После threshold
+// отказов ErrTooManyItems подряд предохранитель размыкается, и следующие Put в течение cooldown сразу получают
+// ErrTooManyItems, не тратя время на очередь. Затем пропускается одна пробная Put: если она прошла,
+// то предохранитель замыкается, а если снова отказ - размыкается еще на cooldown
+type circuitBreaker struct {
+	threshold int
+	cooldown  time.Duration
+
+	mutex    sync.Mutex
+	state    circuitState
+	failures int       // отказы подряд в состоянии circuitClosed
+	openedAt time.Time // момент размыкания
+	probing  bool      // пробная Put в состоянии circuitHalfOpen еще не завершилась
+}
+
+func newCircuitBreaker(threshold int, cooldown time.Duration) *circuitBreaker {
+	if cooldown <= 0 {
+		cooldown = defaultCircuitBreakerCooldown
+	}
+	return &circuitBreaker{threshold: threshold, cooldown: cooldown}
+}
+
+// allow сообщает, можно ли выполнить Put. Пропущенная Put должна сообщить результат через done
+func (b *circuitBreaker) allow() bool {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	switch b.state {
+	case circuitOpen:
+		if time.Since(b.openedAt) < b.cooldown {
+			return false
+		}
+		b.state = circuitHalfOpen
+		b.probing = true
+		return true
+	case circuitHalfOpen:
+		// Пока пробная Put не завершилась, остальные отклоняются
+		if b.probing {
+			return false
+		}
+		b.probing = true
+		return true
+	default:
+		return true
+	}
+}
+
+// done учитывает результат Put. Размыкает предохранитель только переполнение очереди, а успешная Put
+// сбрасывает счетчик отказов. Остальные ошибки, например, отмена контекста, состояние не меняют
+func (b *circuitBreaker) done(err error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	full := errors.Is(err, ErrTooManyItems)
+	switch b.state {
+	case circuitHalfOpen:
+		b.probing = false
+		if err == nil {
+			b.state = circuitClosed
+			b.failures = 0
+		} else if full {
+			b.open()
+		}
+	case circuitClosed:
+		if err == nil {
+			b.failures = 0
+		} else if full {
+			b.failures++
+			if b.failures >= b.threshold {
+				b.open()
+			}
+		}
+	}
+}
+
+func (b *circuitBreaker) open() {
+	b.state = circuitOpen
+	b.openedAt = time.Now()
+	b.failures = 0
+}
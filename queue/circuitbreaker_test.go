@@ -0,0 +1,156 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	const cooldown = 50 * time.Millisecond
+	testCases := []struct {
+		description string
+		results     []error // результаты пропущенных Put по порядку
+		wait        bool    // ждать cooldown после results
+		allowed     bool    // пропускается ли следующая Put
+		state       circuitState
+	}{
+		{
+			description: "Closed below threshold",
+			results:     []error{ErrTooManyItems, ErrTooManyItems},
+			allowed:     true,
+			state:       circuitClosed,
+		},
+		{
+			description: "Opens at threshold",
+			results:     []error{ErrTooManyItems, ErrTooManyItems, ErrTooManyItems},
+			allowed:     false,
+			state:       circuitOpen,
+		},
+		{
+			description: "Success resets failures",
+			results:     []error{ErrTooManyItems, ErrTooManyItems, nil, ErrTooManyItems, ErrTooManyItems},
+			allowed:     true,
+			state:       circuitClosed,
+		},
+		{
+			description: "Other errors are not failures",
+			results:     []error{ErrTooManyItems, ErrCanceled, ErrMessageTooLarge, ErrTooManyItems},
+			allowed:     true,
+			state:       circuitClosed,
+		},
+		{
+			description: "Probe after cooldown",
+			results:     []error{ErrTooManyItems, ErrTooManyItems, ErrTooManyItems},
+			wait:        true,
+			allowed:     true,
+			state:       circuitHalfOpen,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			b := newCircuitBreaker(3, cooldown)
+			for _, err := range tc.results {
+				if !b.allow() {
+					t.Fatalf("Put rejected before the results")
+				}
+				b.done(err)
+			}
+			if tc.wait {
+				time.Sleep(cooldown)
+			}
+			if allowed := b.allow(); allowed != tc.allowed {
+				t.Errorf("wrong allow: got %v want %v", allowed, tc.allowed)
+			}
+			if b.state != tc.state {
+				t.Errorf("wrong state: got %v want %v", b.state, tc.state)
+			}
+		})
+	}
+}
+
+func TestCircuitBreakerHalfOpen(t *testing.T) {
+	const cooldown = 50 * time.Millisecond
+	b := newCircuitBreaker(1, cooldown)
+	b.done(ErrTooManyItems)
+
+	time.Sleep(cooldown)
+	if !b.allow() {
+		t.Fatalf("probe rejected")
+	}
+	// Пока проба не завершилась, остальные Put отклоняются
+	if b.allow() {
+		t.Errorf("second probe allowed")
+	}
+	// Неудачная проба размыкает предохранитель еще на cooldown
+	b.done(ErrTooManyItems)
+	if b.allow() {
+		t.Errorf("allowed after failed probe")
+	}
+
+	time.Sleep(cooldown)
+	if !b.allow() {
+		t.Fatalf("probe rejected")
+	}
+	b.done(nil)
+	if b.state != circuitClosed {
+		t.Errorf("wrong state after successful probe: got %v want %v", b.state, circuitClosed)
+	}
+	if !b.allow() || !b.allow() {
+		t.Errorf("closed breaker rejects Put")
+	}
+}
+
+func TestQueueManagerCircuitBreaker(t *testing.T) {
+	const cooldown = 50 * time.Millisecond
+	manager := newQueueManager(
+		QueueManagerConfig{
+			MaxQueueNum:             10,
+			MaxMessageNumPerQueue:   1,
+			CircuitBreakerThreshold: 2,
+			CircuitBreakerCooldown:  cooldown,
+		},
+		newMemoryQueue,
+	)
+	defer manager.Stop()
+	ctx := context.Background()
+	if err := manager.Put(ctx, "name", "message1"); err != nil {
+		t.Fatalf("unexpected error at Put [%v]", err)
+	}
+	for range 2 {
+		if err := manager.Put(ctx, "name", "message"); !errors.Is(err, ErrTooManyItems) {
+			t.Fatalf("wrong error: got [%v] want [%v]", err, ErrTooManyItems)
+		}
+	}
+	// Место освободилось, но предохранитель разомкнут до конца cooldown
+	if _, err := manager.Get(ctx, "name", 1); err != nil {
+		t.Fatalf("unexpected error at Get [%v]", err)
+	}
+	if err := manager.Put(ctx, "name", "message2"); !errors.Is(err, ErrTooManyItems) {
+		t.Errorf("wrong error with open breaker: got [%v] want [%v]", err, ErrTooManyItems)
+	}
+	// Предохранитель одной очереди не влияет на другие
+	if err := manager.Put(ctx, "other", "message"); err != nil {
+		t.Errorf("unexpected error at Put to other queue [%v]", err)
+	}
+	// PutBlocking не ограничивается
+	if err := manager.PutBlocking(ctx, "name", "message3"); err != nil {
+		t.Errorf("unexpected error at PutBlocking [%v]", err)
+	}
+	if _, err := manager.Get(ctx, "name", 1); err != nil {
+		t.Fatalf("unexpected error at Get [%v]", err)
+	}
+
+	time.Sleep(cooldown)
+	if err := manager.Put(ctx, "name", "message4"); err != nil {
+		t.Errorf("unexpected error at probe Put [%v]", err)
+	}
+	message, err := manager.Get(ctx, "name", 1)
+	if err != nil {
+		t.Fatalf("unexpected error at Get [%v]", err)
+	}
+	if message.Body != "message4" {
+		t.Errorf("wrong message: got [%v] want [%v]", message.Body, "message4")
+	}
+}
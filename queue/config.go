@@ -0,0 +1,135 @@
+package queue
+
+import (
+	"fmt"
+	"time"
+)
+
+// ttlCheckInterval задает наибольший период проверки устаревших сообщений в очереди с TTL
+const ttlCheckInterval = time.Second
+
+// requeueCheckInterval задает наибольший период проверки сообщений в обработке, у которых истек visibility timeout
+const requeueCheckInterval = time.Second
+
+// defaultNackRetryDelay задает задержку первой повторной попытки после Nack, если она не задана в менеджере
+const defaultNackRetryDelay = time.Second
+
+// maxNackRetryDelay ограничивает задержку повторной попытки после Nack
+const maxNackRetryDelay = 300 * time.Second
+
+// asyncPutBufferSize задает число сообщений PutAsync, которые очередь держит до приема диспетчером
+const asyncPutBufferSize = 1024
+
+// OverflowPolicy задает, что делает Put в заполненную очередь
+type OverflowPolicy string
+
+const (
+	OverflowReject     OverflowPolicy = "reject"     // отказать с ErrTooManyItems
+	OverflowDropOldest OverflowPolicy = "dropOldest" // удалить самые старые сообщения, освобождая место новому
+)
+
+// QueueConfig задает настройки отдельной очереди, переопределяющие настройки менеджера.
+// Нулевые поля означают значения по умолчанию
+type QueueConfig struct {
+	MaxMessageNum  int            // ограничение на число сообщений, 0 - MaxMessageNumPerQueue менеджера
+	OverflowPolicy OverflowPolicy // пусто - OverflowReject
+	TTL            time.Duration  // время жизни сообщения в очереди с момента приема, 0 - без ограничения
+	// MaxConsecutiveFailures задает число сообщений подряд, не подтвержденных до истечения visibility timeout,
+	// после которого очередь приостанавливается: Get получают ErrQueueSuspended, а новые сообщения уходят
+	// в очередь недоставленных сообщений. 0 - без ограничения
+	MaxConsecutiveFailures int
+	// MaxRetries задает число повторных попыток после Nack с retry, после которого сообщение переносится
+	// в очередь недоставленных сообщений. 0 - без ограничения
+	MaxRetries int
+}
+
+// validate проверяет настройки, заданные пользователем
+func (c QueueConfig) validate() error {
+	if c.MaxMessageNum < 0 {
+		return fmt.Errorf("%w: negative max message number %d", ErrInvalidConfig, c.MaxMessageNum)
+	}
+	if c.TTL < 0 {
+		return fmt.Errorf("%w: negative TTL %v", ErrInvalidConfig, c.TTL)
+	}
+	if c.MaxConsecutiveFailures < 0 {
+		return fmt.Errorf("%w: negative max consecutive failures %d", ErrInvalidConfig, c.MaxConsecutiveFailures)
+	}
+	if c.MaxRetries < 0 {
+		return fmt.Errorf("%w: negative max retries %d", ErrInvalidConfig, c.MaxRetries)
+	}
+	switch c.OverflowPolicy {
+	case "", OverflowReject, OverflowDropOldest:
+	default:
+		return fmt.Errorf("%w: unknown overflow policy %q", ErrInvalidConfig, c.OverflowPolicy)
+	}
+	return nil
+}
+
+// effectiveConfig возвращает настройки очереди name: переопределенные через SetConfig поля поверх настроек менеджера
+func (q *shardedQueueManager) effectiveConfig(name string) QueueConfig {
+	q.overridesMutex.RLock()
+	config := q.overrides[name]
+	q.overridesMutex.RUnlock()
+	if config.MaxMessageNum == 0 {
+		config.MaxMessageNum = q.config.MaxMessageNumPerQueue
+	}
+	if config.OverflowPolicy == "" {
+		config.OverflowPolicy = OverflowReject
+	}
+	return config
+}
+
+func (q *shardedQueueManager) SetConfig(name string, config QueueConfig) (QueueConfig, error) {
+	return q.updateConfig(name, func(c *QueueConfig) {
+		*c = config
+	})
+}
+
+// updateConfig меняет настройки очереди name функцией update и применяет их. Изменения настроек идут по одному,
+// поэтому update видит результат предыдущего и одновременные изменения разных полей не теряются
+func (q *shardedQueueManager) updateConfig(name string, update func(config *QueueConfig)) (QueueConfig, error) {
+	if err := q.ValidateName(name); err != nil {
+		return QueueConfig{}, err
+	}
+	if _, foundTopic := q.find(name); foundTopic != nil {
+		return QueueConfig{}, ErrWrongQueueType
+	}
+	q.configMutex.Lock()
+	defer q.configMutex.Unlock()
+	q.overridesMutex.RLock()
+	prev, hadPrev := q.overrides[name]
+	q.overridesMutex.RUnlock()
+	config := prev
+	update(&config)
+	if err := config.validate(); err != nil {
+		return QueueConfig{}, err
+	}
+	// Настройки сохраняются до применения, чтобы очередь, созданная в это же время, получила уже новые
+	q.overridesMutex.Lock()
+	q.overrides[name] = config
+	q.overridesMutex.Unlock()
+	effective := q.effectiveConfig(name)
+	if foundQueue := q.findQueue(name); foundQueue != nil {
+		if err := foundQueue.UpdateConfig(effective); err != nil {
+			q.overridesMutex.Lock()
+			if hadPrev {
+				q.overrides[name] = prev
+			} else {
+				delete(q.overrides, name)
+			}
+			q.overridesMutex.Unlock()
+			return QueueConfig{}, err
+		}
+	}
+	return effective, nil
+}
+
+func (q *shardedQueueManager) Config(name string) (QueueConfig, error) {
+	if err := q.ValidateName(name); err != nil {
+		return QueueConfig{}, err
+	}
+	if _, foundTopic := q.find(name); foundTopic != nil {
+		return QueueConfig{}, ErrWrongQueueType
+	}
+	return q.effectiveConfig(name), nil
+}
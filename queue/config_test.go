@@ -0,0 +1,259 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestQueueManagerSetConfig(t *testing.T) {
+	manager := NewQueueManager(QueueManagerConfig{
+		MaxQueueNum:                10,
+		MaxMessageNumPerQueue:      10,
+		MaxSubscriptionNumPerTopic: 10,
+	})
+	defer manager.Stop()
+	ctx := context.Background()
+
+	// Настройки еще не созданной очереди применяются при её создании
+	if _, err := manager.SetConfig("new", QueueConfig{MaxMessageNum: 2}); err != nil {
+		t.Fatalf("Unexpected exception: %v", err)
+	}
+	for i := range 2 {
+		if err := manager.Put(ctx, "new", fmt.Sprintf("message%d", i)); err != nil {
+			t.Fatalf("Unexpected exception: %v", err)
+		}
+	}
+	if err := manager.Put(ctx, "new", "message2"); !errors.Is(err, ErrTooManyItems) {
+		t.Errorf("wrong error: got [%v] want [%v]", err, ErrTooManyItems)
+	}
+
+	// Работающая очередь получает новый лимит сразу
+	for i := range 5 {
+		if err := manager.Put(ctx, "existing", fmt.Sprintf("message%d", i)); err != nil {
+			t.Fatalf("Unexpected exception: %v", err)
+		}
+	}
+	if _, err := manager.SetConfig("existing", QueueConfig{MaxMessageNum: 3}); !errors.Is(err, ErrTooManyItems) {
+		t.Errorf("wrong error: got [%v] want [%v]", err, ErrTooManyItems)
+	}
+	// Отклоненные настройки не сохраняются
+	if config, _ := manager.Config("existing"); config.MaxMessageNum != 10 {
+		t.Errorf("wrong max message number: got %v want %v", config.MaxMessageNum, 10)
+	}
+	if _, err := manager.SetConfig("existing", QueueConfig{MaxMessageNum: 6}); err != nil {
+		t.Fatalf("Unexpected exception: %v", err)
+	}
+	if err := manager.Put(ctx, "existing", "message5"); err != nil {
+		t.Errorf("Unexpected exception: %v", err)
+	}
+	if err := manager.Put(ctx, "existing", "message6"); !errors.Is(err, ErrTooManyItems) {
+		t.Errorf("wrong error: got [%v] want [%v]", err, ErrTooManyItems)
+	}
+
+	// Resize тоже меняет действующие настройки
+	if err := manager.Resize("existing", 8); err != nil {
+		t.Fatalf("Unexpected exception: %v", err)
+	}
+	expected := QueueConfig{MaxMessageNum: 8, OverflowPolicy: OverflowReject}
+	if config, err := manager.Config("existing"); err != nil || config != expected {
+		t.Errorf("wrong config: got %+v, %v want %+v", config, err, expected)
+	}
+	expected = QueueConfig{MaxMessageNum: 10, OverflowPolicy: OverflowReject}
+	if config, err := manager.Config("unknown"); err != nil || config != expected {
+		t.Errorf("wrong default config: got %+v, %v want %+v", config, err, expected)
+	}
+
+	for _, config := range []QueueConfig{{MaxMessageNum: -1}, {TTL: -time.Second}, {OverflowPolicy: "dropNewest"}} {
+		if _, err := manager.SetConfig("invalid", config); !errors.Is(err, ErrInvalidConfig) {
+			t.Errorf("wrong error for %+v: got [%v] want [%v]", config, err, ErrInvalidConfig)
+		}
+	}
+}
+
+// TestQueueManagerDeleteConfig проверяет, что очередь, созданная заново после Delete, получает настройки по умолчанию
+func TestQueueManagerDeleteConfig(t *testing.T) {
+	manager := NewQueueManager(QueueManagerConfig{
+		MaxQueueNum:           10,
+		MaxMessageNumPerQueue: 10,
+	})
+	defer manager.Stop()
+	ctx := context.Background()
+	if _, err := manager.SetConfig("name", QueueConfig{MaxMessageNum: 1}); err != nil {
+		t.Fatalf("Unexpected exception: %v", err)
+	}
+	if err := manager.Put(ctx, "name", "message0"); err != nil {
+		t.Fatalf("Unexpected exception: %v", err)
+	}
+	if err := manager.Delete("name"); err != nil {
+		t.Fatalf("Unexpected exception: %v", err)
+	}
+
+	for i := range 2 {
+		if err := manager.Put(ctx, "name", fmt.Sprintf("message%d", i)); err != nil {
+			t.Fatalf("Unexpected exception: %v", err)
+		}
+	}
+	expected := QueueConfig{MaxMessageNum: 10, OverflowPolicy: OverflowReject}
+	if config, err := manager.Config("name"); err != nil || config != expected {
+		t.Errorf("wrong config: got %+v, %v want %+v", config, err, expected)
+	}
+}
+
+// configHookQueue вызывает beforeUpdate перед каждым UpdateConfig, чтобы тест мог задержать или отклонить изменение
+type configHookQueue struct {
+	queue
+	beforeUpdate func() error
+}
+
+func (q *configHookQueue) UpdateConfig(config QueueConfig) error {
+	if err := q.beforeUpdate(); err != nil {
+		return err
+	}
+	return q.queue.UpdateConfig(config)
+}
+
+// TestQueueManagerResizeConcurrent проверяет, что Resize, вызванный во время применения SetConfig,
+// не теряется, когда SetConfig откатывает свои настройки
+func TestQueueManagerResizeConcurrent(t *testing.T) {
+	factory := newBackendQueueFactory(NewMemoryBackend())
+	updating := make(chan struct{})
+	release := make(chan struct{})
+	var calls atomic.Int32
+	manager := newShardedQueueManager(
+		QueueManagerConfig{
+			MaxQueueNum:           10,
+			MaxMessageNumPerQueue: 10,
+		},
+		func(config queueConfig) (queue, error) {
+			q, err := factory(config)
+			if err != nil {
+				return q, err
+			}
+			return &configHookQueue{queue: q, beforeUpdate: func() error {
+				// Первое изменение ждет сигнала и отклоняется, остальные применяются сразу
+				if calls.Add(1) > 1 {
+					return nil
+				}
+				close(updating)
+				<-release
+				return ErrTooManyItems
+			}}, nil
+		},
+		defaultShardNum,
+	)
+	defer manager.Stop()
+	if _, err := manager.EnsureQueue("name"); err != nil {
+		t.Fatalf("Unexpected exception: %v", err)
+	}
+	setConfigErr := make(chan error, 1)
+	go func() {
+		_, err := manager.SetConfig("name", QueueConfig{MaxMessageNum: 5})
+		setConfigErr <- err
+	}()
+	<-updating
+	resizeErr := make(chan error, 1)
+	go func() {
+		resizeErr <- manager.Resize("name", 8)
+	}()
+	// Resize успевает дойти до настроек, пока SetConfig ждет
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	if err := <-setConfigErr; !errors.Is(err, ErrTooManyItems) {
+		t.Errorf("wrong SetConfig error: got [%v] want [%v]", err, ErrTooManyItems)
+	}
+	if err := <-resizeErr; err != nil {
+		t.Fatalf("Unexpected exception: %v", err)
+	}
+	if config, err := manager.Config("name"); err != nil || config.MaxMessageNum != 8 {
+		t.Errorf("wrong config: got %+v, %v want MaxMessageNum 8", config, err)
+	}
+}
+
+func TestQueueOverflowDropOldest(t *testing.T) {
+	const N = 3
+	q := newQueue(queueConfig{maxMessageNum: N, overflowPolicy: OverflowDropOldest})
+	defer q.Stop()
+
+	for i := range N + 2 {
+		if _, err := q.Put(context.Background(), fmt.Sprintf("message%d", i)); err != nil {
+			t.Errorf("Unexpected exception: %v", err)
+		}
+	}
+	expected := []string{"message2", "message3", "message4"}
+	if messages := q.Snapshot(); !slices.Equal(messages, expected) {
+		t.Errorf("wrong messages: got %v want %v", messages, expected)
+	}
+	// Пакет больше лимита не поместится, даже если удалить все сообщения
+	if _, err := q.PutBatch(context.Background(), []string{"a", "b", "c", "d"}); !errors.Is(err, ErrTooManyItems) {
+		t.Errorf("wrong error: got [%v] want [%v]", err, ErrTooManyItems)
+	}
+	// Удаленные политикой переполнения сообщения не считаются устаревшими
+	if stats := q.Stats(); stats.Dropped != 2 || stats.Expired != 0 {
+		t.Errorf("wrong stats: got %+v want 2 dropped and none expired", stats)
+	}
+}
+
+func TestQueueTTL(t *testing.T) {
+	const ttl = 100 * time.Millisecond
+	q := newQueue(queueConfig{maxMessageNum: 2, ttl: ttl})
+	defer q.Stop()
+
+	for i := range 2 {
+		if _, err := q.Put(context.Background(), fmt.Sprintf("message%d", i)); err != nil {
+			t.Errorf("Unexpected exception: %v", err)
+		}
+	}
+	time.Sleep(ttl / 2)
+	if messages := q.Snapshot(); len(messages) != 2 {
+		t.Errorf("messages expired too early: %v", messages)
+	}
+	// Устаревшие сообщения удаляются по таймеру и освобождают место в очереди
+	time.Sleep(ttl)
+	if stats := q.Stats(); stats.Depth != 0 || stats.Dropped != 2 || stats.Expired != 2 {
+		t.Errorf("wrong stats: got %+v want no messages and 2 dropped and expired", stats)
+	}
+	if _, err := q.Put(context.Background(), "message2"); err != nil {
+		t.Errorf("Unexpected exception: %v", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if message, err := q.Get(ctx); err != nil || message.Body != "message2" {
+		t.Errorf("wrong message: got [%v, %v] want [message2]", message.Body, err)
+	}
+
+	// Удаляются только сообщения старше TTL, а принятые позже остаются
+	if _, err := q.Put(context.Background(), "old"); err != nil {
+		t.Errorf("Unexpected exception: %v", err)
+	}
+	time.Sleep(ttl * 3 / 4)
+	if _, err := q.Put(context.Background(), "fresh"); err != nil {
+		t.Errorf("Unexpected exception: %v", err)
+	}
+	time.Sleep(ttl / 2)
+	if messages := q.Snapshot(); !slices.Equal(messages, []string{"fresh"}) {
+		t.Errorf("wrong messages: got %v want [fresh]", messages)
+	}
+	if stats := q.Stats(); stats.Expired != 3 {
+		t.Errorf("wrong expired: got %v want 3", stats.Expired)
+	}
+	if message, err := q.Get(ctx); err != nil || message.Body != "fresh" {
+		t.Errorf("wrong message: got [%v, %v] want [fresh]", message.Body, err)
+	}
+
+	// Отключение TTL через UpdateConfig сохраняет сообщения
+	if err := q.UpdateConfig(QueueConfig{MaxMessageNum: 2}); err != nil {
+		t.Fatalf("Unexpected exception: %v", err)
+	}
+	if _, err := q.Put(context.Background(), "message3"); err != nil {
+		t.Errorf("Unexpected exception: %v", err)
+	}
+	time.Sleep(2 * ttl)
+	if messages := q.Snapshot(); !slices.Equal(messages, []string{"message3"}) {
+		t.Errorf("wrong messages: got %v want [message3]", messages)
+	}
+}
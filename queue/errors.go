@@ -5,6 +5,21 @@ import (
 )
 
 var (
-	ErrNoMessage    = errors.New("No message")
-	ErrTooManyItems = errors.New("Too many items")
+	ErrNoMessage           = errors.New("No message")
+	ErrTooManyItems        = errors.New("Too many items")
+	ErrQueueNotFound       = errors.New("Queue not found")
+	ErrWrongQueueType      = errors.New("Wrong queue type")
+	ErrMessageNotFound     = errors.New("Message not found")
+	ErrShuttingDown        = errors.New("Queue is shutting down")
+	ErrTooManyWaiters      = errors.New("Too many waiting readers")
+	ErrCanceled            = errors.New("Get canceled by caller")
+	ErrInvalidQueueName    = errors.New("Invalid queue name")
+	ErrMessageTooLarge     = errors.New("Message too large")
+	ErrInvalidPartitionNum = errors.New("Invalid partition number")
+	ErrInvalidConfig       = errors.New("Invalid queue config")
+	ErrQueueSuspended      = errors.New("Queue is suspended")
+	ErrInvalidFilter       = errors.New("Invalid subscription filter")
+	ErrTransactionClosed   = errors.New("Transaction is already committed or rolled back")
+	ErrInvalidAlias        = errors.New("Invalid queue alias")
+	ErrInvalidCursor       = errors.New("Invalid subscription cursor")
 )
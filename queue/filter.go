@@ -0,0 +1,56 @@
+package queue
+
+import (
+	"fmt"
+	"strings"
+)
+
+// MessageFilter отбирает сообщения топика для подписки. Фильтр проверяется до копирования сообщения в буфер
+// подписки, поэтому неподходящие сообщения не занимают её лимит
+type MessageFilter interface {
+	// Match сообщает, должна ли подписка получить сообщение
+	Match(message string) bool
+	// String возвращает фильтр в том виде, в котором его разбирает ParseFilter
+	String() string
+}
+
+// prefixFilterKind задает вид фильтра по началу сообщения
+const prefixFilterKind = "prefix"
+
+// PrefixFilter пропускает сообщения, которые начинаются с заданной строки
+type PrefixFilter string
+
+func (f PrefixFilter) Match(message string) bool {
+	return strings.HasPrefix(message, string(f))
+}
+
+func (f PrefixFilter) String() string {
+	return prefixFilterKind + ":" + string(f)
+}
+
+// ParseFilter разбирает фильтр вида "вид:аргумент", например, "prefix:orders.".
+// Для пустой строки возвращает nil, то есть подписку без фильтра.
+// Возвращает ошибку, оборачивающую ErrInvalidFilter, если вид фильтра неизвестен
+func ParseFilter(s string) (MessageFilter, error) {
+	if s == "" {
+		return nil, nil
+	}
+	kind, arg, found := strings.Cut(s, ":")
+	if !found {
+		return nil, fmt.Errorf("%w: %q has no kind", ErrInvalidFilter, s)
+	}
+	switch kind {
+	case prefixFilterKind:
+		return PrefixFilter(arg), nil
+	default:
+		return nil, fmt.Errorf("%w: unknown kind %q", ErrInvalidFilter, kind)
+	}
+}
+
+// filterString возвращает фильтр в виде строки, для подписки без фильтра - пустую
+func filterString(filter MessageFilter) string {
+	if filter == nil {
+		return ""
+	}
+	return filter.String()
+}
@@ -0,0 +1,74 @@
+package queue
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestParseFilter(t *testing.T) {
+	testCases := []struct {
+		description string
+		filter      string
+		err         error
+		matches     []string
+		mismatches  []string
+	}{
+		{
+			description: "Empty",
+		},
+		{
+			description: "Prefix",
+			filter:      "prefix:orders.",
+			matches:     []string{"orders.", "orders.created"},
+			mismatches:  []string{"", "orders", "payments.orders."},
+		},
+		{
+			description: "Empty prefix",
+			filter:      "prefix:",
+			matches:     []string{"", "anything"},
+		},
+		{
+			description: "Prefix with colon",
+			filter:      "prefix:a:b",
+			matches:     []string{"a:b:c"},
+			mismatches:  []string{"a"},
+		},
+		{
+			description: "No kind",
+			filter:      "orders.",
+			err:         ErrInvalidFilter,
+		},
+		{
+			description: "Unknown kind",
+			filter:      "regexp:^orders",
+			err:         ErrInvalidFilter,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			filter, err := ParseFilter(tc.filter)
+			if !errors.Is(err, tc.err) {
+				t.Fatalf("wrong error: got [%v] want [%v]", err, tc.err)
+			}
+			if err != nil {
+				return
+			}
+			if got := filterString(filter); got != tc.filter {
+				t.Errorf("wrong filter string: got %q want %q", got, tc.filter)
+			}
+			if filter == nil {
+				return
+			}
+			for _, message := range tc.matches {
+				if !filter.Match(message) {
+					t.Errorf("message [%s] expected to match", message)
+				}
+			}
+			for _, message := range tc.mismatches {
+				if filter.Match(message) {
+					t.Errorf("message [%s] expected not to match", message)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,115 @@
+package queue
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// consumerGroupKey задает ключ группы потребителей в контексте Get
+type consumerGroupKey struct{}
+
+// WithConsumerGroup возвращает контекст, Get и GetAck с которым выполняются от имени группы потребителей group.
+// Группа не меняет доставку: читатели всех групп конкурируют за сообщения очереди как обычно,
+// а менеджер только считает участников группы и выданные группе сообщения
+func WithConsumerGroup(ctx context.Context, group string) context.Context {
+	return context.WithValue(ctx, consumerGroupKey{}, group)
+}
+
+// ConsumerGroupFromContext возвращает группу потребителей, заданную через WithConsumerGroup, или пустую строку
+func ConsumerGroupFromContext(ctx context.Context) string {
+	group, _ := ctx.Value(consumerGroupKey{}).(string)
+	return group
+}
+
+// ConsumerGroupStats задает статистику группы потребителей очереди
+type ConsumerGroupStats struct {
+	Name     string
+	Members  int   // число Get группы, которые сейчас ждут сообщения
+	Consumed int64 // число сообщений, выданных группе за всё время
+	Lag      int64 // принятые очередью сообщения за вычетом выданных группе, но не меньше 0
+}
+
+// consumerGroups учитывает группы потребителей всех очередей менеджера. Участником группы считается Get,
+// который ждет сообщения, поэтому участник уходит из группы, как только его контекст завершен
+type consumerGroups struct {
+	mutex sync.Mutex
+	// members задает для очереди число ждущих участников каждой группы
+	members map[string]map[string]int
+	// consumed задает для очереди число сообщений, выданных каждой группе. Группа без участников остается,
+	// чтобы её отставание было видно и между запросами
+	consumed map[string]map[string]int64
+}
+
+func newConsumerGroups() *consumerGroups {
+	return &consumerGroups{
+		members:  make(map[string]map[string]int),
+		consumed: make(map[string]map[string]int64),
+	}
+}
+
+// join учитывает нового участника группы group очереди name
+func (g *consumerGroups) join(name, group string) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	if g.members[name] == nil {
+		g.members[name] = make(map[string]int)
+	}
+	g.members[name][group]++
+	if g.consumed[name] == nil {
+		g.consumed[name] = make(map[string]int64)
+	}
+	if _, ok := g.consumed[name][group]; !ok {
+		g.consumed[name][group] = 0
+	}
+}
+
+// leave убирает участника группы, добавленного через join, и учитывает выданное ему сообщение
+func (g *consumerGroups) leave(name, group string, delivered bool) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	groups := g.members[name]
+	// Очередь могли удалить, пока участник ждал сообщения
+	if groups == nil {
+		return
+	}
+	if groups[group]--; groups[group] <= 0 {
+		delete(groups, group)
+	}
+	if len(groups) == 0 {
+		delete(g.members, name)
+	}
+	if delivered && g.consumed[name] != nil {
+		g.consumed[name][group]++
+	}
+}
+
+// stats возвращает статистику групп очереди name, отсортированную по имени группы.
+// produced задает число принятых очередью сообщений, от него считается отставание
+func (g *consumerGroups) stats(name string, produced int64) []ConsumerGroupStats {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	result := make([]ConsumerGroupStats, 0, len(g.consumed[name]))
+	for group, consumed := range g.consumed[name] {
+		result = append(result, ConsumerGroupStats{
+			Name:     group,
+			Members:  g.members[name][group],
+			Consumed: consumed,
+			// Повторная доставка после visibility timeout может обогнать число принятых сообщений
+			Lag: max(produced-consumed, 0),
+		})
+	}
+	slices.SortFunc(result, func(a, b ConsumerGroupStats) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+	return result
+}
+
+// remove забывает группы удаленной очереди name
+func (g *consumerGroups) remove(name string) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	delete(g.members, name)
+	delete(g.consumed, name)
+}
@@ -0,0 +1,39 @@
+package queue
+
+// QueueHooks задает необязательные обработчики событий очередей, nil поля не вызываются.
+// Менеджер вызывает их синхронно в горутине операции после её успешного завершения,
+// поэтому обработчики должны быть быстрыми, а долгую работу переносить в свои горутины сами.
+//
+// Для топиков messageID пуст в OnPut, так как у каждой подписки своя копия сообщения со своим идентификатором.
+// Копирование в привязанные через Bind очереди, доставка на webhook'и и Move события OnPut и OnGet не вызывают.
+// PutAsync не вызывает OnPut, так как не знает, примет ли очередь сообщение
+type QueueHooks struct {
+	OnPut    func(queue, messageID string) // сообщение принято очередью через Put, PutBatch или Move
+	OnGet    func(queue, messageID string) // сообщение выдано читателю через Get, GetAck или GetSub
+	OnCreate func(queue string)            // очередь или топик созданы, в том числе неявно при первом обращении
+	OnDelete func(queue string)            // очередь или топик удалены через Delete
+}
+
+func (h QueueHooks) put(queue, messageID string) {
+	if h.OnPut != nil {
+		h.OnPut(queue, messageID)
+	}
+}
+
+func (h QueueHooks) get(queue, messageID string) {
+	if h.OnGet != nil {
+		h.OnGet(queue, messageID)
+	}
+}
+
+func (h QueueHooks) create(queue string) {
+	if h.OnCreate != nil {
+		h.OnCreate(queue)
+	}
+}
+
+func (h QueueHooks) delete(queue string) {
+	if h.OnDelete != nil {
+		h.OnDelete(queue)
+	}
+}
@@ -0,0 +1,120 @@
+package queue
+
+import (
+	"slices"
+	"sync/atomic"
+	"time"
+)
+
+// DefaultWaitLatencyBuckets задает границы корзин гистограммы ожидания Get, если WaitLatencyBuckets не задан
+var DefaultWaitLatencyBuckets = []time.Duration{
+	10 * time.Millisecond,
+	50 * time.Millisecond,
+	100 * time.Millisecond,
+	500 * time.Millisecond,
+	time.Second,
+	5 * time.Second,
+	10 * time.Second,
+	30 * time.Second,
+}
+
+// MessageWaitBuckets задает границы корзин гистограммы времени сообщения в очереди от Put до выдачи Get
+var MessageWaitBuckets = []time.Duration{
+	time.Millisecond,
+	10 * time.Millisecond,
+	100 * time.Millisecond,
+	time.Second,
+	10 * time.Second,
+}
+
+// HistogramStats задает снимок гистограммы длительностей
+type HistogramStats struct {
+	Bounds []time.Duration // верхние границы корзин по возрастанию, включительно
+	Counts []int64         // число наблюдений в каждой корзине, последняя корзина - больше всех границ
+	Count  int64           // общее число наблюдений
+	Sum    time.Duration   // сумма всех наблюдений
+}
+
+// WaitLatencyStats задает время ожидания Get от постановки в список ожидания до результата
+type WaitLatencyStats struct {
+	Delivered HistogramStats // Get, получившие сообщение
+	Expired   HistogramStats // Get, не дождавшиеся сообщения: истек таймаут или вызывающий отменил запрос
+}
+
+// latencyHistogram считает длительности по корзинам. Общая для всех очередей менеджера,
+// наблюдения добавляются из их горутин dispatch без блокировок
+type latencyHistogram struct {
+	bounds []time.Duration
+	counts []atomic.Int64 // на одну корзину больше, чем границ
+	sum    atomic.Int64   // сумма в наносекундах
+}
+
+func newLatencyHistogram(bounds []time.Duration) *latencyHistogram {
+	bounds = slices.Clone(bounds)
+	slices.Sort(bounds)
+	bounds = slices.Compact(bounds)
+	return &latencyHistogram{
+		bounds: bounds,
+		counts: make([]atomic.Int64, len(bounds)+1),
+	}
+}
+
+// observe добавляет длительность в первую корзину, граница которой не меньше d. Nil гистограмма ничего не считает
+func (h *latencyHistogram) observe(d time.Duration) {
+	if h == nil {
+		return
+	}
+	i, _ := slices.BinarySearch(h.bounds, d)
+	h.counts[i].Add(1)
+	h.sum.Add(int64(d))
+}
+
+func (h *latencyHistogram) snapshot() HistogramStats {
+	res := HistogramStats{
+		Bounds: slices.Clone(h.bounds),
+		Counts: make([]int64, len(h.bounds)+1),
+		Sum:    time.Duration(h.sum.Load()),
+	}
+	for i := range res.Counts {
+		res.Counts[i] = h.counts[i].Load()
+		res.Count += res.Counts[i]
+	}
+	return res
+}
+
+// waitLatency хранит гистограммы ожидания Get по исходу
+type waitLatency struct {
+	delivered *latencyHistogram
+	expired   *latencyHistogram
+}
+
+func newWaitLatency(bounds []time.Duration) *waitLatency {
+	if bounds == nil {
+		bounds = DefaultWaitLatencyBuckets
+	}
+	return &waitLatency{
+		delivered: newLatencyHistogram(bounds),
+		expired:   newLatencyHistogram(bounds),
+	}
+}
+
+// observe учитывает время ожидания запроса, который получил сообщение или не дождался его.
+// Nil waitLatency ничего не считает
+func (w *waitLatency) observe(ws *getWaitStatus, delivered bool) {
+	if w == nil {
+		return
+	}
+	d := time.Since(ws.createdAt)
+	if delivered {
+		w.delivered.observe(d)
+	} else {
+		w.expired.observe(d)
+	}
+}
+
+func (w *waitLatency) snapshot() WaitLatencyStats {
+	return WaitLatencyStats{
+		Delivered: w.delivered.snapshot(),
+		Expired:   w.expired.snapshot(),
+	}
+}
@@ -0,0 +1,95 @@
+package queue
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestLatencyHistogram(t *testing.T) {
+	h := newLatencyHistogram([]time.Duration{time.Second, 10 * time.Millisecond, 100 * time.Millisecond, time.Second})
+	for _, d := range []time.Duration{0, 10 * time.Millisecond, 11 * time.Millisecond, 500 * time.Millisecond, time.Minute} {
+		h.observe(d)
+	}
+	stats := h.snapshot()
+	if want := []time.Duration{10 * time.Millisecond, 100 * time.Millisecond, time.Second}; !slices.Equal(stats.Bounds, want) {
+		t.Errorf("wrong bounds: got %v want %v", stats.Bounds, want)
+	}
+	// Граница входит в свою корзину, а все, что больше последней границы, попадает в дополнительную корзину
+	if want := []int64{2, 1, 1, 1}; !slices.Equal(stats.Counts, want) {
+		t.Errorf("wrong counts: got %v want %v", stats.Counts, want)
+	}
+	if stats.Count != 5 {
+		t.Errorf("wrong count: got %v want %v", stats.Count, 5)
+	}
+	if want := time.Minute + 521*time.Millisecond; stats.Sum != want {
+		t.Errorf("wrong sum: got %v want %v", stats.Sum, want)
+	}
+}
+
+// TestQueueWaitLatency проверяет, что время ожидания Get попадает в гистограмму своего исхода
+func TestQueueWaitLatency(t *testing.T) {
+	const delay = 100 * time.Millisecond
+	latency := newWaitLatency([]time.Duration{delay / 2, 2 * delay, time.Minute})
+	q := newQueue(queueConfig{maxMessageNum: 10, waitLatency: latency})
+	defer q.Stop()
+
+	// Сообщение приходит через delay после начала ожидания
+	go func() {
+		time.Sleep(delay)
+		_, _ = q.Put(context.Background(), "message")
+	}()
+	if _, err := q.Get(context.Background()); err != nil {
+		t.Fatalf("Unexpected exception: %v", err)
+	}
+	// Сообщения нет, ожидание истекает через delay
+	ctx, cancel := context.WithTimeout(context.Background(), delay)
+	defer cancel()
+	if _, err := q.Get(ctx); err == nil {
+		t.Fatalf("expected error")
+	}
+
+	stats := latency.snapshot()
+	for _, tc := range []struct {
+		outcome string
+		stats   HistogramStats
+	}{
+		{"delivered", stats.Delivered},
+		{"expired", stats.Expired},
+	} {
+		if want := []int64{0, 1, 0, 0}; !slices.Equal(tc.stats.Counts, want) {
+			t.Errorf("wrong %s counts: got %v want %v", tc.outcome, tc.stats.Counts, want)
+		}
+		if tc.stats.Sum < delay || tc.stats.Sum > 2*delay {
+			t.Errorf("wrong %s sum: got %v want about %v", tc.outcome, tc.stats.Sum, delay)
+		}
+	}
+}
+
+// TestQueueMessageWait проверяет, что время сообщения в очереди от Put до Get попадает в свою корзину
+func TestQueueMessageWait(t *testing.T) {
+	const delay = 20 * time.Millisecond
+	q := newQueue(queueConfig{maxMessageNum: 10})
+	defer q.Stop()
+
+	if _, err := q.Put(context.Background(), "message"); err != nil {
+		t.Fatalf("Unexpected exception: %v", err)
+	}
+	time.Sleep(delay)
+	if _, err := q.Get(context.Background()); err != nil {
+		t.Fatalf("Unexpected exception: %v", err)
+	}
+
+	stats := q.MessageWait()
+	if !slices.Equal(stats.Bounds, MessageWaitBuckets) {
+		t.Errorf("wrong bounds: got %v want %v", stats.Bounds, MessageWaitBuckets)
+	}
+	// delay попадает в корзину (10ms, 100ms]
+	if want := []int64{0, 0, 1, 0, 0, 0}; !slices.Equal(stats.Counts, want) {
+		t.Errorf("wrong counts: got %v want %v", stats.Counts, want)
+	}
+	if stats.Sum < delay || stats.Sum > 5*delay {
+		t.Errorf("wrong sum: got %v want about %v", stats.Sum, delay)
+	}
+}
@@ -1,102 +1,1115 @@
 package queue
 
 import (
+	"cmp"
 	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+var (
+	errorLogger = log.New(os.Stderr, "[ERROR]:QUEUE:", log.Ldate|log.Ltime|log.Lmicroseconds)
 )
 
 // QueueManager задает интерфейс менеджера очередей.
 // Очередь доступна по имени.
 type QueueManager interface {
 	// Get извлекает из очереди, заданной name, сообщение, вызывая метод Get очереди.
-	Get(ctx context.Context, name string, timeout int) (string, error)
+	// Возвращает ErrQueueNotFound сразу, если такой очереди нет, ErrNoMessage, если очередь пуста,
+	// и ErrWrongQueueType, если name - это топик.
+	// Если ctx задает группу потребителей через WithConsumerGroup, то на время ожидания вызывающий
+	// считается участником группы, а выданное сообщение учитывается в её статистике
+	Get(ctx context.Context, name string, timeout int) (Message, error)
+	// GetAck извлекает из очереди, заданной name, сообщение, вызывая метод GetAck очереди.
+	// Сообщение остается в обработке до подтверждения через Ack по его идентификатору.
+	// Ошибки и учет группы потребителей такие же, как у Get
+	GetAck(ctx context.Context, name string, timeout int) (Message, error)
+	// Ack подтверждает обработку сообщения id из очереди name.
+	// Возвращает ErrQueueNotFound, если такой очереди нет, и ErrMessageNotFound,
+	// если сообщение не в обработке, например, истек его visibility timeout
+	Ack(name, id string) error
+	// Nack отказывается от обработки сообщения id из очереди name. Без retry сообщение сразу возвращается в начало
+	// очереди, а с retry - через 2^attempt NackRetryDelay, но не позже чем через 300 секунд. После MaxRetries
+	// повторных попыток сообщение переносится в очередь недоставленных сообщений name + ".dlq" вместе с числом попыток.
+	// Если она переполнена, то сообщение остается в обработке с новым visibility timeout, а вызывающий получает
+	// ErrTooManyItems. Ошибки такие же, как у Ack
+	Nack(name, id string, retry bool) error
+	// GetSub извлекает сообщение для подписки sub из топика, заданного name.
+	// Топик и подписка создаются при первом обращении.
+	// Возвращает ErrWrongQueueType, если name - это обычная очередь, и
+	// ErrTooManyItems, если срабатывает лимит на количество очередей или подписок
+	GetSub(ctx context.Context, name, sub string, timeout int) (Message, error)
+	// Subscribe создает подписку sub на топик name с фильтром filter, создавая и топик при необходимости.
+	// Подписка получает только сообщения, которые пропускает фильтр, остальные не занимают её буфер.
+	// Фильтр задается при создании подписки: для существующей подписки с другим фильтром возвращается
+	// ErrInvalidFilter. Остальные ошибки такие же, как у GetSub
+	Subscribe(name, sub string, filter MessageFilter) error
+	// ResumeSub возобновляет чтение подписки sub топика name с курсора cursor - идентификатора последнего сообщения,
+	// полученного читателем. Возвращает сообщения, выданные подписке после курсора в пределах SubscriptionRetention,
+	// которые читатель мог не получить, например, из-за разрыва соединения. Курсор общий для всех читателей подписки,
+	// поэтому при нескольких читателях возвращаются и сообщения, выданные другим. Возвращает ErrInvalidCursor
+	// для курсора, который не является идентификатором сообщения. Остальные ошибки такие же, как у GetSub
+	ResumeSub(name, sub, cursor string) ([]Message, error)
 	// Put кладет в очередь, заданную name, сообщение, вызывая матод Put очереди
+	// Если name - это топик, то сообщение копируется во все его подписки.
 	// Может вернуть ошибку ErrTooManyItems, если срабатывает лимит на
 	// количество очередей
-	Put(name, message string) error
+	// Принятое сообщение асинхронно копируется во все очереди, привязанные к name через Bind.
+	// Ошибки копирования только логируются и не влияют на результат Put.
+	// Отмена контекста прерывает ожидание, пока очередь примет сообщение, но не копирование в привязанные очереди.
+	// Сообщение длиннее MaxMessageBytes не принимается с ошибкой ErrMessageTooLarge.
+	// Если включен предохранитель, то после серии переполнений очередь на время отклоняет Put с ErrTooManyItems.
+	// Сообщение в очередь, приостановленную после MaxConsecutiveFailures неудачных доставок,
+	// помещается в очередь недоставленных сообщений name + ".dlq"
+	Put(ctx context.Context, name, message string) error
+	// PutBlocking помещает сообщение в очередь, как Put, но в переполненную очередь не отказывает с ErrTooManyItems сразу,
+	// а ждет, пока читатели освободят место, до истечения ctx. Если место так и не освободилось, то возвращает
+	// ErrTooManyItems, а если ctx отменил вызывающий - ErrCanceled. Лимит на число очередей не ждет
+	PutBlocking(ctx context.Context, name, message string) error
+	// PutAsync помещает сообщение в очередь, как Put, но не ждет, пока очередь его примет: сообщение, которое
+	// не поместится в лимит, будет отброшено без ошибки. Возвращает ErrTooManyItems, если очередь не успевает
+	// принимать такие сообщения или достигнут лимит на число очередей, ErrMessageTooLarge, если сообщение длиннее
+	// MaxMessageBytes, и ErrWrongQueueType, если name - это топик. OnPut для таких сообщений не вызывается,
+	// а в привязанные очереди они копируются сразу
+	PutAsync(ctx context.Context, name, message string) error
+	// Bind привязывает очередь target к очереди name: сообщения, помещенные в name,
+	// будут копироваться и в target. Порядок сообщений в target не гарантируется
+	Bind(name, target string)
+	// Unbind удаляет привязку очереди target к очереди name
+	Unbind(name, target string)
+	// AddWebhook регистрирует url, на который POST запросом доставляются сообщения из очереди name.
+	// Очередь создается, если её нет. Сообщения, которые не удалось доставить после
+	// всех повторных попыток, помещаются в очередь с именем name + ".dlq".
+	// Возвращает ErrWrongQueueType, если name - это топик
+	AddWebhook(name, url string) error
+	// Pause приостанавливает доставку сообщений из очереди, заданной name.
+	// Возвращает ErrQueueNotFound, если такой очереди нет. Топики не приостанавливаются
+	Pause(name string) error
+	// Resume возобновляет доставку сообщений из очереди, заданной name.
+	// Возвращает ErrQueueNotFound, если такой очереди нет
+	Resume(name string) error
+	// Unsuspend возобновляет очередь, приостановленную после MaxConsecutiveFailures неподтвержденных сообщений подряд,
+	// и сбрасывает счетчик неудач. Возвращает ErrQueueNotFound, если такой очереди нет
+	Unsuspend(name string) error
+	// Restart перезапускает горутину, которая обрабатывает запросы к очереди name, если очередь оказалась
+	// в неисправном состоянии. Сообщения сохраняются, ожидающие Get получают ErrShuttingDown, а ожидающие
+	// места PutBlocking - ErrTooManyItems, поэтому клиенты могут просто повторить запрос. Остальные вызовы
+	// на время перезапуска ждут. Возвращает ErrQueueNotFound, если такой очереди нет, ErrWrongQueueType,
+	// если name - это топик, и ошибку ctx, если очередь не приняла запрос до завершения ctx
+	Restart(ctx context.Context, name string) error
+	// Move перекладывает сообщение из начала очереди src в конец очереди dest, создавая dest при необходимости.
+	// Пока dest не примет сообщение, src хранит его в хранилище и в общем лимите, поэтому падение процесса
+	// оставляет сообщение в src. Если dest переполнена, то сообщение возвращается в начало src, а вызывающий
+	// получает ErrTooManyItems. Если src успели остановить или удалить, то вернуть сообщение некуда,
+	// и ошибка оборачивает и ошибку dest, и ErrShuttingDown: остановленная очередь сохранила сообщение
+	// в хранилище, а удаленная удалила вместе с остальными. Как и Put, в приостановленную dest сообщение
+	// попадает в её очередь недоставленных сообщений, а после переноса вызывается OnPut для dest и сообщение
+	// копируется в очереди, привязанные к dest. Возвращает ErrQueueNotFound, если src нет,
+	// ErrNoMessage, если src пуста, ErrWrongQueueType, если src или dest - это топик, и ErrQueueSuspended,
+	// если dest приостановлена, а src - её очередь недоставленных сообщений
+	Move(ctx context.Context, src, dest string) error
+	// Replay возвращает через Move до limit сообщений (0 - все) из очереди недоставленных сообщений name
+	// в очередь, из которой они туда попали, то есть name без суффикса ".dlq". Сообщения попадают в конец очереди
+	// как новые, с нулевым числом попыток. Переносятся только сообщения, которые были в name на момент вызова,
+	// чтобы снова не доставленные сообщения не переносились по кругу. Возвращает число перенесенных сообщений
+	// и ошибку, на которой перенос остановился: ErrTooManyItems, если очередь заполнилась. Возвращает ошибку,
+	// оборачивающую ErrInvalidQueueName, если name не оканчивается на ".dlq", ErrQueueNotFound, если name нет,
+	// ErrWrongQueueType, если name или исходная очередь - это топик, и ErrQueueSuspended, если исходная очередь
+	// приостановлена: сообщения остаются в name до Unsuspend
+	Replay(ctx context.Context, name string, limit int) (int, error)
+	// Purge удаляет все сообщения из очереди, заданной name, не удаляя саму очередь, и возвращает их число.
+	// Возвращает ErrQueueNotFound, если такой очереди нет, и ErrWrongQueueType, если name - это топик
+	Purge(name string) (int, error)
+	// PutBatch помещает сообщения в очередь, заданную name, создавая ее при необходимости: либо все, либо ни одного.
+	// Возвращает ErrTooManyItems, если все сообщения не помещаются в лимит, ErrMessageTooLarge, если хотя бы одно
+	// длиннее MaxMessageBytes, и ErrWrongQueueType, если name - это топик
+	PutBatch(ctx context.Context, name string, messages []string) error
+	// AddAlias задает псевдоним alias, под которым Get, GetAck, Ack, GetSub, Subscribe, ResumeSub, Put, PutBlocking,
+	// PutAsync, PutBatch и транзакции обращаются к очереди или топику name. Псевдоним может указывать на другой псевдоним.
+	// Очередь name может еще не существовать, а при удалении через Delete её псевдонимы удаляются.
+	// Возвращает ошибку, оборачивающую ErrInvalidAlias, если alias совпадает с существующей очередью
+	// или псевдонимы образуют цикл, и ошибку, оборачивающую ErrInvalidQueueName, если имя alias недопустимо
+	AddAlias(name, alias string) error
+	// RemoveAlias удаляет псевдоним alias очереди name, не затрагивая саму очередь.
+	// Возвращает ErrQueueNotFound, если такого псевдонима у name нет
+	RemoveAlias(name, alias string) error
+	// Aliases возвращает отсортированные псевдонимы, которые указывают прямо на name
+	Aliases(name string) []string
+	// Begin начинает транзакцию, которая помещает сообщения в несколько очередей: либо во все, либо ни в одну
+	Begin() Transaction
+	// Snapshot возвращает все сообщения очереди, заданной name, по порядку, не извлекая их.
+	// Возвращает ErrQueueNotFound, если такой очереди нет, и ErrWrongQueueType, если name - это топик
+	Snapshot(name string) ([]string, error)
+	// Sample возвращает не более n сообщений очереди name, равномерно выбранных от начала до конца, не извлекая их.
+	// Первое и последнее сообщения входят в выборку, если n больше 1. Ошибки такие же, как у Snapshot
+	Sample(name string, n int) ([]string, error)
+	// Resize меняет ограничение на число сообщений в очереди, заданной name.
+	// Возвращает ErrQueueNotFound, если такой очереди нет, ErrWrongQueueType, если name - это топик,
+	// и ErrTooManyItems, если в очереди уже больше сообщений, чем newMax
+	Resize(name string, newMax int) error
+	// SetConfig переопределяет настройки очереди name и возвращает действующие настройки с учетом значений по умолчанию.
+	// Настройки сохраняются и для еще не созданной очереди и применяются при её создании, а работающей очереди
+	// передаются сразу. Возвращает ErrInvalidConfig для недопустимых значений, ErrWrongQueueType для топика
+	// и ErrTooManyItems, если в очереди уже больше сообщений, чем новый лимит, тогда настройки не меняются
+	SetConfig(name string, config QueueConfig) (QueueConfig, error)
+	// Config возвращает действующие настройки очереди name, в том числе еще не созданной
+	Config(name string) (QueueConfig, error)
+	// Delete останавливает очередь или топик, заданный name, и удаляет его из менеджера вместе
+	// с привязками, заданными через Bind, и настройками, заданными через SetConfig. Для префикса партиций
+	// удаляет правило маршрутизации, а партиции остаются обычными очередями. Возвращает ErrQueueNotFound,
+	// если нет ни такой очереди, ни такого префикса
+	Delete(name string) error
+	// Stats возвращает статистику очереди name.
+	// Возвращает ErrQueueNotFound, если такой очереди нет, и ErrWrongQueueType, если name - это топик
+	Stats(name string) (QueueStats, error)
+	// ConsumerGroups возвращает статистику групп потребителей очереди name, отсортированную по имени группы.
+	// Группа появляется при первом Get от её имени и остается до удаления очереди. Возвращает те же ошибки, что и Stats
+	ConsumerGroups(name string) ([]ConsumerGroupStats, error)
+	// MessageWait возвращает гистограмму времени сообщений очереди name от Put до выдачи Get с границами
+	// MessageWaitBuckets. Возвращает те же ошибки, что и Stats
+	MessageWait(name string) (HistogramStats, error)
+	// List возвращает отсортированные имена всех очередей и топиков
+	List() []string
+	// ValidateName проверяет имя очереди по QueueNamePattern из настроек менеджера.
+	// Возвращает ошибку, оборачивающую ErrInvalidQueueName. Очереди и топики с недопустимыми именами
+	// не создаются: методы, создающие их при первом обращении, возвращают ту же ошибку
+	ValidateName(name string) error
+	// EnsureQueue создает пустую очередь name, если её еще нет, и сообщает, была ли очередь создана этим вызовом.
+	// Нужна, чтобы читатели могли ждать сообщений в очереди до первого Put, не получая ErrQueueNotFound.
+	// Возвращает ErrTooManyItems, если срабатывает лимит на количество очередей, и ErrWrongQueueType, если name - это топик
+	EnsureQueue(name string) (bool, error)
+	// CreatePartitioned создает очереди {prefix}-0 ... {prefix}-{n-1} и направляет в них Put и Get по имени prefix:
+	// Put пишет в партиции по очереди (round-robin), а Get ищет сообщение, начиная каждый раз со следующей партиции.
+	// Порядок сообщений сохраняется только внутри партиции. GetAck, Stats и остальные методы с именем prefix
+	// не работают, к ним нужно обращаться по именам партиций. Возвращает ErrInvalidPartitionNum, если n не больше 0,
+	// и ErrWrongQueueType, если prefix или имя партиции уже занято топиком, а prefix - очередью.
+	// Если лимит на число очередей сработал посреди создания, то созданные партиции остаются обычными очередями
+	CreatePartitioned(prefix string, n int) error
+	// WaitLatency возвращает гистограммы времени ожидания Get во всех очередях и подписках
+	// от создания запроса до получения сообщения или до истечения таймаута
+	WaitLatency() WaitLatencyStats
 	// Stop останавливает очереди
 	Stop()
 }
 
 type QueueManagerConfig struct {
-	MaxQueueNum           int
-	MaxMessageNumPerQueue int
+	MaxQueueNum                int // ограничение на суммарное число очередей и топиков
+	MaxMessageNumPerQueue      int // ограничение на число сообщений в очереди и в буфере каждой подписки
+	MaxTotalMessages           int // ограничение на суммарное число сообщений во всех очередях и подписках, 0 - без ограничения
+	MaxWaitersPerQueue         int // ограничение на число ожидающих Get в очереди и в каждой подписке, 0 - без ограничения
+	MaxSubscriptionNumPerTopic int
+	WebhookMaxRetries          int             // число повторных попыток доставки на webhook
+	WebhookRetryDelay          time.Duration   // задержка перед первой повторной попыткой, далее удваивается
+	VisibilityTimeout          time.Duration   // время, на которое сообщение из GetAck уходит в обработку
+	NackRetryDelay             time.Duration   // задержка первой повторной попытки после Nack, далее удваивается, 0 - секунда
+	Hooks                      QueueHooks      // обработчики событий очередей
+	QueueNamePattern           *regexp.Regexp  // допустимые имена очередей, nil - правило ValidateQueueName
+	MaxMessageBytes            int             // ограничение на размер сообщения в байтах, 0 - без ограничения
+	DataDir                    string          // каталог для журналов очередей на диске, пусто - очереди только в памяти
+	SyncMode                   SyncMode        // когда журналы очередей сбрасываются на диск, пусто - SyncModeSync
+	MaxLogBytes                int64           // размер журнала очереди, после которого он переписывается, 0 - 64 МиБ
+	WaitLatencyBuckets         []time.Duration // границы корзин гистограммы ожидания Get, nil - DefaultWaitLatencyBuckets
+	Storage                    StorageBackend  // внешнее хранилище сообщений очередей, если задано, то DataDir не используется
+	// Tracer создает спаны Get, Put и выдачи сообщений, связанные через контекст вызова, nil отключает трассировку
+	Tracer trace.Tracer
+	// CircuitBreakerThreshold задает число отказов Put из-за переполнения очереди подряд, после которого
+	// Put в эту очередь на CircuitBreakerCooldown отклоняются сразу, 0 - без предохранителя
+	CircuitBreakerThreshold int
+	CircuitBreakerCooldown  time.Duration // 0 - одна секунда
+	// ReaderWeights задает веса потребителей (WithConsumerID), по которым сообщение достается одному из нескольких
+	// ожидающих Get очереди: при одновременном ожидании потребитель с весом 3 получает втрое больше сообщений,
+	// чем с весом 1. Потребители без веса получают вес 1. nil - Get обслуживаются строго по порядку поступления
+	ReaderWeights map[string]int
+	// SubscriptionRetention задает, сколько подписка помнит выданные сообщения для ResumeSub, если курсор
+	// читателя их ещё не подтвердил. Подписка помнит не больше MaxMessageNumPerQueue сообщений.
+	// 0 - выданные сообщения не хранятся, и после переподключения читатель получает только буфер подписки
+	SubscriptionRetention time.Duration
 }
 
-// NewQueueManager создает менеджер очередей
+// queueFactory создает очередь по её настройкам, в тестах вместо настоящих очередей подставляются моки
+type queueFactory func(queueConfig) (queue, error)
+
+// NewQueueManager создает менеджер очередей.
+// Если задан Storage или DataDir, то сообщения очередей хранятся в Storage или в журналах в DataDir,
+// а сохраненные там очереди создаются сразу. Топики и настройки очередей, заданные через SetConfig,
+// хранятся только в памяти
 func NewQueueManager(config QueueManagerConfig) QueueManager {
 	// Наружу выставляем версию со стандартной фабрикой очередей
-	return newQueueManager(config, newQueue)
+	switch {
+	case config.Storage != nil:
+		manager := newShardedQueueManager(config, newBackendQueueFactory(config.Storage), defaultShardNum)
+		manager.restore(config.Storage.Queues)
+		return manager
+	case config.DataDir != "":
+		manager := newShardedQueueManager(config, newPersistentQueue, defaultShardNum)
+		manager.restore(func() ([]string, error) {
+			return persistedQueueNames(config.DataDir)
+		})
+		return manager
+	default:
+		return newQueueManager(config, newMemoryQueue)
+	}
 }
 
 // newQueueManager создает менеджер очередей и позволяет мокать очереди для юнит тестов
-func newQueueManager(config QueueManagerConfig, factory func(int) queue) QueueManager {
-	return &queueManagerImpl{
-		config:  config,
-		queues:  make(map[string]queue),
-		factory: factory,
+func newQueueManager(config QueueManagerConfig, factory queueFactory) QueueManager {
+	return newShardedQueueManager(config, factory, defaultShardNum)
+}
+
+// newShardedQueueManager создает менеджер очередей, разбитых на shardNum шардов
+func newShardedQueueManager(config QueueManagerConfig, factory queueFactory, shardNum int) *shardedQueueManager {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &shardedQueueManager{
+		config:        config,
+		shards:        newQueueShards(shardNum),
+		bindings:      make(map[string][]string),
+		partitions:    make(map[string]*partitionRule),
+		overrides:     make(map[string]QueueConfig),
+		breakers:      make(map[string]*circuitBreaker),
+		aliases:       make(map[string]string),
+		factory:       factory,
+		budget:        newMessageBudget(config.MaxTotalMessages),
+		waitLatency:   newWaitLatency(config.WaitLatencyBuckets),
+		groups:        newConsumerGroups(),
+		webhookClient: &http.Client{Timeout: 10 * time.Second},
+		webhooksCtx:   ctx,
+		stopWebhooks:  cancel,
 	}
 }
 
-type queueManagerImpl struct {
-	config QueueManagerConfig
-	queues map[string]queue
-	// Чтение мапы с очередями должно быть много чаще, чем запись
-	mutex   sync.RWMutex
-	factory func(int) queue
+// shardedQueueManager хранит очереди в шардах по хешу имени, у каждого шарда своя блокировка
+type shardedQueueManager struct {
+	config   QueueManagerConfig
+	shards   []*queueShard
+	queueNum atomic.Int64 // суммарное число очередей и топиков во всех шардах
+	// bindings задает для очереди список очередей, в которые копируются её сообщения
+	bindings      map[string][]string
+	bindingsMutex sync.RWMutex
+	// partitions задает для префикса партиции, по которым распределяются Put и Get
+	partitions      map[string]*partitionRule
+	partitionsMutex sync.RWMutex
+	// overrides задает настройки отдельных очередей, заданные через SetConfig, в том числе для еще не созданных
+	overrides      map[string]QueueConfig
+	overridesMutex sync.RWMutex
+	configMutex    sync.Mutex // упорядочивает изменения настроек через updateConfig вместе с их применением
+	factory        queueFactory
+	budget         *messageBudget // общий для всех очередей лимит на число сообщений
+	waitLatency    *waitLatency   // общие для всех очередей гистограммы ожидания Get
+	groups         *consumerGroups
+
+	// breakers задает предохранители Put существующих очередей, если они включены
+	breakers      map[string]*circuitBreaker
+	breakersMutex sync.RWMutex
+
+	// aliases задает для псевдонима имя, под которым Put и Get обращаются к очереди или топику
+	aliases      map[string]string
+	aliasesMutex sync.RWMutex
+
+	webhookClient *http.Client
+	webhooksCtx   context.Context    // отменяется при Stop и завершает доставку на webhook'и
+	stopWebhooks  context.CancelFunc // отменяет webhooksCtx
+	webhooksWg    sync.WaitGroup     // для ожидания завершения горутин доставки на webhook'и
 }
 
-func (q *queueManagerImpl) Get(ctx context.Context, name string, timeout int) (string, error) {
+func (q *shardedQueueManager) Get(ctx context.Context, name string, timeout int) (message Message, err error) {
+	name = q.resolveAlias(name)
+	ctx, span := startSpan(ctx, q.config.Tracer, "get", name)
+	defer func() { q.endSpan(span, name, err) }()
 	ctx, cancel := context.WithTimeout(ctx, time.Duration(timeout)*time.Second)
 	defer cancel()
-	var foundQueue queue
+	if rule := q.partition(name); rule != nil {
+		return q.getPartitioned(ctx, rule)
+	}
+	foundQueue, foundTopic := q.find(name)
+	if foundTopic != nil {
+		return Message{}, ErrWrongQueueType
+	}
+	if foundQueue == nil {
+		return Message{}, ErrQueueNotFound
+	}
+	if group := ConsumerGroupFromContext(ctx); group != "" {
+		q.groups.join(name, group)
+		defer func() { q.groups.leave(name, group, err == nil) }()
+	}
+	message, err = foundQueue.Get(ctx)
+	if err != nil {
+		return Message{}, err
+	}
+	q.config.Hooks.get(name, message.ID)
+	return message, nil
+}
+
+func (q *shardedQueueManager) GetAck(ctx context.Context, name string, timeout int) (message Message, err error) {
+	name = q.resolveAlias(name)
+	ctx, span := startSpan(ctx, q.config.Tracer, "getAck", name)
+	defer func() { q.endSpan(span, name, err) }()
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(timeout)*time.Second)
+	defer cancel()
+	foundQueue, foundTopic := q.find(name)
+	if foundTopic != nil {
+		return Message{}, ErrWrongQueueType
+	}
+	if foundQueue == nil {
+		return Message{}, ErrQueueNotFound
+	}
+	if group := ConsumerGroupFromContext(ctx); group != "" {
+		q.groups.join(name, group)
+		defer func() { q.groups.leave(name, group, err == nil) }()
+	}
+	message, err = foundQueue.GetAck(ctx)
+	if err != nil {
+		return Message{}, err
+	}
+	q.config.Hooks.get(name, message.ID)
+	return message, nil
+}
+
+func (q *shardedQueueManager) Ack(name, id string) error {
+	foundQueue := q.findQueue(q.resolveAlias(name))
+	if foundQueue == nil {
+		return ErrQueueNotFound
+	}
+	return foundQueue.Ack(id)
+}
+
+func (q *shardedQueueManager) Nack(name, id string, retry bool) error {
+	name = q.resolveAlias(name)
+	foundQueue := q.findQueue(name)
+	if foundQueue == nil {
+		return ErrQueueNotFound
+	}
+	env, err := foundQueue.Nack(id, retry)
+	if err != nil || env == nil {
+		return err
+	}
+	dlq, dlqTopic, err := q.findOrCreate(name + deadLetterSuffix)
+	if err == nil && dlqTopic != nil {
+		err = ErrWrongQueueType
+	}
+	if err == nil {
+		err = dlq.putDeadLetter(context.Background(), env)
+	}
+	if err != nil {
+		// Сообщение снова в обработке, и его можно отклонить повторно, как после отказа dest в Move
+		if abortErr := foundQueue.finishTake(env.id, false); abortErr != nil {
+			return fmt.Errorf("%w, message is not returned to [%s]: %w", err, name, abortErr)
+		}
+		return err
+	}
+	// Сообщение уже в .dlq. Если name остановили, то копия в её хранилище вернется после перезапуска
+	if err := foundQueue.finishTake(env.id, true); err != nil {
+		errorLogger.Printf("nack in [%s]: message is not removed after dead letter: %v\n", name, err)
+	}
+	return nil
+}
+
+func (q *shardedQueueManager) GetSub(ctx context.Context, name, sub string, timeout int) (Message, error) {
+	name = q.resolveAlias(name)
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(timeout)*time.Second)
+	defer cancel()
+	foundTopic, err := q.findOrCreateTopic(name)
+	if err != nil {
+		return Message{}, err
+	}
+	message, err := foundTopic.Get(ctx, sub)
+	if err != nil {
+		return Message{}, err
+	}
+	q.config.Hooks.get(name, message.ID)
+	return message, nil
+}
+
+func (q *shardedQueueManager) ResumeSub(name, sub, cursor string) ([]Message, error) {
+	foundTopic, err := q.findOrCreateTopic(q.resolveAlias(name))
+	if err != nil {
+		return nil, err
+	}
+	return foundTopic.Resume(sub, cursor)
+}
+
+func (q *shardedQueueManager) Subscribe(name, sub string, filter MessageFilter) error {
+	foundTopic, err := q.findOrCreateTopic(q.resolveAlias(name))
+	if err != nil {
+		return err
+	}
+	_, err = foundTopic.Subscribe(sub, filter)
+	return err
+}
+
+// findOrCreateTopic ищет топик по имени, создавая его, если имя не занято.
+// Возвращает ErrWrongQueueType, если name - это обычная очередь, и ErrTooManyItems,
+// если срабатывает лимит на количество очередей
+func (q *shardedQueueManager) findOrCreateTopic(name string) (*topic, error) {
+	foundQueue, foundTopic := q.find(name)
+	if foundQueue != nil {
+		return nil, ErrWrongQueueType
+	}
+	if foundTopic == nil {
+		if err := q.ValidateName(name); err != nil {
+			return nil, err
+		}
+		var err error
+		created := false
+		foundTopic, err = func() (*topic, error) {
+			shard := q.shard(name)
+			shard.mutex.Lock()
+			defer shard.mutex.Unlock()
+			// Проверим, вдруг имя заняли между Read Lock и данным Lock
+			if shard.queues[name] != nil {
+				return nil, ErrWrongQueueType
+			}
+			if t := shard.topics[name]; t != nil {
+				return t, nil
+			}
+			// Топики учитываются в лимите на число очередей
+			if !q.reserveQueue() {
+				return nil, ErrTooManyItems
+			}
+			config := q.queueConfig(name)
+			// Подписки топиков хранятся только в памяти
+			config.memoryOnly = true
+			t := newTopic(config, q.config.MaxSubscriptionNumPerTopic, q.config.SubscriptionRetention, q.factory)
+			shard.topics[name] = t
+			created = true
+			return t, nil
+		}()
+		if err != nil {
+			return nil, err
+		}
+		if created {
+			q.config.Hooks.create(name)
+		}
+	}
+	return foundTopic, nil
+}
+
+func (q *shardedQueueManager) Put(ctx context.Context, name, message string) error {
+	return q.putAndNotify(ctx, name, message, false)
+}
+
+func (q *shardedQueueManager) PutBlocking(ctx context.Context, name, message string) error {
+	return q.putAndNotify(ctx, name, message, true)
+}
+
+// putAndNotify помещает сообщение в очередь, а затем вызывает обработчик OnPut и копирует его в привязанные очереди
+func (q *shardedQueueManager) putAndNotify(ctx context.Context, name, message string, block bool) (err error) {
+	name = q.resolveAlias(name)
+	if rule := q.partition(name); rule != nil {
+		// Сообщение в префикс партиций попадает в очередную партицию, обработчики и привязки работают с ней
+		name = rule.nextPut()
+	}
+	// Обработчики и привязки работают с очередью, в которую сообщение попало на самом деле
+	name = q.putTarget(name)
+	ctx, span := startSpan(ctx, q.config.Tracer, "put", name)
+	defer func() { q.endSpan(span, name, err) }()
+	id, err := q.put(ctx, name, message, block)
+	if err != nil {
+		return err
+	}
+	q.config.Hooks.put(name, id)
+	q.fanout(name, message)
+	return nil
+}
+
+func (q *shardedQueueManager) PutAsync(ctx context.Context, name, message string) error {
+	name = q.resolveAlias(name)
+	if rule := q.partition(name); rule != nil {
+		name = rule.nextPut()
+	}
+	name = q.putTarget(name)
+	foundQueue, foundTopic, err := q.findOrCreate(name)
+	if err != nil {
+		return err
+	}
+	// Топик копирует сообщение в подписки по отдельности и не может принять его одним запросом в буфер
+	if foundTopic != nil {
+		return ErrWrongQueueType
+	}
+	if err := foundQueue.PutAsync(ctx, message); err != nil {
+		return err
+	}
+	q.fanout(name, message)
+	return nil
+}
+
+func (q *shardedQueueManager) PutBatch(ctx context.Context, name string, messages []string) error {
+	name = q.putTarget(q.resolveAlias(name))
+	foundQueue, foundTopic, err := q.findOrCreate(name)
+	if err != nil {
+		return err
+	}
+	// Подписки топика пишутся по отдельности, поэтому атомарность для них не гарантируется
+	if foundTopic != nil {
+		return ErrWrongQueueType
+	}
+	ids, err := foundQueue.PutBatch(ctx, messages)
+	if err != nil {
+		return err
+	}
+	for _, id := range ids {
+		q.config.Hooks.put(name, id)
+	}
+	for _, message := range messages {
+		q.fanout(name, message)
+	}
+	return nil
+}
+
+// put кладет сообщение в очередь или топик name без копирования в привязанные очереди
+// и возвращает идентификатор сообщения, для топика он пуст
+func (q *shardedQueueManager) put(ctx context.Context, name, message string, block bool) (string, error) {
+	foundQueue, foundTopic, err := q.findOrCreate(name)
+	if err != nil {
+		return "", err
+	}
+	if foundTopic != nil {
+		if block {
+			return "", foundTopic.PutBlocking(ctx, message)
+		}
+		return "", foundTopic.Put(ctx, message)
+	}
+	if block {
+		// PutBlocking и так ждет, пока освободится место, поэтому предохранитель его не ограничивает
+		return foundQueue.PutBlocking(ctx, message)
+	}
+	breaker := q.circuitBreaker(name)
+	if breaker == nil {
+		return foundQueue.Put(ctx, message)
+	}
+	if !breaker.allow() {
+		return "", ErrTooManyItems
+	}
+	id, err := foundQueue.Put(ctx, message)
+	breaker.done(err)
+	return id, err
+}
+
+// putTarget возвращает имя очереди, в которую на самом деле попадают сообщения для name:
+// для приостановленной очереди это её очередь недоставленных сообщений
+func (q *shardedQueueManager) putTarget(name string) string {
+	if foundQueue := q.findQueue(name); foundQueue != nil && foundQueue.Suspended() {
+		return name + deadLetterSuffix
+	}
+	return name
+}
+
+// circuitBreaker возвращает предохранитель очереди name, создавая его при первом обращении,
+// или nil, если предохранители выключены
+func (q *shardedQueueManager) circuitBreaker(name string) *circuitBreaker {
+	if q.config.CircuitBreakerThreshold <= 0 {
+		return nil
+	}
+	q.breakersMutex.RLock()
+	breaker := q.breakers[name]
+	q.breakersMutex.RUnlock()
+	if breaker != nil {
+		return breaker
+	}
+	q.breakersMutex.Lock()
+	defer q.breakersMutex.Unlock()
+	if breaker = q.breakers[name]; breaker == nil {
+		breaker = newCircuitBreaker(q.config.CircuitBreakerThreshold, q.config.CircuitBreakerCooldown)
+		q.breakers[name] = breaker
+	}
+	return breaker
+}
+
+// findOrCreate ищет по имени очередь или топик, создавая очередь, если не найдено ни того, ни другого.
+// Может вернуть ошибку ErrTooManyItems, если срабатывает лимит на количество очередей,
+// и ошибку фабрики, например, если не удалось открыть файл очереди
+func (q *shardedQueueManager) findOrCreate(name string) (queue, *topic, error) {
+	foundQueue, foundTopic, _, err := q.findOrCreateQueue(name)
+	return foundQueue, foundTopic, err
+}
+
+// findOrCreateQueue работает как findOrCreate и дополнительно сообщает, создана ли очередь этим вызовом
+func (q *shardedQueueManager) findOrCreateQueue(name string) (queue, *topic, bool, error) {
+	foundQueue, foundTopic := q.find(name)
+	if foundQueue != nil || foundTopic != nil {
+		return foundQueue, foundTopic, false, nil
+	}
+	if err := q.ValidateName(name); err != nil {
+		return nil, nil, false, err
+	}
+	created := false
+	foundQueue, foundTopic, err := func() (queue, *topic, error) {
+		shard := q.shard(name)
+		shard.mutex.Lock()
+		defer shard.mutex.Unlock()
+		foundQueue, foundTopic := shard.queues[name], shard.topics[name]
+		// Проверим, вдруг очереди не было в Read Lock, а при входе в данный Lock очередь уже есть
+		if foundQueue != nil || foundTopic != nil {
+			return foundQueue, foundTopic, nil
+		}
+		// Проверяем лимит на число очередей
+		if !q.reserveQueue() {
+			return nil, nil, ErrTooManyItems
+		}
+		foundQueue, err := q.factory(q.queueConfig(name))
+		if err != nil {
+			q.queueNum.Add(-1)
+			return nil, nil, err
+		}
+		shard.queues[name] = foundQueue
+		created = true
+		return foundQueue, nil, nil
+	}()
+	if err != nil {
+		return nil, nil, false, err
+	}
+	// Обработчик вызывается без блокировки шарда, чтобы он мог обращаться к менеджеру
+	if created {
+		q.config.Hooks.create(name)
+	}
+	return foundQueue, foundTopic, created, nil
+}
+
+func (q *shardedQueueManager) EnsureQueue(name string) (bool, error) {
+	_, foundTopic, created, err := q.findOrCreateQueue(name)
+	if err != nil {
+		return false, err
+	}
+	if foundTopic != nil {
+		return false, ErrWrongQueueType
+	}
+	return created, nil
+}
+
+// reserveQueue учитывает новую очередь или топик в лимите на их суммарное число.
+// Возвращает false, если лимит исчерпан
+func (q *shardedQueueManager) reserveQueue() bool {
+	for {
+		num := q.queueNum.Load()
+		if num >= int64(q.config.MaxQueueNum) {
+			return false
+		}
+		if q.queueNum.CompareAndSwap(num, num+1) {
+			return true
+		}
+	}
+}
+
+// fanout асинхронно копирует сообщение в очереди, привязанные к name.
+// Копирование не идет дальше по привязкам целевых очередей, поэтому циклы привязок безопасны
+func (q *shardedQueueManager) fanout(name, message string) {
+	var targets []string
 	func() {
-		q.mutex.RLock()
-		defer q.mutex.RUnlock()
-		foundQueue = q.queues[name]
+		q.bindingsMutex.RLock()
+		defer q.bindingsMutex.RUnlock()
+		targets = q.bindings[name]
+	}()
+	if len(targets) == 0 {
+		return
+	}
+	go func() {
+		for _, target := range targets {
+			target = q.putTarget(target)
+			// Копирование уже не связано с исходным запросом, поэтому его контекст не используется
+			if _, err := q.put(context.Background(), target, message, false); err != nil {
+				errorLogger.Printf("fanout from [%s] to [%s] error: %v\n", name, target, err)
+			}
+		}
+	}()
+}
+
+func (q *shardedQueueManager) Bind(name, target string) {
+	q.bindingsMutex.Lock()
+	defer q.bindingsMutex.Unlock()
+	if slices.Contains(q.bindings[name], target) {
+		return
+	}
+	// Слайс не меняется на месте, так как его могут читать горутины fanout без блокировки
+	q.bindings[name] = append(slices.Clip(q.bindings[name]), target)
+}
+
+func (q *shardedQueueManager) Unbind(name, target string) {
+	q.bindingsMutex.Lock()
+	defer q.bindingsMutex.Unlock()
+	targets := slices.DeleteFunc(slices.Clone(q.bindings[name]), func(v string) bool {
+		return v == target
+	})
+	if len(targets) == 0 {
+		delete(q.bindings, name)
+		return
+	}
+	q.bindings[name] = targets
+}
+
+func (q *shardedQueueManager) AddWebhook(name, url string) error {
+	foundQueue, foundTopic, err := q.findOrCreate(name)
+	if err != nil {
+		return err
+	}
+	if foundTopic != nil {
+		return ErrWrongQueueType
+	}
+	w := &webhook{
+		name:       name,
+		url:        url,
+		source:     foundQueue,
+		maxRetries: q.config.WebhookMaxRetries,
+		retryDelay: q.config.WebhookRetryDelay,
+		client:     q.webhookClient,
+		deadLetter: func(ctx context.Context, message string) error {
+			_, err := q.put(ctx, name+deadLetterSuffix, message, false)
+			return err
+		},
+	}
+	// Для каждого webhook'а запускается своя горутина доставки, которая завершается при Stop
+	q.webhooksWg.Add(1)
+	go func() {
+		defer q.webhooksWg.Done()
+		w.run(q.webhooksCtx)
 	}()
+	return nil
+}
+
+func (q *shardedQueueManager) Pause(name string) error {
+	foundQueue := q.findQueue(name)
+	if foundQueue == nil {
+		return ErrQueueNotFound
+	}
+	foundQueue.Pause()
+	return nil
+}
+
+func (q *shardedQueueManager) Resume(name string) error {
+	foundQueue := q.findQueue(name)
+	if foundQueue == nil {
+		return ErrQueueNotFound
+	}
+	foundQueue.Resume()
+	return nil
+}
+
+func (q *shardedQueueManager) Unsuspend(name string) error {
+	foundQueue := q.findQueue(name)
 	if foundQueue == nil {
-		return "", ErrNoMessage
+		return ErrQueueNotFound
 	}
-	return foundQueue.Get(ctx)
+	foundQueue.Unsuspend()
+	return nil
 }
 
-func (q *queueManagerImpl) Put(name, message string) error {
-	var foundQueue queue
+func (q *shardedQueueManager) Restart(ctx context.Context, name string) error {
+	foundQueue, foundTopic := q.find(name)
+	if foundTopic != nil {
+		return ErrWrongQueueType
+	}
+	if foundQueue == nil {
+		return ErrQueueNotFound
+	}
+	return foundQueue.Restart(ctx)
+}
+
+func (q *shardedQueueManager) Move(ctx context.Context, src, dest string) error {
+	srcQueue, srcTopic := q.find(src)
+	if srcTopic != nil {
+		return ErrWrongQueueType
+	}
+	if srcQueue == nil {
+		return ErrQueueNotFound
+	}
+	// Сообщение попадает туда же, куда его положил бы Put. Возврат из очереди недоставленных сообщений
+	// в приостановленную очередь вернул бы его в ту же очередь недоставленных сообщений
+	if dest = q.putTarget(dest); dest == src {
+		return ErrQueueSuspended
+	}
+	destQueue, destTopic, err := q.findOrCreate(dest)
+	if err != nil {
+		return err
+	}
+	if destTopic != nil {
+		return ErrWrongQueueType
+	}
+	// Диспетчер src не ждет решения о сообщении и продолжает обрабатывать запросы, поэтому взаимной блокировки
+	// с dest или с транзакцией, которая заблокировала dest и ждет src, нет
+	env, err := srcQueue.take()
+	if err != nil {
+		return err
+	}
+	id, err := destQueue.Put(ctx, env.message)
+	if err != nil {
+		if abortErr := srcQueue.finishTake(env.id, false); abortErr != nil {
+			return fmt.Errorf("%w, message is not returned to [%s]: %w", err, src, abortErr)
+		}
+		return err
+	}
+	// Сообщение уже в dest. Если src остановили, то копия в её хранилище вернется после перезапуска,
+	// как и сообщение, извлеченное без подтверждения
+	if err := srcQueue.finishTake(env.id, true); err != nil {
+		errorLogger.Printf("move from [%s] to [%s]: message is not removed from source: %v\n", src, dest, err)
+	}
+	// Для dest перенесенное сообщение - такое же новое, как принятое через Put
+	q.config.Hooks.put(dest, id)
+	q.fanout(dest, env.message)
+	return nil
+}
+
+func (q *shardedQueueManager) Replay(ctx context.Context, name string, limit int) (int, error) {
+	src, ok := strings.CutSuffix(name, deadLetterSuffix)
+	if !ok || src == "" {
+		return 0, fmt.Errorf("%w: [%s] is not a dead letter queue", ErrInvalidQueueName, name)
+	}
+	stats, err := q.Stats(name)
+	if err != nil {
+		return 0, err
+	}
+	if limit <= 0 || int64(limit) > stats.Depth {
+		limit = int(stats.Depth)
+	}
+	// Каждое сообщение переносится отдельно, поэтому при остановке оно остается либо в name, либо в src
+	for replayed := range limit {
+		if err := q.Move(ctx, name, src); err != nil {
+			if errors.Is(err, ErrNoMessage) {
+				// Сообщения успели забрать из name другие читатели
+				err = nil
+			}
+			return replayed, err
+		}
+	}
+	return limit, nil
+}
+
+func (q *shardedQueueManager) Resize(name string, newMax int) error {
+	foundQueue, foundTopic := q.find(name)
+	if foundTopic != nil {
+		return ErrWrongQueueType
+	}
+	if foundQueue == nil {
+		return ErrQueueNotFound
+	}
+	// Новый лимит запоминается как настройка очереди, чтобы Config возвращал действующее значение.
+	// Остальные настройки не меняются, даже если их одновременно меняет SetConfig
+	_, err := q.updateConfig(name, func(config *QueueConfig) {
+		config.MaxMessageNum = newMax
+	})
+	return err
+}
+
+func (q *shardedQueueManager) Delete(name string) error {
+	hadPartitions := q.removePartitions(name)
+	err := func() error {
+		shard := q.shard(name)
+		shard.mutex.Lock()
+		defer shard.mutex.Unlock()
+		foundQueue, foundTopic := shard.queues[name], shard.topics[name]
+		if foundQueue == nil && foundTopic == nil {
+			return ErrQueueNotFound
+		}
+		// Остановленная очередь сразу отвечает на Get и Put ошибками, поэтому вызовы,
+		// которые успели найти её до удаления, не зависнут
+		if foundQueue != nil {
+			// Удаленная очередь не должна восстановиться после перезапуска, поэтому её сообщения удаляются и с диска
+			foundQueue.Destroy()
+			delete(shard.queues, name)
+		}
+		if foundTopic != nil {
+			foundTopic.Stop()
+			delete(shard.topics, name)
+		}
+		q.queueNum.Add(-1)
+		return nil
+	}()
+	if errors.Is(err, ErrQueueNotFound) && hadPartitions {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	func() {
+		q.bindingsMutex.Lock()
+		defer q.bindingsMutex.Unlock()
+		delete(q.bindings, name)
+	}()
+	// Новая очередь с тем же именем начинает с настройками по умолчанию
 	func() {
-		q.mutex.RLock()
-		defer q.mutex.RUnlock()
-		foundQueue = q.queues[name]
+		q.overridesMutex.Lock()
+		defer q.overridesMutex.Unlock()
+		delete(q.overrides, name)
 	}()
+	// Новая очередь с тем же именем начинает с замкнутым предохранителем
+	func() {
+		q.breakersMutex.Lock()
+		defer q.breakersMutex.Unlock()
+		delete(q.breakers, name)
+	}()
+	q.removeAliasesOf(name)
+	q.groups.remove(name)
+	q.config.Hooks.delete(name)
+	return nil
+}
+
+func (q *shardedQueueManager) Purge(name string) (int, error) {
+	foundQueue, foundTopic := q.find(name)
+	if foundTopic != nil {
+		return 0, ErrWrongQueueType
+	}
+	if foundQueue == nil {
+		return 0, ErrQueueNotFound
+	}
+	return foundQueue.Purge(), nil
+}
+
+func (q *shardedQueueManager) Snapshot(name string) ([]string, error) {
+	foundQueue, foundTopic := q.find(name)
+	if foundTopic != nil {
+		return nil, ErrWrongQueueType
+	}
+	if foundQueue == nil {
+		return nil, ErrQueueNotFound
+	}
+	return foundQueue.Snapshot(), nil
+}
+
+func (q *shardedQueueManager) Sample(name string, n int) ([]string, error) {
+	foundQueue, foundTopic := q.find(name)
+	if foundTopic != nil {
+		return nil, ErrWrongQueueType
+	}
+	if foundQueue == nil {
+		return nil, ErrQueueNotFound
+	}
+	return foundQueue.Sample(n), nil
+}
+
+func (q *shardedQueueManager) Stats(name string) (QueueStats, error) {
+	foundQueue, foundTopic := q.find(name)
+	if foundTopic != nil {
+		return QueueStats{}, ErrWrongQueueType
+	}
+	if foundQueue == nil {
+		return QueueStats{}, ErrQueueNotFound
+	}
+	return foundQueue.Stats(), nil
+}
+
+func (q *shardedQueueManager) ConsumerGroups(name string) ([]ConsumerGroupStats, error) {
+	stats, err := q.Stats(name)
+	if err != nil {
+		return nil, err
+	}
+	return q.groups.stats(name, stats.Produced), nil
+}
+
+func (q *shardedQueueManager) MessageWait(name string) (HistogramStats, error) {
+	foundQueue, foundTopic := q.find(name)
+	if foundTopic != nil {
+		return HistogramStats{}, ErrWrongQueueType
+	}
 	if foundQueue == nil {
-		err := func() error {
-			q.mutex.Lock()
-			defer q.mutex.Unlock()
-			foundQueue = q.queues[name]
-			// Проверим, вдруг очереди не было в Read Lock, а при входе в данный Lock очередь уже есть
-			if foundQueue != nil {
-				return nil
+		return HistogramStats{}, ErrQueueNotFound
+	}
+	return foundQueue.MessageWait(), nil
+}
+
+func (q *shardedQueueManager) List() []string {
+	names := make([]string, 0, q.queueNum.Load())
+	for _, shard := range q.shards {
+		func() {
+			shard.mutex.RLock()
+			defer shard.mutex.RUnlock()
+			for name := range shard.queues {
+				names = append(names, name)
 			}
-			// Проверяем лимит на число очередей
-			if len(q.queues) >= q.config.MaxQueueNum {
-				return ErrTooManyItems
+			for name := range shard.topics {
+				names = append(names, name)
 			}
-			foundQueue = q.factory(q.config.MaxMessageNumPerQueue)
-			q.queues[name] = foundQueue
-			return nil
 		}()
-		if err != nil {
-			return err
+	}
+	// Сортируем уже без блокировки
+	slices.Sort(names)
+	return names
+}
+
+func (q *shardedQueueManager) ValidateName(name string) error {
+	return validateQueueName(name, q.config.QueueNamePattern)
+}
+
+func (q *shardedQueueManager) WaitLatency() WaitLatencyStats {
+	return q.waitLatency.snapshot()
+}
+
+// queueConfig возвращает настройки для новой очереди name с учетом переопределенных через SetConfig
+func (q *shardedQueueManager) queueConfig(name string) queueConfig {
+	config := q.effectiveConfig(name)
+	return queueConfig{
+		maxMessageNum:     config.MaxMessageNum,
+		visibilityTimeout: q.config.VisibilityTimeout,
+		budget:            q.budget,
+		maxWaiters:        q.config.MaxWaitersPerQueue,
+		maxMessageBytes:   q.config.MaxMessageBytes,
+		overflowPolicy:    config.OverflowPolicy,
+		ttl:               config.TTL,
+		maxFailures:       config.MaxConsecutiveFailures,
+		maxRetries:        config.MaxRetries,
+		retryDelay:        cmp.Or(q.config.NackRetryDelay, defaultNackRetryDelay),
+		readerWeights:     q.config.ReaderWeights,
+		name:              name,
+		dataDir:           q.config.DataDir,
+		syncMode:          q.config.SyncMode,
+		maxLogBytes:       q.config.MaxLogBytes,
+		waitLatency:       q.waitLatency,
+		tracer:            q.config.Tracer,
+	}
+}
+
+// restore создает очереди с сохраненными сообщениями, имена которых возвращает persisted. Ошибки только логируются,
+// чтобы одна поврежденная очередь не мешала работать остальным
+func (q *shardedQueueManager) restore(persisted func() ([]string, error)) {
+	names, err := persisted()
+	if err != nil {
+		errorLogger.Printf("read persisted queues error: %v\n", err)
+		return
+	}
+	for _, name := range names {
+		if _, _, err := q.findOrCreate(name); err != nil {
+			errorLogger.Printf("restore queue [%s] error: %v\n", name, err)
 		}
 	}
-	return foundQueue.Put(message)
 }
 
-func (q *queueManagerImpl) Stop() {
-	q.mutex.Lock()
-	defer q.mutex.Unlock()
-	for _, v := range q.queues {
-		v.Stop()
+// findQueue ищет очередь по имени под Read Lock, возвращает nil, если очереди нет
+func (q *shardedQueueManager) findQueue(name string) queue {
+	foundQueue, _ := q.find(name)
+	return foundQueue
+}
+
+// find ищет по имени очередь и топик в его шарде, найдено может быть не больше одного из них
+func (q *shardedQueueManager) find(name string) (queue, *topic) {
+	return q.shard(name).find(name)
+}
+
+// shard возвращает шард, в котором хранится очередь или топик name
+func (q *shardedQueueManager) shard(name string) *queueShard {
+	return q.shards[shardIndex(name, len(q.shards))]
+}
+
+func (q *shardedQueueManager) Stop() {
+	// Сначала дожидаемся горутин доставки на webhook'и, так как они могут писать в очереди
+	q.stopWebhooks()
+	q.webhooksWg.Wait()
+	for _, shard := range q.shards {
+		func() {
+			shard.mutex.Lock()
+			defer shard.mutex.Unlock()
+			for _, v := range shard.queues {
+				v.Stop()
+			}
+			for _, v := range shard.topics {
+				v.Stop()
+			}
+		}()
 	}
 }
@@ -4,43 +4,166 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"slices"
 	"strconv"
+	"sync"
 	"testing"
+	"time"
 )
 
 type testQueue struct {
-	items []string
+	items  []string
+	taken  map[string]string // сообщения, извлеченные take, по идентификатору
+	lastID int
 }
 
-func (q *testQueue) Get(_ context.Context) (string, error) {
+func (q *testQueue) Get(_ context.Context) (Message, error) {
 	if len(q.items) == 0 {
-		return "", ErrNoMessage
+		return Message{}, ErrNoMessage
 	}
 	res := q.items[0]
 	q.items = q.items[1:]
-	return res, nil
+	return Message{Body: res}, nil
 }
 
-func (q *testQueue) Put(message string) error {
-	q.items = append(q.items, message)
+func (q *testQueue) GetAck(ctx context.Context) (Message, error) {
+	return q.Get(ctx)
+}
+
+func (q *testQueue) Ack(_ string) error {
 	return nil
 }
 
+func (q *testQueue) Nack(_ string, _ bool) (*envelope, error) {
+	return nil, nil
+}
+
+func (q *testQueue) putDeadLetter(ctx context.Context, env *envelope) error {
+	_, err := q.Put(ctx, env.message)
+	return err
+}
+
+func (q *testQueue) Put(_ context.Context, message string) (string, error) {
+	q.items = append(q.items, message)
+	return "", nil
+}
+
+func (q *testQueue) PutBlocking(ctx context.Context, message string) (string, error) {
+	return q.Put(ctx, message)
+}
+
+func (q *testQueue) PutAsync(ctx context.Context, message string) error {
+	_, err := q.Put(ctx, message)
+	return err
+}
+
+func (q *testQueue) PutBatch(_ context.Context, messages []string) ([]string, error) {
+	q.items = append(q.items, messages...)
+	return make([]string, len(messages)), nil
+}
+
 func (q *testQueue) Len() int {
 	return 0
 }
 
+func (q *testQueue) take() (*envelope, error) {
+	if len(q.items) == 0 {
+		return nil, ErrNoMessage
+	}
+	res := q.items[0]
+	q.items = q.items[1:]
+	if q.taken == nil {
+		q.taken = make(map[string]string)
+	}
+	q.lastID++
+	id := strconv.Itoa(q.lastID)
+	q.taken[id] = res
+	return &envelope{id: id, message: res}, nil
+}
+
+func (q *testQueue) finishTake(id string, commit bool) error {
+	if !commit {
+		q.items = append([]string{q.taken[id]}, q.items...)
+	}
+	delete(q.taken, id)
+	return nil
+}
+
+func (q *testQueue) prepare(messages []string) (preparedPut, error) {
+	return &testPrepared{queue: q, messages: messages}, nil
+}
+
+// testPrepared применяет сообщения транзакции к testQueue только при фиксации
+type testPrepared struct {
+	queue    *testQueue
+	messages []string
+}
+
+func (p *testPrepared) commit() []string {
+	p.queue.items = append(p.queue.items, p.messages...)
+	return make([]string, len(p.messages))
+}
+
+func (p *testPrepared) abort() {
+}
+
+func (q *testQueue) UpdateConfig(_ QueueConfig) error {
+	return nil
+}
+
+func (q *testQueue) Purge() int {
+	n := len(q.items)
+	q.items = nil
+	return n
+}
+
+func (q *testQueue) Snapshot() []string {
+	return append([]string(nil), q.items...)
+}
+
+func (q *testQueue) Sample(n int) []string {
+	return append([]string(nil), q.items[:min(n, len(q.items))]...)
+}
+
+func (q *testQueue) Stats() QueueStats {
+	return QueueStats{Depth: int64(len(q.items))}
+}
+
+func (q *testQueue) MessageWait() HistogramStats {
+	return HistogramStats{}
+}
+
+func (q *testQueue) Pause() {
+}
+
+func (q *testQueue) Resume() {
+}
+
+func (q *testQueue) Restart(ctx context.Context) error {
+	return nil
+}
+
+func (q *testQueue) Suspended() bool {
+	return false
+}
+
+func (q *testQueue) Unsuspend() {
+}
+
 func (q *testQueue) Stop() {
 }
 
+func (q *testQueue) Destroy() {
+}
+
 func TestQueueManagerBasic(t *testing.T) {
 	manager := newQueueManager(
 		QueueManagerConfig{
 			MaxQueueNum:           100,
 			MaxMessageNumPerQueue: 10_000,
 		},
-		func(_ int) queue {
-			return &testQueue{}
+		func(_ queueConfig) (queue, error) {
+			return &testQueue{}, nil
 		},
 	)
 	ctx := context.Background()
@@ -55,10 +178,10 @@ func TestQueueManagerBasic(t *testing.T) {
 				message: fmt.Sprintf("message%d", i),
 			}
 			_, err := manager.Get(ctx, tc.name, 1)
-			if !errors.Is(err, ErrNoMessage) {
-				t.Errorf("wrong error: got [%v] want [%v]", err, ErrNoMessage)
+			if !errors.Is(err, ErrQueueNotFound) {
+				t.Errorf("wrong error: got [%v] want [%v]", err, ErrQueueNotFound)
 			}
-			err = manager.Put(tc.name, tc.message)
+			err = manager.Put(context.Background(), tc.name, tc.message)
 			if err != nil {
 				t.Errorf("unexpected error at Put [%v]", err)
 			}
@@ -66,8 +189,8 @@ func TestQueueManagerBasic(t *testing.T) {
 			if err != nil {
 				t.Errorf("unexpected error at Get [%v]", err)
 			}
-			if message != tc.message {
-				t.Errorf("wrong message: got [%v] want [%v]", message, tc.message)
+			if message.Body != tc.message {
+				t.Errorf("wrong message: got [%v] want [%v]", message.Body, tc.message)
 			}
 		})
 	}
@@ -80,8 +203,8 @@ func TestQueueManagerMaxQueueNum(t *testing.T) {
 			MaxQueueNum:           N,
 			MaxMessageNumPerQueue: 10_000,
 		},
-		func(_ int) queue {
-			return &testQueue{}
+		func(_ queueConfig) (queue, error) {
+			return &testQueue{}, nil
 		},
 	)
 	for i := range N {
@@ -92,13 +215,1105 @@ func TestQueueManagerMaxQueueNum(t *testing.T) {
 			name:    fmt.Sprintf("name%d", i),
 			message: fmt.Sprintf("message%d", i),
 		}
-		err := manager.Put(tc.name, tc.message)
+		err := manager.Put(context.Background(), tc.name, tc.message)
 		if err != nil {
 			t.Errorf("unexpected error at Put [%v]", err)
 		}
 	}
-	err := manager.Put("extra_queue", "")
+	err := manager.Put(context.Background(), "extra_queue", "")
 	if !errors.Is(err, ErrTooManyItems) {
 		t.Errorf("wrong error: got [%v] want [%v]", err, ErrTooManyItems)
 	}
 }
+
+// TestQueueManagerMaxTotalMessages проверяет совместную работу лимитов на число сообщений в очереди и во всех очередях
+func TestQueueManagerMaxTotalMessages(t *testing.T) {
+	manager := newQueueManager(
+		QueueManagerConfig{
+			MaxQueueNum:           10,
+			MaxMessageNumPerQueue: 3,
+			MaxTotalMessages:      5,
+			VisibilityTimeout:     time.Minute,
+		},
+		newMemoryQueue,
+	)
+	defer manager.Stop()
+
+	for range 3 {
+		if err := manager.Put(context.Background(), "first", "message"); err != nil {
+			t.Errorf("unexpected error at Put [%v]", err)
+		}
+	}
+	// Срабатывает лимит очереди
+	if err := manager.Put(context.Background(), "first", "message"); !errors.Is(err, ErrTooManyItems) {
+		t.Errorf("wrong error: got [%v] want [%v]", err, ErrTooManyItems)
+	}
+	for range 2 {
+		if err := manager.Put(context.Background(), "second", "message"); err != nil {
+			t.Errorf("unexpected error at Put [%v]", err)
+		}
+	}
+	// Срабатывает общий лимит, хотя в очереди second есть место
+	if err := manager.Put(context.Background(), "second", "message"); !errors.Is(err, ErrTooManyItems) {
+		t.Errorf("wrong error: got [%v] want [%v]", err, ErrTooManyItems)
+	}
+	// Доставленное сообщение освобождает место
+	if _, err := manager.Get(context.Background(), "first", 1); err != nil {
+		t.Errorf("unexpected error at Get [%v]", err)
+	}
+	if err := manager.Put(context.Background(), "second", "message"); err != nil {
+		t.Errorf("unexpected error at Put [%v]", err)
+	}
+	// Сообщение в обработке занимает место до подтверждения
+	message, err := manager.GetAck(context.Background(), "first", 1)
+	if err != nil {
+		t.Errorf("unexpected error at GetAck [%v]", err)
+	}
+	if err := manager.Put(context.Background(), "third", "message"); !errors.Is(err, ErrTooManyItems) {
+		t.Errorf("wrong error: got [%v] want [%v]", err, ErrTooManyItems)
+	}
+	if err := manager.Ack("first", message.ID); err != nil {
+		t.Errorf("unexpected error at Ack [%v]", err)
+	}
+	if err := manager.Put(context.Background(), "third", "message"); err != nil {
+		t.Errorf("unexpected error at Put [%v]", err)
+	}
+}
+
+// TestQueueManagerMove проверяет перекладывание сообщения и его возврат в исходную очередь,
+// если целевая переполнена
+func TestQueueManagerMove(t *testing.T) {
+	manager := newQueueManager(
+		QueueManagerConfig{
+			MaxQueueNum:                10,
+			MaxMessageNumPerQueue:      2,
+			MaxSubscriptionNumPerTopic: 1,
+		},
+		newMemoryQueue,
+	)
+	defer manager.Stop()
+	ctx := context.Background()
+
+	if err := manager.Move(ctx, "src", "dest"); !errors.Is(err, ErrQueueNotFound) {
+		t.Errorf("wrong error: got [%v] want [%v]", err, ErrQueueNotFound)
+	}
+	for _, put := range []struct{ name, message string }{
+		{"src", "message1"}, {"src", "message2"}, {"dest", "other1"}, {"dest", "other2"},
+	} {
+		if err := manager.Put(ctx, put.name, put.message); err != nil {
+			t.Fatalf("unexpected error at Put [%v]", err)
+		}
+	}
+	// dest переполнена, сообщение возвращается в начало src и не считается доставленным
+	if err := manager.Move(ctx, "src", "dest"); !errors.Is(err, ErrTooManyItems) {
+		t.Errorf("wrong error: got [%v] want [%v]", err, ErrTooManyItems)
+	}
+	if stats, _ := manager.Stats("src"); stats.Depth != 2 || stats.Consumed != 0 {
+		t.Errorf("wrong src stats after failed Move: %+v", stats)
+	}
+	// Освобождаем место в dest и перекладываем оба сообщения src
+	for range 2 {
+		if _, err := manager.Get(ctx, "dest", 1); err != nil {
+			t.Errorf("unexpected error at Get [%v]", err)
+		}
+	}
+	for range 2 {
+		if err := manager.Move(ctx, "src", "dest"); err != nil {
+			t.Errorf("unexpected error at Move [%v]", err)
+		}
+	}
+	if err := manager.Move(ctx, "src", "dest"); !errors.Is(err, ErrNoMessage) {
+		t.Errorf("wrong error: got [%v] want [%v]", err, ErrNoMessage)
+	}
+	if stats, _ := manager.Stats("src"); stats.Consumed != 2 {
+		t.Errorf("wrong src consumed: got %v want 2", stats.Consumed)
+	}
+	// Порядок сообщений после возврата сохраняется
+	for _, expected := range []string{"message1", "message2"} {
+		if message, err := manager.Get(ctx, "dest", 1); err != nil || message.Body != expected {
+			t.Errorf("wrong Get result: got [%v] [%v] want [%v]", message.Body, err, expected)
+		}
+	}
+	if _, err := manager.GetSub(ctx, "topic", "sub", 0); !errors.Is(err, ErrNoMessage) {
+		t.Errorf("wrong error: got [%v] want [%v]", err, ErrNoMessage)
+	}
+	if err := manager.Move(ctx, "topic", "dest"); !errors.Is(err, ErrWrongQueueType) {
+		t.Errorf("wrong error: got [%v] want [%v]", err, ErrWrongQueueType)
+	}
+	if err := manager.Restart(ctx, "topic"); !errors.Is(err, ErrWrongQueueType) {
+		t.Errorf("wrong error: got [%v] want [%v]", err, ErrWrongQueueType)
+	}
+}
+
+// TestQueueManagerReplay проверяет, что сообщения очереди недоставленных сообщений возвращаются в исходную очередь
+// с нулевым числом попыток, а перенос останавливается, когда исходная очередь заполнена
+func TestQueueManagerReplay(t *testing.T) {
+	manager := newShardedQueueManager(
+		QueueManagerConfig{
+			MaxQueueNum:                10,
+			MaxMessageNumPerQueue:      3,
+			MaxSubscriptionNumPerTopic: 1,
+		},
+		newMemoryQueue,
+		defaultShardNum,
+	)
+	defer manager.Stop()
+	ctx := context.Background()
+
+	if _, err := manager.Replay(ctx, "orders.dlq", 0); !errors.Is(err, ErrQueueNotFound) {
+		t.Errorf("wrong error: got [%v] want [%v]", err, ErrQueueNotFound)
+	}
+	for _, name := range []string{"orders", ".dlq"} {
+		if _, err := manager.Replay(ctx, name, 0); !errors.Is(err, ErrInvalidQueueName) {
+			t.Errorf("wrong error for [%s]: got [%v] want [%v]", name, err, ErrInvalidQueueName)
+		}
+	}
+	// Сообщения попадают в .dlq так же, как после исчерпания повторных попыток
+	dlq, _, err := manager.findOrCreate("orders.dlq")
+	if err != nil {
+		t.Fatalf("unexpected error at findOrCreate [%v]", err)
+	}
+	for i := range 3 {
+		env := &envelope{message: fmt.Sprintf("dead%d", i), enqueuedAt: time.Now(), attempts: 5}
+		if err := dlq.putDeadLetter(ctx, env); err != nil {
+			t.Fatalf("unexpected error at putDeadLetter [%v]", err)
+		}
+	}
+	if err := manager.Put(ctx, "orders", "live"); err != nil {
+		t.Fatalf("unexpected error at Put [%v]", err)
+	}
+
+	if n, err := manager.Replay(ctx, "orders.dlq", 1); err != nil || n != 1 {
+		t.Errorf("wrong Replay result: got [%v] [%v] want [1] [nil]", n, err)
+	}
+	// В orders осталось место только для одного сообщения
+	if n, err := manager.Replay(ctx, "orders.dlq", 0); !errors.Is(err, ErrTooManyItems) || n != 1 {
+		t.Errorf("wrong Replay result: got [%v] [%v] want [1] [%v]", n, err, ErrTooManyItems)
+	}
+	for _, expected := range []string{"live", "dead0", "dead1"} {
+		message, err := manager.Get(ctx, "orders", 1)
+		if err != nil || message.Body != expected || message.Attempts != 0 {
+			t.Errorf("wrong Get result: got [%v] [%v] attempts [%v] want [%v]", message.Body, err, message.Attempts, expected)
+		}
+	}
+	// Сообщение, которое не поместилось, осталось в начале .dlq
+	if messages, err := manager.Snapshot("orders.dlq"); err != nil || !slices.Equal(messages, []string{"dead2"}) {
+		t.Errorf("wrong dead letters: got %v [%v] want [dead2]", messages, err)
+	}
+	if n, err := manager.Replay(ctx, "orders.dlq", 10); err != nil || n != 1 {
+		t.Errorf("wrong Replay result: got [%v] [%v] want [1] [nil]", n, err)
+	}
+	if n, err := manager.Replay(ctx, "orders.dlq", 0); err != nil || n != 0 {
+		t.Errorf("wrong Replay of empty queue: got [%v] [%v] want [0] [nil]", n, err)
+	}
+	if message, err := manager.Get(ctx, "orders", 1); err != nil || message.Body != "dead2" {
+		t.Errorf("wrong Get result: got [%v] [%v] want [dead2]", message.Body, err)
+	}
+}
+
+// TestQueueManagerMoveSuspended проверяет, что Move и Replay не кладут сообщения в приостановленную очередь
+func TestQueueManagerMoveSuspended(t *testing.T) {
+	manager := NewQueueManager(QueueManagerConfig{
+		MaxQueueNum:           10,
+		MaxMessageNumPerQueue: 10,
+		VisibilityTimeout:     time.Minute,
+	})
+	defer manager.Stop()
+	ctx := context.Background()
+	if _, err := manager.SetConfig("orders", QueueConfig{MaxConsecutiveFailures: 1}); err != nil {
+		t.Fatalf("Unexpected exception: %v", err)
+	}
+	// Отказ от единственного сообщения приостанавливает orders, и оно остается в ней
+	if err := manager.Put(ctx, "orders", "live"); err != nil {
+		t.Fatalf("Unexpected exception: %v", err)
+	}
+	message, err := manager.GetAck(ctx, "orders", 1)
+	if err != nil {
+		t.Fatalf("Unexpected exception: %v", err)
+	}
+	if err := manager.Nack("orders", message.ID, false); err != nil {
+		t.Fatalf("Unexpected exception: %v", err)
+	}
+	if err := manager.Put(ctx, "src", "moved"); err != nil {
+		t.Fatalf("Unexpected exception: %v", err)
+	}
+
+	// Как и Put, Move в приостановленную очередь кладет сообщение в её очередь недоставленных сообщений
+	if err := manager.Move(ctx, "src", "orders"); err != nil {
+		t.Fatalf("Unexpected exception: %v", err)
+	}
+	if n, err := manager.Replay(ctx, "orders.dlq", 0); !errors.Is(err, ErrQueueSuspended) || n != 0 {
+		t.Errorf("wrong Replay result: got [%v] [%v] want [0] [%v]", n, err, ErrQueueSuspended)
+	}
+	for name, expected := range map[string][]string{"orders": {"live"}, "orders.dlq": {"moved"}, "src": nil} {
+		if messages, err := manager.Snapshot(name); err != nil || !slices.Equal(messages, expected) {
+			t.Errorf("wrong messages in [%s]: got %v [%v] want %v", name, messages, err, expected)
+		}
+	}
+
+	if err := manager.Unsuspend("orders"); err != nil {
+		t.Fatalf("Unexpected exception: %v", err)
+	}
+	if n, err := manager.Replay(ctx, "orders.dlq", 0); err != nil || n != 1 {
+		t.Errorf("wrong Replay result: got [%v] [%v] want [1] [nil]", n, err)
+	}
+	if messages, err := manager.Snapshot("orders"); err != nil || !slices.Equal(messages, []string{"live", "moved"}) {
+		t.Errorf("wrong messages: got %v [%v] want [live moved]", messages, err)
+	}
+}
+
+// TestQueueManagerMoveNotifies проверяет, что Move и Replay, как и Put, вызывают OnPut
+// и копируют сообщение в очереди, привязанные к dest
+func TestQueueManagerMoveNotifies(t *testing.T) {
+	puts := make(chan string, 10)
+	manager := NewQueueManager(QueueManagerConfig{
+		MaxQueueNum:           10,
+		MaxMessageNumPerQueue: 10,
+		Hooks: QueueHooks{
+			OnPut: func(queue, messageID string) {
+				puts <- queue
+			},
+		},
+	})
+	defer manager.Stop()
+	ctx := context.Background()
+	// Копия ждет в заранее созданной очереди, чтобы Get ждал асинхронного копирования
+	if _, err := manager.EnsureQueue("copy"); err != nil {
+		t.Fatalf("Unexpected exception: %v", err)
+	}
+	manager.Bind("dest", "copy")
+	manager.Bind("orders", "copy")
+	for _, name := range []string{"src", "orders.dlq"} {
+		if err := manager.Put(ctx, name, name); err != nil {
+			t.Fatalf("Unexpected exception: %v", err)
+		}
+		if queue := <-puts; queue != name {
+			t.Errorf("wrong OnPut queue: got [%v] want [%v]", queue, name)
+		}
+	}
+
+	if err := manager.Move(ctx, "src", "dest"); err != nil {
+		t.Fatalf("Unexpected exception: %v", err)
+	}
+	if n, err := manager.Replay(ctx, "orders.dlq", 0); err != nil || n != 1 {
+		t.Fatalf("wrong Replay result: got [%v] [%v] want [1] [nil]", n, err)
+	}
+	for _, expected := range []string{"dest", "orders"} {
+		if queue := <-puts; queue != expected {
+			t.Errorf("wrong OnPut queue: got [%v] want [%v]", queue, expected)
+		}
+	}
+	var copies []string
+	for range 2 {
+		message, err := manager.Get(ctx, "copy", 1)
+		if err != nil {
+			t.Fatalf("unexpected error at Get [%v]", err)
+		}
+		copies = append(copies, message.Body)
+	}
+	slices.Sort(copies)
+	if expected := []string{"orders.dlq", "src"}; !slices.Equal(copies, expected) {
+		t.Errorf("wrong copies: got %v want %v", copies, expected)
+	}
+}
+
+// putHookQueue вызывает beforePut перед каждым Put, чтобы тест мог вмешаться в середину Move
+type putHookQueue struct {
+	queue
+	beforePut func()
+}
+
+func (q *putHookQueue) Put(ctx context.Context, message string) (string, error) {
+	if q.beforePut != nil {
+		q.beforePut()
+	}
+	return q.queue.Put(ctx, message)
+}
+
+// TestQueueManagerMoveKeepsMessage проверяет, что src хранит перекладываемое сообщение, пока dest его не примет,
+// а удаление src посреди Move не приводит к молчаливой потере сообщения
+func TestQueueManagerMoveKeepsMessage(t *testing.T) {
+	backend := NewMemoryBackend()
+	factory := newBackendQueueFactory(backend)
+	dest := &putHookQueue{}
+	manager := newShardedQueueManager(
+		QueueManagerConfig{
+			MaxQueueNum:           10,
+			MaxMessageNumPerQueue: 1,
+		},
+		func(config queueConfig) (queue, error) {
+			q, err := factory(config)
+			if err != nil || config.name != "dest" {
+				return q, err
+			}
+			dest.queue = q
+			return dest, nil
+		},
+		defaultShardNum,
+	)
+	defer manager.Stop()
+	ctx := context.Background()
+	stored := func(name string) []string {
+		messages, err := backend.Load(name)
+		if err != nil {
+			t.Fatalf("unexpected error at Load [%v]", err)
+		}
+		bodies := make([]string, len(messages))
+		for i, message := range messages {
+			bodies[i] = message.Body
+		}
+		return bodies
+	}
+
+	// Пока dest принимает сообщение, оно остается в хранилище src
+	if err := manager.Put(ctx, "src", "message1"); err != nil {
+		t.Fatalf("unexpected error at Put [%v]", err)
+	}
+	var storedDuringMove []string
+	dest.beforePut = func() {
+		storedDuringMove = stored("src")
+	}
+	if err := manager.Move(ctx, "src", "dest"); err != nil {
+		t.Fatalf("unexpected error at Move [%v]", err)
+	}
+	if !slices.Equal(storedDuringMove, []string{"message1"}) {
+		t.Errorf("wrong src storage during Move: got %v want [message1]", storedDuringMove)
+	}
+	if messages := stored("src"); len(messages) != 0 {
+		t.Errorf("wrong src storage after Move: got %v want none", messages)
+	}
+
+	// src удаляют, когда dest уже переполнена: вызывающий узнает, что сообщение не вернулось в src
+	if err := manager.Put(ctx, "src", "message2"); err != nil {
+		t.Fatalf("unexpected error at Put [%v]", err)
+	}
+	dest.beforePut = func() {
+		if err := manager.Delete("src"); err != nil {
+			t.Errorf("unexpected error at Delete [%v]", err)
+		}
+	}
+	err := manager.Move(ctx, "src", "dest")
+	if !errors.Is(err, ErrTooManyItems) || !errors.Is(err, ErrShuttingDown) {
+		t.Errorf("wrong error: got [%v] want [%v] and [%v]", err, ErrTooManyItems, ErrShuttingDown)
+	}
+
+	// src удаляют, когда dest может принять сообщение: оно переложено
+	if message, err := manager.Get(ctx, "dest", 1); err != nil || message.Body != "message1" {
+		t.Fatalf("wrong Get result: got [%v] [%v] want [message1]", message.Body, err)
+	}
+	if err := manager.Put(ctx, "src", "message3"); err != nil {
+		t.Fatalf("unexpected error at Put [%v]", err)
+	}
+	if err := manager.Move(ctx, "src", "dest"); err != nil {
+		t.Errorf("unexpected error at Move [%v]", err)
+	}
+	if message, err := manager.Get(ctx, "dest", 1); err != nil || message.Body != "message3" {
+		t.Errorf("wrong Get result: got [%v] [%v] want [message3]", message.Body, err)
+	}
+}
+
+func TestQueueManagerPauseNoQueue(t *testing.T) {
+	manager := newQueueManager(
+		QueueManagerConfig{
+			MaxQueueNum:           100,
+			MaxMessageNumPerQueue: 10_000,
+		},
+		func(_ queueConfig) (queue, error) {
+			return &testQueue{}, nil
+		},
+	)
+	if err := manager.Pause("name"); !errors.Is(err, ErrQueueNotFound) {
+		t.Errorf("wrong error: got [%v] want [%v]", err, ErrQueueNotFound)
+	}
+	if err := manager.Resume("name"); !errors.Is(err, ErrQueueNotFound) {
+		t.Errorf("wrong error: got [%v] want [%v]", err, ErrQueueNotFound)
+	}
+	if err := manager.Restart(context.Background(), "name"); !errors.Is(err, ErrQueueNotFound) {
+		t.Errorf("wrong error: got [%v] want [%v]", err, ErrQueueNotFound)
+	}
+	if err := manager.Ack("name", "1"); !errors.Is(err, ErrQueueNotFound) {
+		t.Errorf("wrong error: got [%v] want [%v]", err, ErrQueueNotFound)
+	}
+	if err := manager.Put(context.Background(), "name", "message"); err != nil {
+		t.Errorf("unexpected error at Put [%v]", err)
+	}
+	if err := manager.Pause("name"); err != nil {
+		t.Errorf("unexpected error at Pause [%v]", err)
+	}
+	if err := manager.Resume("name"); err != nil {
+		t.Errorf("unexpected error at Resume [%v]", err)
+	}
+}
+
+func TestQueueManagerTopic(t *testing.T) {
+	manager := newQueueManager(
+		QueueManagerConfig{
+			MaxQueueNum:                2,
+			MaxMessageNumPerQueue:      10_000,
+			MaxSubscriptionNumPerTopic: 10,
+		},
+		func(_ queueConfig) (queue, error) {
+			return &testQueue{}, nil
+		},
+	)
+	ctx := context.Background()
+	// Первое обращение с подпиской создает топик и подписку
+	if _, err := manager.GetSub(ctx, "topic", "sub", 1); !errors.Is(err, ErrNoMessage) {
+		t.Errorf("wrong error: got [%v] want [%v]", err, ErrNoMessage)
+	}
+	if err := manager.Put(context.Background(), "topic", "message"); err != nil {
+		t.Errorf("unexpected error at Put [%v]", err)
+	}
+	message, err := manager.GetSub(ctx, "topic", "sub", 1)
+	if err != nil {
+		t.Errorf("unexpected error at GetSub [%v]", err)
+	}
+	if message.Body != "message" {
+		t.Errorf("wrong message: got [%v] want [%v]", message.Body, "message")
+	}
+	if _, err := manager.Get(ctx, "topic", 1); !errors.Is(err, ErrWrongQueueType) {
+		t.Errorf("wrong error: got [%v] want [%v]", err, ErrWrongQueueType)
+	}
+	if err := manager.Put(context.Background(), "queue", "message"); err != nil {
+		t.Errorf("unexpected error at Put [%v]", err)
+	}
+	if _, err := manager.GetSub(ctx, "queue", "sub", 1); !errors.Is(err, ErrWrongQueueType) {
+		t.Errorf("wrong error: got [%v] want [%v]", err, ErrWrongQueueType)
+	}
+	if err := manager.Subscribe("queue", "sub", PrefixFilter("orders.")); !errors.Is(err, ErrWrongQueueType) {
+		t.Errorf("wrong error: got [%v] want [%v]", err, ErrWrongQueueType)
+	}
+	// Подписка с фильтром получает только подходящие сообщения
+	if err := manager.Subscribe("topic", "orders", PrefixFilter("orders.")); err != nil {
+		t.Errorf("unexpected error at Subscribe [%v]", err)
+	}
+	for _, body := range []string{"payments.1", "orders.1"} {
+		if err := manager.Put(context.Background(), "topic", body); err != nil {
+			t.Errorf("unexpected error at Put [%v]", err)
+		}
+	}
+	message, err = manager.GetSub(ctx, "topic", "orders", 1)
+	if err != nil {
+		t.Errorf("unexpected error at GetSub [%v]", err)
+	}
+	if message.Body != "orders.1" {
+		t.Errorf("wrong message: got [%v] want [%v]", message.Body, "orders.1")
+	}
+	// Топики и очереди делят общий лимит
+	if _, err := manager.GetSub(ctx, "extra_topic", "sub", 1); !errors.Is(err, ErrTooManyItems) {
+		t.Errorf("wrong error: got [%v] want [%v]", err, ErrTooManyItems)
+	}
+}
+
+func TestQueueManagerFanout(t *testing.T) {
+	manager := newQueueManager(
+		QueueManagerConfig{
+			MaxQueueNum:           100,
+			MaxMessageNumPerQueue: 10_000,
+		},
+		newMemoryQueue,
+	)
+	defer manager.Stop()
+	ctx := context.Background()
+	// Создаем целевые очереди заранее, чтобы Get ждал асинхронного копирования, а не возвращал
+	// ErrQueueNotFound сразу для несуществующей очереди
+	for _, name := range []string{"target1", "target2"} {
+		if err := manager.Put(context.Background(), name, "warmup"); err != nil {
+			t.Errorf("unexpected error at Put [%v]", err)
+		}
+		if _, err := manager.Get(ctx, name, 1); err != nil {
+			t.Errorf("unexpected error at Get [%v]", err)
+		}
+	}
+	manager.Bind("source", "target1")
+	manager.Bind("source", "target2")
+	// Цикл привязок не должен приводить к бесконечному копированию
+	manager.Bind("target1", "source")
+	if err := manager.Put(context.Background(), "source", "message"); err != nil {
+		t.Errorf("unexpected error at Put [%v]", err)
+	}
+	for _, name := range []string{"source", "target1", "target2"} {
+		message, err := manager.Get(ctx, name, 1)
+		if err != nil {
+			t.Errorf("unexpected error at Get from [%s] [%v]", name, err)
+		}
+		if message.Body != "message" {
+			t.Errorf("wrong message in [%s]: got [%v] want [%v]", name, message.Body, "message")
+		}
+	}
+	manager.Unbind("source", "target2")
+	if err := manager.Put(context.Background(), "source", "message"); err != nil {
+		t.Errorf("unexpected error at Put [%v]", err)
+	}
+	if _, err := manager.Get(ctx, "target1", 1); err != nil {
+		t.Errorf("unexpected error at Get [%v]", err)
+	}
+	// Get ждет таймаут, за который асинхронное копирование, которого быть не должно, успело бы пройти
+	if _, err := manager.Get(ctx, "target2", 1); !errors.Is(err, ErrNoMessage) {
+		t.Errorf("wrong error: got [%v] want [%v]", err, ErrNoMessage)
+	}
+}
+
+func TestQueueManagerGetNotFound(t *testing.T) {
+	manager := newQueueManager(
+		QueueManagerConfig{
+			MaxQueueNum:           10,
+			MaxMessageNumPerQueue: 10,
+		},
+		newMemoryQueue,
+	)
+	defer manager.Stop()
+	ctx := context.Background()
+	testCases := []struct {
+		description string
+		name        string
+		err         error
+	}{
+		{
+			description: "Missing queue",
+			name:        "missing",
+			err:         ErrQueueNotFound,
+		},
+		{
+			description: "Empty queue",
+			name:        "empty",
+			err:         ErrNoMessage,
+		},
+	}
+	// Очередь остается после того, как из неё забрали последнее сообщение
+	if err := manager.Put(ctx, "empty", "message"); err != nil {
+		t.Fatalf("unexpected error at Put [%v]", err)
+	}
+	if _, err := manager.Get(ctx, "empty", 1); err != nil {
+		t.Fatalf("unexpected error at Get [%v]", err)
+	}
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			if _, err := manager.Get(ctx, tc.name, 1); !errors.Is(err, tc.err) {
+				t.Errorf("wrong Get error: got [%v] want [%v]", err, tc.err)
+			}
+			if _, err := manager.GetAck(ctx, tc.name, 1); !errors.Is(err, tc.err) {
+				t.Errorf("wrong GetAck error: got [%v] want [%v]", err, tc.err)
+			}
+		})
+	}
+}
+
+// TestQueueManagerEnsureQueue проверяет явное создание очереди: повторный вызов ничего не меняет, а лимит учитывается
+func TestQueueManagerEnsureQueue(t *testing.T) {
+	manager := newQueueManager(
+		QueueManagerConfig{
+			MaxQueueNum:                2,
+			MaxMessageNumPerQueue:      10,
+			MaxSubscriptionNumPerTopic: 1,
+		},
+		newMemoryQueue,
+	)
+	defer manager.Stop()
+	if err := manager.Subscribe("topic", "sub", nil); err != nil {
+		t.Fatalf("unexpected error at Subscribe [%v]", err)
+	}
+	// Шаги выполняются по порядку: каждый опирается на очереди, созданные предыдущими
+	testCases := []struct {
+		description string
+		name        string
+		created     bool
+		err         error
+	}{
+		{
+			description: "Create",
+			name:        "name1",
+			created:     true,
+		},
+		{
+			description: "Repeat",
+			name:        "name1",
+		},
+		{
+			description: "Topic",
+			name:        "topic",
+			err:         ErrWrongQueueType,
+		},
+		{
+			description: "Limit",
+			name:        "name2",
+			err:         ErrTooManyItems,
+		},
+	}
+	for _, tc := range testCases {
+		created, err := manager.EnsureQueue(tc.name)
+		if !errors.Is(err, tc.err) {
+			t.Errorf("%s: wrong error: got [%v] want [%v]", tc.description, err, tc.err)
+		}
+		if created != tc.created {
+			t.Errorf("%s: wrong created: got %v want %v", tc.description, created, tc.created)
+		}
+	}
+	// Созданная очередь пуста, и Get ждет в ней сообщения, а не получает ErrQueueNotFound
+	if _, err := manager.Get(context.Background(), "name1", 1); !errors.Is(err, ErrNoMessage) {
+		t.Errorf("wrong Get error: got [%v] want [%v]", err, ErrNoMessage)
+	}
+	if stats, err := manager.Stats("name1"); err != nil || stats.Depth != 0 {
+		t.Errorf("wrong Stats: got %+v, [%v] want empty queue", stats, err)
+	}
+}
+
+func TestQueueManagerDelete(t *testing.T) {
+	manager := newQueueManager(
+		QueueManagerConfig{
+			MaxQueueNum:           1,
+			MaxMessageNumPerQueue: 10_000,
+		},
+		func(_ queueConfig) (queue, error) {
+			return &testQueue{}, nil
+		},
+	)
+	if err := manager.Delete("name"); !errors.Is(err, ErrQueueNotFound) {
+		t.Errorf("wrong error: got [%v] want [%v]", err, ErrQueueNotFound)
+	}
+	if err := manager.Put(context.Background(), "name", "message"); err != nil {
+		t.Errorf("unexpected error at Put [%v]", err)
+	}
+	if err := manager.Delete("name"); err != nil {
+		t.Errorf("unexpected error at Delete [%v]", err)
+	}
+	// Вместе с очередью удаляются и её сообщения
+	if _, err := manager.Get(context.Background(), "name", 1); !errors.Is(err, ErrQueueNotFound) {
+		t.Errorf("wrong error: got [%v] want [%v]", err, ErrQueueNotFound)
+	}
+	// Удаленная очередь освобождает место в лимите на число очередей
+	if err := manager.Put(context.Background(), "other_name", "message"); err != nil {
+		t.Errorf("unexpected error at Put [%v]", err)
+	}
+}
+
+// TestQueueManagerDeleteRace проверяет, что Delete безопасно вызывать параллельно с Get и Put.
+// Тест имеет смысл запускать с -race
+func TestQueueManagerDeleteRace(t *testing.T) {
+	const N = 100
+	manager := newQueueManager(
+		QueueManagerConfig{
+			MaxQueueNum:           100,
+			MaxMessageNumPerQueue: 10_000,
+		},
+		newMemoryQueue,
+	)
+	defer manager.Stop()
+	var wg sync.WaitGroup
+	wg.Add(3)
+	go func() {
+		defer wg.Done()
+		for range N {
+			// Очередь может быть удалена в любой момент, поэтому ошибки ожидаемы
+			_ = manager.Put(context.Background(), "name", "message")
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for range N {
+			// Короткий таймаут, чтобы пустая очередь не задерживала тест
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+			_, _ = manager.Get(ctx, "name", 1)
+			cancel()
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for range N {
+			_ = manager.Delete("name")
+		}
+	}()
+	// Все вызовы должны завершиться, даже если очередь удалили во время ожидания в Get
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(10 * time.Second):
+		t.Fatalf("Put, Get and Delete did not finish")
+	}
+}
+
+func TestQueueManagerList(t *testing.T) {
+	manager := newQueueManager(
+		QueueManagerConfig{
+			MaxQueueNum:                100,
+			MaxMessageNumPerQueue:      10_000,
+			MaxSubscriptionNumPerTopic: 10,
+		},
+		func(_ queueConfig) (queue, error) {
+			return &testQueue{}, nil
+		},
+	)
+	if names := manager.List(); len(names) != 0 {
+		t.Errorf("wrong list: got %v want empty", names)
+	}
+	for _, name := range []string{"name3", "name1", "name2"} {
+		if err := manager.Put(context.Background(), name, "message"); err != nil {
+			t.Errorf("unexpected error at Put [%v]", err)
+		}
+	}
+	if _, err := manager.GetSub(context.Background(), "topic", "sub", 1); !errors.Is(err, ErrNoMessage) {
+		t.Errorf("wrong error: got [%v] want [%v]", err, ErrNoMessage)
+	}
+	expected := []string{"name1", "name2", "name3", "topic"}
+	if names := manager.List(); !slices.Equal(names, expected) {
+		t.Errorf("wrong list: got %v want %v", names, expected)
+	}
+	if err := manager.Delete("name2"); err != nil {
+		t.Errorf("unexpected error at Delete [%v]", err)
+	}
+	expected = []string{"name1", "name3", "topic"}
+	if names := manager.List(); !slices.Equal(names, expected) {
+		t.Errorf("wrong list: got %v want %v", names, expected)
+	}
+}
+
+func TestQueueManagerStats(t *testing.T) {
+	manager := newQueueManager(
+		QueueManagerConfig{
+			MaxQueueNum:                100,
+			MaxMessageNumPerQueue:      10_000,
+			MaxSubscriptionNumPerTopic: 10,
+		},
+		func(_ queueConfig) (queue, error) {
+			return &testQueue{}, nil
+		},
+	)
+	if _, err := manager.Stats("name"); !errors.Is(err, ErrQueueNotFound) {
+		t.Errorf("wrong error: got [%v] want [%v]", err, ErrQueueNotFound)
+	}
+	for range 2 {
+		if err := manager.Put(context.Background(), "name", "message"); err != nil {
+			t.Errorf("unexpected error at Put [%v]", err)
+		}
+	}
+	stats, err := manager.Stats("name")
+	if err != nil {
+		t.Errorf("unexpected error at Stats [%v]", err)
+	}
+	if stats.Depth != 2 {
+		t.Errorf("wrong depth: got %v want %v", stats.Depth, 2)
+	}
+	if _, err := manager.GetSub(context.Background(), "topic", "sub", 1); !errors.Is(err, ErrNoMessage) {
+		t.Errorf("wrong error: got [%v] want [%v]", err, ErrNoMessage)
+	}
+	if _, err := manager.Stats("topic"); !errors.Is(err, ErrWrongQueueType) {
+		t.Errorf("wrong error: got [%v] want [%v]", err, ErrWrongQueueType)
+	}
+}
+
+func TestQueueManagerHooks(t *testing.T) {
+	// Буфер с запасом, чтобы обработчики не блокировали операции менеджера
+	events := make(chan string, 100)
+	manager := NewQueueManager(QueueManagerConfig{
+		MaxQueueNum:                10,
+		MaxMessageNumPerQueue:      10,
+		MaxSubscriptionNumPerTopic: 10,
+		VisibilityTimeout:          time.Minute,
+		Hooks: QueueHooks{
+			OnPut: func(queue, messageID string) {
+				events <- "put " + queue + " " + messageID
+			},
+			OnGet: func(queue, messageID string) {
+				events <- "get " + queue + " " + messageID
+			},
+			OnCreate: func(queue string) {
+				events <- "create " + queue
+			},
+			OnDelete: func(queue string) {
+				events <- "delete " + queue
+			},
+		},
+	})
+	defer manager.Stop()
+
+	if err := manager.Put(context.Background(), "name", "message1"); err != nil {
+		t.Fatalf("unexpected error at Put [%v]", err)
+	}
+	if err := manager.PutBatch(context.Background(), "name", []string{"message2", "message3"}); err != nil {
+		t.Fatalf("unexpected error at PutBatch [%v]", err)
+	}
+	if _, err := manager.Get(context.Background(), "name", 1); err != nil {
+		t.Fatalf("unexpected error at Get [%v]", err)
+	}
+	if _, err := manager.GetAck(context.Background(), "name", 1); err != nil {
+		t.Fatalf("unexpected error at GetAck [%v]", err)
+	}
+	// Неудачные операции событий не вызывают
+	if _, err := manager.Get(context.Background(), "other", 1); !errors.Is(err, ErrQueueNotFound) {
+		t.Errorf("wrong error: got [%v] want [%v]", err, ErrQueueNotFound)
+	}
+	if err := manager.Delete("other"); !errors.Is(err, ErrQueueNotFound) {
+		t.Errorf("wrong error: got [%v] want [%v]", err, ErrQueueNotFound)
+	}
+	if _, err := manager.GetSub(context.Background(), "topic", "sub", 1); !errors.Is(err, ErrNoMessage) {
+		t.Errorf("wrong error: got [%v] want [%v]", err, ErrNoMessage)
+	}
+	if err := manager.Delete("name"); err != nil {
+		t.Fatalf("unexpected error at Delete [%v]", err)
+	}
+
+	expected := []string{
+		"create name",
+		"put name 1",
+		"put name 2",
+		"put name 3",
+		"get name 1",
+		"get name 2",
+		"create topic",
+		"delete name",
+	}
+	// Обработчики вызываются синхронно, поэтому все события уже в канале
+	close(events)
+	var got []string
+	for event := range events {
+		got = append(got, event)
+	}
+	if !slices.Equal(got, expected) {
+		t.Errorf("wrong events: got %v want %v", got, expected)
+	}
+}
+
+// BenchmarkQueueManagerShards сравнивает менеджер с одной блокировкой и с шардами,
+// когда 16 горутин одновременно работают каждая со своей очередью
+func BenchmarkQueueManagerShards(b *testing.B) {
+	const G = 16
+	for _, shardNum := range []int{1, defaultShardNum} {
+		b.Run(fmt.Sprintf("shards=%d", shardNum), func(b *testing.B) {
+			manager := newShardedQueueManager(
+				QueueManagerConfig{MaxQueueNum: G},
+				func(_ queueConfig) (queue, error) {
+					return &testQueue{}, nil
+				},
+				shardNum,
+			)
+			defer manager.Stop()
+			var wg sync.WaitGroup
+			b.ResetTimer()
+			for g := range G {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					name := fmt.Sprintf("name%d", g)
+					for range b.N / G {
+						_ = manager.Put(context.Background(), name, "message")
+						_, _ = manager.Stats(name)
+					}
+				}()
+			}
+			wg.Wait()
+		})
+	}
+}
+
+// TestQueueManagerNackDeadLetterFull проверяет, что сообщение, которое не приняла переполненная очередь
+// недоставленных сообщений, остается в обработке и его можно отклонить повторно
+func TestQueueManagerNackDeadLetterFull(t *testing.T) {
+	manager := NewQueueManager(QueueManagerConfig{
+		MaxQueueNum:           10,
+		MaxMessageNumPerQueue: 1,
+		VisibilityTimeout:     time.Minute,
+		NackRetryDelay:        time.Millisecond,
+	})
+	defer manager.Stop()
+	ctx := context.Background()
+	if _, err := manager.SetConfig("name", QueueConfig{MaxRetries: 1}); err != nil {
+		t.Fatalf("Unexpected exception: %v", err)
+	}
+	for _, name := range []string{"name", "name" + deadLetterSuffix} {
+		if err := manager.Put(ctx, name, name); err != nil {
+			t.Fatalf("Unexpected exception: %v", err)
+		}
+	}
+	message, err := manager.GetAck(ctx, "name", 1)
+	if err != nil {
+		t.Fatalf("Unexpected exception: %v", err)
+	}
+	if err := manager.Nack("name", message.ID, true); err != nil {
+		t.Fatalf("Unexpected exception: %v", err)
+	}
+	if message, err = manager.GetAck(ctx, "name", 1); err != nil {
+		t.Fatalf("Unexpected exception: %v", err)
+	}
+
+	if err := manager.Nack("name", message.ID, true); !errors.Is(err, ErrTooManyItems) {
+		t.Fatalf("wrong error: got [%v] want [%v]", err, ErrTooManyItems)
+	}
+	if stats, err := manager.Stats("name"); err != nil || stats.InFlight != 1 || stats.Depth != 0 {
+		t.Errorf("wrong stats after failed dead letter: %+v, %v", stats, err)
+	}
+	// Место в .dlq освободилось, и повторный отказ переносит сообщение
+	if _, err := manager.Get(ctx, "name"+deadLetterSuffix, 1); err != nil {
+		t.Fatalf("Unexpected exception: %v", err)
+	}
+	if err := manager.Nack("name", message.ID, true); err != nil {
+		t.Fatalf("Unexpected exception: %v", err)
+	}
+	if stats, err := manager.Stats("name"); err != nil || stats.InFlight != 0 || stats.Depth != 0 || stats.Consumed != 2 {
+		t.Errorf("wrong stats after dead letter: %+v, %v", stats, err)
+	}
+	if messages, err := manager.Snapshot("name" + deadLetterSuffix); err != nil || !slices.Equal(messages, []string{"name"}) {
+		t.Errorf("wrong dead letter messages: got %v, %v", messages, err)
+	}
+}
+
+// TestQueueManagerSuspend проверяет, что сообщения в приостановленную очередь уходят в очередь недоставленных
+// сообщений, а Unsuspend возвращает очередь к обычной работе
+func TestQueueManagerSuspend(t *testing.T) {
+	const visibilityTimeout = 50 * time.Millisecond
+	manager := NewQueueManager(QueueManagerConfig{
+		MaxQueueNum:           10,
+		MaxMessageNumPerQueue: 10,
+		VisibilityTimeout:     visibilityTimeout,
+	})
+	defer manager.Stop()
+	ctx := context.Background()
+	if err := manager.Unsuspend("name"); !errors.Is(err, ErrQueueNotFound) {
+		t.Errorf("wrong error: got [%v] want [%v]", err, ErrQueueNotFound)
+	}
+	if _, err := manager.SetConfig("name", QueueConfig{MaxConsecutiveFailures: 1}); err != nil {
+		t.Fatalf("Unexpected exception: %v", err)
+	}
+	if err := manager.Put(ctx, "name", "message1"); err != nil {
+		t.Fatalf("Unexpected exception: %v", err)
+	}
+	if _, err := manager.GetAck(ctx, "name", 1); err != nil {
+		t.Fatalf("Unexpected exception: %v", err)
+	}
+	time.Sleep(2 * visibilityTimeout)
+
+	if _, err := manager.Get(ctx, "name", 1); !errors.Is(err, ErrQueueSuspended) {
+		t.Errorf("wrong error: got [%v] want [%v]", err, ErrQueueSuspended)
+	}
+	if err := manager.Put(ctx, "name", "message2"); err != nil {
+		t.Fatalf("Unexpected exception: %v", err)
+	}
+	if err := manager.PutBatch(ctx, "name", []string{"message3"}); err != nil {
+		t.Fatalf("Unexpected exception: %v", err)
+	}
+	messages, err := manager.Snapshot("name" + deadLetterSuffix)
+	if err != nil {
+		t.Fatalf("Unexpected exception: %v", err)
+	}
+	if expected := []string{"message2", "message3"}; !slices.Equal(messages, expected) {
+		t.Errorf("wrong dead letter messages: got %v want %v", messages, expected)
+	}
+
+	if err := manager.Unsuspend("name"); err != nil {
+		t.Fatalf("Unexpected exception: %v", err)
+	}
+	if err := manager.Put(ctx, "name", "message4"); err != nil {
+		t.Fatalf("Unexpected exception: %v", err)
+	}
+	for _, expected := range []string{"message1", "message4"} {
+		message, err := manager.Get(ctx, "name", 1)
+		if err != nil {
+			t.Fatalf("Unexpected exception: %v", err)
+		}
+		if message.Body != expected {
+			t.Errorf("wrong message: got [%v] want [%v]", message.Body, expected)
+		}
+	}
+}
+
+// TestQueueManagerConsumerGroups проверяет учет участников и отставания групп потребителей
+func TestQueueManagerConsumerGroups(t *testing.T) {
+	manager := NewQueueManager(QueueManagerConfig{
+		MaxQueueNum:           10,
+		MaxMessageNumPerQueue: 10,
+		VisibilityTimeout:     time.Minute,
+	})
+	defer manager.Stop()
+	ctx := context.Background()
+	if _, err := manager.ConsumerGroups("name"); !errors.Is(err, ErrQueueNotFound) {
+		t.Errorf("wrong error: got [%v] want [%v]", err, ErrQueueNotFound)
+	}
+	for i := range 3 {
+		if err := manager.Put(ctx, "name", fmt.Sprintf("message%d", i)); err != nil {
+			t.Fatalf("Unexpected exception: %v", err)
+		}
+	}
+	if _, err := manager.Get(WithConsumerGroup(ctx, "workers"), "name", 1); err != nil {
+		t.Fatalf("Unexpected exception: %v", err)
+	}
+	if _, err := manager.GetAck(WithConsumerGroup(ctx, "workers"), "name", 1); err != nil {
+		t.Fatalf("Unexpected exception: %v", err)
+	}
+	if _, err := manager.Get(WithConsumerGroup(ctx, "audit"), "name", 1); err != nil {
+		t.Fatalf("Unexpected exception: %v", err)
+	}
+	// Get без группы в статистику групп не попадает
+	if _, err := manager.Get(ctx, "name", 1); !errors.Is(err, ErrNoMessage) {
+		t.Errorf("wrong error: got [%v] want [%v]", err, ErrNoMessage)
+	}
+
+	// Ожидающий Get участвует в группе, пока его контекст не завершен
+	waitCtx, cancel := context.WithCancel(WithConsumerGroup(ctx, "workers"))
+	errCh := make(chan error, 1)
+	go func() {
+		_, err := manager.Get(waitCtx, "name", 10)
+		errCh <- err
+	}()
+	time.Sleep(50 * time.Millisecond)
+	groups, err := manager.ConsumerGroups("name")
+	if err != nil {
+		t.Fatalf("Unexpected exception: %v", err)
+	}
+	expected := []ConsumerGroupStats{
+		{Name: "audit", Consumed: 1, Lag: 2},
+		{Name: "workers", Members: 1, Consumed: 2, Lag: 1},
+	}
+	if !slices.Equal(groups, expected) {
+		t.Errorf("wrong consumer groups: got %+v want %+v", groups, expected)
+	}
+	cancel()
+	if err := <-errCh; !errors.Is(err, ErrCanceled) {
+		t.Errorf("wrong error: got [%v] want [%v]", err, ErrCanceled)
+	}
+	groups, _ = manager.ConsumerGroups("name")
+	expected[1].Members = 0
+	if !slices.Equal(groups, expected) {
+		t.Errorf("wrong consumer groups after leave: got %+v want %+v", groups, expected)
+	}
+
+	// Группы удаленной очереди забываются
+	if err := manager.Delete("name"); err != nil {
+		t.Fatalf("Unexpected exception: %v", err)
+	}
+	if err := manager.Put(ctx, "name", "message"); err != nil {
+		t.Fatalf("Unexpected exception: %v", err)
+	}
+	if groups, _ := manager.ConsumerGroups("name"); len(groups) != 0 {
+		t.Errorf("groups of deleted queue are kept: %+v", groups)
+	}
+}
+
+func TestQueueManagerPutAsync(t *testing.T) {
+	manager := newQueueManager(
+		QueueManagerConfig{
+			MaxQueueNum:                10,
+			MaxMessageNumPerQueue:      10,
+			MaxSubscriptionNumPerTopic: 1,
+		},
+		newMemoryQueue,
+	)
+	defer manager.Stop()
+	ctx := context.Background()
+
+	if err := manager.PutAsync(ctx, "name", "message"); err != nil {
+		t.Fatalf("unexpected error at PutAsync [%v]", err)
+	}
+	// Get дожидается сообщения, даже если очередь еще не разобрала буфер
+	if message, err := manager.Get(ctx, "name", 1); err != nil || message.Body != "message" {
+		t.Errorf("wrong Get: got [%v], [%v] want [message]", message.Body, err)
+	}
+	if err := manager.Subscribe("topic", "sub", nil); err != nil {
+		t.Fatalf("unexpected error at Subscribe [%v]", err)
+	}
+	if err := manager.PutAsync(ctx, "topic", "message"); !errors.Is(err, ErrWrongQueueType) {
+		t.Errorf("wrong error: got [%v] want [%v]", err, ErrWrongQueueType)
+	}
+}
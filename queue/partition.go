@@ -0,0 +1,124 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+// partitionPollInterval задает, сколько Get ждет сообщения в одной партиции, прежде чем проверить остальные
+const partitionPollInterval = 100 * time.Millisecond
+
+// partitionRule задает маршрутизацию имени префикса в партиции {prefix}-0 ... {prefix}-{n-1}
+type partitionRule struct {
+	names   []string      // имена партиций по порядку
+	putNext atomic.Uint64 // счетчик round-robin для Put
+	getNext atomic.Uint64 // счетчик round-robin для Get
+}
+
+// partitionName возвращает имя i-й партиции префикса
+func partitionName(prefix string, i int) string {
+	return prefix + "-" + strconv.Itoa(i)
+}
+
+// nextPut возвращает партицию для очередного Put
+func (r *partitionRule) nextPut() string {
+	return r.names[(r.putNext.Add(1)-1)%uint64(len(r.names))]
+}
+
+// nextGet возвращает номер партиции, с которой начинает поиск очередной Get
+func (r *partitionRule) nextGet() int {
+	return int((r.getNext.Add(1) - 1) % uint64(len(r.names)))
+}
+
+func (q *shardedQueueManager) CreatePartitioned(prefix string, n int) error {
+	if n <= 0 {
+		return fmt.Errorf("%w: %d", ErrInvalidPartitionNum, n)
+	}
+	if err := q.ValidateName(prefix); err != nil {
+		return err
+	}
+	// Иначе Put в префикс было бы неясно, писать в саму очередь или в партиции
+	if foundQueue, foundTopic := q.find(prefix); foundQueue != nil || foundTopic != nil {
+		return ErrWrongQueueType
+	}
+	rule := &partitionRule{names: make([]string, n)}
+	for i := range n {
+		rule.names[i] = partitionName(prefix, i)
+		// Существующие очереди с такими именами становятся партициями вместе с сообщениями
+		_, foundTopic, err := q.findOrCreate(rule.names[i])
+		if err != nil {
+			return err
+		}
+		if foundTopic != nil {
+			return ErrWrongQueueType
+		}
+	}
+	q.partitionsMutex.Lock()
+	defer q.partitionsMutex.Unlock()
+	// Повторный вызов заменяет правило, уже созданные партиции сверх нового n остаются обычными очередями
+	q.partitions[prefix] = rule
+	return nil
+}
+
+// partition возвращает правило маршрутизации префикса, nil - если name не префикс партиций
+func (q *shardedQueueManager) partition(name string) *partitionRule {
+	q.partitionsMutex.RLock()
+	defer q.partitionsMutex.RUnlock()
+	return q.partitions[name]
+}
+
+// removePartitions удаляет правило маршрутизации префикса name и сообщает, было ли оно.
+// После этого Put и Get с именем name снова работают с обычной очередью
+func (q *shardedQueueManager) removePartitions(name string) bool {
+	q.partitionsMutex.Lock()
+	defer q.partitionsMutex.Unlock()
+	_, ok := q.partitions[name]
+	delete(q.partitions, name)
+	return ok
+}
+
+// getPartitioned извлекает сообщение из партиций, начиная с очередной по round-robin. Сначала выбирается
+// первая непустая партиция, а если все пусты, то Get ждет в очередной партиции не дольше partitionPollInterval
+// и снова проверяет все. Поэтому сообщение, пришедшее в другую партицию, ждет читателя не дольше этого интервала
+func (q *shardedQueueManager) getPartitioned(ctx context.Context, rule *partitionRule) (Message, error) {
+	for {
+		start := rule.nextGet()
+		var name string
+		var target queue
+		for i := range rule.names {
+			candidate := rule.names[(start+i)%len(rule.names)]
+			foundQueue := q.findQueue(candidate)
+			if foundQueue == nil {
+				// Партицию удалили через Delete, пропускаем её
+				continue
+			}
+			if target == nil {
+				// Если все партиции пусты, то ждем в первой существующей
+				name, target = candidate, foundQueue
+			}
+			if foundQueue.Stats().Depth > 0 {
+				name, target = candidate, foundQueue
+				break
+			}
+		}
+		if target == nil {
+			return Message{}, ErrQueueNotFound
+		}
+		pollCtx, cancel := context.WithTimeout(ctx, partitionPollInterval)
+		message, err := target.Get(pollCtx)
+		cancel()
+		if err == nil {
+			q.config.Hooks.get(name, message.ID)
+			return message, nil
+		}
+		// Истек только интервал ожидания партиции, а не Get целиком
+		if errors.Is(err, ErrNoMessage) && ctx.Err() == nil {
+			continue
+		}
+		return Message{}, err
+	}
+}
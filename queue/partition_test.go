@@ -0,0 +1,204 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"testing"
+	"time"
+)
+
+func newPartitionTestManager() QueueManager {
+	return NewQueueManager(QueueManagerConfig{
+		MaxQueueNum:                10,
+		MaxMessageNumPerQueue:      10,
+		MaxSubscriptionNumPerTopic: 10,
+	})
+}
+
+func TestCreatePartitioned(t *testing.T) {
+	testCases := []struct {
+		description string
+		prepare     func(manager QueueManager)
+		prefix      string
+		n           int
+		err         error
+	}{
+		{
+			description: "OK",
+			prefix:      "jobs",
+			n:           3,
+		},
+		{
+			description: "Existing partition keeps messages",
+			prepare: func(manager QueueManager) {
+				manager.Put(context.Background(), "jobs-1", "message")
+			},
+			prefix: "jobs",
+			n:      3,
+		},
+		{
+			description: "Zero partitions",
+			prefix:      "jobs",
+			n:           0,
+			err:         ErrInvalidPartitionNum,
+		},
+		{
+			description: "Prefix is a queue",
+			prepare: func(manager QueueManager) {
+				manager.Put(context.Background(), "jobs", "message")
+			},
+			prefix: "jobs",
+			n:      3,
+			err:    ErrWrongQueueType,
+		},
+		{
+			description: "Partition is a topic",
+			prepare: func(manager QueueManager) {
+				ctx, cancel := context.WithCancel(context.Background())
+				cancel()
+				manager.GetSub(ctx, "jobs-2", "sub", 1)
+			},
+			prefix: "jobs",
+			n:      3,
+			err:    ErrWrongQueueType,
+		},
+		{
+			description: "Invalid prefix",
+			prefix:      "jobs/1",
+			n:           3,
+			err:         ErrInvalidQueueName,
+		},
+		{
+			description: "Too many queues",
+			prefix:      "jobs",
+			n:           11,
+			err:         ErrTooManyItems,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			manager := newPartitionTestManager()
+			defer manager.Stop()
+			if tc.prepare != nil {
+				tc.prepare(manager)
+			}
+			err := manager.CreatePartitioned(tc.prefix, tc.n)
+			if !errors.Is(err, tc.err) {
+				t.Fatalf("wrong error: got [%v] want [%v]", err, tc.err)
+			}
+			if tc.err != nil {
+				return
+			}
+			expected := []string{"jobs-0", "jobs-1", "jobs-2"}
+			if names := manager.List(); !slices.Equal(names, expected) {
+				t.Errorf("wrong queues: got %v want %v", names, expected)
+			}
+		})
+	}
+}
+
+func TestPartitionedPutGet(t *testing.T) {
+	const N = 3
+	manager := newPartitionTestManager()
+	defer manager.Stop()
+	if err := manager.CreatePartitioned("jobs", N); err != nil {
+		t.Fatalf("Unexpected exception: %v", err)
+	}
+	for i := range 2 * N {
+		if err := manager.Put(context.Background(), "jobs", fmt.Sprintf("message%d", i)); err != nil {
+			t.Fatalf("Unexpected exception: %v", err)
+		}
+	}
+	// Round-robin раскладывает сообщения по партициям поровну и по порядку
+	for i := range N {
+		name := partitionName("jobs", i)
+		stats, err := manager.Stats(name)
+		if err != nil {
+			t.Fatalf("Unexpected exception: %v", err)
+		}
+		if stats.Depth != 2 {
+			t.Errorf("wrong %s depth: got %v want %v", name, stats.Depth, 2)
+		}
+	}
+	var received []string
+	for range 2 * N {
+		message, err := manager.Get(context.Background(), "jobs", 1)
+		if err != nil {
+			t.Fatalf("Unexpected exception: %v", err)
+		}
+		received = append(received, message.Body)
+	}
+	// Get тоже обходит партиции по очереди, поэтому сообщения приходят в порядке записи
+	for i, message := range received {
+		if expected := fmt.Sprintf("message%d", i); message != expected {
+			t.Errorf("wrong message: got [%s] want [%s]", message, expected)
+		}
+	}
+	if _, err := manager.Get(context.Background(), "jobs", 1); !errors.Is(err, ErrNoMessage) {
+		t.Errorf("wrong error: got [%v] want [%v]", err, ErrNoMessage)
+	}
+}
+
+func TestPartitionedGetWaits(t *testing.T) {
+	manager := newPartitionTestManager()
+	defer manager.Stop()
+	if err := manager.CreatePartitioned("jobs", 3); err != nil {
+		t.Fatalf("Unexpected exception: %v", err)
+	}
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		// Сообщение приходит в партицию напрямую, а не через префикс
+		manager.Put(context.Background(), "jobs-2", "message")
+	}()
+	start := time.Now()
+	message, err := manager.Get(context.Background(), "jobs", 2)
+	if err != nil {
+		t.Fatalf("Unexpected exception: %v", err)
+	}
+	if message.Body != "message" {
+		t.Errorf("wrong message: got [%s] want [message]", message.Body)
+	}
+	if elapsed := time.Since(start); elapsed > 50*time.Millisecond+2*partitionPollInterval {
+		t.Errorf("message is received too late: %v", elapsed)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+	if _, err := manager.Get(ctx, "jobs", 2); !errors.Is(err, ErrCanceled) {
+		t.Errorf("wrong error: got [%v] want [%v]", err, ErrCanceled)
+	}
+}
+
+// TestPartitionedDelete проверяет, что после Delete префикса Put и Get с этим именем работают с обычной очередью,
+// а партиции остаются обычными очередями вместе с сообщениями
+func TestPartitionedDelete(t *testing.T) {
+	manager := newPartitionTestManager()
+	defer manager.Stop()
+	ctx := context.Background()
+	if err := manager.CreatePartitioned("jobs", 2); err != nil {
+		t.Fatalf("Unexpected exception: %v", err)
+	}
+	if err := manager.Put(ctx, "jobs", "partitioned"); err != nil {
+		t.Fatalf("Unexpected exception: %v", err)
+	}
+	if err := manager.Delete("jobs"); err != nil {
+		t.Fatalf("Unexpected exception: %v", err)
+	}
+	if err := manager.Delete("jobs"); !errors.Is(err, ErrQueueNotFound) {
+		t.Errorf("wrong error: got [%v] want [%v]", err, ErrQueueNotFound)
+	}
+
+	if err := manager.Put(ctx, "jobs", "plain"); err != nil {
+		t.Fatalf("Unexpected exception: %v", err)
+	}
+	for name, expected := range map[string][]string{"jobs": {"plain"}, partitionName("jobs", 0): {"partitioned"}} {
+		if messages, err := manager.Snapshot(name); err != nil || !slices.Equal(messages, expected) {
+			t.Errorf("wrong messages in [%s]: got %v [%v] want %v", name, messages, err, expected)
+		}
+	}
+	if message, err := manager.Get(ctx, "jobs", 1); err != nil || message.Body != "plain" {
+		t.Errorf("wrong Get result: got [%v] [%v] want [plain]", message.Body, err)
+	}
+}
@@ -0,0 +1,119 @@
+package queue
+
+import (
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// dataFileSuffix задает расширение файлов с журналами очередей в DataDir
+const dataFileSuffix = ".wal"
+
+// messageStorage сохраняет сообщения очереди на диске. Вызывается только из горутины dispatch
+type messageStorage interface {
+	// save сохраняет сообщения и последний выданный идентификатор: либо все, либо ни одного
+	save(envs ...*envelope) error
+	// remove удаляет сообщения по идентификаторам
+	remove(ids ...string) error
+	// close закрывает хранилище
+	close()
+}
+
+// persistentStorage задает хранилище, из которого persistentQueue восстанавливает сообщения при создании
+type persistentStorage interface {
+	messageStorage
+	// load возвращает сохраненные сообщения в порядке поступления и последний выданный идентификатор
+	load() ([]*envelope, uint64, error)
+	// done возвращает канал, который закрывается, когда хранилище закрыто
+	done() <-chan struct{}
+	// destroy удаляет сообщения закрытого хранилища
+	destroy() error
+}
+
+// persistentQueue задает очередь, сообщения которой сохраняются вне памяти и переживают перезапуск брокера.
+// Сообщения обрабатываются так же, как в queueImpl, а диспетчер записывает каждое изменение в хранилище:
+// Put подтверждается только после записи сообщения, а Get удаляет его из хранилища.
+// Сообщения в обработке (GetAck) считаются не извлеченными до Ack, поэтому после перезапуска возвращаются в очередь
+type persistentQueue struct {
+	*queueImpl
+	storage persistentStorage
+}
+
+// newPersistentQueue создает очередь, которая хранит сообщения в журнале в config.dataDir, и восстанавливает
+// по нему сохраненные ранее сообщения. Без config.dataDir создает очередь в памяти
+func newPersistentQueue(config queueConfig) (queue, error) {
+	if config.dataDir == "" || config.memoryOnly {
+		return newMemoryQueue(config)
+	}
+	storage, err := openWAL(dataFilePath(config.dataDir, config.name), config.syncMode, config.maxLogBytes)
+	if err != nil {
+		return nil, err
+	}
+	return startPersistentQueue(config, storage)
+}
+
+// startPersistentQueue создает очередь с сообщениями из storage и запускает её.
+// Если сообщения не удалось загрузить, то закрывает storage
+func startPersistentQueue(config queueConfig, storage persistentStorage) (queue, error) {
+	envs, lastID, err := storage.load()
+	if err != nil {
+		storage.close()
+		return nil, err
+	}
+	q := makeQueueImpl(config)
+	q.storage = storage
+	q.lastID = lastID
+	for _, env := range envs {
+		// Сохраненные сообщения уже были приняты, поэтому лимиты не проверяем
+		q.budget.force()
+		q.messages.Push(env)
+	}
+	q.counters.depth.Store(int64(q.messages.Len()))
+	q.start()
+	return &persistentQueue{queueImpl: q, storage: storage}, nil
+}
+
+// Stop останавливает очередь и ждет закрытия хранилища, чтобы его сразу можно было открыть снова
+func (q *persistentQueue) Stop() {
+	q.queueImpl.Stop()
+	<-q.storage.done()
+}
+
+// Destroy останавливает очередь и удаляет её сообщения из хранилища
+func (q *persistentQueue) Destroy() {
+	q.Stop()
+	if err := q.storage.destroy(); err != nil {
+		errorLogger.Printf("destroy storage error: %v\n", err)
+	}
+}
+
+// dataFilePath возвращает путь к журналу очереди name.
+// Имя экранируется, так как шаблон имен очередей может допускать символы, недопустимые в именах файлов
+func dataFilePath(dataDir, name string) string {
+	return filepath.Join(dataDir, url.PathEscape(name)+dataFileSuffix)
+}
+
+// persistedQueueNames возвращает имена очередей, журналы которых есть в dataDir, и создает dataDir, если его нет
+func persistedQueueNames(dataDir string) ([]string, error) {
+	if err := os.MkdirAll(dataDir, 0o755); err != nil {
+		return nil, err
+	}
+	entries, err := os.ReadDir(dataDir)
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, entry := range entries {
+		fileName, ok := strings.CutSuffix(entry.Name(), dataFileSuffix)
+		if !ok || entry.IsDir() {
+			continue
+		}
+		name, err := url.PathUnescape(fileName)
+		if err != nil {
+			continue
+		}
+		names = append(names, name)
+	}
+	return names, nil
+}
@@ -0,0 +1,146 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+// TestPersistentQueueRestart проверяет, что сообщения, не извлеченные до остановки, и сообщения в обработке
+// переживают повторное создание очереди, а извлеченные - нет
+func TestPersistentQueueRestart(t *testing.T) {
+	config := queueConfig{maxMessageNum: 10, visibilityTimeout: time.Minute, name: "name", dataDir: t.TempDir()}
+	ctx := context.Background()
+
+	q, err := newPersistentQueue(config)
+	if err != nil {
+		t.Fatalf("Unexpected exception: %v", err)
+	}
+	for _, message := range []string{"message1", "message2", "message3"} {
+		if _, err := q.Put(ctx, message); err != nil {
+			t.Fatalf("Unexpected exception: %v", err)
+		}
+	}
+	if _, err := q.PutBatch(ctx, []string{"message4", "message5"}); err != nil {
+		t.Fatalf("Unexpected exception: %v", err)
+	}
+	if _, err := q.Get(ctx); err != nil {
+		t.Fatalf("Unexpected exception: %v", err)
+	}
+	// Неподтвержденное сообщение после перезапуска снова доступно
+	if _, err := q.GetAck(ctx); err != nil {
+		t.Fatalf("Unexpected exception: %v", err)
+	}
+	acked, err := q.GetAck(ctx)
+	if err != nil {
+		t.Fatalf("Unexpected exception: %v", err)
+	}
+	if err := q.Ack(acked.ID); err != nil {
+		t.Fatalf("Unexpected exception: %v", err)
+	}
+	q.Stop()
+
+	q, err = newPersistentQueue(config)
+	if err != nil {
+		t.Fatalf("Unexpected exception: %v", err)
+	}
+	defer q.Stop()
+	want := []string{"message2", "message4", "message5"}
+	if messages := q.Snapshot(); !slices.Equal(messages, want) {
+		t.Errorf("wrong messages: got %v want %v", messages, want)
+	}
+	if stats := q.Stats(); stats.Depth != int64(len(want)) {
+		t.Errorf("wrong depth: got %v want %v", stats.Depth, len(want))
+	}
+	// Идентификаторы не повторяются после перезапуска
+	id, err := q.Put(ctx, "message6")
+	if err != nil {
+		t.Fatalf("Unexpected exception: %v", err)
+	}
+	if id != "6" {
+		t.Errorf("wrong id: got %v want %v", id, "6")
+	}
+	message, err := q.Get(ctx)
+	if err != nil {
+		t.Fatalf("Unexpected exception: %v", err)
+	}
+	if message.ID != "2" || message.Body != "message2" {
+		t.Errorf("wrong message: got [%v %v] want [%v %v]", message.ID, message.Body, "2", "message2")
+	}
+}
+
+// TestPersistentQueueManagerRestart проверяет, что менеджер с DataDir восстанавливает очереди после перезапуска,
+// кроме удаленных, а очищенные очереди восстанавливаются пустыми
+func TestPersistentQueueManagerRestart(t *testing.T) {
+	config := QueueManagerConfig{
+		MaxQueueNum:                10,
+		MaxMessageNumPerQueue:      10,
+		MaxSubscriptionNumPerTopic: 10,
+		DataDir:                    filepath.Join(t.TempDir(), "data"),
+	}
+	ctx := context.Background()
+
+	manager := NewQueueManager(config)
+	for _, name := range []string{"kept", "deleted", "purged"} {
+		if err := manager.Put(ctx, name, name+"1"); err != nil {
+			t.Fatalf("Unexpected exception: %v", err)
+		}
+		if err := manager.Put(ctx, name, name+"2"); err != nil {
+			t.Fatalf("Unexpected exception: %v", err)
+		}
+	}
+	if err := manager.Delete("deleted"); err != nil {
+		t.Fatalf("Unexpected exception: %v", err)
+	}
+	if _, err := manager.Purge("purged"); err != nil {
+		t.Fatalf("Unexpected exception: %v", err)
+	}
+	// Подписки топиков на диске не сохраняются
+	if _, err := manager.GetSub(ctx, "topic", "sub", 0); !errors.Is(err, ErrNoMessage) {
+		t.Fatalf("wrong error: got [%v] want [%v]", err, ErrNoMessage)
+	}
+	manager.Stop()
+
+	manager = NewQueueManager(config)
+	defer manager.Stop()
+	if names, want := manager.List(), []string{"kept", "purged"}; !slices.Equal(names, want) {
+		t.Errorf("wrong queues: got %v want %v", names, want)
+	}
+	for _, want := range []string{"kept1", "kept2"} {
+		message, err := manager.Get(ctx, "kept", 0)
+		if err != nil {
+			t.Fatalf("Unexpected exception: %v", err)
+		}
+		if message.Body != want {
+			t.Errorf("wrong message: got [%v] want [%v]", message.Body, want)
+		}
+	}
+	if _, err := manager.Get(ctx, "purged", 0); !errors.Is(err, ErrNoMessage) {
+		t.Errorf("wrong error: got [%v] want [%v]", err, ErrNoMessage)
+	}
+}
+
+// TestPersistentQueueOpenError проверяет, что ошибка открытия файла очереди возвращается из Put,
+// а очередь не создается и не занимает лимит
+func TestPersistentQueueOpenError(t *testing.T) {
+	dataDir := t.TempDir()
+	manager := NewQueueManager(QueueManagerConfig{MaxQueueNum: 1, MaxMessageNumPerQueue: 10, DataDir: dataDir})
+	defer manager.Stop()
+	// Каталог с именем файла очереди не дает его открыть
+	if err := os.Mkdir(dataFilePath(dataDir, "broken"), 0o755); err != nil {
+		t.Fatalf("Unexpected exception: %v", err)
+	}
+	if err := manager.Put(context.Background(), "broken", "message"); err == nil {
+		t.Errorf("expected error")
+	}
+	if names := manager.List(); len(names) != 0 {
+		t.Errorf("wrong queues: got %v want none", names)
+	}
+	if err := manager.Put(context.Background(), "name", "message"); err != nil {
+		t.Errorf("Unexpected exception: %v", err)
+	}
+}
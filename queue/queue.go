@@ -3,70 +3,350 @@ package queue
 import (
 	"container/list"
 	"context"
+	"errors"
+	"slices"
+	"strconv"
+	"sync"
 	"sync/atomic"
+	"time"
+
+	"go.opentelemetry.io/otel/trace"
 )
 
 // queue опеределяет интерфейс для работы с очередью сообщений
 type queue interface {
 	// Get извлекает сообщение из начала очереди
-	// Если очередь пуста, то ждет в течении timeout или пока contex не отменят и возвращает ошибку ErrNoMessage
-	Get(ctx context.Context) (string, error)
-	// Put помещает новое сообщение в конец очереди.
+	// Если очередь пуста, то ждет в течении timeout или пока contex не отменят и возвращает ошибку ErrNoMessage,
+	// если истек срок контекста, и ErrCanceled, если контекст отменил вызывающий
+	Get(ctx context.Context) (Message, error)
+	// GetAck извлекает сообщение из начала очереди, как Get, но не удаляет его окончательно:
+	// сообщение становится "в обработке" на время visibility timeout очереди и возвращается
+	// в начало очереди, если за это время не подтверждено через Ack
+	GetAck(ctx context.Context) (Message, error)
+	// Ack подтверждает обработку сообщения, полученного через GetAck, и окончательно удаляет его.
+	// Возвращает ErrMessageNotFound, если сообщения с таким id нет в обработке
+	Ack(id string) error
+	// Nack возвращает в очередь сообщение, полученное через GetAck, не дожидаясь visibility timeout.
+	// Без retry сообщение сразу встает в начало очереди. С retry оно возвращается через 2^attempt retryDelay,
+	// но не позже maxNackRetryDelay, а после maxRetries повторных попыток извлекается как take и возвращается
+	// вызывающему для переноса в очередь недоставленных сообщений. Решение о нем передается через finishTake:
+	// без commit сообщение снова в обработке с новым visibility timeout. Возвращает ErrMessageNotFound,
+	// если сообщения с таким id нет в обработке
+	Nack(id string, retry bool) (*envelope, error)
+	// Put помещает новое сообщение в конец очереди и возвращает присвоенный ему идентификатор.
 	// Может вернуть ошибку ErrTooManyItems, если срабатывает лимит на
-	// количество сообщений в одной очереди
-	Put(message string) error
+	// количество сообщений в одной очереди.
+	// Если контекст отменен до того, как очередь приняла сообщение, то возвращает ошибку контекста
+	Put(ctx context.Context, message string) (string, error)
+	// PutBlocking помещает сообщение в очередь, как Put, но если очередь заполнена, то ждет, пока читатели
+	// не освободят место. Ожидающие писатели принимаются в порядке поступления.
+	// Возвращает ErrTooManyItems, если место не освободилось до истечения контекста, и ErrCanceled,
+	// если контекст отменил вызывающий
+	PutBlocking(ctx context.Context, message string) (string, error)
+	// PutBatch помещает сообщения в конец очереди за одно обращение к диспетчеру: либо все, либо ни одного.
+	// Возвращает идентификаторы сообщений в том же порядке.
+	// Возвращает ErrTooManyItems, если все сообщения не помещаются в лимит, и тогда очередь не меняется
+	PutBatch(ctx context.Context, messages []string) ([]string, error)
+	// PutAsync передает сообщение очереди, не дожидаясь, пока она его примет. Сообщение, которое не поместилось
+	// в лимит, отбрасывается без сообщения писателю. Возвращает ErrTooManyItems, если буфер таких сообщений
+	// заполнен или очередь остановлена, и ErrMessageTooLarge, если сообщение длиннее лимита
+	PutAsync(ctx context.Context, message string) error
+	// Pause приостанавливает доставку сообщений: Get ждут, даже если в очереди есть сообщения
+	Pause()
+	// Resume возобновляет доставку сообщений, в том числе в уже ожидающие Get
+	Resume()
+	// Suspended сообщает, приостановлена ли очередь после MaxConsecutiveFailures неподтвержденных сообщений подряд
+	Suspended() bool
+	// Unsuspend снимает приостановку и сбрасывает счетчик неподтвержденных сообщений
+	Unsuspend()
+	// Restart останавливает горутину, которая обрабатывает запросы к очереди, и запускает новую. Сообщения,
+	// в том числе в обработке (GetAck), пауза и приостановка сохраняются, а ожидающие Get и PutBlocking
+	// получают те же ошибки, что и при остановке очереди. Остальные запросы на время перезапуска ждут.
+	// Возвращает ошибку ctx, если прежняя горутина не приняла запрос до его завершения,
+	// и ErrShuttingDown для остановленной очереди
+	Restart(ctx context.Context) error
+	// take без ожидания извлекает сообщение из начала очереди, даже если доставка на паузе, но до вызова finishTake
+	// очередь хранит его в хранилище и в общем лимите. Возвращает ErrNoMessage, если очередь пуста,
+	// и ErrShuttingDown для остановленной очереди
+	take() (*envelope, error)
+	// finishTake с commit окончательно удаляет сообщение, извлеченное take, а без commit возвращает его
+	// в начало очереди. Возвращает ErrShuttingDown, если очередь остановили раньше
+	finishTake(id string, commit bool) error
+	// putDeadLetter помещает в конец очереди сообщение, для которого исчерпаны повторные попытки,
+	// сохраняя число попыток. Лимиты проверяются так же, как в Put
+	putDeadLetter(ctx context.Context, env *envelope) error
+	// prepare резервирует место под сообщения транзакции и блокирует очередь до вызова commit или abort
+	// у результата. Возвращает ErrTooManyItems, если все сообщения не помещаются, и тогда очередь не блокируется
+	prepare(messages []string) (preparedPut, error)
+	// UpdateConfig меняет лимит, политику переполнения и TTL работающей очереди. Ноль в MaxMessageNum не допускается.
+	// Возвращает ErrTooManyItems, если в очереди уже больше сообщений, чем config.MaxMessageNum
+	UpdateConfig(config QueueConfig) error
+	// Purge удаляет все сообщения из очереди и возвращает их число. Очередь продолжает работать,
+	// ожидающие Get остаются в очереди ожидания, сообщения в обработке (GetAck) не затрагиваются
+	Purge() int
+	// Snapshot возвращает все сообщения очереди по порядку, не извлекая их.
+	// Сообщения в обработке (GetAck) не включаются
+	Snapshot() []string
+	// Sample возвращает не более n сообщений, равномерно выбранных от начала до конца очереди, не извлекая их
+	Sample(n int) []string
+	// Stats возвращает статистику очереди
+	Stats() QueueStats
+	// MessageWait возвращает гистограмму времени сообщений в очереди от приема до выдачи Get
+	MessageWait() HistogramStats
 	// Stop оставает процессинг в горутине, которая обрабатывает запросы к очереди
 	Stop()
+	// Destroy останавливает очередь, как Stop, и удаляет её сообщения, сохраненные на диске
+	Destroy()
 }
 
 // queueImpl задает реализацию интерфейса для работы с очередью сообщений
 // queueImpl создается через метод newQueue, в котором запускается отдельная горутина для обработки операций с очередью.
 type queueImpl struct {
-	messages             *listAdapter[string]          // linked list для сообщений в порядке их поступления
+	messages             *ringBuffer[*envelope]        // кольцевой буфер для сообщений в порядке их поступления
 	maxMessageNum        int                           // ограничение на мксимальное количество сообщений в очереди
+	visibilityTimeout    time.Duration                 // время, на которое сообщение из GetAck уходит в обработку
+	budget               *messageBudget                // общий лимит сообщений во всех очередях менеджера
+	maxWaiters           int                           // ограничение на число ожидающих Get, 0 - без ограничения
+	maxMessageBytes      int                           // ограничение на размер сообщения в байтах, 0 - без ограничения
+	overflowPolicy       OverflowPolicy                // политика переполнения, используется только в dispatch
+	ttl                  time.Duration                 // время жизни сообщения, используется только в dispatch
+	ttlTicker            *time.Ticker                  // таймер проверки устаревших сообщений, nil - если TTL не задан
+	lastID               uint64                        // последний выданный идентификатор сообщения, используется только в dispatch
+	inFlight             map[string]*envelope          // сообщения в обработке (GetAck) по идентификатору
+	taken                map[string]*envelope          // сообщения, извлеченные take и ожидающие finishTake, по идентификатору
 	getWaitStatuses      *listAdapter[*getWaitStatus]  // очередь на ожидание сообщений в порядке поступленния запросов (Get)
+	readerSelector       readerSelector                // выбирает Get, которому достается сообщение, используется только в dispatch
+	putWaitStatuses      *listAdapter[*putWaitStatus]  // очередь на ожидание места в порядке поступления запросов (PutBlocking)
 	messageCh            chan *messageWithConfirmation // канал для приема новых сообщений (Put)
+	asyncMessageCh       chan *messageWithConfirmation // буферизованный канал для сообщений без подтверждения (PutAsync)
 	getWaitStatusCh      chan *getWaitStatus           // канал для приёма ожидающий запросов на чтение
 	expiredGetElementsCh chan *list.Element            // канал для просроченных запросов на чтение сообщений (Get)
+	putWaitStatusCh      chan *putWaitStatus           // канал для приема запросов на запись с ожиданием места
+	expiredPutElementsCh chan *list.Element            // канал для просроченных запросов на запись с ожиданием (PutBlocking)
+	ackCh                chan *ackRequest              // канал для подтверждений обработки сообщений (Ack)
+	nackCh               chan *nackRequest             // канал для отказов от обработки сообщений (Nack)
+	requeueTicker        *time.Ticker                  // таймер проверки истекших visibility timeout, nil - если ничего нет в обработке
+	pauseCh              chan bool                     // канал для переключения паузы доставки (Pause/Resume)
+	configCh             chan *configRequest           // канал для изменения настроек работающей очереди (UpdateConfig)
+	restartCh            chan chan struct{}            // канал для перезапуска горутины диспетчера (Restart)
+	takeCh               chan chan *envelope           // канал для извлечения сообщения без ожидания (take)
+	finishTakeCh         chan *finishTakeRequest       // канал для решения об извлеченном сообщении (finishTake)
+	prepareCh            chan *prepareRequest          // канал для блокировки очереди транзакцией (prepare)
+	snapshotCh           chan chan []string            // канал для чтения всех сообщений без извлечения (Snapshot)
+	sampleCh             chan *sampleRequest           // канал для чтения выборки сообщений без извлечения (Sample)
+	purgeCh              chan chan int                 // канал для удаления всех сообщений (Purge)
+	paused               bool                          // приостановлена ли доставка сообщений, используется только в dispatch
+	maxFailures          int                           // неподтвержденных сообщений подряд до приостановки, используется только в dispatch
+	maxRetries           int                           // повторных попыток после Nack до очереди недоставленных сообщений, используется только в dispatch
+	retryDelay           time.Duration                 // задержка первой повторной попытки после Nack
+	failures             atomic.Int64                  // сообщения подряд, не подтвержденные до истечения visibility timeout
+	suspended            atomic.Bool                   // приостановлена ли очередь из-за неподтвержденных сообщений
 	done                 chan struct{}                 // закрытие данного канала означает запрос на прекращение работы очереди
 	stopped              atomic.Bool                   // флаг остановлена ли очередь
+	counters             queueCounters                 // статистика очереди
+	storage              messageStorage                // хранилище сообщений на диске, nil - очередь только в памяти
+	waitLatency          *waitLatency                  // общие для всех очередей гистограммы ожидания Get
+	messageWait          *latencyHistogram             // время сообщений в очереди от приема до выдачи Get
+	name                 string                        // имя очереди для спанов трассировки
+	tracer               trace.Tracer                  // создает спаны выдачи сообщений, nil - без трассировки
+}
+
+// queueConfig задает настройки отдельной очереди
+type queueConfig struct {
+	maxMessageNum     int            // ограничение на количество сообщений в очереди
+	visibilityTimeout time.Duration  // время, на которое сообщение из GetAck уходит в обработку
+	budget            *messageBudget // общий для всех очередей лимит сообщений, nil - без ограничения
+	maxWaiters        int            // ограничение на число ожидающих Get, 0 - без ограничения
+	maxMessageBytes   int            // ограничение на размер сообщения в байтах, 0 - без ограничения
+	overflowPolicy    OverflowPolicy // что делать с Put в заполненную очередь, пусто - OverflowReject
+	ttl               time.Duration  // время жизни сообщения в очереди, 0 - без ограничения
+	maxFailures       int            // неподтвержденных сообщений подряд до приостановки очереди, 0 - без ограничения
+	maxRetries        int            // повторных попыток после Nack до очереди недоставленных сообщений, 0 - без ограничения
+	retryDelay        time.Duration  // задержка первой повторной попытки после Nack, далее удваивается
+	readerWeights     map[string]int // веса потребителей при выборе ожидающего Get, nil - строго по порядку Get
+	name              string         // имя очереди, по нему находится файл с сообщениями
+	dataDir           string         // каталог для хранения сообщений на диске, пусто - очередь только в памяти
+	memoryOnly        bool           // очередь хранится только в памяти, даже если хранилище задано, например, подписка топика
+	syncMode          SyncMode       // когда журнал очереди сбрасывается на диск
+	maxLogBytes       int64          // размер журнала, после которого он переписывается, 0 - defaultMaxLogBytes
+	waitLatency       *waitLatency   // общие для всех очередей гистограммы ожидания Get, nil - без учета
+	tracer            trace.Tracer   // создает спаны выдачи сообщений, nil - без трассировки
+}
+
+// Message задает сообщение, выданное читателю
+type Message struct {
+	ID         string    // идентификатор сообщения, уникальный в пределах очереди или подписки
+	Body       string    // само сообщение
+	EnqueuedAt time.Time // момент, когда очередь приняла сообщение
+	// Attempts задает число повторных попыток доставки после Nack с retry. Для сообщения в очереди
+	// недоставленных сообщений это число попыток, после которых оно туда попало
+	Attempts int
+	// FillRatio задает заполненность очереди в момент выдачи: число оставшихся сообщений, деленное на лимит очереди.
+	// Писатели могут использовать её как признак нагрузки, не запрашивая статистику
+	FillRatio float64
+	// Depth задает число сообщений, оставшихся в очереди после выдачи этого
+	Depth int
+}
+
+// envelope хранит сообщение вместе с его служебными данными
+type envelope struct {
+	id         string    // идентификатор сообщения, уникальный в пределах очереди
+	message    string    // само сообщение
+	enqueuedAt time.Time // момент приема сообщения, не меняется при возврате из обработки
+	deadline   time.Time // момент истечения visibility timeout, пока сообщение в обработке
+	// attempts - число повторных попыток после Nack с retry. На диске не хранится
+	attempts int
+	// retrying - сообщение ждет до deadline повторной попытки после Nack и не может быть подтверждено
+	retrying bool
+	// deadLettering - сообщение извлечено Nack из обработки для переноса в очередь недоставленных сообщений
+	deadLettering bool
+	// spanContext задает спан Put, которым сообщение принято, с ним связывается спан выдачи. На диске не хранится
+	spanContext trace.SpanContext
+}
+
+// toMessage возвращает сообщение в том виде, в котором оно выдается читателю
+func (e *envelope) toMessage() Message {
+	return Message{
+		ID:         e.id,
+		Body:       e.message,
+		EnqueuedAt: e.enqueuedAt,
+		Attempts:   e.attempts,
+	}
+}
+
+type ackRequest struct {
+	id           string
+	confirmation chan error
+}
+
+type nackRequest struct {
+	id           string
+	retry        bool
+	deadLetter   *envelope // сообщение, исчерпавшее повторные попытки, диспетчер заполняет до подтверждения
+	confirmation chan error
+}
+
+type configRequest struct {
+	config       QueueConfig
+	confirmation chan error
 }
 
 type messageWithConfirmation struct {
 	message      string
+	batch        []string          // сообщения PutBatch, если не nil, то message не используется
+	id           string            // идентификатор принятого сообщения Put, диспетчер заполняет до подтверждения
+	ids          []string          // идентификаторы принятых сообщений PutBatch, диспетчер заполняет до подтверждения
+	spanContext  trace.SpanContext // спан писателя, сохраняется в принятых сообщениях
+	async        bool              // писатель не ждет подтверждения, и диспетчер сам возвращает запрос в пул
+	attempts     int               // число повторных попыток сообщения, переносимого в очередь недоставленных сообщений
 	confirmation chan error
 }
 
+// messageWithConfirmationPool переиспользует запросы на запись вместе с каналами подтверждения,
+// чтобы не выделять память на каждый Put
+var messageWithConfirmationPool = sync.Pool{
+	New: func() any {
+		return &messageWithConfirmation{
+			confirmation: make(chan error, 1), // чтобы не блокировать писателя
+		}
+	},
+}
+
 func newMessageWithConfirmation(message string) *messageWithConfirmation {
-	return &messageWithConfirmation{
-		message:      message,
-		confirmation: make(chan error, 1), // чтобы не блокировать писателя
-	}
+	msg := messageWithConfirmationPool.Get().(*messageWithConfirmation)
+	msg.message = message
+	return msg
+}
+
+// release возвращает запрос в пул. Вызывать можно, только если подтверждение из канала уже прочитано,
+// иначе диспетчер может записать в канал подтверждение уже для следующего владельца
+func (m *messageWithConfirmation) release() {
+	m.message = "" // чтобы пул не удерживал память сообщения
+	m.batch = nil
+	m.id = ""
+	m.ids = nil
+	m.spanContext = trace.SpanContext{}
+	m.async = false
+	m.attempts = 0
+	messageWithConfirmationPool.Put(m)
 }
 
 // newQueue создает новую очередь, скрывая детали реализации за интерфейсом queue
-func newQueue(maxMessageNum int) queue {
-	return newQueueImpl(maxMessageNum)
+func newQueue(config queueConfig) queue {
+	return newQueueImpl(config)
+}
+
+// newMemoryQueue создает очередь в памяти, это фабрика очередей менеджера по умолчанию
+func newMemoryQueue(config queueConfig) (queue, error) {
+	return newQueue(config), nil
 }
 
 // newQueueImpl создает новую очередь
-func newQueueImpl(maxMessageNum int) *queueImpl {
+func newQueueImpl(config queueConfig) *queueImpl {
+	res := makeQueueImpl(config)
+	res.start()
+	return res
+}
+
+// makeQueueImpl создает очередь, не запуская горутину диспетчера
+func makeQueueImpl(config queueConfig) *queueImpl {
 	res := &queueImpl{
-		messages:             newListAdapter[string](),
-		maxMessageNum:        maxMessageNum,
+		messages:             newRingBuffer[*envelope](config.maxMessageNum),
+		maxMessageNum:        config.maxMessageNum,
+		visibilityTimeout:    config.visibilityTimeout,
+		budget:               config.budget,
+		maxWaiters:           config.maxWaiters,
+		maxMessageBytes:      config.maxMessageBytes,
+		overflowPolicy:       config.overflowPolicy,
+		ttl:                  config.ttl,
+		maxFailures:          config.maxFailures,
+		maxRetries:           config.maxRetries,
+		retryDelay:           config.retryDelay,
+		waitLatency:          config.waitLatency,
+		name:                 config.name,
+		tracer:               config.tracer,
+		inFlight:             make(map[string]*envelope),
+		taken:                make(map[string]*envelope),
 		getWaitStatuses:      newListAdapter[*getWaitStatus](),
+		readerSelector:       fifoSelector{},
+		putWaitStatuses:      newListAdapter[*putWaitStatus](),
 		messageCh:            make(chan *messageWithConfirmation),
+		asyncMessageCh:       make(chan *messageWithConfirmation, asyncPutBufferSize),
 		getWaitStatusCh:      make(chan *getWaitStatus),
 		expiredGetElementsCh: make(chan *list.Element),
+		putWaitStatusCh:      make(chan *putWaitStatus),
+		expiredPutElementsCh: make(chan *list.Element),
+		ackCh:                make(chan *ackRequest),
+		nackCh:               make(chan *nackRequest),
+		pauseCh:              make(chan bool),
+		configCh:             make(chan *configRequest),
+		restartCh:            make(chan chan struct{}),
+		takeCh:               make(chan chan *envelope),
+		finishTakeCh:         make(chan *finishTakeRequest),
+		prepareCh:            make(chan *prepareRequest),
+		snapshotCh:           make(chan chan []string),
+		sampleCh:             make(chan *sampleRequest),
+		purgeCh:              make(chan chan int),
 		done:                 make(chan struct{}),
 	}
+	if len(config.readerWeights) > 0 {
+		res.readerSelector = newWeightedSelector(config.readerWeights)
+	}
+	res.messageWait = newLatencyHistogram(MessageWaitBuckets)
+	res.counters.markCreated()
+	return res
+}
+
+// start запускает обработку запросов к очереди
+func (q *queueImpl) start() {
+	q.setTTL(q.ttl)
 	// Запуск отдельной новой горутины для обработки запросов к очереди через каналы,
 	// что позволяет работать с очередью без блокировок.
-	go res.dispatch()
-	return res
+	go q.dispatch()
 }
 
-// listAdapter это generic wrapper вокруг двусвязного списка из стандартной библиотеки
+// listAdapter это generic wrapper вокруг двусвязного списка из стандартной библиотеки.
+// Как и сам список, не защищен от одновременного доступа и используется только в dispatch
 type listAdapter[T any] struct {
 	data *list.List
 }
@@ -93,73 +373,486 @@ func (a *listAdapter[T]) Len() int {
 	return a.data.Len()
 }
 
+// RemoveAll удаляет все элементы за O(1), заменяя список новым, и возвращает их число.
+// Старый список со всеми узлами освобождается сборщиком мусора целиком
+func (a *listAdapter[T]) RemoveAll() int {
+	n := a.data.Len()
+	a.data = list.New()
+	return n
+}
+
+// All перебирает элементы от начала до конца, не удаляя их
+func (a *listAdapter[T]) All(yield func(T) bool) {
+	for elem := a.data.Front(); elem != nil; elem = elem.Next() {
+		if !yield(elem.Value.(T)) {
+			return
+		}
+	}
+}
+
 func (a *listAdapter[T]) Peek() T {
 	return a.data.Front().Value.(T)
 }
 
 type getWaitStatus struct {
-	msgCh         chan string
+	ack           bool              // сообщение уходит в обработку до подтверждения (GetAck)
+	delivered     bool              // сообщение уже доставлено, используется только в dispatch
+	canceled      bool              // контекст отменен вызывающим, а не истек, задается до отправки в expiredGetElementsCh
+	createdAt     time.Time         // момент создания запроса, от него считается время ожидания
+	spanContext   trace.SpanContext // спан читателя, родительский для спана выдачи сообщения
+	consumer      string            // идентификатор потребителя из WithConsumerID, пусто - не задан
+	fillRatio     float64           // заполненность очереди при выдаче, задается диспетчером до отправки в msgCh
+	depth         int               // число сообщений в очереди после выдачи, задается вместе с fillRatio
+	msgCh         chan *envelope
 	createdElemCh chan *list.Element
 	errCh         chan error
 }
 
-func newGetWaitStatus() *getWaitStatus {
+func newGetWaitStatus(ack bool, spanContext trace.SpanContext) *getWaitStatus {
 	return &getWaitStatus{
+		ack:         ack,
+		createdAt:   time.Now(),
+		spanContext: spanContext,
 		// Для общения с ожидающим клиентом используем буферизованный канал емкостью 1,
 		// чтобы не блокировать пишущую горутину
-		msgCh:         make(chan string, 1),
+		msgCh:         make(chan *envelope, 1),
+		createdElemCh: make(chan *list.Element, 1),
+		errCh:         make(chan error, 1),
+	}
+}
+
+// putWaitStatus задает запрос PutBlocking, который ждет места в очереди
+type putWaitStatus struct {
+	message       string
+	id            string            // идентификатор принятого сообщения, диспетчер заполняет до отправки nil в errCh
+	spanContext   trace.SpanContext // спан писателя, сохраняется в принятом сообщении
+	accepted      bool              // сообщение уже принято, используется только в dispatch
+	canceled      bool              // контекст отменен вызывающим, а не истек, задается до отправки в expiredPutElementsCh
+	createdElemCh chan *list.Element
+	errCh         chan error
+}
+
+func newPutWaitStatus(message string, spanContext trace.SpanContext) *putWaitStatus {
+	return &putWaitStatus{
+		message:     message,
+		spanContext: spanContext,
+		// Буферизованные каналы, чтобы не блокировать диспетчер
 		createdElemCh: make(chan *list.Element, 1),
 		errCh:         make(chan error, 1),
 	}
 }
 
-func (q *queueImpl) Get(ctx context.Context) (res string, err error) {
-	ws := newGetWaitStatus()
+func (q *queueImpl) Get(ctx context.Context) (Message, error) {
+	return q.get(ctx, false)
+}
+
+func (q *queueImpl) GetAck(ctx context.Context) (Message, error) {
+	return q.get(ctx, true)
+}
+
+// get ожидает сообщение из начала очереди, общая часть Get и GetAck
+func (q *queueImpl) get(ctx context.Context, ack bool) (Message, error) {
+	ws := newGetWaitStatus(ack, trace.SpanContextFromContext(ctx))
+	ws.consumer = ConsumerIDFromContext(ctx)
 	// Отправляем запрос на ожидание
-	q.getWaitStatusCh <- ws
-	go func() {
+	select {
+	case q.getWaitStatusCh <- ws:
+	case <-q.done:
+		return Message{}, ErrShuttingDown
+	}
+	// Диспетчер, приняв запрос, сразу сообщает, попал ли он в список ожидания
+	createdElem := <-ws.createdElemCh
+	if createdElem == nil {
+		// Запрос отклонен, ошибка уже в канале
+		return Message{}, <-ws.errCh
+	}
+	// Горутина для отслеживания контекста запускается, только когда контекст завершен, а не на каждый Get,
+	// поэтому тысячи ожидающих читателей не держат тысячи горутин
+	stop := context.AfterFunc(ctx, func() {
+		// Отмена означает, что клиент ушел, а истечение - что сообщения не дождались
+		ws.canceled = errors.Is(ctx.Err(), context.Canceled)
 		select {
-		case <-ctx.Done():
+		case q.expiredGetElementsCh <- createdElem:
+			// Главная горутина обработает полученную запись и запишет в канал ws.errCh ошибку
 		case <-q.done:
-			return
 		}
+	})
+	// Если сообщение получено раньше, то отслеживать контекст больше не нужно
+	defer stop()
+	// Ожидаем от горутины диспетчера приход либо сообщения, либо ошибки
+	var env *envelope
+	select {
+	case env = <-ws.msgCh: // Запрошенное сообщение
+	case err := <-ws.errCh: // Например, запрос просрочен или очередь остановлена
+		return Message{}, err
+	case <-q.done:
+		// Диспетчер мог успеть доставить сообщение перед остановкой, его не теряем
 		select {
-		// Контекст истек, сообщаем в главную горутину, что данную запись можно удалять из очереди на ожидание
-		case expiredGetElem := <-ws.createdElemCh:
-			select {
-			case q.expiredGetElementsCh <- expiredGetElem:
-				// Главная горутина обработает полученную запись и запишет в канал ws.errCh ошибку
-			case <-q.done:
-			}
-		case <-q.done:
+		case env = <-ws.msgCh:
+		default:
+			return Message{}, ErrShuttingDown
 		}
-	}()
-	// Ожидаем от горутины диспетчера приход либо сообщения, либо ошибки
+	}
+	message := env.toMessage()
+	message.FillRatio = ws.fillRatio
+	message.Depth = ws.depth
+	return message, nil
+}
+
+// Ack подтверждает обработку сообщения
+func (q *queueImpl) Ack(id string) error {
+	req := &ackRequest{
+		id:           id,
+		confirmation: make(chan error, 1), // чтобы не блокировать диспетчер
+	}
+	select {
+	case q.ackCh <- req:
+	case <-q.done:
+		return ErrMessageNotFound
+	}
+	select {
+	case err := <-req.confirmation:
+		return err
+	case <-q.done:
+		return ErrMessageNotFound
+	}
+}
+
+func (q *queueImpl) Nack(id string, retry bool) (*envelope, error) {
+	req := &nackRequest{
+		id:           id,
+		retry:        retry,
+		confirmation: make(chan error, 1), // чтобы не блокировать диспетчер
+	}
+	select {
+	case q.nackCh <- req:
+	case <-q.done:
+		return nil, ErrMessageNotFound
+	}
 	select {
-	case res = <-ws.msgCh: // Запрошенное сообщение
-	case err = <-ws.errCh: // Например, запрос просрочен
+	case err := <-req.confirmation:
+		return req.deadLetter, err
 	case <-q.done:
-		return "", ErrNoMessage
+		return nil, ErrMessageNotFound
 	}
-	return
 }
 
 // Put помещает сообщение в очередь
-func (q *queueImpl) Put(message string) error {
+func (q *queueImpl) Put(ctx context.Context, message string) (string, error) {
+	if q.isTooLarge(message) {
+		return "", ErrMessageTooLarge
+	}
 	msg := newMessageWithConfirmation(message)
+	msg.spanContext = trace.SpanContextFromContext(ctx)
+	id, _, err := q.put(ctx, msg)
+	return id, err
+}
+
+// put передает диспетчеру запрос на запись, ждет подтверждения и возвращает идентификаторы принятых сообщений:
+// id для одного сообщения и ids для пакета
+func (q *queueImpl) put(ctx context.Context, msg *messageWithConfirmation) (id string, ids []string, err error) {
 	// отправляем запрос на добавление нового сообщения
 	select {
 	case q.messageCh <- msg:
+	case <-ctx.Done():
+		// Диспетчер запрос не принял, поэтому его можно переиспользовать
+		msg.release()
+		return "", nil, ctx.Err()
 	case <-q.done:
-		return ErrTooManyItems
+		return "", nil, ErrTooManyItems
 	}
 	// Получаем подтверждение принятия сообщения
 	select {
-	case err := <-msg.confirmation:
-		return err
+	case err = <-msg.confirmation:
+		// Канал подтверждения пуст, запрос можно переиспользовать
+		id, ids = msg.id, msg.ids
+		msg.release()
+		return id, ids, err
+	case <-q.done:
+		// Диспетчер мог успеть принять запрос, поэтому в пул его не возвращаем
+		return "", nil, ErrTooManyItems
+	}
+}
+
+func (q *queueImpl) PutBlocking(ctx context.Context, message string) (string, error) {
+	if q.isTooLarge(message) {
+		return "", ErrMessageTooLarge
+	}
+	ws := newPutWaitStatus(message, trace.SpanContextFromContext(ctx))
+	select {
+	case q.putWaitStatusCh <- ws:
+	case <-ctx.Done():
+		return "", ctx.Err()
+	case <-q.done:
+		return "", ErrTooManyItems
+	}
+	// Диспетчер сразу сообщает, пришлось ли запросу встать в список ожидания
+	createdElem := <-ws.createdElemCh
+	if createdElem == nil {
+		// Место нашлось сразу, результат уже в канале
+		err := <-ws.errCh
+		return ws.id, err
+	}
+	// Контекст отслеживается так же, как в get: горутина запускается, только когда он завершен
+	stop := context.AfterFunc(ctx, func() {
+		ws.canceled = errors.Is(ctx.Err(), context.Canceled)
+		select {
+		case q.expiredPutElementsCh <- createdElem:
+		case <-q.done:
+		}
+	})
+	defer stop()
+	select {
+	case err := <-ws.errCh:
+		return ws.id, err
+	case <-q.done:
+		// Диспетчер мог успеть принять сообщение перед остановкой
+		select {
+		case err := <-ws.errCh:
+			return ws.id, err
+		default:
+			return "", ErrTooManyItems
+		}
+	}
+}
+
+func (q *queueImpl) PutBatch(ctx context.Context, messages []string) ([]string, error) {
+	if len(messages) == 0 {
+		return nil, nil
+	}
+	// Пакет принимается целиком или не принимается вовсе, поэтому проверяем все сообщения до записи
+	for _, message := range messages {
+		if q.isTooLarge(message) {
+			return nil, ErrMessageTooLarge
+		}
+	}
+	msg := newMessageWithConfirmation("")
+	msg.batch = messages
+	msg.spanContext = trace.SpanContextFromContext(ctx)
+	_, ids, err := q.put(ctx, msg)
+	return ids, err
+}
+
+// PutAsync передает сообщение в буфер диспетчера без ожидания
+func (q *queueImpl) PutAsync(ctx context.Context, message string) error {
+	if q.isTooLarge(message) {
+		return ErrMessageTooLarge
+	}
+	select {
 	case <-q.done:
 		return ErrTooManyItems
+	default:
 	}
+	msg := newMessageWithConfirmation(message)
+	msg.async = true
+	msg.spanContext = trace.SpanContextFromContext(ctx)
+	select {
+	case q.asyncMessageCh <- msg:
+		return nil
+	default:
+		// Буфер заполнен: диспетчер не успевает за писателями, и ждать его писатель не хочет
+		msg.release()
+		return ErrTooManyItems
+	}
+}
+
+// isTooLarge проверяет размер сообщения до передачи диспетчеру, чтобы слишком большое сообщение не попало в буфер
+func (q *queueImpl) isTooLarge(message string) bool {
+	return q.maxMessageBytes > 0 && len(message) > q.maxMessageBytes
+}
+
+// Pause приостанавливает доставку сообщений в ожидающие Get запросы
+func (q *queueImpl) Pause() {
+	q.setPaused(true)
+}
+
+// Resume возобновляет доставку сообщений
+func (q *queueImpl) Resume() {
+	q.setPaused(false)
+}
+
+// Suspended сообщает, приостановлена ли очередь из-за неподтвержденных сообщений
+func (q *queueImpl) Suspended() bool {
+	return q.suspended.Load()
+}
+
+// Unsuspend снимает приостановку. Флаги атомарные, поэтому диспетчер не нужен: ожидающих Get
+// у приостановленной очереди нет, а новые Get диспетчер уже примет
+func (q *queueImpl) Unsuspend() {
+	q.failures.Store(0)
+	q.suspended.Store(false)
+}
+
+func (q *queueImpl) setPaused(paused bool) {
+	select {
+	case q.pauseCh <- paused:
+	case <-q.done:
+	}
+}
+
+// finishTakeRequest передает диспетчеру решение об извлеченном через take сообщении
+type finishTakeRequest struct {
+	id       string
+	commit   bool
+	finished chan struct{} // закрывается диспетчером после выполнения решения
+}
+
+// take извлекает сообщение из начала очереди без ожидания
+func (q *queueImpl) take() (*envelope, error) {
+	reply := make(chan *envelope, 1) // чтобы не блокировать диспетчер
+	select {
+	case q.takeCh <- reply:
+	case <-q.done:
+		return nil, ErrShuttingDown
+	}
+	select {
+	case env := <-reply:
+		if env == nil {
+			return nil, ErrNoMessage
+		}
+		return env, nil
+	case <-q.done:
+		return nil, ErrShuttingDown
+	}
+}
+
+func (q *queueImpl) finishTake(id string, commit bool) error {
+	req := &finishTakeRequest{id: id, commit: commit, finished: make(chan struct{})}
+	select {
+	case q.finishTakeCh <- req:
+	case <-q.done:
+		return ErrShuttingDown
+	}
+	select {
+	case <-req.finished:
+		return nil
+	case <-q.done:
+		return ErrShuttingDown
+	}
+}
+
+func (q *queueImpl) putDeadLetter(ctx context.Context, env *envelope) error {
+	msg := newMessageWithConfirmation(env.message)
+	msg.attempts = env.attempts
+	msg.spanContext = env.spanContext
+	_, _, err := q.put(ctx, msg)
+	return err
+}
+
+// prepare передает диспетчеру сообщения транзакции. После успешного ответа диспетчер ждет решения
+// транзакции и до него не обрабатывает других запросов
+func (q *queueImpl) prepare(messages []string) (preparedPut, error) {
+	for _, message := range messages {
+		if q.isTooLarge(message) {
+			return nil, ErrMessageTooLarge
+		}
+	}
+	req := &prepareRequest{
+		messages: messages,
+		prepared: make(chan error),
+		decision: make(chan bool),
+		ids:      make(chan []string, 1), // чтобы не блокировать диспетчер
+	}
+	select {
+	case q.prepareCh <- req:
+	case <-q.done:
+		return nil, ErrTooManyItems
+	}
+	// Принятый запрос диспетчер обрабатывает до конца, даже если очередь останавливают
+	if err := <-req.prepared; err != nil {
+		return nil, err
+	}
+	return req, nil
+}
+
+// UpdateConfig передает новые настройки диспетчеру, который применяет их между запросами
+func (q *queueImpl) UpdateConfig(config QueueConfig) error {
+	req := &configRequest{
+		config:       config,
+		confirmation: make(chan error, 1), // чтобы не блокировать диспетчер
+	}
+	select {
+	case q.configCh <- req:
+	case <-q.done:
+		return ErrQueueNotFound
+	}
+	select {
+	case err := <-req.confirmation:
+		return err
+	case <-q.done:
+		return ErrQueueNotFound
+	}
+}
+
+// Purge удаляет все сообщения очереди в горутине диспетчера.
+// Остановленная очередь уже освободила свои сообщения, поэтому для нее возвращается 0
+func (q *queueImpl) Purge() int {
+	reply := make(chan int, 1) // чтобы не блокировать диспетчер
+	select {
+	case q.purgeCh <- reply:
+	case <-q.done:
+		return 0
+	}
+	select {
+	case n := <-reply:
+		return n
+	case <-q.done:
+		return 0
+	}
+}
+
+// Snapshot возвращает копию сообщений очереди, собранную в горутине диспетчера
+func (q *queueImpl) Snapshot() []string {
+	reply := make(chan []string, 1) // чтобы не блокировать диспетчер
+	select {
+	case q.snapshotCh <- reply:
+	case <-q.done:
+		return nil
+	}
+	select {
+	case messages := <-reply:
+		return messages
+	case <-q.done:
+		return nil
+	}
+}
+
+// sampleRequest передает диспетчеру размер выборки для Sample
+type sampleRequest struct {
+	n     int
+	reply chan []string
+}
+
+// Sample возвращает выборку сообщений, собранную в горутине диспетчера, так же как Snapshot
+func (q *queueImpl) Sample(n int) []string {
+	req := &sampleRequest{
+		n:     n,
+		reply: make(chan []string, 1), // чтобы не блокировать диспетчер
+	}
+	select {
+	case q.sampleCh <- req:
+	case <-q.done:
+		return nil
+	}
+	select {
+	case messages := <-req.reply:
+		return messages
+	case <-q.done:
+		return nil
+	}
+}
+
+// Stats возвращает статистику очереди, не обращаясь к горутине диспетчера
+func (q *queueImpl) Stats() QueueStats {
+	stats := q.counters.snapshot()
+	stats.Suspended = q.suspended.Load()
+	return stats
+}
+
+// MessageWait возвращает гистограмму времени сообщений в очереди. Сообщение, возвращенное из обработки,
+// учитывается снова со временем от первого приема
+func (q *queueImpl) MessageWait() HistogramStats {
+	return q.messageWait.snapshot()
 }
 
 // Stop останавливает горутину, которая обрабатывает запросы пользователя
@@ -169,45 +862,649 @@ func (q *queueImpl) Stop() {
 	}
 }
 
+// Destroy у очереди в памяти ничем не отличается от Stop
+func (q *queueImpl) Destroy() {
+	q.Stop()
+}
+
+func (q *queueImpl) Restart(ctx context.Context) error {
+	stopped := make(chan struct{})
+	select {
+	case q.restartCh <- stopped:
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-q.done:
+		return ErrShuttingDown
+	}
+	// После выхода прежней горутины состояние очереди принадлежит этой, пока она не запустит новую
+	<-stopped
+	go q.dispatch()
+	return nil
+}
+
+// rejectWaiters отвечает ожидающим Get и PutBlocking ошибками остановленной очереди
+func (q *queueImpl) rejectWaiters() {
+	q.rejectReaders(ErrShuttingDown)
+	q.counters.waiting.Store(0)
+	// Ожидающие места писатели получают ту же ошибку, что и Put в остановленную очередь
+	for ws := range q.putWaitStatuses.All {
+		// Так же и истекший позже контекст писателя не получает второго ответа
+		ws.accepted = true
+		ws.errCh <- ErrTooManyItems
+	}
+	q.putWaitStatuses.RemoveAll()
+}
+
+// rejectReaders отвечает всем ожидающим Get ошибкой err и очищает очередь ожидания
+func (q *queueImpl) rejectReaders(err error) {
+	for ws := range q.getWaitStatuses.All {
+		// Истекший позже контекст запроса не должен получить второй ответ
+		ws.delivered = true
+		ws.errCh <- err
+	}
+	q.getWaitStatuses.RemoveAll()
+}
+
 // dispatch разбирает и обратаывает входящие запросы к очереди из главной горутины
 func (q *queueImpl) dispatch() {
 	for {
 		select {
 		case <-q.done:
-			// Прекращаем обработку по приходу Stop.
+			// Прекращаем обработку по приходу Stop, сообщения остановленной очереди больше не занимают общий лимит
+			q.setTTL(0)
+			q.stopRequeue()
+			q.budget.release(q.messages.Len() + len(q.inFlight) + len(q.taken))
+			// Ожидающим запросам сообщаем об остановке сами, не полагаясь на то, что они заметят закрытие done
+			q.rejectWaiters()
+			// Хранилище закрывается здесь, так как пишет в него только эта горутина
+			if q.storage != nil {
+				q.storage.close()
+			}
+			return
+		case stopped := <-q.restartCh:
+			// Сообщения, таймеры и хранилище переходят к новой горутине, а ожидающие запросы клиенты повторят
+			q.rejectWaiters()
+			close(stopped)
 			return
 		case newMsg := <-q.messageCh:
-			// Прием нового сообщения на запись в очередь
-			var err error
-			if q.messages.Len() >= q.maxMessageNum {
-				// Отказываемся принимать это сообщение, чтобы не превысить лимит на число сообщений в очереди
-				err = ErrTooManyItems
+			// Прием нового сообщения или пакета сообщений на запись в очередь
+			q.acceptPut(newMsg)
+		case newMsg := <-q.asyncMessageCh:
+			// Прием сообщения без подтверждения
+			q.acceptPut(newMsg)
+		case ws := <-q.putWaitStatusCh:
+			// Прием запроса на запись с ожиданием места. Раньше уже ожидающих писателей он место не занимает
+			if q.putWaitStatuses.Empty() && q.hasRoom() {
+				var err error
+				ws.id, err = q.pushOne(q.newEnvelope(ws.message, ws.spanContext))
+				ws.createdElemCh <- nil
+				ws.errCh <- err
+				q.deliverMessages()
+				continue
+			}
+			ws.createdElemCh <- q.putWaitStatuses.Push(ws)
+		case elem := <-q.expiredPutElementsCh:
+			ws := elem.Value.(*putWaitStatus)
+			// Контекст истекает и у запросов, сообщение которых уже принято
+			if ws.accepted {
+				continue
+			}
+			if ws.canceled {
+				ws.errCh <- ErrCanceled
 			} else {
-				q.messages.Push(newMsg.message)
+				ws.errCh <- ErrTooManyItems
 			}
-			// Подтверждаем принятое сообщение
-			newMsg.confirmation <- err
-			// Доставляем сообщения
-			q.deliverMessages()
+			q.counters.errors.Add(1)
+			q.putWaitStatuses.data.Remove(elem)
 		case waitStatus := <-q.getWaitStatusCh:
 			// Прием запроса на чтение сообщения из очереди
+			if q.suspended.Load() {
+				// Приостановленная очередь не выдает сообщений, пока её не возобновят
+				waitStatus.createdElemCh <- nil
+				waitStatus.errCh <- ErrQueueSuspended
+				continue
+			}
+			if q.maxWaiters > 0 && q.getWaitStatuses.Len() >= q.maxWaiters {
+				// Список ожидания полон, отказываем сразу. Пустой элемент сообщает get,
+				// что отслеживать контекст не нужно: удалять из списка нечего
+				waitStatus.createdElemCh <- nil
+				waitStatus.errCh <- ErrTooManyWaiters
+				q.counters.errors.Add(1)
+				continue
+			}
 			createdElem := q.getWaitStatuses.Push(waitStatus)
 			waitStatus.createdElemCh <- createdElem
 			// Доставляем сообщения в ожидающие запросы
 			q.deliverMessages()
 		case elem := <-q.expiredGetElementsCh:
 			ws := elem.Value.(*getWaitStatus)
-			// Сообщаем, что сообщения не дождались
-			ws.errCh <- ErrNoMessage
+			// Контекст истекает и у запросов, которые уже получили сообщение, их не считаем ошибкой
+			if ws.delivered {
+				continue
+			}
+			// Сообщаем, что сообщения не дождались или запрос отменили
+			if ws.canceled {
+				ws.errCh <- ErrCanceled
+			} else {
+				ws.errCh <- ErrNoMessage
+			}
+			q.waitLatency.observe(ws, false)
+			q.counters.errors.Add(1)
 			// Удаляем просроченный запрос за O(1)
 			q.getWaitStatuses.data.Remove(elem)
+		case req := <-q.ackCh:
+			// Подтвержденное сообщение просто забываем, проверка visibility timeout его уже не найдет
+			var err error
+			if env, ok := q.inFlight[req.id]; ok && !env.retrying {
+				delete(q.inFlight, req.id)
+				q.budget.release(1)
+				q.forget(req.id)
+				q.counters.touch()
+				// Подтвержденная доставка прерывает серию неудач
+				q.failures.Store(0)
+			} else {
+				err = ErrMessageNotFound
+			}
+			req.confirmation <- err
+			// Освободилось место в общем лимите
+			q.deliverMessages()
+		case req := <-q.nackCh:
+			req.confirmation <- q.nack(req)
+			q.deliverMessages()
+		case <-q.requeueTick():
+			q.requeueExpired()
+			q.deliverMessages()
+		case reply := <-q.takeCh:
+			q.expireMessages()
+			var env *envelope
+			if !q.messages.Empty() {
+				// Место в лимите и в хранилище остается за сообщением до решения, чтобы его нельзя было потерять
+				env = q.messages.Pop()
+				q.taken[env.id] = env
+			}
+			reply <- env
+		case req := <-q.finishTakeCh:
+			if env := q.taken[req.id]; env != nil {
+				delete(q.taken, req.id)
+				switch {
+				case req.commit:
+					q.budget.release(1)
+					q.forget(env.id)
+					// Сообщение из обработки уже учтено в consumed при выдаче
+					if !env.deadLettering {
+						q.counters.consumed.Add(1)
+						q.counters.touch()
+					}
+				case env.deadLettering:
+					// Очередь недоставленных сообщений не приняла сообщение, оно снова ждет решения читателя
+					env.deadLettering = false
+					q.startInFlight(env)
+				default:
+					q.messages.PushFront(env)
+				}
+			}
+			close(req.finished)
+			q.deliverMessages()
+		case req := <-q.prepareCh:
+			// Пока транзакция не решит, фиксировать ли сообщения, остальные запросы к очереди ждут
+			q.applyPrepared(req)
+			q.deliverMessages()
+		case reply := <-q.snapshotCh:
+			q.expireMessages()
+			envs := q.messages.PeekAll()
+			messages := make([]string, len(envs))
+			for i, env := range envs {
+				messages[i] = env.message
+			}
+			reply <- messages
+		case req := <-q.sampleCh:
+			q.expireMessages()
+			envs := q.messages.Sample(req.n)
+			messages := make([]string, len(envs))
+			for i, env := range envs {
+				messages[i] = env.message
+			}
+			req.reply <- messages
+		case reply := <-q.purgeCh:
+			// Новый буфер вместо очистки старого, чтобы не держать память, до которой разрасталась очередь
+			n := q.messages.Len()
+			if q.storage != nil {
+				envs := q.messages.PeekAll()
+				ids := make([]string, len(envs))
+				for i, env := range envs {
+					ids[i] = env.id
+				}
+				q.forget(ids...)
+			}
+			q.messages = newRingBuffer[*envelope](q.maxMessageNum)
+			q.budget.release(n)
+			reply <- n
+			q.deliverMessages()
+		case req := <-q.configCh:
+			// Уменьшать лимит ниже текущей глубины нельзя: лишние сообщения пришлось бы выбросить
+			var err error
+			if req.config.MaxMessageNum < q.messages.Len() {
+				err = ErrTooManyItems
+			} else {
+				q.maxMessageNum = req.config.MaxMessageNum
+				q.overflowPolicy = req.config.OverflowPolicy
+				q.setTTL(req.config.TTL)
+				q.maxFailures = req.config.MaxConsecutiveFailures
+				q.maxRetries = req.config.MaxRetries
+			}
+			req.confirmation <- err
+			// Увеличенный лимит может освободить место ожидающим писателям
+			q.deliverMessages()
+		case <-q.ttlTick():
+			// Устаревшие сообщения освобождают место ожидающим писателям
+			q.expireMessages()
+			q.deliverMessages()
+		case paused := <-q.pauseCh:
+			q.paused = paused
+			// После снятия паузы отдаём накопившиеся сообщения ожидающим запросам
+			q.deliverMessages()
+		}
+		// Обновляем текущие размеры после обработки любого запроса. Списки ожидающих меняет только dispatch,
+		// поэтому другие горутины узнают их длину из счетчиков, а не из самих списков
+		q.counters.depth.Store(int64(q.messages.Len()))
+		q.counters.inFlight.Store(int64(len(q.inFlight)))
+		q.counters.waiting.Store(int64(q.getWaitStatuses.Len()))
+	}
+}
+
+// pushOne добавляет новое сообщение, созданное newEnvelope, в конец очереди и возвращает его идентификатор,
+// как push, но без выделения памяти под слайсы, когда хранилища нет
+func (q *queueImpl) pushOne(env *envelope) (string, error) {
+	if q.storage != nil {
+		if err := q.storage.save(env); err != nil {
+			q.rollbackPush(1)
+			return "", err
+		}
+	}
+	q.messages.Push(env)
+	q.counters.produced.Add(1)
+	q.counters.touch()
+	return env.id, nil
+}
+
+// push добавляет новые сообщения в конец очереди и возвращает их идентификаторы, лимиты и место в общем лимите
+// должен проверить и зарезервировать вызывающий. Очередь с хранилищем сначала сохраняет все сообщения на диск
+// и, если это не удалось, то не принимает ни одного и освобождает зарезервированное место
+func (q *queueImpl) push(spanContext trace.SpanContext, messages ...string) ([]string, error) {
+	envs := make([]*envelope, len(messages))
+	for i, message := range messages {
+		envs[i] = q.newEnvelope(message, spanContext)
+	}
+	if q.storage != nil {
+		if err := q.storage.save(envs...); err != nil {
+			q.rollbackPush(len(envs))
+			return nil, err
+		}
+	}
+	ids := make([]string, len(envs))
+	for i, env := range envs {
+		q.messages.Push(env)
+		ids[i] = env.id
+	}
+	q.counters.produced.Add(int64(len(envs)))
+	q.counters.touch()
+	return ids, nil
+}
+
+// applyPrepared резервирует место под сообщения транзакции, сохраняет их в хранилище и ждет решения транзакции.
+// Старые сообщения при этом не вытесняются даже с OverflowDropOldest, иначе откат транзакции потерял бы их
+func (q *queueImpl) applyPrepared(req *prepareRequest) {
+	n := len(req.messages)
+	q.expireMessages()
+	if q.messages.Len()+n > q.maxMessageNum || !q.budget.reserveN(n) {
+		q.counters.errors.Add(1)
+		req.prepared <- ErrTooManyItems
+		return
+	}
+	envs := make([]*envelope, n)
+	ids := make([]string, n)
+	for i, message := range req.messages {
+		envs[i] = q.newEnvelope(message, trace.SpanContext{})
+		ids[i] = envs[i].id
+	}
+	// Сообщения сохраняются до решения, чтобы фиксация уже не могла завершиться ошибкой
+	if q.storage != nil {
+		if err := q.storage.save(envs...); err != nil {
+			q.rollbackPush(n)
+			req.prepared <- err
+			return
 		}
 	}
+	req.prepared <- nil
+	if commit := <-req.decision; !commit {
+		q.forget(ids...)
+		q.lastID -= uint64(n)
+		q.budget.release(n)
+		return
+	}
+	for _, env := range envs {
+		q.messages.Push(env)
+	}
+	q.counters.produced.Add(int64(n))
+	q.counters.touch()
+	req.ids <- ids
+}
+
+// newEnvelope присваивает сообщению следующий идентификатор и запоминает спан писателя
+func (q *queueImpl) newEnvelope(message string, spanContext trace.SpanContext) *envelope {
+	q.lastID++
+	return &envelope{
+		id:          strconv.FormatUint(q.lastID, 10),
+		message:     message,
+		enqueuedAt:  time.Now(),
+		spanContext: spanContext,
+	}
+}
+
+// rollbackPush отменяет выдачу идентификаторов и резерв места под n сообщений, которые не удалось сохранить
+func (q *queueImpl) rollbackPush(n int) {
+	q.lastID -= uint64(n)
+	q.budget.release(n)
+	q.counters.errors.Add(1)
+}
+
+// forget удаляет извлеченные сообщения из хранилища, если оно есть. Ошибка только логируется:
+// сообщение уже извлечено, и худшее, что случится, - его повторная доставка после перезапуска
+func (q *queueImpl) forget(ids ...string) {
+	if q.storage == nil || len(ids) == 0 {
+		return
+	}
+	if err := q.storage.remove(ids...); err != nil {
+		errorLogger.Printf("remove messages from storage error: %v\n", err)
+	}
 }
 
-// deliverMessages доставляет сообщения в ожидающие Get запросы
+// deliverMessages доставляет сообщения в ожидающие Get запросы, а освободившееся место отдает ожидающим PutBlocking
 func (q *queueImpl) deliverMessages() {
-	for !(q.getWaitStatuses.Empty() || q.messages.Empty()) {
-		q.getWaitStatuses.Pop().msgCh <- q.messages.Pop()
+	for {
+		q.deliverToReaders()
+		// Сообщения принятых писателей могут сразу уйти ожидающим читателям, а те освободят место следующим
+		if !q.acceptWaitingPuts() || q.paused {
+			return
+		}
+	}
+}
+
+// acceptPut принимает в очередь сообщение или пакет сообщений из Put, PutBatch или PutAsync
+func (q *queueImpl) acceptPut(newMsg *messageWithConfirmation) {
+	n := 1
+	if newMsg.batch != nil {
+		n = len(newMsg.batch)
+	}
+	var err error
+	if !q.makeRoom(n) {
+		// Отказываемся принимать сообщения, чтобы не превысить лимит на число сообщений
+		// в очереди или во всех очередях. Пакет не принимается даже частично
+		err = ErrTooManyItems
+		q.counters.errors.Add(1)
+	} else if newMsg.batch != nil {
+		newMsg.ids, err = q.push(newMsg.spanContext, newMsg.batch...)
+	} else {
+		env := q.newEnvelope(newMsg.message, newMsg.spanContext)
+		env.attempts = newMsg.attempts
+		newMsg.id, err = q.pushOne(env)
+	}
+	if newMsg.async {
+		// Подтверждения никто не ждет, отказ виден только в счетчике ошибок
+		newMsg.release()
+	} else {
+		// Подтверждаем принятое сообщение
+		newMsg.confirmation <- err
+	}
+	// Доставляем сообщения
+	q.deliverMessages()
+}
+
+// acceptWaitingPuts помещает в очередь сообщения ожидающих PutBlocking, пока есть место.
+// Возвращает, принято ли хотя бы одно сообщение
+func (q *queueImpl) acceptWaitingPuts() bool {
+	accepted := false
+	for !q.putWaitStatuses.Empty() && q.hasRoom() {
+		ws := q.putWaitStatuses.Pop()
+		var err error
+		ws.id, err = q.pushOne(q.newEnvelope(ws.message, ws.spanContext))
+		ws.accepted = true
+		ws.errCh <- err
+		accepted = accepted || err == nil
+	}
+	return accepted
+}
+
+// hasRoom проверяет лимиты очереди и резервирует место под одно сообщение в общем лимите
+func (q *queueImpl) hasRoom() bool {
+	return q.makeRoom(1)
+}
+
+// makeRoom проверяет лимиты перед записью n сообщений и резервирует под них место в общем лимите.
+// С политикой OverflowDropOldest место освобождается удалением самых старых сообщений,
+// а отказ возможен, только если n больше лимита очереди или общий лимит занят другими очередями
+func (q *queueImpl) makeRoom(n int) bool {
+	q.expireMessages()
+	if q.overflowPolicy != OverflowDropOldest || n > q.maxMessageNum {
+		return q.messages.Len()+n <= q.maxMessageNum && q.budget.reserveN(n)
+	}
+	for q.messages.Len()+n > q.maxMessageNum {
+		q.dropOldest()
+	}
+	for !q.budget.reserveN(n) {
+		if q.messages.Empty() {
+			return false
+		}
+		q.dropOldest()
+	}
+	return true
+}
+
+// dropOldest удаляет сообщение из начала очереди без доставки
+func (q *queueImpl) dropOldest() {
+	env := q.messages.Pop()
+	q.forget(env.id)
+	q.budget.release(1)
+	q.counters.dropped.Add(1)
+}
+
+// expireMessages удаляет из начала очереди сообщения старше TTL. Сообщения лежат в порядке приема,
+// в том числе возвращенные в начало, поэтому достаточно проверить начало очереди
+func (q *queueImpl) expireMessages() {
+	if q.ttl <= 0 {
+		return
+	}
+	now := time.Now()
+	for !q.messages.Empty() && now.Sub(q.messages.Peek().enqueuedAt) >= q.ttl {
+		q.dropOldest()
+		q.counters.expired.Add(1)
+	}
+}
+
+// setTTL меняет TTL и перезапускает таймер проверки устаревших сообщений
+func (q *queueImpl) setTTL(ttl time.Duration) {
+	if q.ttlTicker != nil {
+		q.ttlTicker.Stop()
+		q.ttlTicker = nil
+	}
+	q.ttl = ttl
+	if ttl > 0 {
+		// Проверка дешевая, поэтому даже при большом TTL устаревшие сообщения удаляются не позже чем через секунду
+		q.ttlTicker = time.NewTicker(min(ttl, ttlCheckInterval))
+	}
+}
+
+// countFailure учитывает сообщение, не подтвержденное до истечения visibility timeout, и приостанавливает очередь,
+// если таких сообщений подряд набралось maxFailures. Ожидающие Get сразу получают ErrQueueSuspended
+func (q *queueImpl) countFailure() {
+	failures := q.failures.Add(1)
+	if q.maxFailures <= 0 || failures < int64(q.maxFailures) || q.suspended.Load() {
+		return
+	}
+	q.suspended.Store(true)
+	q.rejectReaders(ErrQueueSuspended)
+}
+
+// ttlTick возвращает канал таймера TTL, nil канал без TTL никогда не срабатывает в select
+func (q *queueImpl) ttlTick() <-chan time.Time {
+	if q.ttlTicker == nil {
+		return nil
+	}
+	return q.ttlTicker.C
+}
+
+// deliverToReaders доставляет сообщения в ожидающие Get запросы. Число доставок известно заранее,
+// поэтому общий лимит, счетчик и хранилище обновляются один раз на весь проход, а не на каждое сообщение:
+// при пакетной записи или многих ожидающих читателях журнал получает одну запись вместо записи на сообщение
+func (q *queueImpl) deliverToReaders() {
+	// Устаревшие сообщения читателям не отдаются
+	q.expireMessages()
+	if q.paused {
+		// На паузе сообщения копятся в очереди, а Get запросы ждут
+		return
+	}
+	n := min(q.getWaitStatuses.Len(), q.messages.Len())
+	if n == 0 {
+		return
+	}
+	now := time.Now()
+	var forgotten []string // сообщения без подтверждения больше не хранятся в очереди
+	if q.storage != nil {
+		forgotten = make([]string, 0, n)
+	}
+	released := 0
+	for range n {
+		// Сообщения берутся из начала очереди, а читатель - по выбору readerSelector,
+		// по умолчанию тоже из начала, поэтому порядок FIFO сохраняется
+		ws := q.getWaitStatuses.data.Remove(q.readerSelector.next(q.getWaitStatuses.data)).(*getWaitStatus)
+		env := q.messages.Pop()
+		if ws.ack {
+			q.startInFlight(env)
+		} else {
+			released++
+			if q.storage != nil {
+				forgotten = append(forgotten, env.id)
+			}
+		}
+		ws.delivered = true
+		ws.fillRatio = q.fillRatio()
+		ws.depth = q.messages.Len()
+		ws.msgCh <- env
+		q.waitLatency.observe(ws, true)
+		q.messageWait.observe(now.Sub(env.enqueuedAt))
+		q.traceDelivery(ws, env)
+	}
+	q.budget.release(released)
+	q.forget(forgotten...)
+	q.counters.consumed.Add(int64(n))
+	q.counters.touch()
+}
+
+// fillRatio возвращает отношение числа сообщений в очереди к её лимиту
+func (q *queueImpl) fillRatio() float64 {
+	if q.maxMessageNum <= 0 {
+		return 0
+	}
+	return float64(q.messages.Len()) / float64(q.maxMessageNum)
+}
+
+// startInFlight переводит сообщение в обработку до истечения visibility timeout
+func (q *queueImpl) startInFlight(env *envelope) {
+	env.deadline = time.Now().Add(q.visibilityTimeout)
+	q.inFlight[env.id] = env
+	if q.requeueTicker == nil {
+		// Таймер один на очередь вместо таймера на каждое сообщение. Проверка дешевая, поэтому сообщение
+		// возвращается не позже чем через десятую часть visibility timeout после истечения, но не реже раза в секунду
+		q.requeueTicker = time.NewTicker(max(min(q.visibilityTimeout/10, requeueCheckInterval), time.Millisecond))
+	}
+}
+
+// requeueExpired возвращает в начало очереди сообщения, у которых истек visibility timeout.
+// Сообщения ставятся в том порядке, в котором уходили в обработку, чтобы раньше выданное получили первым
+func (q *queueImpl) requeueExpired() {
+	now := time.Now()
+	var expired []*envelope
+	for id, env := range q.inFlight {
+		if now.Before(env.deadline) {
+			continue
+		}
+		delete(q.inFlight, id)
+		expired = append(expired, env)
+	}
+	// В начало ставится сначала самое позднее сообщение
+	slices.SortFunc(expired, func(a, b *envelope) int {
+		return b.deadline.Compare(a.deadline)
+	})
+	for _, env := range expired {
+		q.messages.PushFront(env)
+		// Неудачу сообщения, отклоненного через Nack, уже учел nack
+		if !env.retrying {
+			q.countFailure()
+		}
+		env.retrying = false
+	}
+	if len(q.inFlight) == 0 {
+		// Без сообщений в обработке таймер не нужен, его заново запустит startInFlight
+		q.stopRequeue()
+	}
+}
+
+// nack обрабатывает отказ от сообщения в обработке. Сообщение, исчерпавшее повторные попытки, переходит
+// в taken, сохраняя место в лимите и в хранилище до finishTake, и возвращается в req.deadLetter
+func (q *queueImpl) nack(req *nackRequest) error {
+	env, ok := q.inFlight[req.id]
+	if !ok || env.retrying {
+		return ErrMessageNotFound
+	}
+	// Отказ - такая же неудачная доставка, как истечение visibility timeout
+	q.countFailure()
+	q.counters.touch()
+	switch {
+	case !req.retry:
+		delete(q.inFlight, req.id)
+		q.messages.PushFront(env)
+	case q.maxRetries > 0 && env.attempts >= q.maxRetries:
+		delete(q.inFlight, req.id)
+		env.deadLettering = true
+		q.taken[env.id] = env
+		req.deadLetter = env
+	default:
+		// Сообщение ждет повторной попытки в обработке: его вернет тот же таймер, что и по visibility timeout
+		env.deadline = time.Now().Add(q.nackRetryDelay(env.attempts))
+		env.attempts++
+		env.retrying = true
+	}
+	if len(q.inFlight) == 0 {
+		q.stopRequeue()
+	}
+	return nil
+}
+
+// nackRetryDelay возвращает задержку повторной попытки после attempt уже сделанных: retryDelay,
+// удваиваемую на каждую попытку, но не больше maxNackRetryDelay
+func (q *queueImpl) nackRetryDelay(attempt int) time.Duration {
+	delay := q.retryDelay
+	for range attempt {
+		if delay >= maxNackRetryDelay {
+			break
+		}
+		delay *= 2
+	}
+	return min(delay, maxNackRetryDelay)
+}
+
+// stopRequeue останавливает таймер проверки visibility timeout
+func (q *queueImpl) stopRequeue() {
+	if q.requeueTicker != nil {
+		q.requeueTicker.Stop()
+		q.requeueTicker = nil
+	}
+}
+
+// requeueTick возвращает канал таймера visibility timeout, nil канал без сообщений в обработке никогда не срабатывает в select
+func (q *queueImpl) requeueTick() <-chan time.Time {
+	if q.requeueTicker == nil {
+		return nil
 	}
+	return q.requeueTicker.C
 }
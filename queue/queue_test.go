@@ -4,6 +4,9 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"path/filepath"
+	"runtime"
+	"slices"
 	"sync"
 	"sync/atomic"
 	"testing"
@@ -17,16 +20,16 @@ import (
 // Операции выполняются последовательно в одной горутине
 func TestQueueBasic(t *testing.T) {
 	const N = 10
-	q := newQueue(N)
+	q := newQueue(queueConfig{maxMessageNum: N})
 	defer q.Stop()
 
 	for i := range N {
-		err := q.Put(fmt.Sprintf("message%d", i))
+		_, err := q.Put(context.Background(), fmt.Sprintf("message%d", i))
 		if err != nil {
 			t.Errorf("Unexpected exception: %v", err)
 		}
 	}
-	err := q.Put("some_more_message")
+	_, err := q.Put(context.Background(), "some_more_message")
 	if !errors.Is(err, ErrTooManyItems) {
 		t.Errorf("wrong error: got [%v] want [%v]", err, ErrTooManyItems)
 	}
@@ -38,23 +41,23 @@ func TestQueueBasic(t *testing.T) {
 			t.Errorf("Unexpected exception: %v", err)
 		}
 		expectedMessage := fmt.Sprintf("message%d", i)
-		if message != expectedMessage {
-			t.Errorf("wrong message: got [%v] want [%v]", message, expectedMessage)
+		if message.Body != expectedMessage {
+			t.Errorf("wrong message: got [%v] want [%v]", message.Body, expectedMessage)
 		}
 	}
 	message, err := q.Get(ctx)
 	if !errors.Is(err, ErrNoMessage) {
 		t.Errorf("wrong error: got [%v] want [%v]", err, ErrNoMessage)
 	}
-	if message != "" {
-		t.Errorf("message expected to be empty but got [%v]", message)
+	if message.Body != "" {
+		t.Errorf("message expected to be empty but got [%v]", message.Body)
 	}
 }
 
 func TestQueueMultiGorutine(t *testing.T) {
 	var mutex sync.Mutex
 	var counter atomic.Int32
-	var errValue atomic.Value
+	var putNum, getNum atomic.Int32
 	const M = 5
 	const N = 10_000
 	messages := make(map[string]int, N*M) // надо заранее подготовиться вместить в мапу все сообщения
@@ -62,35 +65,40 @@ func TestQueueMultiGorutine(t *testing.T) {
 		// фиксируем ожидаемые сообщения
 		messages[fmt.Sprintf("message%d", i+1)] = 1
 	}
-	q := newQueueImpl(N * M)
+	q := newQueueImpl(queueConfig{maxMessageNum: N * M})
 	defer q.Stop()
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 	var wg sync.WaitGroup
 	writer := func() {
+		defer wg.Done()
 		for range N {
 			i := counter.Add(1)
-			err := q.Put(fmt.Sprintf("message%d", i))
-			if err != nil && errValue.Load() != nil {
-				errValue.Store(err)
+			if _, err := q.Put(context.Background(), fmt.Sprintf("message%d", i)); err != nil {
+				// Лимит очереди вмещает все сообщения, поэтому любая ошибка - это дефект
+				t.Errorf("Unexpected Put error: %v", err)
+				return
 			}
+			putNum.Add(1)
 		}
-		wg.Done()
 	}
 	reader := func() {
+		defer wg.Done()
 		for range N {
 			message, err := q.Get(ctx)
-			if err != nil && errValue.Load() != nil {
-				errValue.Store(err)
+			if err != nil {
+				// Ошибка означает, что сообщение потеряно: все N*M сообщений должны дойти за время ctx
+				t.Errorf("Unexpected Get error: %v", err)
+				return
 			}
+			getNum.Add(1)
 			mutex.Lock()
 			// Отмечаем прочитанное сообщение инкрементом
 			// Изначально для каждого соообщения в мапу была записана 1
 			// Каждое сообщение должно быть прочитано один раз, то есть в мапу будут записаны 2
-			messages[message]++
+			messages[message.Body]++
 			mutex.Unlock()
 		}
-		wg.Done()
 	}
 	wg.Add(2 * M)
 	for range M {
@@ -98,10 +106,10 @@ func TestQueueMultiGorutine(t *testing.T) {
 		go reader()
 	}
 	wg.Wait()
-	if v := errValue.Load(); v != nil {
-		t.Logf("Unexpected error: %v", v)
-	}
 	q.Stop()
+	if putNum.Load() != N*M || getNum.Load() != putNum.Load() {
+		t.Errorf("Unexpected Put and Get number: puts %v gets %v want %v", putNum.Load(), getNum.Load(), N*M)
+	}
 	if len(messages) != N*M {
 		// Убедимся, что не были прочитаны незапланированые сообщения
 		t.Errorf("Unexpected message number: got %v want %v", len(messages), N*M)
@@ -112,3 +120,1383 @@ func TestQueueMultiGorutine(t *testing.T) {
 		}
 	}
 }
+
+// TestQueueGetTimeoutNoLoss проверяет, что сообщение, доставленное одновременно с истечением контекста Get,
+// не теряется: оно либо возвращается из Get, либо остается в очереди
+func TestQueueGetTimeoutNoLoss(t *testing.T) {
+	const N = 5000
+	q := newQueueImpl(queueConfig{maxMessageNum: N})
+	defer q.Stop()
+
+	var getNum atomic.Int32
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		for i := range N {
+			if _, err := q.Put(context.Background(), fmt.Sprintf("message%d", i)); err != nil {
+				t.Errorf("Unexpected Put error: %v", err)
+				return
+			}
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for range N {
+			// Таймаут порядка времени доставки, чтобы истечение контекста пересекалось с доставкой
+			ctx, cancel := context.WithTimeout(context.Background(), time.Microsecond)
+			if _, err := q.Get(ctx); err == nil {
+				getNum.Add(1)
+			} else if !errors.Is(err, ErrNoMessage) {
+				t.Errorf("Unexpected Get error: %v", err)
+			}
+			cancel()
+		}
+	}()
+	wg.Wait()
+	// Дочитываем оставшиеся сообщения
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	for {
+		if _, err := q.Get(ctx); err != nil {
+			break
+		}
+		getNum.Add(1)
+	}
+	if getNum.Load() != N {
+		t.Errorf("Unexpected Get number: got %v want %v", getNum.Load(), N)
+	}
+}
+
+// TestQueuePauseResume проверяет, что Get, запрошенный до паузы, не получает сообщение,
+// пока очередь на паузе, и получает его после Resume
+func TestQueuePauseResume(t *testing.T) {
+	q := newQueue(queueConfig{maxMessageNum: 10})
+	defer q.Stop()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	type result struct {
+		message string
+		err     error
+	}
+	resultCh := make(chan result, 1)
+	go func() {
+		message, err := q.Get(ctx)
+		resultCh <- result{message.Body, err}
+	}()
+	// Даём Get встать в очередь на ожидание до паузы
+	time.Sleep(100 * time.Millisecond)
+	q.Pause()
+	if _, err := q.Put(context.Background(), "message"); err != nil {
+		t.Fatalf("Unexpected exception: %v", err)
+	}
+	select {
+	case res := <-resultCh:
+		t.Fatalf("Get is expected to be blocked on paused queue but got [%v] [%v]", res.message, res.err)
+	case <-time.After(200 * time.Millisecond):
+	}
+	q.Resume()
+	select {
+	case res := <-resultCh:
+		if res.err != nil {
+			t.Errorf("Unexpected exception: %v", res.err)
+		}
+		if res.message != "message" {
+			t.Errorf("wrong message: got [%v] want [%v]", res.message, "message")
+		}
+	case <-time.After(time.Second):
+		t.Errorf("Get is expected to be unblocked by Resume")
+	}
+}
+
+// TestQueueRestart проверяет, что перезапуск сохраняет сообщения, в том числе в обработке, а ожидающий Get
+// получает ошибку остановки и может повторить запрос
+func TestQueueRestart(t *testing.T) {
+	q := newQueue(queueConfig{maxMessageNum: 10, visibilityTimeout: time.Minute})
+	defer q.Stop()
+
+	for _, message := range []string{"message0", "message1"} {
+		if _, err := q.Put(context.Background(), message); err != nil {
+			t.Fatalf("Unexpected exception: %v", err)
+		}
+	}
+	inFlight, err := q.GetAck(context.Background())
+	if err != nil {
+		t.Fatalf("Unexpected exception: %v", err)
+	}
+	q.Pause()
+	errCh := make(chan error, 1)
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+		defer cancel()
+		_, err := q.Get(ctx)
+		errCh <- err
+	}()
+	// Даём Get встать в очередь на ожидание до перезапуска
+	time.Sleep(100 * time.Millisecond)
+	if err := q.Restart(context.Background()); err != nil {
+		t.Fatalf("Unexpected exception: %v", err)
+	}
+	select {
+	case err := <-errCh:
+		if !errors.Is(err, ErrShuttingDown) {
+			t.Errorf("wrong error: got [%v] want [%v]", err, ErrShuttingDown)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("waiting Get is not rejected by Restart")
+	}
+	// Пауза пережила перезапуск, поэтому сообщение всё ещё в очереди
+	if messages := q.Snapshot(); !slices.Equal(messages, []string{"message1"}) {
+		t.Errorf("wrong messages: got %v want [message1]", messages)
+	}
+	q.Resume()
+	if err := q.Ack(inFlight.ID); err != nil {
+		t.Errorf("Unexpected exception at Ack: %v", err)
+	}
+	if message, err := q.Get(context.Background()); err != nil || message.Body != "message1" {
+		t.Errorf("wrong Get: got [%v] [%v] want [message1]", message.Body, err)
+	}
+
+	q.Stop()
+	if err := q.Restart(context.Background()); !errors.Is(err, ErrShuttingDown) {
+		t.Errorf("wrong error: got [%v] want [%v]", err, ErrShuttingDown)
+	}
+}
+
+// TestQueueRestartConcurrent проверяет, что Put и Get, идущие во время перезапусков, не теряют сообщений:
+// писатели не получают ошибок, а читатели повторяют Get, отклоненный перезапуском
+func TestQueueRestartConcurrent(t *testing.T) {
+	const N = 200
+	q := newQueue(queueConfig{maxMessageNum: 2 * N})
+	defer q.Stop()
+
+	var wg sync.WaitGroup
+	for range 2 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range N {
+				if _, err := q.Put(context.Background(), fmt.Sprintf("message%d", i)); err != nil {
+					t.Errorf("Unexpected exception at Put: %v", err)
+				}
+			}
+		}()
+	}
+	var received atomic.Int64
+	for range 2 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for received.Load() < 2*N {
+				ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+				_, err := q.Get(ctx)
+				cancel()
+				if err == nil {
+					received.Add(1)
+				} else if !errors.Is(err, ErrShuttingDown) && !errors.Is(err, ErrNoMessage) {
+					t.Errorf("Unexpected exception at Get: %v", err)
+					return
+				}
+			}
+		}()
+	}
+	for range 10 {
+		if err := q.Restart(context.Background()); err != nil {
+			t.Fatalf("Unexpected exception at Restart: %v", err)
+		}
+		time.Sleep(time.Millisecond)
+	}
+	wg.Wait()
+	if n := received.Load(); n != 2*N {
+		t.Errorf("wrong received messages number: got %v want %v", n, 2*N)
+	}
+}
+
+// TestQueuePauseFlush проверяет, что на паузе очередь принимает сообщения, а Get их не получает,
+// и что после Resume все накопленные сообщения доставляются по порядку
+func TestQueuePauseFlush(t *testing.T) {
+	const N = 3
+	q := newQueue(queueConfig{maxMessageNum: 10})
+	defer q.Stop()
+
+	q.Pause()
+	for i := range N {
+		if _, err := q.Put(context.Background(), fmt.Sprintf("message%d", i)); err != nil {
+			t.Fatalf("Unexpected exception: %v", err)
+		}
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	if _, err := q.Get(ctx); !errors.Is(err, ErrNoMessage) {
+		t.Errorf("wrong error on paused queue: got [%v] want [%v]", err, ErrNoMessage)
+	}
+	q.Resume()
+	ctx, cancel = context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	for i := range N {
+		message, err := q.Get(ctx)
+		if err != nil {
+			t.Errorf("Unexpected exception: %v", err)
+		}
+		if expected := fmt.Sprintf("message%d", i); message.Body != expected {
+			t.Errorf("wrong message: got [%s] want [%s]", message.Body, expected)
+		}
+	}
+}
+
+// TestQueueEnqueuedAt проверяет, что сообщение хранит момент приема и его возраст растет, пока оно ждет в очереди
+func TestQueueEnqueuedAt(t *testing.T) {
+	q := newQueue(queueConfig{maxMessageNum: 10})
+	defer q.Stop()
+
+	before := time.Now()
+	for _, message := range []string{"message1", "message2"} {
+		if _, err := q.Put(context.Background(), message); err != nil {
+			t.Fatalf("Unexpected exception: %v", err)
+		}
+	}
+	after := time.Now()
+	var ages []time.Duration
+	for range 2 {
+		time.Sleep(50 * time.Millisecond)
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		message, err := q.Get(ctx)
+		cancel()
+		if err != nil {
+			t.Fatalf("Unexpected exception: %v", err)
+		}
+		if message.EnqueuedAt.Before(before) || message.EnqueuedAt.After(after) {
+			t.Errorf("wrong enqueue time: got [%v] want between [%v] and [%v]", message.EnqueuedAt, before, after)
+		}
+		ages = append(ages, time.Since(message.EnqueuedAt))
+	}
+	// Второе сообщение пролежало в очереди дольше на время ожидания перед вторым Get
+	if ages[0] < 50*time.Millisecond || ages[1] < ages[0]+50*time.Millisecond {
+		t.Errorf("wrong message ages: got %v", ages)
+	}
+}
+
+// TestQueueAck проверяет, что подтвержденное сообщение удаляется из очереди окончательно
+func TestQueueAck(t *testing.T) {
+	q := newQueue(queueConfig{maxMessageNum: 10, visibilityTimeout: time.Minute})
+	defer q.Stop()
+
+	if _, err := q.Put(context.Background(), "message"); err != nil {
+		t.Fatalf("Unexpected exception: %v", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	message, err := q.GetAck(ctx)
+	if err != nil {
+		t.Fatalf("Unexpected exception: %v", err)
+	}
+	if message.Body != "message" {
+		t.Errorf("wrong message: got [%v] want [%v]", message.Body, "message")
+	}
+	if stats := q.Stats(); stats.Depth != 0 || stats.InFlight != 1 {
+		t.Errorf("wrong stats after GetAck: %+v", stats)
+	}
+	if err := q.Ack(message.ID); err != nil {
+		t.Errorf("Unexpected exception: %v", err)
+	}
+	if stats := q.Stats(); stats.Depth != 0 || stats.InFlight != 0 {
+		t.Errorf("wrong stats after Ack: %+v", stats)
+	}
+	if err := q.Ack(message.ID); !errors.Is(err, ErrMessageNotFound) {
+		t.Errorf("wrong error: got [%v] want [%v]", err, ErrMessageNotFound)
+	}
+	if _, err := q.Get(ctx); !errors.Is(err, ErrNoMessage) {
+		t.Errorf("wrong error: got [%v] want [%v]", err, ErrNoMessage)
+	}
+}
+
+// TestQueueNack проверяет, что сообщение после Nack без retry сразу возвращается в очередь,
+// а с retry - только после задержки, и до неё не может быть подтверждено
+func TestQueueNack(t *testing.T) {
+	q := newQueue(queueConfig{maxMessageNum: 10, visibilityTimeout: 100 * time.Millisecond, retryDelay: 50 * time.Millisecond})
+	defer q.Stop()
+
+	if _, err := q.Put(context.Background(), "message"); err != nil {
+		t.Fatalf("Unexpected exception: %v", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	message, err := q.GetAck(ctx)
+	if err != nil {
+		t.Fatalf("Unexpected exception: %v", err)
+	}
+	if _, err := q.Nack(message.ID, false); err != nil {
+		t.Fatalf("Unexpected exception: %v", err)
+	}
+	if stats := q.Stats(); stats.Depth != 1 || stats.InFlight != 0 {
+		t.Errorf("wrong stats after nack: %+v", stats)
+	}
+
+	message, err = q.GetAck(ctx)
+	if err != nil {
+		t.Fatalf("Unexpected exception: %v", err)
+	}
+	start := time.Now()
+	if _, err := q.Nack(message.ID, true); err != nil {
+		t.Fatalf("Unexpected exception: %v", err)
+	}
+	if err := q.Ack(message.ID); !errors.Is(err, ErrMessageNotFound) {
+		t.Errorf("wrong Ack error: got [%v] want [%v]", err, ErrMessageNotFound)
+	}
+	if _, err := q.Nack(message.ID, true); !errors.Is(err, ErrMessageNotFound) {
+		t.Errorf("wrong Nack error: got [%v] want [%v]", err, ErrMessageNotFound)
+	}
+	message, err = q.GetAck(ctx)
+	if err != nil {
+		t.Fatalf("Unexpected exception: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed < 50*time.Millisecond {
+		t.Errorf("message returned before retry delay: %v", elapsed)
+	}
+	if message.Attempts != 1 {
+		t.Errorf("wrong attempts: got %v want 1", message.Attempts)
+	}
+	if err := q.Ack(message.ID); err != nil {
+		t.Errorf("Unexpected exception: %v", err)
+	}
+}
+
+func TestQueueNackRetryDelay(t *testing.T) {
+	q := makeQueueImpl(queueConfig{maxMessageNum: 1, retryDelay: time.Second})
+	for attempt, expected := range []time.Duration{time.Second, 2 * time.Second, 4 * time.Second} {
+		if delay := q.nackRetryDelay(attempt); delay != expected {
+			t.Errorf("wrong delay for attempt %d: got %v want %v", attempt, delay, expected)
+		}
+	}
+	if delay := q.nackRetryDelay(100); delay != maxNackRetryDelay {
+		t.Errorf("wrong capped delay: got %v want %v", delay, maxNackRetryDelay)
+	}
+}
+
+// TestQueueAckVisibilityTimeout проверяет, что неподтвержденное сообщение после visibility timeout
+// возвращается в начало очереди
+func TestQueueAckVisibilityTimeout(t *testing.T) {
+	q := newQueue(queueConfig{maxMessageNum: 10, visibilityTimeout: 100 * time.Millisecond})
+	defer q.Stop()
+
+	for _, message := range []string{"message1", "message2"} {
+		if _, err := q.Put(context.Background(), message); err != nil {
+			t.Fatalf("Unexpected exception: %v", err)
+		}
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+	defer cancel()
+	message, err := q.GetAck(ctx)
+	if err != nil {
+		t.Fatalf("Unexpected exception: %v", err)
+	}
+	if message.Body != "message1" {
+		t.Errorf("wrong message: got [%v] want [%v]", message.Body, "message1")
+	}
+	time.Sleep(200 * time.Millisecond)
+	if err := q.Ack(message.ID); !errors.Is(err, ErrMessageNotFound) {
+		t.Errorf("wrong error: got [%v] want [%v]", err, ErrMessageNotFound)
+	}
+	for _, expectedMessage := range []string{"message1", "message2"} {
+		message, err := q.Get(ctx)
+		if err != nil {
+			t.Errorf("Unexpected exception: %v", err)
+		}
+		if message.Body != expectedMessage {
+			t.Errorf("wrong message: got [%v] want [%v]", message.Body, expectedMessage)
+		}
+	}
+}
+
+// TestQueueRequeueWaiting проверяет, что ожидающий Get получает сообщения после истечения их visibility timeout
+// в том порядке, в котором они уходили в обработку
+func TestQueueRequeueWaiting(t *testing.T) {
+	const visibilityTimeout = 50 * time.Millisecond
+	q := newQueue(queueConfig{maxMessageNum: 10, visibilityTimeout: visibilityTimeout})
+	defer q.Stop()
+
+	messages := []string{"message1", "message2", "message3"}
+	for _, message := range messages {
+		if _, err := q.Put(context.Background(), message); err != nil {
+			t.Fatalf("Unexpected exception: %v", err)
+		}
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+	defer cancel()
+	for range messages {
+		if _, err := q.GetAck(ctx); err != nil {
+			t.Fatalf("Unexpected exception: %v", err)
+		}
+	}
+	// Очередь пуста, поэтому Get ждет, пока сообщения вернутся из обработки
+	start := time.Now()
+	for _, expectedMessage := range messages {
+		message, err := q.Get(ctx)
+		if err != nil {
+			t.Fatalf("Unexpected exception: %v", err)
+		}
+		if message.Body != expectedMessage {
+			t.Errorf("wrong message: got [%v] want [%v]", message.Body, expectedMessage)
+		}
+	}
+	if elapsed := time.Since(start); elapsed >= 10*visibilityTimeout {
+		t.Errorf("messages requeued too late: %v", elapsed)
+	}
+	if stats := q.Stats(); stats.InFlight != 0 {
+		t.Errorf("wrong in flight: got %v want 0", stats.InFlight)
+	}
+}
+
+// TestQueueSuspend проверяет, что очередь приостанавливается после maxFailures неподтвержденных сообщений подряд,
+// подтверждение прерывает серию, а Unsuspend возобновляет выдачу
+func TestQueueSuspend(t *testing.T) {
+	const visibilityTimeout = 50 * time.Millisecond
+	q := newQueue(queueConfig{maxMessageNum: 10, visibilityTimeout: visibilityTimeout, maxFailures: 2})
+	defer q.Stop()
+	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+	defer cancel()
+	if _, err := q.Put(ctx, "message"); err != nil {
+		t.Fatalf("Unexpected exception: %v", err)
+	}
+	// expire получает сообщение и не подтверждает его, дожидаясь возврата в очередь
+	expire := func() {
+		t.Helper()
+		if _, err := q.GetAck(ctx); err != nil {
+			t.Fatalf("Unexpected exception: %v", err)
+		}
+		time.Sleep(2 * visibilityTimeout)
+	}
+
+	// Подтверждение сбрасывает счетчик, поэтому две неудачи не подряд очередь не приостанавливают
+	expire()
+	message, err := q.GetAck(ctx)
+	if err != nil {
+		t.Fatalf("Unexpected exception: %v", err)
+	}
+	if err := q.Ack(message.ID); err != nil {
+		t.Fatalf("Unexpected exception: %v", err)
+	}
+	if _, err := q.Put(ctx, "message"); err != nil {
+		t.Fatalf("Unexpected exception: %v", err)
+	}
+	expire()
+	if q.Suspended() {
+		t.Fatal("queue suspended after failures interrupted by Ack")
+	}
+
+	expire()
+	if !q.Suspended() || !q.Stats().Suspended {
+		t.Fatal("queue not suspended after consecutive failures")
+	}
+	if _, err := q.Get(ctx); !errors.Is(err, ErrQueueSuspended) {
+		t.Errorf("wrong error: got [%v] want [%v]", err, ErrQueueSuspended)
+	}
+	// Ожидающий Get получает ошибку, как только очередь приостанавливается снова
+	q.Unsuspend()
+	expire()
+	if _, err := q.GetAck(ctx); err != nil {
+		t.Fatalf("Unexpected exception: %v", err)
+	}
+	errCh := make(chan error, 1)
+	go func() {
+		_, err := q.Get(ctx)
+		errCh <- err
+	}()
+	time.Sleep(2 * visibilityTimeout)
+	if err := <-errCh; !errors.Is(err, ErrQueueSuspended) {
+		t.Errorf("wrong error: got [%v] want [%v]", err, ErrQueueSuspended)
+	}
+}
+
+func TestListAdapterRemoveAll(t *testing.T) {
+	testCases := []struct {
+		description string
+		n           int
+	}{
+		{description: "Empty", n: 0},
+		{description: "One element", n: 1},
+		{description: "Many elements", n: 100},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			a := newListAdapter[int]()
+			for i := range tc.n {
+				a.Push(i)
+			}
+			if n := a.RemoveAll(); n != tc.n {
+				t.Errorf("wrong removed number: got %v want %v", n, tc.n)
+			}
+			if !a.Empty() || a.Len() != 0 {
+				t.Errorf("list is not empty: %v elements", a.Len())
+			}
+			// Список после очистки работает как новый
+			a.Push(42)
+			if v := a.Pop(); v != 42 || !a.Empty() {
+				t.Errorf("wrong list after RemoveAll: got %v, %v elements left", v, a.Len())
+			}
+		})
+	}
+}
+
+// TestQueueStats проверяет, что счетчики статистики соответствуют числу выполненных операций
+func TestQueueStats(t *testing.T) {
+	const N = 5
+	q := newQueue(queueConfig{maxMessageNum: N, visibilityTimeout: time.Minute})
+	defer q.Stop()
+
+	for i := range N {
+		if _, err := q.Put(context.Background(), fmt.Sprintf("message%d", i)); err != nil {
+			t.Errorf("Unexpected exception: %v", err)
+		}
+	}
+	// Сообщение сверх лимита отклоняется
+	if _, err := q.Put(context.Background(), "some_more_message"); !errors.Is(err, ErrTooManyItems) {
+		t.Errorf("wrong error: got [%v] want [%v]", err, ErrTooManyItems)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	for range N - 1 {
+		if _, err := q.Get(ctx); err != nil {
+			t.Errorf("Unexpected exception: %v", err)
+		}
+	}
+	if _, err := q.GetAck(ctx); err != nil {
+		t.Errorf("Unexpected exception: %v", err)
+	}
+	// Get из пустой очереди не дожидается сообщения
+	if _, err := q.Get(ctx); !errors.Is(err, ErrNoMessage) {
+		t.Errorf("wrong error: got [%v] want [%v]", err, ErrNoMessage)
+	}
+	expected := QueueStats{Depth: 0, InFlight: 1, Produced: N, Consumed: N, Errors: 2}
+	// Моменты создания и активности проверяет TestQueueActivity
+	stats := q.Stats()
+	stats.CreatedAt, stats.LastActivityAt = time.Time{}, time.Time{}
+	if stats != expected {
+		t.Errorf("wrong stats: got %+v want %+v", stats, expected)
+	}
+}
+
+// TestQueueStatsWaiting проверяет, что число ожидающих Get можно читать из других горутин, пока dispatch
+// меняет список ожидающих, запуск с -race ловит обращения к самому списку
+func TestQueueStatsWaiting(t *testing.T) {
+	const N = 20
+	q := newQueue(queueConfig{maxMessageNum: N})
+	defer q.Stop()
+
+	done := make(chan struct{})
+	readerDone := make(chan struct{})
+	go func() {
+		defer close(readerDone)
+		for {
+			select {
+			case <-done:
+				return
+			default:
+			}
+			if waiting := q.Stats().Waiting; waiting < 0 || waiting > N {
+				t.Errorf("wrong waiting: got %v want from 0 to %v", waiting, N)
+				return
+			}
+		}
+	}()
+	var wg sync.WaitGroup
+	for range N {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+			defer cancel()
+			if _, err := q.Get(ctx); err != nil {
+				t.Errorf("Unexpected exception: %v", err)
+			}
+		}()
+	}
+	deadline := time.Now().Add(time.Second)
+	for q.Stats().Waiting != N && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if waiting := q.Stats().Waiting; waiting != N {
+		t.Errorf("wrong waiting: got %v want %v", waiting, N)
+	}
+	for i := range N {
+		if _, err := q.Put(context.Background(), fmt.Sprintf("message%d", i)); err != nil {
+			t.Errorf("Unexpected exception: %v", err)
+		}
+	}
+	wg.Wait()
+	close(done)
+	<-readerDone
+	if waiting := q.Stats().Waiting; waiting != 0 {
+		t.Errorf("wrong waiting after delivery: got %v want 0", waiting)
+	}
+}
+
+// TestQueueActivity проверяет, что момент последней активности сдвигается при Put, Get и Ack,
+// а момент создания не меняется
+func TestQueueActivity(t *testing.T) {
+	const delay = 10 * time.Millisecond
+	before := time.Now()
+	q := newQueue(queueConfig{maxMessageNum: 10, visibilityTimeout: time.Minute})
+	defer q.Stop()
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	created := q.Stats()
+	if created.CreatedAt.Before(before.Round(0)) || created.CreatedAt.After(time.Now()) {
+		t.Errorf("wrong CreatedAt: got %v, queue created after %v", created.CreatedAt, before)
+	}
+	if !created.LastActivityAt.Equal(created.CreatedAt) {
+		t.Errorf("wrong LastActivityAt of new queue: got %v want %v", created.LastActivityAt, created.CreatedAt)
+	}
+	testCases := []struct {
+		description string
+		operation   func() error
+	}{
+		{
+			description: "Put",
+			operation: func() error {
+				_, err := q.Put(ctx, "message1")
+				return err
+			},
+		},
+		{
+			description: "Get",
+			operation: func() error {
+				_, err := q.Get(ctx)
+				return err
+			},
+		},
+		{
+			description: "Ack",
+			operation: func() error {
+				if _, err := q.Put(ctx, "message2"); err != nil {
+					return err
+				}
+				message, err := q.GetAck(ctx)
+				if err != nil {
+					return err
+				}
+				time.Sleep(delay)
+				last := q.Stats().LastActivityAt
+				if err := q.Ack(message.ID); err != nil {
+					return err
+				}
+				if !q.Stats().LastActivityAt.After(last) {
+					return fmt.Errorf("LastActivityAt %v not changed by Ack", last)
+				}
+				return nil
+			},
+		},
+	}
+	last := created.LastActivityAt
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			time.Sleep(delay)
+			if err := tc.operation(); err != nil {
+				t.Fatalf("Unexpected exception: %v", err)
+			}
+			stats := q.Stats()
+			if !stats.LastActivityAt.After(last) {
+				t.Errorf("LastActivityAt not changed: got %v, previous %v", stats.LastActivityAt, last)
+			}
+			if !stats.CreatedAt.Equal(created.CreatedAt) {
+				t.Errorf("CreatedAt changed: got %v want %v", stats.CreatedAt, created.CreatedAt)
+			}
+			last = stats.LastActivityAt
+		})
+	}
+	// Get без сообщения активностью не считается
+	time.Sleep(delay)
+	if _, err := q.Get(ctx); !errors.Is(err, ErrNoMessage) {
+		t.Errorf("wrong error: got [%v] want [%v]", err, ErrNoMessage)
+	}
+	if stats := q.Stats(); !stats.LastActivityAt.Equal(last) {
+		t.Errorf("LastActivityAt changed by empty Get: got %v want %v", stats.LastActivityAt, last)
+	}
+}
+
+// BenchmarkQueuePut измеряет Put в очередь без читателей, с -benchmem видно число аллокаций на Put
+// TestQueueResize проверяет, что после увеличения лимита через UpdateConfig заполненная очередь принимает новые сообщения,
+// а уменьшить лимит ниже текущей глубины нельзя
+func TestQueueResize(t *testing.T) {
+	const N = 3
+	q := newQueue(queueConfig{maxMessageNum: N})
+	defer q.Stop()
+
+	for i := range N {
+		if _, err := q.Put(context.Background(), fmt.Sprintf("message%d", i)); err != nil {
+			t.Errorf("Unexpected exception: %v", err)
+		}
+	}
+	if _, err := q.Put(context.Background(), "some_more_message"); !errors.Is(err, ErrTooManyItems) {
+		t.Errorf("wrong error: got [%v] want [%v]", err, ErrTooManyItems)
+	}
+	if err := q.UpdateConfig(QueueConfig{MaxMessageNum: N - 1}); !errors.Is(err, ErrTooManyItems) {
+		t.Errorf("wrong error: got [%v] want [%v]", err, ErrTooManyItems)
+	}
+	if err := q.UpdateConfig(QueueConfig{MaxMessageNum: 2 * N}); err != nil {
+		t.Errorf("Unexpected exception: %v", err)
+	}
+	for i := N; i < 2*N; i++ {
+		if _, err := q.Put(context.Background(), fmt.Sprintf("message%d", i)); err != nil {
+			t.Errorf("Unexpected exception: %v", err)
+		}
+	}
+	if _, err := q.Put(context.Background(), "some_more_message"); !errors.Is(err, ErrTooManyItems) {
+		t.Errorf("wrong error: got [%v] want [%v]", err, ErrTooManyItems)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	for i := range 2 * N {
+		message, err := q.Get(ctx)
+		if err != nil {
+			t.Errorf("Unexpected exception: %v", err)
+		}
+		if expected := fmt.Sprintf("message%d", i); message.Body != expected {
+			t.Errorf("wrong message: got [%s] want [%s]", message.Body, expected)
+		}
+	}
+}
+
+// TestQueueStopWithWaitingGets проверяет, что Stop освобождает все Get, ожидающие сообщения
+func TestQueueStopWithWaitingGets(t *testing.T) {
+	const N = 1000
+	q := newQueueImpl(queueConfig{maxMessageNum: N})
+
+	var wg sync.WaitGroup
+	var stoppedNum atomic.Int32
+	for range N {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := q.Get(context.Background()); errors.Is(err, ErrShuttingDown) {
+				stoppedNum.Add(1)
+			} else {
+				t.Errorf("wrong error: got [%v] want [%v]", err, ErrShuttingDown)
+			}
+		}()
+	}
+	// Часть Get успевает встать в очередь ожидания, часть встретит уже остановленную очередь
+	time.Sleep(10 * time.Millisecond)
+	q.Stop()
+
+	finished := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(finished)
+	}()
+	select {
+	case <-finished:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Get calls are blocked after Stop: %d of %d returned", stoppedNum.Load(), N)
+	}
+}
+
+// TestQueueMaxWaiters проверяет, что Get сверх лимита ожидающих сразу получает ErrTooManyWaiters,
+// а уже ожидающие Get продолжают получать сообщения
+func TestQueueMaxWaiters(t *testing.T) {
+	const W = 10
+	q := newQueue(queueConfig{maxMessageNum: W, maxWaiters: W})
+	defer q.Stop()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	var wg sync.WaitGroup
+	for range W {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := q.Get(ctx); err != nil {
+				t.Errorf("Unexpected exception: %v", err)
+			}
+		}()
+	}
+	// Даем ожидающим Get встать в список ожидания
+	time.Sleep(50 * time.Millisecond)
+
+	start := time.Now()
+	if _, err := q.Get(ctx); !errors.Is(err, ErrTooManyWaiters) {
+		t.Errorf("wrong error: got [%v] want [%v]", err, ErrTooManyWaiters)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Get over the limit is rejected too slow: %v", elapsed)
+	}
+	for i := range W {
+		if _, err := q.Put(context.Background(), fmt.Sprintf("message%d", i)); err != nil {
+			t.Errorf("Unexpected exception: %v", err)
+		}
+	}
+	wg.Wait()
+}
+
+// TestQueueGetCancelCause проверяет, что истечение срока контекста и его отмена вызывающим
+// возвращают разные ошибки
+func TestQueueGetCancelCause(t *testing.T) {
+	q := newQueue(queueConfig{maxMessageNum: 1})
+	defer q.Stop()
+
+	testCases := []struct {
+		description string
+		newContext  func() (context.Context, context.CancelFunc)
+		err         error
+	}{
+		{
+			description: "Deadline exceeded",
+			newContext: func() (context.Context, context.CancelFunc) {
+				return context.WithTimeout(context.Background(), 10*time.Millisecond)
+			},
+			err: ErrNoMessage,
+		},
+		{
+			description: "Canceled by caller",
+			newContext: func() (context.Context, context.CancelFunc) {
+				ctx, cancel := context.WithCancel(context.Background())
+				time.AfterFunc(10*time.Millisecond, cancel)
+				return ctx, cancel
+			},
+			err: ErrCanceled,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			ctx, cancel := tc.newContext()
+			defer cancel()
+			if _, err := q.Get(ctx); !errors.Is(err, tc.err) {
+				t.Errorf("wrong error: got [%v] want [%v]", err, tc.err)
+			}
+		})
+	}
+}
+
+// TestQueuePutCanceled проверяет, что Put не блокируется навсегда, если диспетчер не принимает сообщение
+func TestQueuePutCanceled(t *testing.T) {
+	// Очередь без горутины диспетчера никогда не примет сообщение
+	q := &queueImpl{
+		messageCh: make(chan *messageWithConfirmation),
+		done:      make(chan struct{}),
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := q.Put(ctx, "message"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("wrong error: got [%v] want [%v]", err, context.DeadlineExceeded)
+	}
+}
+
+func BenchmarkQueuePut(b *testing.B) {
+	q := newQueue(queueConfig{maxMessageNum: b.N})
+	defer q.Stop()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for range b.N {
+		if _, err := q.Put(context.Background(), "message"); err != nil {
+			b.Fatalf("Unexpected exception: %v", err)
+		}
+	}
+}
+
+// BenchmarkQueueWaitingGets измеряет раунд из G читателей, ожидающих сообщения с таймаутом, и G Put.
+// Метрика goroutines - число горутин перед Put: на каждого читателя приходится одна его горутина,
+// а горутины отслеживания контекста не создаются, пока контекст не завершен
+func BenchmarkQueueWaitingGets(b *testing.B) {
+	const G = 1000
+	q := newQueue(queueConfig{maxMessageNum: G})
+	defer q.Stop()
+	b.ReportAllocs()
+	b.ResetTimer()
+	goroutines := 0
+	for range b.N {
+		var started, done sync.WaitGroup
+		started.Add(G)
+		done.Add(G)
+		for range G {
+			go func() {
+				defer done.Done()
+				ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+				defer cancel()
+				started.Done()
+				if _, err := q.Get(ctx); err != nil {
+					b.Errorf("Unexpected exception: %v", err)
+				}
+			}()
+		}
+		started.Wait()
+		goroutines = max(goroutines, runtime.NumGoroutine())
+		for range G {
+			if _, err := q.Put(context.Background(), "message"); err != nil {
+				b.Fatalf("Unexpected exception: %v", err)
+			}
+		}
+		done.Wait()
+	}
+	b.ReportMetric(float64(goroutines), "goroutines")
+}
+
+// BenchmarkQueueBurstDelivery измеряет доставку пакета из G сообщений G ожидающим читателям:
+// PutBatch принимает все сообщения за одну итерацию dispatch, и они сразу раздаются читателям.
+// Для очереди с журналом сюда входит и удаление доставленных сообщений из журнала
+func BenchmarkQueueBurstDelivery(b *testing.B) {
+	const G = 1000
+	batch := make([]string, G)
+	for i := range batch {
+		batch[i] = fmt.Sprintf("message%d", i)
+	}
+	testCases := []struct {
+		description string
+		newQueue    func(b *testing.B) queue
+	}{
+		{
+			description: "memory",
+			newQueue: func(b *testing.B) queue {
+				return newQueue(queueConfig{maxMessageNum: G})
+			},
+		},
+		{
+			description: "wal",
+			newQueue: func(b *testing.B) queue {
+				storage, err := openWAL(filepath.Join(b.TempDir(), "name.wal"), SyncModeNone, 0)
+				if err != nil {
+					b.Fatalf("Unexpected exception: %v", err)
+				}
+				q, err := startPersistentQueue(queueConfig{maxMessageNum: G}, storage)
+				if err != nil {
+					b.Fatalf("Unexpected exception: %v", err)
+				}
+				return q
+			},
+		},
+	}
+	for _, tc := range testCases {
+		b.Run(tc.description, func(b *testing.B) {
+			q := tc.newQueue(b)
+			defer q.Stop()
+			b.ReportAllocs()
+			b.ResetTimer()
+			for range b.N {
+				// Запуск читателей не измеряется
+				b.StopTimer()
+				var started, done sync.WaitGroup
+				started.Add(G)
+				done.Add(G)
+				for range G {
+					go func() {
+						defer done.Done()
+						ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+						defer cancel()
+						started.Done()
+						if _, err := q.Get(ctx); err != nil {
+							b.Errorf("Unexpected exception: %v", err)
+						}
+					}()
+				}
+				started.Wait()
+				// Даем читателям встать в очередь ожидания, чтобы пакет раздавался за один проход
+				time.Sleep(10 * time.Millisecond)
+				b.StartTimer()
+				if _, err := q.PutBatch(context.Background(), batch); err != nil {
+					b.Fatalf("Unexpected exception: %v", err)
+				}
+				done.Wait()
+			}
+		})
+	}
+}
+
+// TestQueueSnapshot проверяет, что Snapshot возвращает сообщения по порядку и не извлекает их
+func TestQueueSnapshot(t *testing.T) {
+	const N = 5
+	q := newQueue(queueConfig{maxMessageNum: N})
+	defer q.Stop()
+
+	if messages := q.Snapshot(); len(messages) != 0 {
+		t.Errorf("wrong snapshot of empty queue: got %v", messages)
+	}
+	for i := range N {
+		if _, err := q.Put(context.Background(), fmt.Sprintf("message%d", i)); err != nil {
+			t.Errorf("Unexpected exception: %v", err)
+		}
+	}
+	messages := q.Snapshot()
+	if len(messages) != N {
+		t.Fatalf("wrong snapshot length: got %v want %v", len(messages), N)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	for i := range N {
+		message, err := q.Get(ctx)
+		if err != nil {
+			t.Errorf("Unexpected exception: %v", err)
+		}
+		if message.Body != messages[i] {
+			t.Errorf("wrong message: got [%s] want [%s]", message.Body, messages[i])
+		}
+		if expected := fmt.Sprintf("message%d", i); message.Body != expected {
+			t.Errorf("wrong message: got [%s] want [%s]", message.Body, expected)
+		}
+	}
+}
+
+// TestQueueFillRatio проверяет заполненность очереди, которую диспетчер передает вместе с сообщением
+func TestQueueFillRatio(t *testing.T) {
+	const N = 4
+	q := newQueue(queueConfig{maxMessageNum: N, visibilityTimeout: time.Minute})
+	defer q.Stop()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	for range N {
+		if _, err := q.Put(ctx, "message"); err != nil {
+			t.Fatalf("Unexpected exception: %v", err)
+		}
+	}
+	// Сообщение в обработке уже не лежит в очереди, поэтому не учитывается
+	for _, expected := range []float64{0.75, 0.5, 0.25, 0} {
+		message, err := q.GetAck(ctx)
+		if err != nil {
+			t.Fatalf("Unexpected exception: %v", err)
+		}
+		if message.FillRatio != expected {
+			t.Errorf("wrong fill ratio: got %v want %v", message.FillRatio, expected)
+		}
+		if depth := int(expected * N); message.Depth != depth {
+			t.Errorf("wrong depth: got %v want %v", message.Depth, depth)
+		}
+	}
+}
+
+// TestQueueSample проверяет выбор сообщений по всей очереди и то, что выборка не извлекает их
+func TestQueueSample(t *testing.T) {
+	const N = 10
+	q := newQueue(queueConfig{maxMessageNum: N})
+	defer q.Stop()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	// Сначала сдвигаем начало очереди, чтобы выборка проходила через границу кольцевого буфера
+	for range 3 {
+		if _, err := q.Put(ctx, "skipped"); err != nil {
+			t.Fatalf("Unexpected exception: %v", err)
+		}
+		if _, err := q.Get(ctx); err != nil {
+			t.Fatalf("Unexpected exception: %v", err)
+		}
+	}
+	if messages := q.Sample(3); len(messages) != 0 {
+		t.Errorf("wrong sample of empty queue: got %v", messages)
+	}
+	for i := range N {
+		if _, err := q.Put(ctx, fmt.Sprintf("message%d", i)); err != nil {
+			t.Fatalf("Unexpected exception: %v", err)
+		}
+	}
+	testCases := []struct {
+		n        int
+		messages []string
+	}{
+		{n: 1, messages: []string{"message0"}},
+		{n: 3, messages: []string{"message0", "message4", "message9"}},
+		{n: 4, messages: []string{"message0", "message3", "message6", "message9"}},
+		{n: 2 * N, messages: q.Snapshot()},
+	}
+	for _, tc := range testCases {
+		if messages := q.Sample(tc.n); !slices.Equal(messages, tc.messages) {
+			t.Errorf("wrong sample of %d: got %v want %v", tc.n, messages, tc.messages)
+		}
+	}
+	if stats := q.Stats(); stats.Depth != N {
+		t.Errorf("wrong depth after Sample: got %v want %v", stats.Depth, N)
+	}
+	message, err := q.Get(ctx)
+	if err != nil {
+		t.Fatalf("Unexpected exception: %v", err)
+	}
+	if message.Body != "message0" {
+		t.Errorf("wrong message: got [%s] want [%s]", message.Body, "message0")
+	}
+}
+
+// TestQueuePurge проверяет, что Purge удаляет сообщения, а очередь продолжает работать
+func TestQueuePurge(t *testing.T) {
+	const N = 3
+	q := newQueue(queueConfig{maxMessageNum: N})
+	defer q.Stop()
+
+	for i := range N {
+		if _, err := q.Put(context.Background(), fmt.Sprintf("message%d", i)); err != nil {
+			t.Errorf("Unexpected exception: %v", err)
+		}
+	}
+	if n := q.Purge(); n != N {
+		t.Errorf("wrong purged number: got %v want %v", n, N)
+	}
+	// После очистки Get ждет до истечения таймаута
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if _, err := q.Get(ctx); !errors.Is(err, ErrNoMessage) {
+		t.Errorf("wrong error: got [%v] want [%v]", err, ErrNoMessage)
+	}
+	// Ожидающий Get получает сообщение, помещенное после очистки, а лимит снова свободен
+	result := make(chan string)
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		message, err := q.Get(ctx)
+		if err != nil {
+			t.Errorf("Unexpected exception: %v", err)
+		}
+		result <- message.Body
+	}()
+	for i := range N {
+		if _, err := q.Put(context.Background(), fmt.Sprintf("new%d", i)); err != nil {
+			t.Errorf("Unexpected exception: %v", err)
+		}
+	}
+	if message := <-result; message != "new0" {
+		t.Errorf("wrong message: got [%s] want [%s]", message, "new0")
+	}
+}
+
+// TestQueuePutBatch проверяет, что пакет, не помещающийся в лимит очереди или общий лимит, не меняет очередь
+func TestQueuePutBatch(t *testing.T) {
+	const N = 4
+	budget := newMessageBudget(N + 1)
+	q := newQueue(queueConfig{maxMessageNum: N, budget: budget})
+	defer q.Stop()
+	other := newQueue(queueConfig{maxMessageNum: N, budget: budget})
+	defer other.Stop()
+
+	if _, err := q.PutBatch(context.Background(), []string{"message0", "message1"}); err != nil {
+		t.Errorf("Unexpected exception: %v", err)
+	}
+	// Превышение лимита очереди: 2 + 3 > N
+	if _, err := q.PutBatch(context.Background(), []string{"a", "b", "c"}); !errors.Is(err, ErrTooManyItems) {
+		t.Errorf("wrong error: got [%v] want [%v]", err, ErrTooManyItems)
+	}
+	// Превышение общего лимита: в очередях 2 + 2, а бюджет N + 1
+	if _, err := other.PutBatch(context.Background(), []string{"a", "b"}); err != nil {
+		t.Errorf("Unexpected exception: %v", err)
+	}
+	if _, err := q.PutBatch(context.Background(), []string{"a", "b"}); !errors.Is(err, ErrTooManyItems) {
+		t.Errorf("wrong error: got [%v] want [%v]", err, ErrTooManyItems)
+	}
+	if messages := q.Snapshot(); !slices.Equal(messages, []string{"message0", "message1"}) {
+		t.Errorf("wrong messages after failed batch: got %v", messages)
+	}
+	if _, err := q.PutBatch(context.Background(), []string{"message2"}); err != nil {
+		t.Errorf("Unexpected exception: %v", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	for i := range 3 {
+		message, err := q.Get(ctx)
+		if err != nil {
+			t.Errorf("Unexpected exception: %v", err)
+		}
+		if expected := fmt.Sprintf("message%d", i); message.Body != expected {
+			t.Errorf("wrong message: got [%s] want [%s]", message.Body, expected)
+		}
+	}
+}
+
+func TestQueuePutAsync(t *testing.T) {
+	const N = 2
+	q := newQueue(queueConfig{maxMessageNum: N})
+	defer q.Stop()
+
+	// Сообщение сверх лимита тоже передается без ошибки, а очередь отбрасывает его
+	for _, message := range []string{"message0", "message1", "message2"} {
+		if err := q.PutAsync(context.Background(), message); err != nil {
+			t.Errorf("Unexpected exception: %v", err)
+		}
+	}
+	deadline := time.Now().Add(time.Second)
+	for q.Stats().Errors == 0 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if stats := q.Stats(); stats.Errors != 1 || stats.Depth != N {
+		t.Errorf("wrong stats: got %+v want 1 error and depth %d", stats, N)
+	}
+	if messages := q.Snapshot(); !slices.Equal(messages, []string{"message0", "message1"}) {
+		t.Errorf("wrong messages: got %v", messages)
+	}
+}
+
+func TestQueuePutAsyncBufferFull(t *testing.T) {
+	// Очередь без горутины диспетчера не разбирает буфер
+	q := makeQueueImpl(queueConfig{maxMessageNum: 1})
+	for range asyncPutBufferSize {
+		if err := q.PutAsync(context.Background(), "message"); err != nil {
+			t.Fatalf("Unexpected exception: %v", err)
+		}
+	}
+	if err := q.PutAsync(context.Background(), "message"); !errors.Is(err, ErrTooManyItems) {
+		t.Errorf("wrong error: got [%v] want [%v]", err, ErrTooManyItems)
+	}
+}
+
+func TestQueueMaxMessageBytes(t *testing.T) {
+	q := newQueue(queueConfig{maxMessageNum: 10, maxMessageBytes: 5})
+	defer q.Stop()
+
+	if _, err := q.Put(context.Background(), "12345"); err != nil {
+		t.Errorf("Unexpected exception: %v", err)
+	}
+	if _, err := q.Put(context.Background(), "123456"); !errors.Is(err, ErrMessageTooLarge) {
+		t.Errorf("wrong error: got [%v] want [%v]", err, ErrMessageTooLarge)
+	}
+	// Размер считается в байтах, а не в символах: 3 символа по 2 байта
+	if _, err := q.Put(context.Background(), "абв"); !errors.Is(err, ErrMessageTooLarge) {
+		t.Errorf("wrong error: got [%v] want [%v]", err, ErrMessageTooLarge)
+	}
+	// Одно большое сообщение отклоняет весь пакет
+	if _, err := q.PutBatch(context.Background(), []string{"a", "123456", "b"}); !errors.Is(err, ErrMessageTooLarge) {
+		t.Errorf("wrong error: got [%v] want [%v]", err, ErrMessageTooLarge)
+	}
+	if messages := q.Snapshot(); !slices.Equal(messages, []string{"12345"}) {
+		t.Errorf("wrong messages: got %v want [12345]", messages)
+	}
+}
+
+func TestQueuePutBlocking(t *testing.T) {
+	testCases := []struct {
+		description string
+		free        func(q queue) // освобождает место в очереди или ничего не делает
+		cancel      bool          // отменить контекст вместо ожидания его истечения
+		err         error
+	}{
+		{
+			description: "Get frees space",
+			free: func(q queue) {
+				q.Get(context.Background())
+			},
+		},
+		{
+			description: "GetAck frees space",
+			free: func(q queue) {
+				q.GetAck(context.Background())
+			},
+		},
+		{
+			description: "Purge frees space",
+			free: func(q queue) {
+				q.Purge()
+			},
+		},
+		{
+			description: "UpdateConfig frees space",
+			free: func(q queue) {
+				q.UpdateConfig(QueueConfig{MaxMessageNum: 2})
+			},
+		},
+		{
+			description: "Timeout",
+			free:        func(queue) {},
+			err:         ErrTooManyItems,
+		},
+		{
+			description: "Canceled",
+			free:        func(queue) {},
+			cancel:      true,
+			err:         ErrCanceled,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			q := newQueue(queueConfig{maxMessageNum: 1, visibilityTimeout: time.Minute})
+			defer q.Stop()
+			if _, err := q.PutBlocking(context.Background(), "message0"); err != nil {
+				t.Fatalf("Unexpected exception: %v", err)
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+			defer cancel()
+			errCh := make(chan error, 1)
+			go func() {
+				_, err := q.PutBlocking(ctx, "message1")
+				errCh <- err
+			}()
+			// Писатель должен встать в ожидание, а не получить отказ
+			select {
+			case err := <-errCh:
+				t.Fatalf("PutBlocking returned before space is freed: %v", err)
+			case <-time.After(50 * time.Millisecond):
+			}
+			tc.free(q)
+			if tc.cancel {
+				cancel()
+			}
+			if err := <-errCh; !errors.Is(err, tc.err) {
+				t.Fatalf("wrong error: got [%v] want [%v]", err, tc.err)
+			}
+			if tc.err != nil {
+				if messages := q.Snapshot(); !slices.Equal(messages, []string{"message0"}) {
+					t.Errorf("wrong messages: got %v want [message0]", messages)
+				}
+				return
+			}
+			if messages := q.Snapshot(); messages[len(messages)-1] != "message1" {
+				t.Errorf("wrong messages: got %v want message1 at the end", messages)
+			}
+		})
+	}
+}
+
+func TestQueuePutBlockingOrder(t *testing.T) {
+	const N = 5
+	q := newQueue(queueConfig{maxMessageNum: 1})
+	defer q.Stop()
+	if _, err := q.Put(context.Background(), "message0"); err != nil {
+		t.Fatalf("Unexpected exception: %v", err)
+	}
+	errCh := make(chan error, N)
+	for i := 1; i <= N; i++ {
+		go func() {
+			_, err := q.PutBlocking(context.Background(), fmt.Sprintf("message%d", i))
+			errCh <- err
+		}()
+		// Писатели встают в ожидание по порядку
+		time.Sleep(10 * time.Millisecond)
+	}
+	// Обычный Put не обходит ожидающих писателей, а сразу получает отказ
+	if _, err := q.Put(context.Background(), "other"); !errors.Is(err, ErrTooManyItems) {
+		t.Errorf("wrong error: got [%v] want [%v]", err, ErrTooManyItems)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	for i := 0; i <= N; i++ {
+		message, err := q.Get(ctx)
+		if err != nil {
+			t.Fatalf("Unexpected exception: %v", err)
+		}
+		if expected := fmt.Sprintf("message%d", i); message.Body != expected {
+			t.Errorf("wrong message: got [%s] want [%s]", message.Body, expected)
+		}
+	}
+	for range N {
+		if err := <-errCh; err != nil {
+			t.Errorf("Unexpected exception: %v", err)
+		}
+	}
+}
+
+func TestQueuePutBlockingStop(t *testing.T) {
+	q := newQueue(queueConfig{maxMessageNum: 1})
+	if _, err := q.Put(context.Background(), "message0"); err != nil {
+		t.Fatalf("Unexpected exception: %v", err)
+	}
+	errCh := make(chan error, 1)
+	go func() {
+		_, err := q.PutBlocking(context.Background(), "message1")
+		errCh <- err
+	}()
+	time.Sleep(50 * time.Millisecond)
+	q.Stop()
+	select {
+	case err := <-errCh:
+		if !errors.Is(err, ErrTooManyItems) {
+			t.Errorf("wrong error: got [%v] want [%v]", err, ErrTooManyItems)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("PutBlocking is not finished after Stop")
+	}
+}
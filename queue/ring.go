@@ -0,0 +1,110 @@
+package queue
+
+// ringBuffer это очередь на кольцевом буфере. В отличие от listAdapter элементы лежат в памяти подряд,
+// поэтому при ограниченной длине очереди нет аллокаций на каждый элемент и обхода указателей.
+// Один слот буфера всегда пуст, чтобы отличать полный буфер от пустого по head и tail.
+// Если элементов больше, чем помещается, то буфер увеличивается вдвое
+type ringBuffer[T any] struct {
+	data []T
+	head int // индекс первого элемента
+	tail int // индекс слота для следующего элемента
+}
+
+// newRingBuffer создает буфер, в который без увеличения помещается capacity элементов
+func newRingBuffer[T any](capacity int) *ringBuffer[T] {
+	return &ringBuffer[T]{
+		data: make([]T, capacity+1),
+	}
+}
+
+// Push добавляет элемент в конец очереди
+func (r *ringBuffer[T]) Push(v T) {
+	r.growIfFull()
+	r.data[r.tail] = v
+	r.tail = r.next(r.tail)
+}
+
+// PushFront добавляет элемент в начало очереди
+func (r *ringBuffer[T]) PushFront(v T) {
+	r.growIfFull()
+	r.head = r.prev(r.head)
+	r.data[r.head] = v
+}
+
+// Pop извлекает элемент из начала очереди, очередь не должна быть пустой
+func (r *ringBuffer[T]) Pop() T {
+	var zero T
+	v := r.data[r.head]
+	r.data[r.head] = zero // чтобы буфер не удерживал память извлеченного элемента
+	r.head = r.next(r.head)
+	return v
+}
+
+// Peek возвращает элемент из начала очереди, не извлекая его, очередь не должна быть пустой
+func (r *ringBuffer[T]) Peek() T {
+	return r.data[r.head]
+}
+
+// PeekAll возвращает копию всех элементов в порядке очереди, не извлекая их
+func (r *ringBuffer[T]) PeekAll() []T {
+	res := make([]T, r.Len())
+	for i := range res {
+		res[i] = r.data[(r.head+i)%len(r.data)]
+	}
+	return res
+}
+
+// Sample возвращает копию не более чем n элементов, равномерно выбранных по всей очереди в её порядке,
+// не извлекая их. В выборку всегда входят первый и последний элементы, если n больше 1
+func (r *ringBuffer[T]) Sample(n int) []T {
+	length := r.Len()
+	if n >= length {
+		return r.PeekAll()
+	}
+	res := make([]T, n)
+	for i := range res {
+		j := 0
+		if n > 1 {
+			j = i * (length - 1) / (n - 1)
+		}
+		res[i] = r.data[(r.head+j)%len(r.data)]
+	}
+	return res
+}
+
+func (r *ringBuffer[T]) Empty() bool {
+	return r.head == r.tail
+}
+
+func (r *ringBuffer[T]) Len() int {
+	return (r.tail - r.head + len(r.data)) % len(r.data)
+}
+
+func (r *ringBuffer[T]) next(i int) int {
+	if i++; i == len(r.data) {
+		return 0
+	}
+	return i
+}
+
+func (r *ringBuffer[T]) prev(i int) int {
+	if i == 0 {
+		return len(r.data) - 1
+	}
+	return i - 1
+}
+
+// growIfFull увеличивает буфер вдвое, если в нем не осталось места для ещё одного элемента
+func (r *ringBuffer[T]) growIfFull() {
+	if r.Len() < len(r.data)-1 {
+		return
+	}
+	data := make([]T, 2*len(r.data))
+	n := r.Len()
+	for i := range n {
+		data[i] = r.data[(r.head+i)%len(r.data)]
+	}
+	r.data = data
+	r.head = 0
+	r.tail = n
+}
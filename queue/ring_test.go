@@ -0,0 +1,73 @@
+package queue
+
+import (
+	"testing"
+)
+
+// TestRingBuffer проверяет порядок элементов при переходе через границу буфера,
+// при добавлении в начало и при увеличении буфера
+func TestRingBuffer(t *testing.T) {
+	const N = 4
+	r := newRingBuffer[int](N)
+	next := 0 // следующий ожидаемый элемент
+	pop := func() {
+		if v := r.Pop(); v != next {
+			t.Errorf("wrong element: got %v want %v", v, next)
+		}
+		next++
+	}
+	// Несколько раз проходим по кругу, не выходя за емкость
+	for i := range 3 * N {
+		r.Push(i)
+		if i%2 == 1 {
+			pop()
+			pop()
+		}
+	}
+	if !r.Empty() {
+		t.Fatalf("ring buffer is expected to be empty but has %d elements", r.Len())
+	}
+	// Заполняем сверх емкости, в том числе через PushFront
+	for i := range 2 * N {
+		r.Push(next + 1 + i)
+	}
+	r.PushFront(next)
+	if r.Len() != 2*N+1 {
+		t.Errorf("wrong length: got %v want %v", r.Len(), 2*N+1)
+	}
+	if v := r.Peek(); v != next {
+		t.Errorf("wrong first element: got %v want %v", v, next)
+	}
+	for i, v := range r.PeekAll() {
+		if v != next+i {
+			t.Errorf("wrong element %d in PeekAll: got %v want %v", i, v, next+i)
+		}
+	}
+	for !r.Empty() {
+		pop()
+	}
+}
+
+// benchmarkMessageBuffer измеряет пропускную способность буфера сообщений при N сообщениях в очереди
+func benchmarkMessageBuffer(b *testing.B, push func(*envelope), pop func() *envelope) {
+	const N = 100_000
+	env := &envelope{message: "message"}
+	for range N {
+		push(env)
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for range b.N {
+		push(pop())
+	}
+}
+
+func BenchmarkListAdapter(b *testing.B) {
+	l := newListAdapter[*envelope]()
+	benchmarkMessageBuffer(b, func(env *envelope) { l.Push(env) }, l.Pop)
+}
+
+func BenchmarkRingBuffer(b *testing.B) {
+	r := newRingBuffer[*envelope](100_000)
+	benchmarkMessageBuffer(b, r.Push, r.Pop)
+}
@@ -0,0 +1,86 @@
+package queue
+
+import (
+	"container/list"
+	"context"
+)
+
+// consumerIDKey задает ключ идентификатора потребителя в контексте Get
+type consumerIDKey struct{}
+
+// WithConsumerID возвращает контекст, Get и GetAck с которым выполняются от имени потребителя id.
+// Идентификатор учитывается только при взвешенном выборе читателя (QueueManagerConfig.ReaderWeights)
+func WithConsumerID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, consumerIDKey{}, id)
+}
+
+// ConsumerIDFromContext возвращает идентификатор потребителя, заданный через WithConsumerID, или пустую строку
+func ConsumerIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(consumerIDKey{}).(string)
+	return id
+}
+
+// readerSelector выбирает ожидающий Get, которому достается очередное сообщение.
+// Вызывается только из dispatch, поэтому может хранить состояние без блокировок
+type readerSelector interface {
+	// next возвращает элемент непустого списка ожидающих Get, упорядоченного по времени поступления
+	next(readers *list.List) *list.Element
+}
+
+// fifoSelector отдает сообщение самому раннему Get, это выбор по умолчанию
+type fifoSelector struct{}
+
+func (fifoSelector) next(readers *list.List) *list.Element {
+	return readers.Front()
+}
+
+// weightedSelector делит сообщения между потребителями, у которых сейчас есть ожидающие Get,
+// пропорционально их весам (smooth weighted round-robin). Внутри одного потребителя Get обслуживаются по порядку,
+// при равенстве выигрывает потребитель, чей Get пришел раньше. Потребители без веса, в том числе
+// без идентификатора, получают вес 1. Доли соблюдаются, только пока потребители ждут одновременно:
+// без конкурентов любой читатель получает сообщение сразу, а накопленный долг ушедшего потребителя забывается
+type weightedSelector struct {
+	weights map[string]int
+	current map[string]int // текущий счет ожидающих потребителей
+}
+
+func newWeightedSelector(weights map[string]int) *weightedSelector {
+	return &weightedSelector{
+		weights: weights,
+		current: make(map[string]int),
+	}
+}
+
+func (s *weightedSelector) weight(consumer string) int {
+	if weight := s.weights[consumer]; weight > 0 {
+		return weight
+	}
+	return 1
+}
+
+func (s *weightedSelector) next(readers *list.List) *list.Element {
+	// Первый ожидающий Get каждого потребителя, проход линейный по числу ожидающих
+	first := make(map[string]*list.Element)
+	var best string
+	total := 0
+	for elem := readers.Front(); elem != nil; elem = elem.Next() {
+		consumer := elem.Value.(*getWaitStatus).consumer
+		if _, ok := first[consumer]; ok {
+			continue
+		}
+		first[consumer] = elem
+		weight := s.weight(consumer)
+		s.current[consumer] += weight
+		total += weight
+		if len(first) == 1 || s.current[consumer] > s.current[best] {
+			best = consumer
+		}
+	}
+	s.current[best] -= total
+	for consumer := range s.current {
+		if _, ok := first[consumer]; !ok {
+			delete(s.current, consumer)
+		}
+	}
+	return first[best]
+}
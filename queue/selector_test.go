@@ -0,0 +1,95 @@
+package queue
+
+import (
+	"container/list"
+	"slices"
+	"testing"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+// TestQueueReaderSelection проверяет, кому из ожидающих Get достаются сообщения: по умолчанию строго по порядку,
+// а с весами - пропорционально весам потребителей, но по порядку внутри каждого потребителя
+func TestQueueReaderSelection(t *testing.T) {
+	consumers := []string{"a", "a", "a", "a", "b", "b", "b", "b"}
+	testCases := []struct {
+		description string
+		weights     map[string]int
+		received    []string // сообщения, полученные ожидающими Get в порядке их поступления
+	}{
+		{
+			description: "FIFO by default",
+			received:    []string{"m0", "m1", "m2", "m3", "", "", "", ""},
+		},
+		{
+			description: "Weighted",
+			weights:     map[string]int{"b": 3},
+			received:    []string{"m1", "", "", "", "m0", "m2", "m3", ""},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			// Очередь без горутины диспетчера, поэтому доставку можно вызвать напрямую и в известном порядке
+			q := makeQueueImpl(queueConfig{maxMessageNum: 10, readerWeights: tc.weights})
+			waiters := make([]*getWaitStatus, len(consumers))
+			for i, consumer := range consumers {
+				waiters[i] = newGetWaitStatus(false, trace.SpanContext{})
+				waiters[i].consumer = consumer
+				q.getWaitStatuses.Push(waiters[i])
+			}
+			for _, message := range []string{"m0", "m1", "m2", "m3"} {
+				if _, err := q.pushOne(q.newEnvelope(message, trace.SpanContext{})); err != nil {
+					t.Fatalf("unexpected error at pushOne [%v]", err)
+				}
+			}
+			q.deliverToReaders()
+			received := make([]string, len(waiters))
+			for i, ws := range waiters {
+				select {
+				case env := <-ws.msgCh:
+					received[i] = env.message
+				default:
+				}
+			}
+			if !slices.Equal(received, tc.received) {
+				t.Errorf("wrong received messages: got %v want %v", received, tc.received)
+			}
+			if n := q.getWaitStatuses.Len(); n != 4 {
+				t.Errorf("wrong number of waiting Get: got %v want 4", n)
+			}
+		})
+	}
+}
+
+// TestWeightedSelectorShares проверяет, что при долгом одновременном ожидании доли потребителей равны их весам,
+// а вес потребителя без идентификатора равен 1
+func TestWeightedSelectorShares(t *testing.T) {
+	selector := newWeightedSelector(map[string]int{"a": 3, "b": 2})
+	readers := list.New()
+	for range 20 {
+		for _, consumer := range []string{"", "a", "b"} {
+			ws := newGetWaitStatus(false, trace.SpanContext{})
+			ws.consumer = consumer
+			readers.PushBack(ws)
+		}
+	}
+	counts := make(map[string]int)
+	for range 18 {
+		counts[readers.Remove(selector.next(readers)).(*getWaitStatus).consumer]++
+	}
+	if counts["a"] != 9 || counts["b"] != 6 || counts[""] != 3 {
+		t.Errorf("wrong shares: got %v want a:9 b:6 :3", counts)
+	}
+
+	// Ушедший потребитель не копит долг: единственный оставшийся получает все сообщения
+	readers.Init()
+	ws := newGetWaitStatus(false, trace.SpanContext{})
+	ws.consumer = "b"
+	readers.PushBack(ws)
+	if elem := selector.next(readers); elem.Value.(*getWaitStatus) != ws {
+		t.Errorf("wrong reader selected")
+	}
+	if len(selector.current) != 1 {
+		t.Errorf("scores of gone consumers left: %v", selector.current)
+	}
+}
@@ -0,0 +1,43 @@
+package queue
+
+import (
+	"hash/fnv"
+	"sync"
+)
+
+// defaultShardNum задает число шардов менеджера очередей по умолчанию
+const defaultShardNum = 32
+
+// queueShard хранит часть очередей и топиков менеджера под своей блокировкой,
+// чтобы обращения к разным очередям не конкурировали за одну блокировку
+type queueShard struct {
+	queues map[string]queue
+	topics map[string]*topic // топики и очереди не пересекаются по именам
+	// Чтение мап должно быть много чаще, чем запись
+	mutex sync.RWMutex
+}
+
+func newQueueShards(shardNum int) []*queueShard {
+	shards := make([]*queueShard, shardNum)
+	for i := range shards {
+		shards[i] = &queueShard{
+			queues: make(map[string]queue),
+			topics: make(map[string]*topic),
+		}
+	}
+	return shards
+}
+
+// shardIndex возвращает номер шарда для имени очереди: fnv32(name) % shardNum
+func shardIndex(name string, shardNum int) int {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(name))
+	return int(h.Sum32() % uint32(shardNum))
+}
+
+// find ищет по имени очередь и топик под Read Lock, найдено может быть не больше одного из них
+func (s *queueShard) find(name string) (queue, *topic) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return s.queues[name], s.topics[name]
+}
@@ -0,0 +1,119 @@
+package queue
+
+import (
+	"database/sql"
+	"fmt"
+	"strconv"
+	"time"
+
+	_ "modernc.org/sqlite" // драйвер SQLite на чистом Go, не требует cgo
+)
+
+// sqliteSchema создает таблицу сообщений всех очередей. Первичный ключ (queue, id) задает
+// порядок сообщений очереди, поэтому Load не сортирует их отдельно
+const sqliteSchema = `CREATE TABLE IF NOT EXISTS messages (
+	queue       TEXT    NOT NULL,
+	id          INTEGER NOT NULL,
+	body        TEXT    NOT NULL,
+	enqueued_at INTEGER NOT NULL,
+	PRIMARY KEY (queue, id)
+) WITHOUT ROWID`
+
+// sqliteBackend хранит сообщения всех очередей в одной таблице базы SQLite
+type sqliteBackend struct {
+	db *sql.DB
+}
+
+// NewSQLiteBackend открывает базу SQLite в файле path, создавая файл и таблицу при необходимости
+func NewSQLiteBackend(path string) (StorageBackend, error) {
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		return nil, err
+	}
+	// SQLite пишет в файл по одному, поэтому одно соединение избавляет от ошибок SQLITE_BUSY,
+	// а настройки PRAGMA действуют на все запросы
+	db.SetMaxOpenConns(1)
+	for _, stmt := range []string{
+		"PRAGMA journal_mode = WAL",
+		"PRAGMA synchronous = FULL",
+		sqliteSchema,
+	} {
+		if _, err := db.Exec(stmt); err != nil {
+			db.Close()
+			return nil, fmt.Errorf("init sqlite %s: %w", path, err)
+		}
+	}
+	return &sqliteBackend{db: db}, nil
+}
+
+func (b *sqliteBackend) Append(queueName string, message Message) error {
+	id, err := strconv.ParseInt(message.ID, 10, 64)
+	if err != nil {
+		return err
+	}
+	_, err = b.db.Exec(
+		"INSERT OR REPLACE INTO messages (queue, id, body, enqueued_at) VALUES (?, ?, ?, ?)",
+		queueName, id, message.Body, message.EnqueuedAt.UnixNano(),
+	)
+	return err
+}
+
+func (b *sqliteBackend) Delete(queueName, id string) error {
+	n, err := strconv.ParseInt(id, 10, 64)
+	if err != nil {
+		return err
+	}
+	_, err = b.db.Exec("DELETE FROM messages WHERE queue = ? AND id = ?", queueName, n)
+	return err
+}
+
+func (b *sqliteBackend) Load(queueName string) ([]Message, error) {
+	rows, err := b.db.Query("SELECT id, body, enqueued_at FROM messages WHERE queue = ? ORDER BY id", queueName)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var messages []Message
+	for rows.Next() {
+		var (
+			id         int64
+			body       string
+			enqueuedAt int64
+		)
+		if err := rows.Scan(&id, &body, &enqueuedAt); err != nil {
+			return nil, err
+		}
+		messages = append(messages, Message{
+			ID:         strconv.FormatInt(id, 10),
+			Body:       body,
+			EnqueuedAt: time.Unix(0, enqueuedAt),
+		})
+	}
+	return messages, rows.Err()
+}
+
+func (b *sqliteBackend) Queues() ([]string, error) {
+	rows, err := b.db.Query("SELECT DISTINCT queue FROM messages ORDER BY queue")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var names []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		names = append(names, name)
+	}
+	return names, rows.Err()
+}
+
+func (b *sqliteBackend) Drop(queueName string) error {
+	_, err := b.db.Exec("DELETE FROM messages WHERE queue = ?", queueName)
+	return err
+}
+
+func (b *sqliteBackend) Close() error {
+	return b.db.Close()
+}
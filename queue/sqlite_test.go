@@ -0,0 +1,24 @@
+package queue
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestSQLiteBackend(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "messages.db")
+	backend, err := NewSQLiteBackend(path)
+	if err != nil {
+		t.Fatalf("Unexpected exception: %v", err)
+	}
+	testStorageBackend(t, backend, func(backend StorageBackend) StorageBackend {
+		if err := backend.Close(); err != nil {
+			t.Fatalf("Unexpected exception: %v", err)
+		}
+		reopened, err := NewSQLiteBackend(path)
+		if err != nil {
+			t.Fatalf("Unexpected exception: %v", err)
+		}
+		return reopened
+	})
+}
@@ -0,0 +1,67 @@
+package queue
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// QueueStats задает статистику очереди
+type QueueStats struct {
+	Depth    int64 // число сообщений, ожидающих доставки
+	InFlight int64 // число сообщений в обработке (GetAck), ожидающих подтверждения
+	Waiting  int64 // число Get, ожидающих сообщения
+	Produced int64 // число принятых сообщений за всё время
+	Consumed int64 // число доставленных читателям сообщений за всё время, повторная доставка учитывается снова
+	Errors   int64 // число отклоненных из-за лимита Put и Get, не дождавшихся сообщения
+	Dropped  int64 // число сообщений, удаленных без доставки по TTL или политикой OverflowDropOldest
+	Expired  int64 // число сообщений из Dropped, удаленных по TTL
+	// CreatedAt - момент создания очереди. Очередь, восстановленная из хранилища, создается заново при запуске
+	CreatedAt time.Time
+	// LastActivityAt - момент последнего приема, выдачи или подтверждения сообщения, до первого из них - CreatedAt
+	LastActivityAt time.Time
+	// Suspended - очередь приостановлена после MaxConsecutiveFailures неподтвержденных сообщений подряд
+	Suspended bool
+}
+
+// queueCounters хранит статистику очереди. Счетчики меняет только горутина dispatch,
+// а читать их можно из любой горутины без блокировок
+type queueCounters struct {
+	depth    atomic.Int64
+	inFlight atomic.Int64
+	waiting  atomic.Int64
+	produced atomic.Int64
+	consumed atomic.Int64
+	errors   atomic.Int64
+	dropped  atomic.Int64
+	expired  atomic.Int64
+	// createdAt задается до запуска dispatch и дальше не меняется
+	createdAt    time.Time
+	lastActivity atomic.Int64 // время в наносекундах Unix
+}
+
+// markCreated запоминает момент создания очереди, вызывается до запуска dispatch
+func (c *queueCounters) markCreated() {
+	c.createdAt = time.Now()
+	c.lastActivity.Store(c.createdAt.UnixNano())
+}
+
+// touch отмечает прием, выдачу или подтверждение сообщения
+func (c *queueCounters) touch() {
+	c.lastActivity.Store(time.Now().UnixNano())
+}
+
+func (c *queueCounters) snapshot() QueueStats {
+	return QueueStats{
+		Depth:    c.depth.Load(),
+		InFlight: c.inFlight.Load(),
+		Waiting:  c.waiting.Load(),
+		Produced: c.produced.Load(),
+		Consumed: c.consumed.Load(),
+		Errors:   c.errors.Load(),
+		Dropped:  c.dropped.Load(),
+		Expired:  c.expired.Load(),
+		// Монотонная часть createdAt для статистики не нужна, а без неё время можно сравнивать через ==
+		CreatedAt:      c.createdAt.Round(0),
+		LastActivityAt: time.Unix(0, c.lastActivity.Load()),
+	}
+}
@@ -0,0 +1,176 @@
+package queue
+
+import (
+	"cmp"
+	"errors"
+	"slices"
+	"strconv"
+	"sync"
+)
+
+// StorageBackend задает внешнее хранилище сообщений очередей, например, базу данных.
+// Очередь пишет в хранилище из своей горутины dispatch, поэтому методы для разных очередей
+// могут вызываться одновременно
+type StorageBackend interface {
+	// Append сохраняет сообщение, принятое очередью queueName. Сообщение с тем же ID заменяется:
+	// так сохраняется сообщение, возвращенное в очередь
+	Append(queueName string, message Message) error
+	// Delete удаляет извлеченное сообщение id очереди queueName
+	Delete(queueName, id string) error
+	// Load возвращает сохраненные сообщения очереди queueName в порядке поступления
+	Load(queueName string) ([]Message, error)
+	// Queues возвращает имена очередей, у которых есть сохраненные сообщения
+	Queues() ([]string, error)
+	// Drop удаляет все сообщения очереди queueName
+	Drop(queueName string) error
+	// Close закрывает хранилище, вызывается после остановки менеджера очередей
+	Close() error
+}
+
+// newBackendQueueFactory возвращает фабрику очередей, которые хранят сообщения в backend
+func newBackendQueueFactory(backend StorageBackend) queueFactory {
+	return func(config queueConfig) (queue, error) {
+		if config.memoryOnly {
+			return newMemoryQueue(config)
+		}
+		return startPersistentQueue(config, &backendStorage{
+			backend: backend,
+			name:    config.name,
+			closed:  make(chan struct{}),
+		})
+	}
+}
+
+// backendStorage сохраняет сообщения одной очереди в StorageBackend
+type backendStorage struct {
+	backend StorageBackend
+	name    string
+	closed  chan struct{}
+}
+
+func (s *backendStorage) load() ([]*envelope, uint64, error) {
+	messages, err := s.backend.Load(s.name)
+	if err != nil {
+		return nil, 0, err
+	}
+	envs := make([]*envelope, len(messages))
+	var lastID uint64
+	for i, message := range messages {
+		id, err := strconv.ParseUint(message.ID, 10, 64)
+		if err != nil {
+			return nil, 0, err
+		}
+		lastID = max(lastID, id)
+		envs[i] = &envelope{id: message.ID, message: message.Body, enqueuedAt: message.EnqueuedAt}
+	}
+	return envs, lastID, nil
+}
+
+// save сохраняет сообщения по одному. Если сохранить все не удалось, то уже сохраненные удаляются,
+// чтобы пакет не восстановился частично
+func (s *backendStorage) save(envs ...*envelope) error {
+	for i, env := range envs {
+		if err := s.backend.Append(s.name, env.toMessage()); err != nil {
+			for _, saved := range envs[:i] {
+				if deleteErr := s.backend.Delete(s.name, saved.id); deleteErr != nil {
+					errorLogger.Printf("rollback message [%s] of [%s] error: %v\n", saved.id, s.name, deleteErr)
+				}
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *backendStorage) remove(ids ...string) error {
+	var errs []error
+	for _, id := range ids {
+		if err := s.backend.Delete(s.name, id); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// close только отмечает, что очередь больше не пишет в хранилище: backend общий для всех очередей
+// и закрывается владельцем
+func (s *backendStorage) close() {
+	close(s.closed)
+}
+
+func (s *backendStorage) done() <-chan struct{} {
+	return s.closed
+}
+
+func (s *backendStorage) destroy() error {
+	return s.backend.Drop(s.name)
+}
+
+// memoryBackend хранит сообщения в памяти процесса. Сообщения переживают удаление и повторное создание
+// очереди в менеджере и остановку менеджера, но не перезапуск брокера, поэтому подходит для тестов
+type memoryBackend struct {
+	mutex  sync.Mutex
+	queues map[string]map[string]Message // сообщения по имени очереди и идентификатору
+}
+
+// NewMemoryBackend создает хранилище сообщений в памяти процесса
+func NewMemoryBackend() StorageBackend {
+	return &memoryBackend{queues: make(map[string]map[string]Message)}
+}
+
+func (b *memoryBackend) Append(queueName string, message Message) error {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	if b.queues[queueName] == nil {
+		b.queues[queueName] = make(map[string]Message)
+	}
+	b.queues[queueName][message.ID] = message
+	return nil
+}
+
+func (b *memoryBackend) Delete(queueName, id string) error {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	delete(b.queues[queueName], id)
+	if len(b.queues[queueName]) == 0 {
+		delete(b.queues, queueName)
+	}
+	return nil
+}
+
+func (b *memoryBackend) Load(queueName string) ([]Message, error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	messages := make([]Message, 0, len(b.queues[queueName]))
+	for _, message := range b.queues[queueName] {
+		messages = append(messages, message)
+	}
+	// Идентификаторы выдаются по возрастанию, а возвращенное сообщение сохраняет свой идентификатор.
+	// Числа без ведущих нулей сравниваются по длине записи, а при равной длине - посимвольно
+	slices.SortFunc(messages, func(a, b Message) int {
+		return cmp.Or(cmp.Compare(len(a.ID), len(b.ID)), cmp.Compare(a.ID, b.ID))
+	})
+	return messages, nil
+}
+
+func (b *memoryBackend) Queues() ([]string, error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	names := make([]string, 0, len(b.queues))
+	for name := range b.queues {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names, nil
+}
+
+func (b *memoryBackend) Drop(queueName string) error {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	delete(b.queues, queueName)
+	return nil
+}
+
+func (b *memoryBackend) Close() error {
+	return nil
+}
@@ -0,0 +1,125 @@
+package queue
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+)
+
+// testStorageBackend проверяет контракт StorageBackend. reopen имитирует перезапуск брокера:
+// закрывает хранилище и открывает его снова
+func testStorageBackend(t *testing.T, backend StorageBackend, reopen func(StorageBackend) StorageBackend) {
+	t.Helper()
+	enqueuedAt := time.Unix(0, time.Now().UnixNano())
+	for _, step := range []struct {
+		queueName string
+		message   Message
+	}{
+		{"a", Message{ID: "1", Body: "message1", EnqueuedAt: enqueuedAt}},
+		{"a", Message{ID: "2", Body: "message2", EnqueuedAt: enqueuedAt}},
+		{"a", Message{ID: "10", Body: "message10", EnqueuedAt: enqueuedAt}},
+		{"b", Message{ID: "1", Body: "other", EnqueuedAt: enqueuedAt}},
+		// Возвращенное в очередь сообщение сохраняется снова с тем же ID
+		{"a", Message{ID: "1", Body: "message1", EnqueuedAt: enqueuedAt}},
+	} {
+		if err := backend.Append(step.queueName, step.message); err != nil {
+			t.Fatalf("Unexpected exception: %v", err)
+		}
+	}
+	if err := backend.Delete("a", "2"); err != nil {
+		t.Fatalf("Unexpected exception: %v", err)
+	}
+	backend = reopen(backend)
+	defer backend.Close()
+
+	messages, err := backend.Load("a")
+	if err != nil {
+		t.Fatalf("Unexpected exception: %v", err)
+	}
+	want := []Message{
+		{ID: "1", Body: "message1", EnqueuedAt: enqueuedAt},
+		{ID: "10", Body: "message10", EnqueuedAt: enqueuedAt},
+	}
+	if !slices.EqualFunc(messages, want, func(a, b Message) bool {
+		return a.ID == b.ID && a.Body == b.Body && a.EnqueuedAt.Equal(b.EnqueuedAt)
+	}) {
+		t.Errorf("wrong messages: got %v want %v", messages, want)
+	}
+	if names, err := backend.Queues(); err != nil || !slices.Equal(names, []string{"a", "b"}) {
+		t.Errorf("wrong queues: got %v [%v] want %v", names, err, []string{"a", "b"})
+	}
+	if err := backend.Drop("b"); err != nil {
+		t.Fatalf("Unexpected exception: %v", err)
+	}
+	if names, err := backend.Queues(); err != nil || !slices.Equal(names, []string{"a"}) {
+		t.Errorf("wrong queues: got %v [%v] want %v", names, err, []string{"a"})
+	}
+	if messages, err := backend.Load("b"); err != nil || len(messages) != 0 {
+		t.Errorf("wrong messages: got %v [%v] want none", messages, err)
+	}
+}
+
+func TestMemoryBackend(t *testing.T) {
+	testStorageBackend(t, NewMemoryBackend(), func(backend StorageBackend) StorageBackend {
+		return backend
+	})
+}
+
+// TestStorageBackendQueueManager проверяет, что менеджер с Storage восстанавливает очереди из хранилища
+// после перезапуска, а удаленные очереди удаляет и из хранилища
+func TestStorageBackendQueueManager(t *testing.T) {
+	backend := NewMemoryBackend()
+	config := QueueManagerConfig{
+		MaxQueueNum:           10,
+		MaxMessageNumPerQueue: 10,
+		VisibilityTimeout:     time.Minute,
+		Storage:               backend,
+	}
+	ctx := context.Background()
+
+	manager := NewQueueManager(config)
+	for _, message := range []string{"message1", "message2", "message3"} {
+		if err := manager.Put(ctx, "kept", message); err != nil {
+			t.Fatalf("Unexpected exception: %v", err)
+		}
+	}
+	if err := manager.Put(ctx, "deleted", "message"); err != nil {
+		t.Fatalf("Unexpected exception: %v", err)
+	}
+	if _, err := manager.Get(ctx, "kept", 0); err != nil {
+		t.Fatalf("Unexpected exception: %v", err)
+	}
+	// Неподтвержденное сообщение после перезапуска снова доступно
+	if _, err := manager.GetAck(ctx, "kept", 0); err != nil {
+		t.Fatalf("Unexpected exception: %v", err)
+	}
+	if err := manager.Delete("deleted"); err != nil {
+		t.Fatalf("Unexpected exception: %v", err)
+	}
+	manager.Stop()
+
+	manager = NewQueueManager(config)
+	defer manager.Stop()
+	if names, want := manager.List(), []string{"kept"}; !slices.Equal(names, want) {
+		t.Errorf("wrong queues: got %v want %v", names, want)
+	}
+	messages, err := manager.Snapshot("kept")
+	if err != nil {
+		t.Fatalf("Unexpected exception: %v", err)
+	}
+	if want := []string{"message2", "message3"}; !slices.Equal(messages, want) {
+		t.Errorf("wrong messages: got %v want %v", messages, want)
+	}
+	if err := manager.Put(ctx, "kept", "message4"); err != nil {
+		t.Fatalf("Unexpected exception: %v", err)
+	}
+	// Идентификаторы продолжаются после восстановленных
+	stored, err := backend.Load("kept")
+	if err != nil {
+		t.Fatalf("Unexpected exception: %v", err)
+	}
+	if last := stored[len(stored)-1]; last.ID != "4" || last.Body != "message4" {
+		t.Errorf("wrong last message: got [%v %v] want [%v %v]", last.ID, last.Body, "4", "message4")
+	}
+}
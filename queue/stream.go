@@ -0,0 +1,80 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// streamNoQueueDelay задает паузу между ожиданиями, пока очереди ещё нет: Get на несуществующую очередь отвечает сразу
+const streamNoQueueDelay = 100 * time.Millisecond
+
+// Stream передает в send сообщения очереди name по мере поступления, ожидая каждое не дольше timeout секунд
+// и повторяя ожидание, пока не отменят ctx. Используется потоковыми интерфейсами: WebSocket, SSE и gRPC.
+// Возвращает nil после отмены ctx, иначе - ошибку менеджера очередей или send
+func Stream(ctx context.Context, queueManager QueueManager, name string, timeout int, send func(message string) error) error {
+	get := func(ctx context.Context, timeout int) (Message, error) {
+		return queueManager.Get(ctx, name, timeout)
+	}
+	return stream(ctx, name, timeout, get, func(message Message) error {
+		return send(message.Body)
+	})
+}
+
+// StreamSub передает в send сообщения подписки sub топика name так же, как Stream. Если задан курсор cursor,
+// то сначала передаются сообщения, которые подписка выдала после него (ResumeSub): так переподключившийся
+// читатель продолжает с того места, где остановился. Идентификатор каждого сообщения send получает
+// в Message.ID, чтобы читатель мог передать его курсором при следующем подключении
+func StreamSub(ctx context.Context, queueManager QueueManager, name, sub, cursor string, timeout int,
+	send func(message Message) error) error {
+	if cursor != "" {
+		missed, err := queueManager.ResumeSub(name, sub, cursor)
+		if err != nil {
+			return err
+		}
+		for _, message := range missed {
+			if err := send(message); err != nil {
+				return err
+			}
+		}
+	}
+	get := func(ctx context.Context, timeout int) (Message, error) {
+		return queueManager.GetSub(ctx, name, sub, timeout)
+	}
+	return stream(ctx, name, timeout, get, send)
+}
+
+// stream повторяет ожидание сообщения через get и передает полученные сообщения в send, пока не отменят ctx
+func stream(ctx context.Context, name string, timeout int, get func(ctx context.Context, timeout int) (Message, error),
+	send func(message Message) error) error {
+	// С нулевым таймаутом ожидание превратилось бы в непрерывный опрос очереди
+	timeout = max(timeout, 1)
+	for {
+		message, err := get(ctx, timeout)
+		if ctx.Err() != nil {
+			// Сообщение, полученное одновременно с отключением клиента, отправить уже некуда.
+			// Сообщение подписки с окном хранения вернет следующее подключение с курсором
+			if err == nil {
+				errorLogger.Printf("stream queue [%s] message lost on close\n", name)
+			}
+			return nil
+		}
+		if errors.Is(err, ErrQueueNotFound) || errors.Is(err, ErrQueueSuspended) {
+			// Очередь создаст первый Put или возобновит администратор, а до тех пор не нагружаем менеджер
+			select {
+			case <-ctx.Done():
+			case <-time.After(streamNoQueueDelay):
+			}
+			continue
+		}
+		if errors.Is(err, ErrNoMessage) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if err := send(message); err != nil {
+			return err
+		}
+	}
+}
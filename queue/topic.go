@@ -0,0 +1,233 @@
+package queue
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// topic задает очередь в режиме pub/sub: каждая подписка получает свою копию каждого сообщения.
+//
+// Каждая подписка - это отдельная очередь со своим буфером, поэтому сообщение, помещенное в топик,
+// хранится в памяти столько раз, сколько у топика подписок. В худшем случае топик занимает
+// maxSubscriptionNum * config.maxMessageNum сообщений. Подписки не удаляются, пока работает брокер,
+// и брошенная подписка копит сообщения, пока не упрется в лимит config.maxMessageNum.
+// Подписка с фильтром получает и хранит только подходящие сообщения.
+//
+// Если задано окно хранения retention, то подписка помнит выданные сообщения, пока их не подтвердит курсор
+// читателя или не истечет окно, но не больше config.maxMessageNum. Так читатель потока, потерявший соединение,
+// получает через Resume сообщения, которые ушли в разорванное соединение.
+type topic struct {
+	config             queueConfig              // настройки буфера каждой подписки
+	maxSubscriptionNum int                      // ограничение на количество подписок
+	retention          time.Duration            // окно хранения выданных сообщений, 0 - не хранятся
+	subscriptions      map[string]*subscription // подписки по идентификатору подписки
+	// Чтение мапы с подписками должно быть много чаще, чем запись
+	mutex   sync.RWMutex
+	factory queueFactory
+}
+
+// newTopic создает топик, буферы подписок создаются через factory
+func newTopic(config queueConfig, maxSubscriptionNum int, retention time.Duration, factory queueFactory) *topic {
+	return &topic{
+		config:             config,
+		maxSubscriptionNum: maxSubscriptionNum,
+		retention:          retention,
+		subscriptions:      make(map[string]*subscription),
+		factory:            factory,
+	}
+}
+
+// subscription задает буфер подписки и фильтр, который задается при создании подписки и дальше не меняется
+type subscription struct {
+	queue
+	filter MessageFilter // nil - подписка получает все сообщения
+
+	mutex    sync.Mutex
+	retained []retainedMessage // выданные и не подтвержденные курсором сообщения в порядке выдачи
+}
+
+// retainedMessage задает сообщение, выданное из подписки, и момент выдачи, от которого считается окно хранения
+type retainedMessage struct {
+	message     Message
+	deliveredAt time.Time
+}
+
+// retain запоминает выданное сообщение, вытесняя самые старые сверх limit
+func (s *subscription) retain(message Message, now time.Time, retention time.Duration, limit int) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.expire(now, retention)
+	if len(s.retained) >= limit {
+		s.retained = s.retained[len(s.retained)-limit+1:]
+	}
+	s.retained = append(s.retained, retainedMessage{message: message, deliveredAt: now})
+}
+
+// resume забывает сообщения, подтвержденные курсором cursor, и возвращает остальные сохраненные
+func (s *subscription) resume(cursor uint64, now time.Time, retention time.Duration) []Message {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.expire(now, retention)
+	// Идентификаторы сообщений подписки растут в порядке выдачи
+	for len(s.retained) > 0 {
+		id, err := strconv.ParseUint(s.retained[0].message.ID, 10, 64)
+		if err == nil && id > cursor {
+			break
+		}
+		s.retained = s.retained[1:]
+	}
+	res := make([]Message, len(s.retained))
+	for i, retained := range s.retained {
+		res[i] = retained.message
+	}
+	return res
+}
+
+// expire забывает сообщения, выданные раньше окна хранения, вызывается под s.mutex
+func (s *subscription) expire(now time.Time, retention time.Duration) {
+	for len(s.retained) > 0 && now.Sub(s.retained[0].deliveredAt) > retention {
+		s.retained = s.retained[1:]
+	}
+}
+
+// accepts сообщает, нужно ли копировать сообщение в буфер подписки
+func (s *subscription) accepts(message string) bool {
+	return s.filter == nil || s.filter.Match(message)
+}
+
+// Subscribe создает подписку sub с фильтром filter, если её ещё нет.
+// Подписка получает только сообщения, помещенные в топик после её создания.
+// Может вернуть ошибку ErrTooManyItems, если срабатывает лимит на количество подписок, и ErrInvalidFilter,
+// если подписка уже есть с другим фильтром. nil в filter подходит к подписке с любым фильтром
+func (t *topic) Subscribe(sub string, filter MessageFilter) (queue, error) {
+	found, err := t.findOrSubscribe(sub, filter)
+	if err != nil {
+		return nil, err
+	}
+	return found.queue, nil
+}
+
+// findOrSubscribe работает как Subscribe, но возвращает саму подписку
+func (t *topic) findOrSubscribe(sub string, filter MessageFilter) (*subscription, error) {
+	var found *subscription
+	func() {
+		t.mutex.RLock()
+		defer t.mutex.RUnlock()
+		found = t.subscriptions[sub]
+	}()
+	if found == nil {
+		var err error
+		if found, err = t.subscribe(sub, filter); err != nil {
+			return nil, err
+		}
+	}
+	if filter != nil && filterString(found.filter) != filter.String() {
+		return nil, fmt.Errorf("%w: subscription [%s] has filter %q", ErrInvalidFilter, sub, filterString(found.filter))
+	}
+	return found, nil
+}
+
+// subscribe создает подписку под блокировкой на запись, если её не создали раньше
+func (t *topic) subscribe(sub string, filter MessageFilter) (*subscription, error) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	// Проверим, вдруг подписки не было в Read Lock, а при входе в данный Lock подписка уже есть
+	if found := t.subscriptions[sub]; found != nil {
+		return found, nil
+	}
+	if len(t.subscriptions) >= t.maxSubscriptionNum {
+		return nil, ErrTooManyItems
+	}
+	subQueue, err := t.factory(t.config)
+	if err != nil {
+		return nil, err
+	}
+	created := &subscription{queue: subQueue, filter: filter}
+	t.subscriptions[sub] = created
+	return created, nil
+}
+
+// Get извлекает сообщение из буфера подписки sub, создавая подписку без фильтра при первом обращении.
+// С окном хранения выданное сообщение запоминается до подтверждения курсором
+func (t *topic) Get(ctx context.Context, sub string) (Message, error) {
+	found, err := t.findOrSubscribe(sub, nil)
+	if err != nil {
+		return Message{}, err
+	}
+	message, err := found.Get(ctx)
+	if err == nil && t.retention > 0 {
+		found.retain(message, time.Now(), t.retention, max(t.config.maxMessageNum, 1))
+	}
+	return message, err
+}
+
+// Resume подтверждает сообщения подписки sub до курсора cursor включительно и возвращает в порядке выдачи
+// остальные сообщения, выданные в пределах окна хранения. Курсор - это идентификатор последнего сообщения,
+// которое получил читатель. Возвращенные сообщения остаются сохраненными до следующего курсора,
+// поэтому повторный разрыв соединения их тоже не теряет. Возвращает ErrInvalidCursor, если курсор
+// не идентификатор сообщения. Подписка создается, если её ещё нет
+func (t *topic) Resume(sub, cursor string) ([]Message, error) {
+	id, err := strconv.ParseUint(cursor, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("%w: [%s]", ErrInvalidCursor, cursor)
+	}
+	found, err := t.findOrSubscribe(sub, nil)
+	if err != nil {
+		return nil, err
+	}
+	if t.retention <= 0 {
+		return nil, nil
+	}
+	return found.resume(id, time.Now(), t.retention), nil
+}
+
+// Put помещает копию сообщения в буфер каждой текущей подписки, фильтр которой пропускает сообщение.
+// Если буфер какой-то подписки переполнен, то сообщение всё равно доставляется в остальные подписки,
+// а вызывающий получает ошибку ErrTooManyItems
+func (t *topic) Put(ctx context.Context, message string) error {
+	t.mutex.RLock()
+	defer t.mutex.RUnlock()
+	var res error
+	for _, s := range t.subscriptions {
+		if !s.accepts(message) {
+			continue
+		}
+		if _, err := s.Put(ctx, message); err != nil {
+			res = err
+		}
+	}
+	return res
+}
+
+// PutBlocking помещает копию сообщения в буфер каждой подходящей подписки, ожидая места в переполненных буферах.
+// Ожидание идет без блокировки топика, чтобы медленная подписка не мешала создавать новые.
+// Как и Put, возвращает последнюю ошибку, не прерывая доставку в остальные подписки
+func (t *topic) PutBlocking(ctx context.Context, message string) error {
+	t.mutex.RLock()
+	subQueues := make([]queue, 0, len(t.subscriptions))
+	for _, s := range t.subscriptions {
+		if s.accepts(message) {
+			subQueues = append(subQueues, s.queue)
+		}
+	}
+	t.mutex.RUnlock()
+	var res error
+	for _, subQueue := range subQueues {
+		if _, err := subQueue.PutBlocking(ctx, message); err != nil {
+			res = err
+		}
+	}
+	return res
+}
+
+// Stop останавливает очереди всех подписок
+func (t *topic) Stop() {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	for _, s := range t.subscriptions {
+		s.Stop()
+	}
+}
@@ -0,0 +1,208 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"testing"
+	"time"
+)
+
+// TestTopicTwoSubscriptions проверяет, что две подписки независимо читают один и тот же поток сообщений:
+// * создаются две подписки
+// * в топик помещаются N сообщений
+// * каждая подписка читает все N сообщений в порядке их поступления
+func TestTopicTwoSubscriptions(t *testing.T) {
+	const N = 10
+	tp := newTopic(queueConfig{maxMessageNum: N}, 2, 0, newMemoryQueue)
+	defer tp.Stop()
+
+	subs := []string{"sub1", "sub2"}
+	for _, sub := range subs {
+		if _, err := tp.Subscribe(sub, nil); err != nil {
+			t.Fatalf("Unexpected exception: %v", err)
+		}
+	}
+	for i := range N {
+		if err := tp.Put(context.Background(), fmt.Sprintf("message%d", i)); err != nil {
+			t.Errorf("Unexpected exception: %v", err)
+		}
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+	defer cancel()
+	for _, sub := range subs {
+		for i := range N {
+			message, err := tp.Get(ctx, sub)
+			if err != nil {
+				t.Errorf("Unexpected exception: %v", err)
+			}
+			expectedMessage := fmt.Sprintf("message%d", i)
+			if message.Body != expectedMessage {
+				t.Errorf("wrong message for [%s]: got [%v] want [%v]", sub, message.Body, expectedMessage)
+			}
+		}
+	}
+}
+
+// TestTopicLimits проверяет лимиты на число подписок и на размер буфера подписки
+func TestTopicLimits(t *testing.T) {
+	tp := newTopic(queueConfig{maxMessageNum: 1}, 1, 0, newMemoryQueue)
+	defer tp.Stop()
+
+	if _, err := tp.Subscribe("sub1", nil); err != nil {
+		t.Fatalf("Unexpected exception: %v", err)
+	}
+	if _, err := tp.Subscribe("sub2", nil); !errors.Is(err, ErrTooManyItems) {
+		t.Errorf("wrong error: got [%v] want [%v]", err, ErrTooManyItems)
+	}
+	if err := tp.Put(context.Background(), "message1"); err != nil {
+		t.Errorf("Unexpected exception: %v", err)
+	}
+	if err := tp.Put(context.Background(), "message2"); !errors.Is(err, ErrTooManyItems) {
+		t.Errorf("wrong error: got [%v] want [%v]", err, ErrTooManyItems)
+	}
+}
+
+// TestTopicFilters проверяет, что две подписки с разными фильтрами получают из одного потока только свои сообщения,
+// а чужие сообщения не занимают их буферы
+func TestTopicFilters(t *testing.T) {
+	// Буфер подписки вмещает два сообщения, а в топик помещаются четыре
+	tp := newTopic(queueConfig{maxMessageNum: 2}, 2, 0, newMemoryQueue)
+	defer tp.Stop()
+
+	filters := map[string]MessageFilter{
+		"orders":   PrefixFilter("orders."),
+		"payments": PrefixFilter("payments."),
+	}
+	for sub, filter := range filters {
+		if _, err := tp.Subscribe(sub, filter); err != nil {
+			t.Fatalf("Unexpected exception: %v", err)
+		}
+	}
+	for _, message := range []string{"orders.1", "payments.1", "orders.2", "payments.2", "refunds.1"} {
+		if err := tp.Put(context.Background(), message); err != nil {
+			t.Errorf("Unexpected exception at [%s]: %v", message, err)
+		}
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	expected := map[string][]string{
+		"orders":   {"orders.1", "orders.2"},
+		"payments": {"payments.1", "payments.2"},
+	}
+	for sub, messages := range expected {
+		for _, expectedMessage := range messages {
+			message, err := tp.Get(ctx, sub)
+			if err != nil {
+				t.Fatalf("Unexpected exception: %v", err)
+			}
+			if message.Body != expectedMessage {
+				t.Errorf("wrong message for [%s]: got [%v] want [%v]", sub, message.Body, expectedMessage)
+			}
+		}
+		if _, err := tp.Get(ctx, sub); !errors.Is(err, ErrNoMessage) {
+			t.Errorf("wrong error for [%s]: got [%v] want [%v]", sub, err, ErrNoMessage)
+		}
+	}
+
+	// Фильтр существующей подписки не меняется
+	if _, err := tp.Subscribe("orders", PrefixFilter("payments.")); !errors.Is(err, ErrInvalidFilter) {
+		t.Errorf("wrong error: got [%v] want [%v]", err, ErrInvalidFilter)
+	}
+	if _, err := tp.Subscribe("orders", PrefixFilter("orders.")); err != nil {
+		t.Errorf("Unexpected exception: %v", err)
+	}
+}
+
+// TestTopicResume проверяет, что подписка с окном хранения возвращает по курсору выданные после него сообщения,
+// а подтвержденные курсором и устаревшие сообщения забывает
+func TestTopicResume(t *testing.T) {
+	testCases := []struct {
+		description string
+		retention   time.Duration
+		maxMessages int
+		cursor      int // номер последнего полученного читателем сообщения из выданных
+		wait        time.Duration
+		missed      []string
+	}{
+		{
+			description: "Missed messages",
+			retention:   time.Minute,
+			maxMessages: 10,
+			cursor:      0,
+			missed:      []string{"message1", "message2"},
+		},
+		{
+			description: "All received",
+			retention:   time.Minute,
+			maxMessages: 10,
+			cursor:      2,
+			missed:      []string{},
+		},
+		{
+			description: "Retention expired",
+			retention:   10 * time.Millisecond,
+			maxMessages: 10,
+			cursor:      0,
+			wait:        50 * time.Millisecond,
+			missed:      []string{},
+		},
+		{
+			description: "Retention limited by buffer size",
+			retention:   time.Minute,
+			maxMessages: 1,
+			cursor:      0,
+			missed:      []string{"message2"},
+		},
+		{
+			description: "No retention",
+			cursor:      0,
+			maxMessages: 10,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			tp := newTopic(queueConfig{maxMessageNum: tc.maxMessages}, 1, tc.retention, newMemoryQueue)
+			defer tp.Stop()
+			if _, err := tp.Subscribe("sub", nil); err != nil {
+				t.Fatalf("Unexpected exception: %v", err)
+			}
+			// Читатель получает по одному сообщению, чтобы небольшой буфер не переполнился
+			var delivered []Message
+			for i := range 3 {
+				if err := tp.Put(context.Background(), fmt.Sprintf("message%d", i)); err != nil {
+					t.Fatalf("Unexpected exception: %v", err)
+				}
+				message, err := tp.Get(context.Background(), "sub")
+				if err != nil {
+					t.Fatalf("Unexpected exception: %v", err)
+				}
+				delivered = append(delivered, message)
+			}
+			time.Sleep(tc.wait)
+
+			missed, err := tp.Resume("sub", delivered[tc.cursor].ID)
+			if err != nil {
+				t.Fatalf("Unexpected exception: %v", err)
+			}
+			bodies := make([]string, len(missed))
+			for i, message := range missed {
+				bodies[i] = message.Body
+			}
+			if !slices.Equal(bodies, tc.missed) {
+				t.Errorf("wrong missed messages: got %v want %v", bodies, tc.missed)
+			}
+			// Возвращенные сообщения остаются до следующего курсора
+			if again, _ := tp.Resume("sub", delivered[tc.cursor].ID); len(again) != len(missed) {
+				t.Errorf("wrong missed messages on second Resume: got %v want %v", len(again), len(missed))
+			}
+		})
+	}
+
+	tp := newTopic(queueConfig{maxMessageNum: 1}, 1, time.Minute, newMemoryQueue)
+	defer tp.Stop()
+	if _, err := tp.Resume("sub", "abc"); !errors.Is(err, ErrInvalidCursor) {
+		t.Errorf("wrong error: got [%v] want [%v]", err, ErrInvalidCursor)
+	}
+}
@@ -0,0 +1,70 @@
+package queue
+
+import (
+	"context"
+	"errors"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+// Атрибуты спанов операций с очередями
+const (
+	queueNameKey      = attribute.Key("queue.name")
+	queueDepthKey     = attribute.Key("queue.depth")
+	queueOperationKey = attribute.Key("queue.operation")
+)
+
+// startSpan начинает спан операции operation с очередью name, дочерний для спана из ctx.
+// Без tracer трассировка выключена: возвращает ctx как есть и спан, который ничего не записывает
+func startSpan(ctx context.Context, tracer trace.Tracer, operation, name string) (context.Context, trace.Span) {
+	if tracer == nil {
+		return ctx, noop.Span{}
+	}
+	return tracer.Start(ctx, "queue."+operation, trace.WithAttributes(
+		queueNameKey.String(name),
+		queueOperationKey.String(operation),
+	))
+}
+
+// endSpan записывает в спан ошибку операции и завершает его. ErrNoMessage и ErrQueueNotFound не считаются
+// ошибкой: Get, не дождавшийся сообщения, - обычный исход долгого опроса, а очередь создаст первый Put
+func endSpan(span trace.Span, err error) {
+	if err != nil && !errors.Is(err, ErrNoMessage) && !errors.Is(err, ErrQueueNotFound) {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// traceDelivery записывает спан выдачи сообщения env читателю ws. Спан дочерний для спана Get читателя
+// и связан со спаном Put, который поставил сообщение в очередь, поэтому трассировки писателя и читателя
+// соединяются. Вызывается только из dispatch
+func (q *queueImpl) traceDelivery(ws *getWaitStatus, env *envelope) {
+	if q.tracer == nil {
+		return
+	}
+	ctx := trace.ContextWithSpanContext(context.Background(), ws.spanContext)
+	opts := []trace.SpanStartOption{trace.WithAttributes(
+		queueNameKey.String(q.name),
+		queueOperationKey.String("dispatch"),
+		queueDepthKey.Int(q.messages.Len()),
+	)}
+	if env.spanContext.IsValid() {
+		opts = append(opts, trace.WithLinks(trace.Link{SpanContext: env.spanContext}))
+	}
+	_, span := q.tracer.Start(ctx, "queue.dispatch", opts...)
+	span.End()
+}
+
+// endSpan записывает в спан глубину очереди name после операции, если спан записывается, и завершает его
+func (q *shardedQueueManager) endSpan(span trace.Span, name string, err error) {
+	if span.IsRecording() {
+		if foundQueue := q.findQueue(name); foundQueue != nil {
+			span.SetAttributes(queueDepthKey.Int64(foundQueue.Stats().Depth))
+		}
+	}
+	endSpan(span, err)
+}
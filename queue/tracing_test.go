@@ -0,0 +1,135 @@
+package queue
+
+import (
+	"context"
+	"testing"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+// findSpan возвращает первый спан с именем name
+func findSpan(t *testing.T, spans tracetest.SpanStubs, name string) tracetest.SpanStub {
+	t.Helper()
+	for _, span := range spans {
+		if span.Name == name {
+			return span
+		}
+	}
+	t.Fatalf("span %v not found in %v", name, len(spans))
+	return tracetest.SpanStub{}
+}
+
+// checkAttributes проверяет атрибуты спана
+func checkAttributes(t *testing.T, span tracetest.SpanStub, want map[attribute.Key]attribute.Value) {
+	t.Helper()
+	attrs := attribute.NewSet(span.Attributes...)
+	for key, value := range want {
+		if got, _ := attrs.Value(key); got != value {
+			t.Errorf("wrong attribute %v of %v: got %v want %v", key, span.Name, got.Emit(), value.Emit())
+		}
+	}
+}
+
+// TestTracing проверяет, что спан выдачи сообщения продолжает трассировку читателя и связан со спаном писателя
+func TestTracing(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	tracerProvider := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	tracer := tracerProvider.Tracer("test")
+	manager := NewQueueManager(QueueManagerConfig{
+		MaxQueueNum:           10,
+		MaxMessageNumPerQueue: 10,
+		Tracer:                tracer,
+	})
+	defer manager.Stop()
+
+	putCtx, putParent := tracer.Start(context.Background(), "producer")
+	for _, message := range []string{"message1", "message2"} {
+		if err := manager.Put(putCtx, "name1", message); err != nil {
+			t.Fatalf("Unexpected exception: %v", err)
+		}
+	}
+	putParent.End()
+	getCtx, getParent := tracer.Start(context.Background(), "consumer")
+	if _, err := manager.Get(getCtx, "name1", 1); err != nil {
+		t.Fatalf("Unexpected exception: %v", err)
+	}
+	getParent.End()
+
+	spans := exporter.GetSpans()
+	put := findSpan(t, spans, "queue.put")
+	if put.Parent.SpanID() != putParent.SpanContext().SpanID() {
+		t.Errorf("wrong put parent: got %v want %v", put.Parent.SpanID(), putParent.SpanContext().SpanID())
+	}
+	checkAttributes(t, put, map[attribute.Key]attribute.Value{
+		queueNameKey:      attribute.StringValue("name1"),
+		queueOperationKey: attribute.StringValue("put"),
+		queueDepthKey:     attribute.Int64Value(1),
+	})
+	get := findSpan(t, spans, "queue.get")
+	if get.Parent.SpanID() != getParent.SpanContext().SpanID() {
+		t.Errorf("wrong get parent: got %v want %v", get.Parent.SpanID(), getParent.SpanContext().SpanID())
+	}
+	checkAttributes(t, get, map[attribute.Key]attribute.Value{
+		queueNameKey:      attribute.StringValue("name1"),
+		queueOperationKey: attribute.StringValue("get"),
+		queueDepthKey:     attribute.Int64Value(1),
+	})
+	dispatch := findSpan(t, spans, "queue.dispatch")
+	if dispatch.Parent.SpanID() != get.SpanContext.SpanID() {
+		t.Errorf("wrong dispatch parent: got %v want %v", dispatch.Parent.SpanID(), get.SpanContext.SpanID())
+	}
+	if len(dispatch.Links) != 1 || dispatch.Links[0].SpanContext.SpanID() != put.SpanContext.SpanID() {
+		t.Errorf("wrong dispatch links: got %v want link to %v", dispatch.Links, put.SpanContext.SpanID())
+	}
+	checkAttributes(t, dispatch, map[attribute.Key]attribute.Value{
+		queueNameKey:      attribute.StringValue("name1"),
+		queueOperationKey: attribute.StringValue("dispatch"),
+		queueDepthKey:     attribute.Int64Value(1),
+	})
+}
+
+// TestTracingErrors проверяет, что ошибки отмечают спан, а Get без очереди - нет
+func TestTracingErrors(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	tracerProvider := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	manager := NewQueueManager(QueueManagerConfig{
+		MaxQueueNum:           10,
+		MaxMessageNumPerQueue: 1,
+		Tracer:                tracerProvider.Tracer("test"),
+	})
+	defer manager.Stop()
+	ctx := context.Background()
+
+	if _, err := manager.Get(ctx, "name1", 1); err != ErrQueueNotFound {
+		t.Fatalf("wrong error: got %v want %v", err, ErrQueueNotFound)
+	}
+	if err := manager.Put(ctx, "name1", "message1"); err != nil {
+		t.Fatalf("Unexpected exception: %v", err)
+	}
+	if err := manager.Put(ctx, "name1", "message2"); err != ErrTooManyItems {
+		t.Fatalf("wrong error: got %v want %v", err, ErrTooManyItems)
+	}
+
+	spans := exporter.GetSpans()
+	if len(spans) != 3 {
+		t.Fatalf("wrong number of spans: got %v want %v", len(spans), 3)
+	}
+	for i, want := range []codes.Code{codes.Unset, codes.Unset, codes.Error} {
+		if spans[i].Status.Code != want {
+			t.Errorf("wrong status of span %v %v: got %v want %v", i, spans[i].Name, spans[i].Status.Code, want)
+		}
+	}
+}
+
+// TestTracingDisabled проверяет, что без Tracer контекст вызова не меняется
+func TestTracingDisabled(t *testing.T) {
+	ctx := context.Background()
+	got, span := startSpan(ctx, nil, "get", "name1")
+	if got != ctx || span.IsRecording() {
+		t.Errorf("tracing is not disabled: context changed %v, recording %v", got != ctx, span.IsRecording())
+	}
+	endSpan(span, ErrTooManyItems)
+}
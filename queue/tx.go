@@ -0,0 +1,157 @@
+package queue
+
+import (
+	"slices"
+	"sync"
+)
+
+// Transaction накапливает Put в несколько очередей и применяет их вместе: либо все, либо ни одного.
+// Транзакция не предназначена для использования из нескольких горутин одновременно
+type Transaction interface {
+	// Put запоминает сообщение для очереди name, ничего не меняя до Commit.
+	// Возвращает ошибку, оборачивающую ErrInvalidQueueName, если имя недопустимо,
+	// и ErrTransactionClosed после Commit или Rollback
+	Put(name, message string) error
+	// Commit блокирует затронутые очереди в порядке их имен, чтобы встречные транзакции не ждали друг друга,
+	// и помещает в них все сообщения. Если хотя бы одна очередь не принимает свои сообщения, то не меняется ни одна.
+	// Ошибки такие же, как у PutBatch, и ErrTransactionClosed для уже завершенной транзакции.
+	// После Commit транзакция завершена, даже если он вернул ошибку
+	Commit() error
+	// Rollback отменяет накопленные Put. Для завершенной транзакции ничего не делает,
+	// поэтому его удобно вызывать через defer
+	Rollback() error
+}
+
+// preparedPut задает сообщения транзакции, под которые очередь уже зарезервировала место.
+// Очередь заблокирована, пока не вызван commit или abort
+type preparedPut interface {
+	// commit помещает сообщения в очередь, снимает блокировку и возвращает идентификаторы сообщений
+	commit() []string
+	// abort освобождает зарезервированное место и снимает блокировку
+	abort()
+}
+
+// prepareRequest передает диспетчеру очереди сообщения транзакции и её решение
+type prepareRequest struct {
+	messages []string
+	prepared chan error    // ответ диспетчера, удалось ли зарезервировать место
+	decision chan bool     // true - зафиксировать сообщения, false - откатить
+	ids      chan []string // идентификаторы зафиксированных сообщений
+}
+
+func (r *prepareRequest) commit() []string {
+	r.decision <- true
+	return <-r.ids
+}
+
+func (r *prepareRequest) abort() {
+	r.decision <- false
+}
+
+// transactionPut задает сообщение, накопленное транзакцией
+type transactionPut struct {
+	name    string
+	message string
+}
+
+type transaction struct {
+	manager *shardedQueueManager
+
+	mutex  sync.Mutex
+	puts   []transactionPut
+	closed bool
+}
+
+func (q *shardedQueueManager) Begin() Transaction {
+	return &transaction{manager: q}
+}
+
+func (t *transaction) Put(name, message string) error {
+	if err := t.manager.ValidateName(name); err != nil {
+		return err
+	}
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	if t.closed {
+		return ErrTransactionClosed
+	}
+	t.puts = append(t.puts, transactionPut{name: name, message: message})
+	return nil
+}
+
+func (t *transaction) Rollback() error {
+	t.close()
+	return nil
+}
+
+// close завершает транзакцию и возвращает накопленные Put, а если она уже была завершена - ErrTransactionClosed
+func (t *transaction) close() ([]transactionPut, error) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	if t.closed {
+		return nil, ErrTransactionClosed
+	}
+	t.closed = true
+	puts := t.puts
+	t.puts = nil
+	return puts, nil
+}
+
+func (t *transaction) Commit() error {
+	puts, err := t.close()
+	if err != nil {
+		return err
+	}
+	q := t.manager
+	// Сообщения попадают туда же, куда их положил бы Put: в очередную партицию
+	// или в очередь недоставленных сообщений приостановленной очереди
+	messages := make(map[string][]string)
+	for _, put := range puts {
+		name := q.resolveAlias(put.name)
+		if rule := q.partition(name); rule != nil {
+			name = rule.nextPut()
+		}
+		name = q.putTarget(name)
+		messages[name] = append(messages[name], put.message)
+	}
+	names := make([]string, 0, len(messages))
+	for name := range messages {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	queues := make([]queue, len(names))
+	for i, name := range names {
+		foundQueue, foundTopic, err := q.findOrCreate(name)
+		if err != nil {
+			return err
+		}
+		// Подписки топика пишутся по отдельности, поэтому атомарность для них не гарантируется
+		if foundTopic != nil {
+			return ErrWrongQueueType
+		}
+		queues[i] = foundQueue
+	}
+	// Очереди блокируются в одном порядке во всех транзакциях, поэтому транзакции не могут ждать друг друга по кругу
+	prepared := make([]preparedPut, 0, len(queues))
+	for i, foundQueue := range queues {
+		p, err := foundQueue.prepare(messages[names[i]])
+		if err != nil {
+			for _, p := range prepared {
+				p.abort()
+			}
+			return err
+		}
+		prepared = append(prepared, p)
+	}
+	for i, p := range prepared {
+		for _, id := range p.commit() {
+			q.config.Hooks.put(names[i], id)
+		}
+	}
+	for _, name := range names {
+		for _, message := range messages[name] {
+			q.fanout(name, message)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,175 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"sync"
+	"testing"
+)
+
+// TestTransaction проверяет, что транзакция помещает сообщения либо во все очереди, либо ни в одну
+func TestTransaction(t *testing.T) {
+	testCases := []struct {
+		description string
+		prefilled   []string // сообщения, которые уже лежат в name2
+		rollback    bool
+		err         error
+		name1       []string
+		name2       []string
+	}{
+		{
+			description: "Commit",
+			name1:       []string{"m1", "m3"},
+			name2:       []string{"m2"},
+		},
+		{
+			description: "Second queue full",
+			prefilled:   []string{"p1", "p2"},
+			err:         ErrTooManyItems,
+			name1:       []string{},
+			name2:       []string{"p1", "p2"},
+		},
+		{
+			description: "Rollback",
+			rollback:    true,
+			name1:       []string{},
+			name2:       []string{},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			manager := newQueueManager(
+				QueueManagerConfig{
+					MaxQueueNum:           10,
+					MaxMessageNumPerQueue: 2,
+				},
+				newMemoryQueue,
+			)
+			defer manager.Stop()
+			// Пустая name1 создается заранее, чтобы её можно было проверить и после отката
+			if _, err := manager.EnsureQueue("name1"); err != nil {
+				t.Fatalf("unexpected error at EnsureQueue [%v]", err)
+			}
+			if _, err := manager.EnsureQueue("name2"); err != nil {
+				t.Fatalf("unexpected error at EnsureQueue [%v]", err)
+			}
+			for _, message := range tc.prefilled {
+				if err := manager.Put(context.Background(), "name2", message); err != nil {
+					t.Fatalf("unexpected error at Put [%v]", err)
+				}
+			}
+
+			tx := manager.Begin()
+			for _, put := range []struct{ name, message string }{{"name1", "m1"}, {"name2", "m2"}, {"name1", "m3"}} {
+				if err := tx.Put(put.name, put.message); err != nil {
+					t.Fatalf("unexpected error at transaction Put [%v]", err)
+				}
+			}
+			// До фиксации очереди не меняются
+			if messages, _ := manager.Snapshot("name1"); len(messages) != 0 {
+				t.Errorf("messages before Commit: %v", messages)
+			}
+			var err error
+			if tc.rollback {
+				err = tx.Rollback()
+			} else {
+				err = tx.Commit()
+			}
+			if !errors.Is(err, tc.err) {
+				t.Errorf("wrong error: got [%v] want [%v]", err, tc.err)
+			}
+			for name, expected := range map[string][]string{"name1": tc.name1, "name2": tc.name2} {
+				messages, err := manager.Snapshot(name)
+				if err != nil {
+					t.Fatalf("unexpected error at Snapshot [%v]", err)
+				}
+				if !slices.Equal(messages, expected) {
+					t.Errorf("wrong %s messages: got %v want %v", name, messages, expected)
+				}
+			}
+
+			// Завершенная транзакция больше не принимает сообщений, а Rollback ничего не делает
+			if err := tx.Put("name1", "late"); !errors.Is(err, ErrTransactionClosed) {
+				t.Errorf("wrong Put error: got [%v] want [%v]", err, ErrTransactionClosed)
+			}
+			if err := tx.Commit(); !errors.Is(err, ErrTransactionClosed) {
+				t.Errorf("wrong Commit error: got [%v] want [%v]", err, ErrTransactionClosed)
+			}
+			if err := tx.Rollback(); err != nil {
+				t.Errorf("unexpected error at Rollback [%v]", err)
+			}
+		})
+	}
+}
+
+// TestTransactionTopic проверяет, что транзакция не пишет в топики и тогда не меняет и остальные очереди
+func TestTransactionTopic(t *testing.T) {
+	manager := newQueueManager(
+		QueueManagerConfig{
+			MaxQueueNum:                10,
+			MaxMessageNumPerQueue:      10,
+			MaxSubscriptionNumPerTopic: 1,
+		},
+		newMemoryQueue,
+	)
+	defer manager.Stop()
+	if err := manager.Subscribe("topic", "sub", nil); err != nil {
+		t.Fatalf("unexpected error at Subscribe [%v]", err)
+	}
+	tx := manager.Begin()
+	if err := tx.Put("name", "m1"); err != nil {
+		t.Fatalf("unexpected error at transaction Put [%v]", err)
+	}
+	if err := tx.Put("topic", "m2"); err != nil {
+		t.Fatalf("unexpected error at transaction Put [%v]", err)
+	}
+	if err := tx.Commit(); !errors.Is(err, ErrWrongQueueType) {
+		t.Errorf("wrong error: got [%v] want [%v]", err, ErrWrongQueueType)
+	}
+	if messages, _ := manager.Snapshot("name"); len(messages) != 0 {
+		t.Errorf("messages after failed Commit: %v", messages)
+	}
+}
+
+// TestTransactionConcurrent проверяет, что встречные транзакции не блокируют друг друга,
+// даже если добавляют сообщения в очереди в разном порядке
+func TestTransactionConcurrent(t *testing.T) {
+	const N = 100
+	manager := newQueueManager(
+		QueueManagerConfig{
+			MaxQueueNum:           10,
+			MaxMessageNumPerQueue: 4 * N,
+		},
+		newMemoryQueue,
+	)
+	defer manager.Stop()
+	var wg sync.WaitGroup
+	for _, names := range [][]string{{"name1", "name2"}, {"name2", "name1"}} {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range N {
+				tx := manager.Begin()
+				for _, name := range names {
+					if err := tx.Put(name, "message"); err != nil {
+						t.Errorf("unexpected error at transaction Put [%v]", err)
+					}
+				}
+				if err := tx.Commit(); err != nil {
+					t.Errorf("unexpected error at Commit [%v]", err)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	for _, name := range []string{"name1", "name2"} {
+		stats, err := manager.Stats(name)
+		if err != nil {
+			t.Fatalf("unexpected error at Stats [%v]", err)
+		}
+		if stats.Depth != 2*N {
+			t.Errorf("wrong %s depth: got %v want %v", name, stats.Depth, 2*N)
+		}
+	}
+}
@@ -0,0 +1,31 @@
+package queue
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// defaultQueueNamePattern задает допустимые имена очередей по умолчанию: латиница, цифры, '_' и '-', от 1 до 128 символов
+var defaultQueueNamePattern = regexp.MustCompile(`^[a-zA-Z0-9_-]{1,128}$`)
+
+// ValidateQueueName проверяет имя очереди или топика по правилу по умолчанию.
+// Возвращает ошибку, оборачивающую ErrInvalidQueueName
+func ValidateQueueName(name string) error {
+	return validateQueueName(name, defaultQueueNamePattern)
+}
+
+// validateQueueName проверяет имя по pattern, nil означает правило по умолчанию.
+// Имя очереди недоставленных сообщений проверяется без суффикса deadLetterSuffix, так как его добавляет сам брокер
+func validateQueueName(name string, pattern *regexp.Regexp) error {
+	if pattern == nil {
+		pattern = defaultQueueNamePattern
+	}
+	if pattern.MatchString(name) {
+		return nil
+	}
+	if base, found := strings.CutSuffix(name, deadLetterSuffix); found && pattern.MatchString(base) {
+		return nil
+	}
+	return fmt.Errorf("%w: %q does not match %s", ErrInvalidQueueName, name, pattern)
+}
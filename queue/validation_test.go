@@ -0,0 +1,131 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestValidateQueueName(t *testing.T) {
+	testCases := []struct {
+		description string
+		name        string
+		pattern     *regexp.Regexp
+		isValid     bool
+	}{
+		{
+			description: "Letters and digits",
+			name:        "Queue1",
+			isValid:     true,
+		},
+		{
+			description: "Underscore and dash",
+			name:        "my_queue-1",
+			isValid:     true,
+		},
+		{
+			description: "Single char",
+			name:        "q",
+			isValid:     true,
+		},
+		{
+			description: "Max length",
+			name:        strings.Repeat("a", 128),
+			isValid:     true,
+		},
+		{
+			description: "Dead letter queue",
+			name:        "queue1" + deadLetterSuffix,
+			isValid:     true,
+		},
+		{
+			description: "Empty",
+			name:        "",
+		},
+		{
+			description: "Too long",
+			name:        strings.Repeat("a", 129),
+		},
+		{
+			description: "Dot",
+			name:        "queue.1",
+		},
+		{
+			description: "Slash",
+			name:        "queue/1",
+		},
+		{
+			description: "Space",
+			name:        "queue 1",
+		},
+		{
+			description: "Newline at the end",
+			name:        "queue1\n",
+		},
+		{
+			description: "Null byte",
+			name:        "queue\x001",
+		},
+		{
+			description: "Unicode",
+			name:        "очередь",
+		},
+		{
+			description: "Only dead letter suffix",
+			name:        deadLetterSuffix,
+		},
+		{
+			description: "Dead letter queue of invalid name",
+			name:        "queue/1" + deadLetterSuffix,
+		},
+		{
+			description: "Custom pattern allows dot",
+			name:        "orders.eu",
+			pattern:     regexp.MustCompile(`^[a-z]+(\.[a-z]+)*$`),
+			isValid:     true,
+		},
+		{
+			description: "Custom pattern rejects digits",
+			name:        "orders1",
+			pattern:     regexp.MustCompile(`^[a-z]+(\.[a-z]+)*$`),
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			var err error
+			if tc.pattern == nil {
+				err = ValidateQueueName(tc.name)
+			} else {
+				err = validateQueueName(tc.name, tc.pattern)
+			}
+			if tc.isValid && err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+			if !tc.isValid && !errors.Is(err, ErrInvalidQueueName) {
+				t.Errorf("wrong error: got [%v] want [%v]", err, ErrInvalidQueueName)
+			}
+		})
+	}
+}
+
+func TestQueueManagerInvalidName(t *testing.T) {
+	manager := NewQueueManager(QueueManagerConfig{
+		MaxQueueNum:                10,
+		MaxMessageNumPerQueue:      10,
+		MaxSubscriptionNumPerTopic: 10,
+		QueueNamePattern:           regexp.MustCompile(`^[a-z.]+$`),
+	})
+	defer manager.Stop()
+
+	if err := manager.Put(context.Background(), "queue1", "message1"); !errors.Is(err, ErrInvalidQueueName) {
+		t.Errorf("wrong Put error: got [%v] want [%v]", err, ErrInvalidQueueName)
+	}
+	if err := manager.Put(context.Background(), "orders.eu", "message1"); err != nil {
+		t.Errorf("unexpected Put error: %v", err)
+	}
+	if names := manager.List(); len(names) != 1 || names[0] != "orders.eu" {
+		t.Errorf("wrong queues: got %v want [orders.eu]", names)
+	}
+}
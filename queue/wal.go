@@ -0,0 +1,418 @@
+package queue
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// SyncMode задает, когда журнал очереди сбрасывается на диск через fsync
+type SyncMode string
+
+const (
+	// SyncModeNone не вызывает fsync: записи переживают падение процесса, но не отключение питания
+	SyncModeNone SyncMode = "none"
+	// SyncModeAsync вызывает fsync в фоне раз в walSyncInterval, при отключении питания теряются записи за этот интервал
+	SyncModeAsync SyncMode = "async"
+	// SyncModeSync вызывает fsync после каждой записи до подтверждения Put
+	SyncModeSync SyncMode = "sync"
+)
+
+// ParseSyncMode проверяет режим fsync журнала, пустая строка означает SyncModeSync
+func ParseSyncMode(s string) (SyncMode, error) {
+	switch mode := SyncMode(s); mode {
+	case "":
+		return SyncModeSync, nil
+	case SyncModeNone, SyncModeAsync, SyncModeSync:
+		return mode, nil
+	default:
+		return "", fmt.Errorf("unknown sync mode %q, want none, async or sync", s)
+	}
+}
+
+const (
+	// walSyncInterval задает период fsync в режиме SyncModeAsync
+	walSyncInterval = time.Second
+	// defaultMaxLogBytes задает размер журнала, после которого он переписывается, если MaxLogBytes не задан
+	defaultMaxLogBytes = 64 << 20
+	// walFrameHeaderSize задает размер заголовка записи: длина и CRC32 содержимого
+	walFrameHeaderSize = 8
+)
+
+// errCorruptedRecord означает запись с верной контрольной суммой, которую не удалось разобрать
+var errCorruptedRecord = errors.New("corrupted log record")
+
+// Операции журнала
+const (
+	walOpPut      byte = 1 // сообщение принято: id, время приема, длина и само сообщение
+	walOpConsume  byte = 2 // сообщение извлечено (tombstone): id
+	walOpSequence byte = 3 // последний выданный идентификатор, пишется в начало переписанного журнала: id
+)
+
+// walStorage хранит сообщения одной очереди в журнале упреждающей записи (WAL).
+// Журнал состоит из записей: 4 байта длины, 4 байта CRC32 и содержимое из одной или нескольких операций.
+// Запись пишется на диск одним вызовом, поэтому пакет сообщений после сбоя восстанавливается целиком или не восстанавливается.
+// Запись, оборванная падением посреди записи, при открытии отбрасывается вместе со всем, что идет после неё.
+//
+// Когда журнал вырастает больше maxBytes, он переписывается (ротация): новый файл содержит только сообщения,
+// которые еще не извлечены, и заменяет старый через rename, поэтому сбой во время ротации ничего не теряет
+type walStorage struct {
+	path     string
+	syncMode SyncMode
+	maxBytes int64
+	live     map[uint64]*envelope // не извлеченные сообщения, из них собирается журнал при ротации
+	lastID   uint64               // последний выданный идентификатор, сохраняется при ротации
+
+	mutex    sync.Mutex // защищает file и dirty от фонового fsync
+	file     *os.File
+	size     int64 // текущий размер журнала
+	rotateAt int64 // размер, при превышении которого журнал переписывается
+	dirty    bool  // есть записи без fsync, используется в SyncModeAsync
+
+	stopSync chan struct{} // закрытие останавливает фоновый fsync
+	syncDone chan struct{} // закрывается, когда фоновый fsync завершен
+	closed   chan struct{} // закрывается, когда журнал закрыт
+}
+
+// openWAL открывает журнал очереди, создавая его при необходимости, и восстанавливает по нему сообщения
+func openWAL(path string, syncMode SyncMode, maxBytes int64) (*walStorage, error) {
+	if syncMode == "" {
+		syncMode = SyncModeSync
+	}
+	if maxBytes <= 0 {
+		maxBytes = defaultMaxLogBytes
+	}
+	// Временный файл остается, только если процесс упал посреди ротации, а журнал тогда еще старый
+	_ = os.Remove(path + ".tmp")
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("open log %s: %w", path, err)
+	}
+	s := &walStorage{
+		path:     path,
+		syncMode: syncMode,
+		maxBytes: maxBytes,
+		live:     make(map[uint64]*envelope),
+		file:     file,
+		closed:   make(chan struct{}),
+	}
+	if err := s.replay(); err != nil {
+		file.Close()
+		return nil, fmt.Errorf("replay log %s: %w", path, err)
+	}
+	s.rotateAt = max(maxBytes, 2*s.size)
+	if syncMode == SyncModeAsync {
+		s.stopSync = make(chan struct{})
+		s.syncDone = make(chan struct{})
+		go s.syncLoop()
+	}
+	return s, nil
+}
+
+// replay читает журнал от начала и применяет операции к live. Оборванную запись в конце
+// отрезает, чтобы следующие записи не оказались после неё
+func (s *walStorage) replay() error {
+	data, err := io.ReadAll(s.file)
+	if err != nil {
+		return err
+	}
+	offset := 0
+	for offset < len(data) {
+		payload, ok := readFrame(data[offset:])
+		if !ok || s.apply(payload) != nil {
+			errorLogger.Printf("log %s: dropping %d bytes of torn record at offset %d\n", s.path, len(data)-offset, offset)
+			if err := s.file.Truncate(int64(offset)); err != nil {
+				return err
+			}
+			break
+		}
+		offset += walFrameHeaderSize + len(payload)
+	}
+	s.size = int64(offset)
+	_, err = s.file.Seek(s.size, io.SeekStart)
+	return err
+}
+
+// readFrame возвращает содержимое записи в начале data и false, если запись оборвана или повреждена
+func readFrame(data []byte) ([]byte, bool) {
+	if len(data) < walFrameHeaderSize {
+		return nil, false
+	}
+	n := int(binary.BigEndian.Uint32(data))
+	if n > len(data)-walFrameHeaderSize {
+		return nil, false
+	}
+	payload := data[walFrameHeaderSize : walFrameHeaderSize+n]
+	if crc32.ChecksumIEEE(payload) != binary.BigEndian.Uint32(data[4:]) {
+		return nil, false
+	}
+	return payload, true
+}
+
+// apply применяет операции одной записи. Запись проверяется целиком до применения,
+// чтобы поврежденная запись не применилась частично
+func (s *walStorage) apply(payload []byte) error {
+	var envs []*envelope
+	var consumed []uint64
+	lastID := s.lastID
+	for len(payload) > 0 {
+		op := payload[0]
+		payload = payload[1:]
+		if len(payload) < 8 {
+			return errCorruptedRecord
+		}
+		id := binary.BigEndian.Uint64(payload)
+		payload = payload[8:]
+		switch op {
+		case walOpPut:
+			if len(payload) < 12 {
+				return errCorruptedRecord
+			}
+			enqueuedAt := int64(binary.BigEndian.Uint64(payload))
+			n := int(binary.BigEndian.Uint32(payload[8:]))
+			payload = payload[12:]
+			if n > len(payload) {
+				return errCorruptedRecord
+			}
+			envs = append(envs, &envelope{
+				id:         strconv.FormatUint(id, 10),
+				message:    string(payload[:n]),
+				enqueuedAt: time.Unix(0, enqueuedAt),
+			})
+			payload = payload[n:]
+			lastID = max(lastID, id)
+		case walOpConsume:
+			consumed = append(consumed, id)
+		case walOpSequence:
+			lastID = max(lastID, id)
+		default:
+			return errCorruptedRecord
+		}
+	}
+	for _, env := range envs {
+		id, _ := strconv.ParseUint(env.id, 10, 64)
+		s.live[id] = env
+	}
+	for _, id := range consumed {
+		delete(s.live, id)
+	}
+	s.lastID = lastID
+	return nil
+}
+
+// load возвращает восстановленные сообщения в порядке поступления и последний выданный идентификатор.
+// Журнал уже прочитан при открытии, поэтому ошибок не бывает
+func (s *walStorage) load() ([]*envelope, uint64, error) {
+	return s.liveEnvelopes(), s.lastID, nil
+}
+
+func (s *walStorage) done() <-chan struct{} {
+	return s.closed
+}
+
+func (s *walStorage) destroy() error {
+	if err := os.Remove(s.path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// liveEnvelopes возвращает не извлеченные сообщения по возрастанию идентификатора. Сообщения, возвращенные
+// в начало очереди, сохраняют свой идентификатор, поэтому порядок идентификаторов совпадает с порядком очереди
+func (s *walStorage) liveEnvelopes() []*envelope {
+	ids := make([]uint64, 0, len(s.live))
+	for id := range s.live {
+		ids = append(ids, id)
+	}
+	slices.Sort(ids)
+	envs := make([]*envelope, len(ids))
+	for i, id := range ids {
+		envs[i] = s.live[id]
+	}
+	return envs
+}
+
+func (s *walStorage) save(envs ...*envelope) error {
+	var payload []byte
+	ids := make([]uint64, len(envs))
+	for i, env := range envs {
+		id, err := strconv.ParseUint(env.id, 10, 64)
+		if err != nil {
+			return err
+		}
+		ids[i] = id
+		payload = appendPutOp(payload, id, env)
+	}
+	if err := s.append(payload); err != nil {
+		return err
+	}
+	for i, env := range envs {
+		s.live[ids[i]] = env
+		s.lastID = max(s.lastID, ids[i])
+	}
+	s.rotateIfNeeded()
+	return nil
+}
+
+func (s *walStorage) remove(ids ...string) error {
+	var payload []byte
+	nums := make([]uint64, len(ids))
+	for i, id := range ids {
+		n, err := strconv.ParseUint(id, 10, 64)
+		if err != nil {
+			return err
+		}
+		nums[i] = n
+		payload = appendIDOp(payload, walOpConsume, n)
+	}
+	if err := s.append(payload); err != nil {
+		return err
+	}
+	for _, n := range nums {
+		delete(s.live, n)
+	}
+	s.rotateIfNeeded()
+	return nil
+}
+
+// append дописывает запись в журнал одним вызовом Write. Если запись не удалась, то журнал обрезается
+// до прежнего размера, чтобы обрывок не скрыл следующие записи
+func (s *walStorage) append(payload []byte) error {
+	frame := appendFrame(make([]byte, 0, walFrameHeaderSize+len(payload)), payload)
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	_, err := s.file.Write(frame)
+	if err == nil && s.syncMode == SyncModeSync {
+		err = s.file.Sync()
+	}
+	if err != nil {
+		_ = s.file.Truncate(s.size)
+		_, _ = s.file.Seek(s.size, io.SeekStart)
+		return err
+	}
+	s.size += int64(len(frame))
+	s.dirty = s.syncMode != SyncModeSync
+	return nil
+}
+
+// rotateIfNeeded переписывает журнал, если он вырос больше допустимого. Ошибка ротации только логируется:
+// старый журнал остается целым, и ротация повторится при следующей записи
+func (s *walStorage) rotateIfNeeded() {
+	if s.size <= s.rotateAt {
+		return
+	}
+	if err := s.rotate(); err != nil {
+		errorLogger.Printf("rotate log %s error: %v\n", s.path, err)
+	}
+}
+
+// rotate записывает во временный файл последний идентификатор и не извлеченные сообщения
+// и заменяет им журнал
+func (s *walStorage) rotate() error {
+	tmpPath := s.path + ".tmp"
+	tmp, err := os.OpenFile(tmpPath, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0o600)
+	if err != nil {
+		return err
+	}
+	// Идентификаторы не должны повторяться и после перезапуска, даже если все сообщения извлечены
+	data := appendFrame(nil, appendIDOp(nil, walOpSequence, s.lastID))
+	for _, env := range s.liveEnvelopes() {
+		id, _ := strconv.ParseUint(env.id, 10, 64)
+		data = appendFrame(data, appendPutOp(nil, id, env))
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	// Новый журнал должен быть на диске до того, как заменит старый
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := os.Rename(tmpPath, s.path); err != nil {
+		tmp.Close()
+		return err
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if err := s.file.Close(); err != nil {
+		errorLogger.Printf("close log %s error: %v\n", s.path, err)
+	}
+	s.file = tmp
+	s.size = int64(len(data))
+	s.rotateAt = max(s.maxBytes, 2*s.size)
+	s.dirty = false
+	return nil
+}
+
+// syncLoop сбрасывает журнал на диск раз в walSyncInterval в режиме SyncModeAsync
+func (s *walStorage) syncLoop() {
+	defer close(s.syncDone)
+	ticker := time.NewTicker(walSyncInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			s.sync()
+		case <-s.stopSync:
+			return
+		}
+	}
+}
+
+// sync сбрасывает журнал на диск, если с прошлого раза были записи
+func (s *walStorage) sync() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if !s.dirty {
+		return
+	}
+	if err := s.file.Sync(); err != nil {
+		errorLogger.Printf("sync log %s error: %v\n", s.path, err)
+		return
+	}
+	s.dirty = false
+}
+
+func (s *walStorage) close() {
+	if s.stopSync != nil {
+		close(s.stopSync)
+		<-s.syncDone
+	}
+	// Даже без fsync после каждой записи журнал при штатной остановке сбрасывается на диск
+	if s.syncMode != SyncModeNone {
+		s.sync()
+	}
+	if err := s.file.Close(); err != nil {
+		errorLogger.Printf("close log %s error: %v\n", s.path, err)
+	}
+	close(s.closed)
+}
+
+// appendFrame дописывает к buf запись с заголовком из длины и CRC32 содержимого
+func appendFrame(buf, payload []byte) []byte {
+	buf = binary.BigEndian.AppendUint32(buf, uint32(len(payload)))
+	buf = binary.BigEndian.AppendUint32(buf, crc32.ChecksumIEEE(payload))
+	return append(buf, payload...)
+}
+
+// appendPutOp дописывает к buf операцию приема сообщения
+func appendPutOp(buf []byte, id uint64, env *envelope) []byte {
+	buf = appendIDOp(buf, walOpPut, id)
+	buf = binary.BigEndian.AppendUint64(buf, uint64(env.enqueuedAt.UnixNano()))
+	buf = binary.BigEndian.AppendUint32(buf, uint32(len(env.message)))
+	return append(buf, env.message...)
+}
+
+// appendIDOp дописывает к buf операцию, у которой есть только идентификатор
+func appendIDOp(buf []byte, op byte, id uint64) []byte {
+	buf = append(buf, op)
+	return binary.BigEndian.AppendUint64(buf, id)
+}
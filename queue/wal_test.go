@@ -0,0 +1,260 @@
+package queue
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// walMessages возвращает сообщения журнала по порядку
+func walMessages(s *walStorage) []string {
+	envs, _, _ := s.load()
+	messages := make([]string, len(envs))
+	for i, env := range envs {
+		messages[i] = env.message
+	}
+	return messages
+}
+
+func newTestEnvelope(id int, message string) *envelope {
+	return &envelope{id: strconv.Itoa(id), message: message, enqueuedAt: time.Now()}
+}
+
+func TestWALReplay(t *testing.T) {
+	for _, syncMode := range []SyncMode{SyncModeNone, SyncModeAsync, SyncModeSync} {
+		t.Run(string(syncMode), func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "name.wal")
+			s, err := openWAL(path, syncMode, 0)
+			if err != nil {
+				t.Fatalf("Unexpected exception: %v", err)
+			}
+			first := newTestEnvelope(1, "message1")
+			if err := s.save(first); err != nil {
+				t.Fatalf("Unexpected exception: %v", err)
+			}
+			if err := s.save(newTestEnvelope(2, "message2"), newTestEnvelope(3, "message3")); err != nil {
+				t.Fatalf("Unexpected exception: %v", err)
+			}
+			if err := s.remove("2"); err != nil {
+				t.Fatalf("Unexpected exception: %v", err)
+			}
+			s.close()
+
+			s, err = openWAL(path, syncMode, 0)
+			if err != nil {
+				t.Fatalf("Unexpected exception: %v", err)
+			}
+			defer s.close()
+			envs, lastID, _ := s.load()
+			if lastID != 3 {
+				t.Errorf("wrong last id: got %v want %v", lastID, 3)
+			}
+			if messages, want := walMessages(s), []string{"message1", "message3"}; !slices.Equal(messages, want) {
+				t.Errorf("wrong messages: got %v want %v", messages, want)
+			}
+			if !envs[0].enqueuedAt.Equal(first.enqueuedAt) || envs[0].id != "1" {
+				t.Errorf("wrong envelope: got [%v %v] want [%v %v]", envs[0].id, envs[0].enqueuedAt, "1", first.enqueuedAt)
+			}
+		})
+	}
+}
+
+// TestWALTruncated проверяет восстановление журнала, оборванного падением на любом байте последней записи
+func TestWALTruncated(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "name.wal")
+	s, err := openWAL(path, SyncModeNone, 0)
+	if err != nil {
+		t.Fatalf("Unexpected exception: %v", err)
+	}
+	// Размеры журнала после каждой операции
+	sizes := []int64{0}
+	if err := s.save(newTestEnvelope(1, "message1")); err != nil {
+		t.Fatalf("Unexpected exception: %v", err)
+	}
+	sizes = append(sizes, s.size)
+	if err := s.save(newTestEnvelope(2, "message2"), newTestEnvelope(3, "message3")); err != nil {
+		t.Fatalf("Unexpected exception: %v", err)
+	}
+	sizes = append(sizes, s.size)
+	if err := s.remove("1"); err != nil {
+		t.Fatalf("Unexpected exception: %v", err)
+	}
+	sizes = append(sizes, s.size)
+	s.close()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Unexpected exception: %v", err)
+	}
+	// Сообщения после каждой целиком записанной операции
+	states := [][]string{
+		{},
+		{"message1"},
+		{"message1", "message2", "message3"},
+		{"message2", "message3"},
+	}
+
+	for cut := int64(0); cut <= int64(len(data)); cut++ {
+		t.Run(strconv.FormatInt(cut, 10), func(t *testing.T) {
+			// Последняя операция, записанная целиком
+			op := 0
+			for op+1 < len(sizes) && sizes[op+1] <= cut {
+				op++
+			}
+			cutPath := filepath.Join(dir, "cut"+strconv.FormatInt(cut, 10)+".wal")
+			if err := os.WriteFile(cutPath, data[:cut], 0o600); err != nil {
+				t.Fatalf("Unexpected exception: %v", err)
+			}
+			s, err := openWAL(cutPath, SyncModeNone, 0)
+			if err != nil {
+				t.Fatalf("Unexpected exception: %v", err)
+			}
+			if messages := walMessages(s); !slices.Equal(messages, states[op]) {
+				t.Errorf("wrong messages: got %v want %v", messages, states[op])
+			}
+			// Оборванная запись отрезана, поэтому следующая запись после перезапуска читается
+			if s.size != sizes[op] {
+				t.Errorf("wrong size: got %v want %v", s.size, sizes[op])
+			}
+			if err := s.save(newTestEnvelope(4, "message4")); err != nil {
+				t.Fatalf("Unexpected exception: %v", err)
+			}
+			s.close()
+			s, err = openWAL(cutPath, SyncModeNone, 0)
+			if err != nil {
+				t.Fatalf("Unexpected exception: %v", err)
+			}
+			defer s.close()
+			want := append(slices.Clone(states[op]), "message4")
+			if messages := walMessages(s); !slices.Equal(messages, want) {
+				t.Errorf("wrong messages after append: got %v want %v", messages, want)
+			}
+		})
+	}
+}
+
+// TestWALCorrupted проверяет, что запись с неверной контрольной суммой отбрасывается вместе с концом журнала
+func TestWALCorrupted(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "name.wal")
+	s, err := openWAL(path, SyncModeNone, 0)
+	if err != nil {
+		t.Fatalf("Unexpected exception: %v", err)
+	}
+	for i := 1; i <= 3; i++ {
+		if err := s.save(newTestEnvelope(i, "message"+strconv.Itoa(i))); err != nil {
+			t.Fatalf("Unexpected exception: %v", err)
+		}
+	}
+	// Сообщения одной длины, поэтому и записи одного размера
+	frameSize := s.size / 3
+	s.close()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Unexpected exception: %v", err)
+	}
+	// Портим последний байт второй записи
+	data[2*frameSize-1] ^= 0xff
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatalf("Unexpected exception: %v", err)
+	}
+
+	s, err = openWAL(path, SyncModeNone, 0)
+	if err != nil {
+		t.Fatalf("Unexpected exception: %v", err)
+	}
+	defer s.close()
+	if messages, want := walMessages(s), []string{"message1"}; !slices.Equal(messages, want) {
+		t.Errorf("wrong messages: got %v want %v", messages, want)
+	}
+}
+
+// TestWALRotation проверяет, что журнал переписывается при превышении размера и сохраняет
+// не извлеченные сообщения и последний идентификатор
+func TestWALRotation(t *testing.T) {
+	const (
+		N        = 1000
+		maxBytes = 1024
+	)
+	path := filepath.Join(t.TempDir(), "name.wal")
+	s, err := openWAL(path, SyncModeNone, maxBytes)
+	if err != nil {
+		t.Fatalf("Unexpected exception: %v", err)
+	}
+	for i := 1; i <= N; i++ {
+		if err := s.save(newTestEnvelope(i, "message"+strconv.Itoa(i))); err != nil {
+			t.Fatalf("Unexpected exception: %v", err)
+		}
+		// Последние два сообщения не извлекаются
+		if i <= N-2 {
+			if err := s.remove(strconv.Itoa(i)); err != nil {
+				t.Fatalf("Unexpected exception: %v", err)
+			}
+		}
+	}
+	s.close()
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("Unexpected exception: %v", err)
+	}
+	if info.Size() > 2*maxBytes {
+		t.Errorf("log is not rotated: size %v", info.Size())
+	}
+
+	s, err = openWAL(path, SyncModeNone, maxBytes)
+	if err != nil {
+		t.Fatalf("Unexpected exception: %v", err)
+	}
+	_, lastID, _ := s.load()
+	if lastID != N {
+		t.Errorf("wrong last id: got %v want %v", lastID, N)
+	}
+	want := []string{"message" + strconv.Itoa(N-1), "message" + strconv.Itoa(N)}
+	if messages := walMessages(s); !slices.Equal(messages, want) {
+		t.Errorf("wrong messages: got %v want %v", messages, want)
+	}
+	// После ротации пустой очереди последний идентификатор тоже сохраняется
+	if err := s.remove(strconv.Itoa(N-1), strconv.Itoa(N)); err != nil {
+		t.Fatalf("Unexpected exception: %v", err)
+	}
+	if err := s.rotate(); err != nil {
+		t.Fatalf("Unexpected exception: %v", err)
+	}
+	s.close()
+	s, err = openWAL(path, SyncModeNone, maxBytes)
+	if err != nil {
+		t.Fatalf("Unexpected exception: %v", err)
+	}
+	defer s.close()
+	envs, lastID, _ := s.load()
+	if len(envs) != 0 || lastID != N {
+		t.Errorf("wrong state: got [%v %v] want [%v %v]", len(envs), lastID, 0, N)
+	}
+}
+
+func TestParseSyncMode(t *testing.T) {
+	testCases := []struct {
+		value string
+		mode  SyncMode
+		isErr bool
+	}{
+		{value: "", mode: SyncModeSync},
+		{value: "none", mode: SyncModeNone},
+		{value: "async", mode: SyncModeAsync},
+		{value: "sync", mode: SyncModeSync},
+		{value: "always", isErr: true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.value, func(t *testing.T) {
+			mode, err := ParseSyncMode(tc.value)
+			if (err != nil) != tc.isErr {
+				t.Fatalf("wrong error: got [%v] want error %v", err, tc.isErr)
+			}
+			if mode != tc.mode {
+				t.Errorf("wrong mode: got %v want %v", mode, tc.mode)
+			}
+		})
+	}
+}
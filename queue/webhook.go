@@ -0,0 +1,95 @@
+package queue
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// deadLetterSuffix задает суффикс имени очереди, в которую попадают недоставленные сообщения
+const deadLetterSuffix = ".dlq"
+
+// webhookMessage задает тело POST запроса, которым сообщение доставляется на webhook
+type webhookMessage struct {
+	Message string `json:"message"`
+}
+
+// webhook доставляет сообщения из очереди на зарегистрированный URL.
+// Если на одну очередь зарегистрировано несколько webhook'ов, то они конкурируют за сообщения,
+// как обычные читатели, и каждое сообщение доставляется только в один из них.
+type webhook struct {
+	name       string        // имя очереди, из которой читаются сообщения
+	url        string        // URL, на который сообщения отправляются POST запросом
+	source     queue         // очередь, из которой читаются сообщения
+	maxRetries int           // число повторных попыток доставки после первой неудачной
+	retryDelay time.Duration // задержка перед первой повторной попыткой, далее удваивается
+	client     *http.Client
+	// deadLetter помещает в очередь недоставленных сообщений сообщение, для которого исчерпаны попытки
+	deadLetter func(ctx context.Context, message string) error
+}
+
+// run читает сообщения из очереди и доставляет их, пока не отменят контекст
+func (w *webhook) run(ctx context.Context) {
+	for {
+		message, err := w.source.Get(ctx)
+		if err != nil {
+			// Get без таймаута возвращает ошибку, только когда отменен контекст или остановлена очередь
+			return
+		}
+		if !w.deliver(ctx, message.Body) {
+			if ctx.Err() != nil {
+				return
+			}
+			if err := w.deadLetter(ctx, message.Body); err != nil {
+				errorLogger.Printf("webhook [%s] dead letter for [%s] error: %v\n", w.url, w.name, err)
+			}
+		}
+	}
+}
+
+// deliver отправляет сообщение, повторяя попытки с экспоненциально растущей задержкой.
+// Возвращает false, если все попытки исчерпаны или отменен контекст
+func (w *webhook) deliver(ctx context.Context, message string) bool {
+	delay := w.retryDelay
+	for attempt := 0; ; attempt++ {
+		err := w.post(ctx, message)
+		if err == nil {
+			return true
+		}
+		errorLogger.Printf("webhook [%s] delivery for [%s] attempt %d error: %v\n", w.url, w.name, attempt+1, err)
+		if attempt >= w.maxRetries {
+			return false
+		}
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return false
+		}
+		delay *= 2
+	}
+}
+
+// post выполняет одну попытку доставки, успешной считается любая 2xx
+func (w *webhook) post(ctx context.Context, message string) error {
+	body, err := json.Marshal(webhookMessage{Message: message})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	res, err := w.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return fmt.Errorf("unexpected status code %d", res.StatusCode)
+	}
+	return nil
+}
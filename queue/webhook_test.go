@@ -0,0 +1,95 @@
+package queue
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func newWebhookTestManager() QueueManager {
+	return newQueueManager(
+		QueueManagerConfig{
+			MaxQueueNum:           100,
+			MaxMessageNumPerQueue: 10_000,
+			WebhookMaxRetries:     2,
+			WebhookRetryDelay:     10 * time.Millisecond,
+		},
+		newMemoryQueue,
+	)
+}
+
+// TestWebhookDelivery проверяет, что сообщения из очереди доставляются на webhook в порядке поступления
+func TestWebhookDelivery(t *testing.T) {
+	messageCh := make(chan string, 10)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var m webhookMessage
+		if err := json.NewDecoder(r.Body).Decode(&m); err != nil {
+			t.Errorf("json decoding error: %v", err)
+		}
+		messageCh <- m.Message
+	}))
+	defer server.Close()
+	manager := newWebhookTestManager()
+	defer manager.Stop()
+
+	if err := manager.AddWebhook("name", server.URL); err != nil {
+		t.Fatalf("unexpected error at AddWebhook [%v]", err)
+	}
+	messages := []string{"message1", "message2"}
+	for _, message := range messages {
+		if err := manager.Put(context.Background(), "name", message); err != nil {
+			t.Errorf("unexpected error at Put [%v]", err)
+		}
+	}
+	for _, expectedMessage := range messages {
+		select {
+		case message := <-messageCh:
+			if message != expectedMessage {
+				t.Errorf("wrong message: got [%v] want [%v]", message, expectedMessage)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("message [%v] was not delivered", expectedMessage)
+		}
+	}
+}
+
+// TestWebhookDeadLetter проверяет, что после исчерпания повторных попыток сообщение попадает в очередь .dlq
+func TestWebhookDeadLetter(t *testing.T) {
+	var attempts atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts.Add(1)
+		http.Error(w, "", http.StatusInternalServerError)
+	}))
+	defer server.Close()
+	manager := newWebhookTestManager()
+	defer manager.Stop()
+
+	if err := manager.AddWebhook("name", server.URL); err != nil {
+		t.Fatalf("unexpected error at AddWebhook [%v]", err)
+	}
+	if err := manager.Put(context.Background(), "name", "message"); err != nil {
+		t.Errorf("unexpected error at Put [%v]", err)
+	}
+	// Очередь .dlq создается только при первом недоставленном сообщении, поэтому опрашиваем её
+	deadline := time.Now().Add(time.Second)
+	for {
+		message, err := manager.Get(context.Background(), "name"+deadLetterSuffix, 1)
+		if err == nil {
+			if message.Body != "message" {
+				t.Errorf("wrong message: got [%v] want [%v]", message.Body, "message")
+			}
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("message was not moved to dead letter queue")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if v := attempts.Load(); v != 3 {
+		t.Errorf("wrong attempts number: got %v want %v", v, 3)
+	}
+}
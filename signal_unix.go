@@ -0,0 +1,27 @@
+//go:build !windows
+
+package main
+
+import (
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/nebotan/simplebroker/queue"
+)
+
+// watchStatsSignal по каждому SIGUSR1 пишет статистику очередей в stderr, не останавливая сервис.
+// На Windows SIGUSR1 нет, поэтому там используется заглушка из signal_windows.go
+func watchStatsSignal(queueManager queue.QueueManager) {
+	// Отдельный канал, чтобы SIGUSR1 не смешивался с сигналами остановки
+	usr1Ch := make(chan os.Signal, 1)
+	signal.Notify(usr1Ch, syscall.SIGUSR1)
+	go func() {
+		for range usr1Ch {
+			if err := dumpStats(os.Stderr, queueManager); err != nil {
+				log.Printf("[ERROR]: stats dump error: %v\n", err)
+			}
+		}
+	}()
+}
@@ -0,0 +1,9 @@
+package main
+
+import (
+	"github.com/nebotan/simplebroker/queue"
+)
+
+// watchStatsSignal ничего не делает: на Windows нет SIGUSR1
+func watchStatsSignal(queue.QueueManager) {
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+// otlpEndpointEnvs задает переменные окружения OTLP экспортера, любая из которых включает трассировку
+var otlpEndpointEnvs = []string{"OTEL_EXPORTER_OTLP_ENDPOINT", "OTEL_EXPORTER_OTLP_TRACES_ENDPOINT"}
+
+// newTracerProvider создает провайдер спанов, который отправляет их по OTLP/HTTP. Адрес коллектора и остальные
+// настройки экспортер читает из стандартных переменных OTEL_*. Если адрес не задан, то возвращает провайдер,
+// который ничего не записывает. Возвращаемая функция отправляет накопленные спаны и останавливает провайдер
+func newTracerProvider(ctx context.Context, lookupEnv func(string) (string, bool)) (trace.TracerProvider, func(context.Context) error, error) {
+	configured := false
+	for _, env := range otlpEndpointEnvs {
+		if v, ok := lookupEnv(env); ok && v != "" {
+			configured = true
+		}
+	}
+	if !configured {
+		return noop.NewTracerProvider(), func(context.Context) error { return nil }, nil
+	}
+	exporter, err := otlptracehttp.New(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	// OTEL_SERVICE_NAME и OTEL_RESOURCE_ATTRIBUTES заменяют имя сервиса по умолчанию
+	res, err := resource.Merge(
+		resource.NewSchemaless(attribute.String("service.name", "simplebroker")),
+		resource.Environment(),
+	)
+	if err != nil {
+		return nil, nil, err
+	}
+	tracerProvider := sdktrace.NewTracerProvider(sdktrace.WithBatcher(exporter), sdktrace.WithResource(res))
+	return tracerProvider, tracerProvider.Shutdown, nil
+}